@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+)
+
+const (
+	// auditRedacted replaces the arguments of commands that are redacted.
+	auditRedacted = "[redacted]"
+	// auditPruneInterval is how often entries older than the retention are
+	// removed from the audit log.
+	auditPruneInterval = time.Hour
+
+	errFmtAuditSave  = "bot: Failed to save audit entry"
+	errFmtAuditPrune = "bot: Failed to prune audit log"
+)
+
+// audit saves an entry in the audit log if the network's config asks for a
+// record to be kept of the command, and removes the entries that are older
+// than the retention.
+func (b *Bot) audit(command *cmd.Cmd, entry *data.AuditEntry) {
+	cfg := b.conf.Network(entry.NetworkID)
+	if cfg == nil {
+		return
+	}
+
+	switch mode, _ := cfg.Audit(); mode {
+	case config.AuditAll:
+	case config.AuditPrivileged:
+		if !command.RequireAuth {
+			return
+		}
+	default:
+		return
+	}
+
+	redact, _ := cfg.AuditRedact()
+	for _, name := range redact {
+		if strings.EqualFold(name, entry.Command) &&
+			len(strings.TrimSpace(entry.Arguments)) != 0 {
+
+			entry.Arguments = auditRedacted
+			break
+		}
+	}
+	entry.Arguments = strings.TrimSpace(entry.Arguments)
+
+	days, _ := b.conf.AuditRetention()
+
+	b.protectStore.Lock()
+	defer b.protectStore.Unlock()
+
+	if b.store == nil {
+		return
+	}
+	if err := b.store.SaveAudit(entry); err != nil {
+		b.Error(errFmtAuditSave, "cmd", entry.Command, "err", err)
+		return
+	}
+
+	if days == 0 || entry.Time.Sub(b.auditPruned) < auditPruneInterval {
+		return
+	}
+	b.auditPruned = entry.Time
+
+	before := entry.Time.Add(-time.Duration(days) * 24 * time.Hour)
+	if _, err := b.store.PruneAudit(before); err != nil {
+		b.Error(errFmtAuditPrune, "err", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
@@ -106,6 +107,10 @@ type Bot struct {
 	msgDispatchers sync.WaitGroup
 	protectStore   sync.RWMutex
 	protectServers sync.RWMutex
+
+	// auditPruned is when the audit log was last pruned, it's protected by
+	// protectStore.
+	auditPruned time.Time
 }
 
 // CheckConfig checks a bots config for validity.
@@ -241,6 +246,7 @@ func (b *Bot) startServer(srv *Server, writing, reading bool) {
 	}
 
 	srv.Close()
+	srv.closeDCCChats()
 	close(srv.killable)
 	b.serverEnd <- serverOp{srv, false, err}
 	srv.setStatus(STATUS_STOPPED)
@@ -270,12 +276,18 @@ func (b *Bot) dispatch(srv *Server) (disconnect bool, err error) {
 			ircMsg.NetworkID = srv.networkID
 			ircMsg.NetworkInfo = srv.netInfo
 
+			var changes []*irc.Event
+			var seen []*data.StoredSeen
 			srv.protectState.Lock()
 			if srv.state != nil {
-				srv.state.Update(ircMsg)
+				changes, seen = srv.state.Update(ircMsg)
 			}
 			srv.protectState.Unlock()
+			srv.saveSeen(seen)
 			b.dispatchMessage(srv, ircMsg)
+			for _, change := range changes {
+				b.dispatchMessage(srv, change)
+			}
 		case srv.killable <- 0:
 			err = errServerKilled
 			break
@@ -288,11 +300,18 @@ func (b *Bot) dispatch(srv *Server) (disconnect bool, err error) {
 }
 
 // dispatch sends a message to both the bot's dispatcher and the given servers
+// priority handlers are run first, the bot's then the server's, and if none
+// of them consume the event it's sent on to the concurrent handlers and cmds.
 func (b *Bot) dispatchMessage(s *Server, ev *irc.Event) {
-	b.dispatcher.Dispatch(s.writer, ev)
-	s.dispatcher.Dispatch(s.writer, ev)
+	if b.dispatcher.DispatchPriority(s.writer, ev) ||
+		s.dispatcher.DispatchPriority(s.writer, ev) {
+		return
+	}
+
+	b.dispatcher.DispatchConcurrent(s.writer, ev)
+	s.dispatcher.DispatchConcurrent(s.writer, ev)
 	b.cmds.Dispatch(s.networkID, s.cmds.GetPrefix(), s.writer, ev, b)
-	s.cmds.Dispatch(s.networkID, 0, s.writer, ev, b)
+	s.cmds.Dispatch(s.networkID, "", s.writer, ev, b)
 }
 
 // Stop shuts down all connections and exits.
@@ -349,6 +368,27 @@ func (b *Bot) RegisterNetwork(
 	return 0, errUnknownServerID
 }
 
+// RegisterPriority adds a priority event handler to the bot's global
+// dispatcher. Global priority handlers run before network ones.
+// See dispatch.Dispatcher.RegisterPriority for in-depth documentation.
+func (b *Bot) RegisterPriority(
+	event string, priority int, handler interface{}) int {
+
+	return b.dispatcher.RegisterPriority(event, priority, handler)
+}
+
+// RegisterNetworkPriority adds a priority event handler to a network specific
+// dispatcher.
+// See dispatch.Dispatcher.RegisterPriority for in-depth documentation.
+func (b *Bot) RegisterNetworkPriority(networkID string, event string,
+	priority int, handler interface{}) (int, error) {
+
+	if s := b.getServer(networkID); s != nil {
+		return s.dispatcher.RegisterPriority(event, priority, handler), nil
+	}
+	return 0, errUnknownServerID
+}
+
 // Unregister removes an event handler from the bot's global dispatcher
 func (b *Bot) Unregister(event string, id int) bool {
 	return b.dispatcher.Unregister(event, id)
@@ -537,7 +577,8 @@ func createBot(conf *config.Config, connProv ConnProvider,
 	networks := conf.Networks()
 	cfg := conf.Network("")
 	pfx, _ := cfg.Prefix()
-	b.createDispatching(pfx, nil)
+	seq, _ := cfg.Sequential()
+	b.createDispatching(pfx, seq, nil)
 
 	makeStore := false
 	for _, net := range networks {
@@ -586,7 +627,17 @@ func (b *Bot) createServer(netID string, conf *config.Config) (*Server, error) {
 
 	cfg := conf.Network(netID)
 	pfx, _ := cfg.Prefix()
-	s.createDispatching(pfx, nil)
+	seq, _ := cfg.Sequential()
+	s.createDispatching(pfx, seq, nil)
+	s.cmds.SetLocale(b.locales)
+	s.cmds.SetAudit(b.audit)
+	s.cmds.SetIdentity(b.Identity)
+
+	if addressing, _ := cfg.NickAddressing(); addressing {
+		separators, _ := cfg.NickSeparators()
+		b.cmds.SetAddressing(netID, separators)
+		s.cmds.SetAddressing(netID, separators)
+	}
 
 	nostate, _ := cfg.NoState()
 	if !nostate {
@@ -606,10 +657,66 @@ func (b *Bot) createServer(netID string, conf *config.Config) (*Server, error) {
 }
 
 // createDispatcher uses the bot's current ProtoCaps to create a dispatcher.
-func (b *Bot) createDispatching(prefix rune, channels []string) {
+func (b *Bot) createDispatching(prefix string, sequential bool,
+	channels []string) {
+
 	b.dispatchCore = dispatch.NewDispatchCore(b.Logger, channels...)
 	b.dispatcher = dispatch.NewDispatcher(b.dispatchCore)
+	b.dispatcher.SetSequential(sequential)
 	b.cmds = cmd.NewCmds(prefix, b.dispatchCore)
+	b.cmds.SetSequential(sequential)
+	b.cmds.SetUnknownCmds(b.unknownCmds)
+	b.cmds.SetLocale(b.locales)
+	b.cmds.SetAudit(b.audit)
+	b.cmds.SetIdentity(b.Identity)
+}
+
+// unknownCmds looks up how commands that are not found should be answered
+// in the config, the channel's setting is used over the network's.
+func (b *Bot) unknownCmds(networkID, channel string) int {
+	cfg := b.conf.Network(networkID)
+	if cfg == nil {
+		return 0
+	}
+
+	mode, _ := cfg.UnknownCmds()
+	if len(channel) != 0 {
+		chs, _ := cfg.Channels()
+		for _, ch := range chs {
+			if strings.EqualFold(ch.Name, channel) && len(ch.UnknownCmds) != 0 {
+				mode = ch.UnknownCmds
+				break
+			}
+		}
+	}
+
+	switch mode {
+	case config.UnknownCmdsPrivate:
+		return cmd.PRIVATE
+	case config.UnknownCmdsPublic:
+		return cmd.PUBLIC
+	}
+	return 0
+}
+
+// locales looks up the language messages are sent to users in from the
+// config, the channel's setting is used over the network's.
+func (b *Bot) locales(networkID, channel string) string {
+	cfg := b.conf.Network(networkID)
+	if cfg == nil {
+		return ""
+	}
+
+	lang, _ := cfg.Locale()
+	if len(channel) != 0 {
+		chs, _ := cfg.Channels()
+		for _, ch := range chs {
+			if strings.EqualFold(ch.Name, channel) && len(ch.Locale) != 0 {
+				return ch.Locale
+			}
+		}
+	}
+	return lang
 }
 
 // createStore creates a store from a filename.
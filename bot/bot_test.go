@@ -224,6 +224,51 @@ func TestBot_Dispatching(t *testing.T) {
 	}
 }
 
+func TestBot_DispatchStateChanges(t *testing.T) {
+	t.Parallel()
+	conn := mocks.NewConn()
+	connProvider := func(srv string) (net.Conn, error) {
+		return conn, nil
+	}
+	b, _ := createBot(fakeConfig, connProvider, nil, devNull, false, false)
+
+	result := make(chan *irc.Event)
+	thandler := &testHandler{
+		func(_ irc.Writer, ev *irc.Event) {
+			result <- ev
+		},
+	}
+	b.Register(irc.JOIN, thandler)
+	b.Register(irc.SELFJOINED, thandler)
+
+	end := b.Start()
+
+	welcome := []byte(":irc.test.net 001 bot :Welcome bot!user@host\r\n")
+	join := []byte(":bot!user@host JOIN #chan\r\n")
+	go func() {
+		conn.Send(welcome, len(welcome), nil)
+		conn.Send(join, len(join), io.EOF)
+	}()
+
+	// Handlers run concurrently so the two may arrive in any order.
+	got := map[string]*irc.Event{}
+	for i := 0; i < 2; i++ {
+		d := <-result
+		got[d.Name] = d
+	}
+	if got[irc.JOIN] == nil {
+		t.Error("Expected a dispatch of join.")
+	}
+	if d := got[irc.SELFJOINED]; d == nil ||
+		d.Sender != "bot!user@host" || d.Args[0] != "#chan" {
+
+		t.Error("Expected a dispatch of self joined:", d)
+	}
+
+	for _ = range end {
+	}
+}
+
 func TestBot_Dispatch_ConnectDisconnect(t *testing.T) {
 	t.Parallel()
 	conn := mocks.NewConn()
@@ -372,6 +417,23 @@ func TestBot_Register(t *testing.T) {
 		t.Error("Unregister should unregister events.")
 	}
 
+	gid = b.RegisterPriority(irc.PRIVMSG, 5, &coreHandler{})
+	id, err = b.RegisterNetworkPriority(netID, irc.PRIVMSG, 5, &coreHandler{})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !b.Unregister(irc.PRIVMSG, gid) {
+		t.Error("Should unregister the global priority registration.")
+	}
+	if ok, _ := b.UnregisterNetwork(netID, irc.PRIVMSG, id); !ok {
+		t.Error("Unregister should unregister priority events.")
+	}
+
+	_, err = b.RegisterNetworkPriority("", "", 0, &coreHandler{})
+	if err != errUnknownServerID {
+		t.Error("Expecting:", errUnknownServerID, "got:", err)
+	}
+
 	_, err = b.RegisterNetwork("", "", &coreHandler{})
 	if err != errUnknownServerID {
 		t.Error("Expecting:", errUnknownServerID, "got:", err)
@@ -423,6 +485,72 @@ func TestBot_RegisterCmd(t *testing.T) {
 	}
 }
 
+func TestBot_UnknownCmds(t *testing.T) {
+	t.Parallel()
+
+	conf := fakeConfig.Clone()
+	net := conf.Network(netID)
+	net.SetUnknownCmds(config.UnknownCmdsPrivate)
+	net.SetChannels([]config.Channel{
+		{Name: "#public", UnknownCmds: config.UnknownCmdsPublic},
+		{Name: "#ignore", UnknownCmds: config.UnknownCmdsIgnore},
+		{Name: "#inherit"},
+	})
+	b, _ := createBot(conf, nil, nil, devNull, false, false)
+
+	var table = []struct {
+		Network string
+		Channel string
+		Mode    int
+	}{
+		{netID, "", cmd.PRIVATE},
+		{netID, "#PUBLIC", cmd.PUBLIC},
+		{netID, "#ignore", 0},
+		{netID, "#inherit", cmd.PRIVATE},
+		{netID, "#unconfigured", cmd.PRIVATE},
+		{"badServer", "", 0},
+	}
+
+	for _, test := range table {
+		if mode := b.unknownCmds(test.Network, test.Channel); mode != test.Mode {
+			t.Errorf("Expected mode for %v %v to be %v, got: %v",
+				test.Network, test.Channel, test.Mode, mode)
+		}
+	}
+}
+
+func TestBot_Locales(t *testing.T) {
+	t.Parallel()
+
+	conf := fakeConfig.Clone()
+	net := conf.Network(netID)
+	net.SetLocale("fr")
+	net.SetChannels([]config.Channel{
+		{Name: "#german", Locale: "de"},
+		{Name: "#inherit"},
+	})
+	b, _ := createBot(conf, nil, nil, devNull, false, false)
+
+	var table = []struct {
+		Network string
+		Channel string
+		Locale  string
+	}{
+		{netID, "", "fr"},
+		{netID, "#GERMAN", "de"},
+		{netID, "#inherit", "fr"},
+		{netID, "#unconfigured", "fr"},
+		{"badServer", "", ""},
+	}
+
+	for _, test := range table {
+		if lang := b.locales(test.Network, test.Channel); lang != test.Locale {
+			t.Errorf("Expected locale for %v %v to be %v, got: %v",
+				test.Network, test.Channel, test.Locale, lang)
+		}
+	}
+}
+
 func TestBot_Providers(t *testing.T) {
 	t.Parallel()
 	storeConf1 := fakeConfig.Clone()
@@ -81,6 +81,12 @@ func (s *Server) rehashConfig(newConfig *config.Config) {
 	if setNick {
 		s.Write([]byte(irc.NICK + " :" + newNick))
 	}
+
+	s.protectState.Lock()
+	if s.state != nil {
+		s.setScrollback(newConfig.Network(s.networkID))
+	}
+	s.protectState.Unlock()
 }
 
 // Rehash loads the config from a file. It attempts to use the previously read
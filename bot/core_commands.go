@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
 )
 
 var rgxFlags = regexp.MustCompile(`[A-Za-z]+`)
@@ -33,6 +36,7 @@ const (
 	delmask   = `delmask`
 
 	resetpasswd = `setpasswd`
+	setlocale   = `locale`
 
 	ggive      = `ggive`
 	sgive      = `sgive`
@@ -42,6 +46,23 @@ const (
 	take       = `take`
 	takeAllArg = `all`
 
+	alias    = `alias`
+	salias   = `salias`
+	unalias  = `unalias`
+	sunalias = `sunalias`
+	aliases  = `aliases`
+
+	aliasFlags = `GSC`
+
+	audit = `audit`
+
+	topics       = `topics`
+	topiclock    = `topiclock`
+	topicunlock  = `topicunlock`
+	topicrestore = `topicrestore`
+
+	dumpstate = `dumpstate`
+
 	help = `help`
 
 	errFmtRegister = `bot: A core command registration failed: %v`
@@ -97,6 +118,14 @@ const (
 	resetpasswdSuccess       = `Password reset successful.`
 	resetpasswdSuccessTarget = `Your password was reset by %v, it is now: %v`
 
+	setlocaleDesc = `Shows or sets the language messages are sent to you ` +
+		`in. Use none to go back to the language of the channel or network.`
+	setlocaleNone    = `none`
+	setlocaleCurrent = `Your locale is: %v`
+	setlocaleSuccess = `Your locale is now: %v`
+	setlocaleReset   = `Your locale has been removed.`
+	setlocaleFailure = `No translations are available for (%v).`
+
 	ggiveDesc = `Gives global access to a user.` +
 		` Arguments can be numeric levels or flags.`
 	ggiveSuccess = `User [%v] now has: (%v) globally.`
@@ -125,18 +154,82 @@ const (
 	takeFailureNo = `No action taken. User [%v](%v) has none of the given ` +
 		`access to remove.`
 
+	aliasDesc = `Creates an alias on a channel that expands to a command. ` +
+		`The expansion may use $1-$9 for arguments, $* for all arguments, ` +
+		`$nick and $chan. If no arguments are used they're added to the end.`
+	saliasDesc = `Creates an alias on the network that expands to a ` +
+		`command. The expansion may use $1-$9 for arguments, $* for all ` +
+		`arguments, $nick and $chan. If no arguments are used they're added ` +
+		`to the end.`
+	aliasSuccess        = `Alias [%v] now expands to: %v`
+	aliasFailureCmd     = `Alias [%v] is already a command.`
+	aliasFailureNoCmd   = `The command [%v] does not exist.`
+	aliasFailureUsage   = `An alias must expand to a command. Usage: %v`
+	unaliasDesc         = `Removes an alias from a channel.`
+	sunaliasDesc        = `Removes an alias from the network.`
+	unaliasSuccess      = `Removed alias [%v].`
+	unaliasFailure      = `Alias [%v] does not exist.`
+	aliasesDesc         = `Lists the aliases for a channel and the network.`
+	aliasesNoAliases    = `No aliases for %v`
+	aliasesHead         = `Aliases for %v:`
+	aliasesList         = `%v: %v`
+	aliasesNetworkScope = `the network`
+
+	auditDesc = `Shows the most recent commands used on the network that ` +
+		`were recorded, filtered by any of the flags given. --stats counts ` +
+		`the uses of each command instead.`
+	auditNoEntries  = `No commands have been recorded.`
+	auditHead       = `Showing %v commands:`
+	auditHeadOne    = `Showing %v command:`
+	auditList       = `%v %v %v [%v] %v %v: %v`
+	auditPrivate    = `private`
+	auditSucceeded  = `ok`
+	auditStatsHead  = `Uses of %v commands:`
+	auditStatsOne   = `Uses of %v command:`
+	auditStatsList  = `%-*v %v (%v failed)`
+	auditTimeFormat = `2006-01-02 15:04:05`
+	auditCount      = 10
+
+	topicsDesc = `Lists the previous topics of a channel, the most recent ` +
+		`first.`
+	topicsNone        = `No previous topics for %v`
+	topicsHead        = `Previous topics for %v:`
+	topicsList        = `%v) %v`
+	topicsListBy      = `%v) %v (set by %v on %v)`
+	topicsTimeFormat  = `2006-01-02 15:04`
+	topicFailureNotOn = `Not on channel [%v].`
+	topiclockDesc     = `Locks the topic of a channel, changes to it by ` +
+		`users without access are reverted.`
+	topiclockSuccess   = `Locked the topic of %v: %v`
+	topicunlockDesc    = `Unlocks the topic of a channel.`
+	topicunlockSuccess = `Unlocked the topic of %v.`
+	topicunlockFailure = `The topic of %v is not locked.`
+	topicrestoreDesc   = `Restores a previous topic of a channel, the most ` +
+		`recent one unless its number from the topics command is given. If ` +
+		`the topic is locked the restored topic is locked instead.`
+	topicrestoreFailure = `There is no previous topic %v for %v.`
+
+	dumpstateDesc = `Writes what the bot knows about a channel and the ` +
+		`users on it to a file next to the store, to attach to bug reports.`
+	dumpstateSuccess = `Wrote the state of %v to: %v`
+	dumpstateNoState = `The state is disabled on this network.`
+	dumpstateFailure = `Not on channel [%v].`
+
 	gusersDesc    = `Lists all the users added to the global access list.`
 	gusersNoUsers = `No users for %v`
 	gusersHead    = `Showing %v users:`
+	gusersHeadOne = `Showing %v user:`
 
 	usersDesc = `Lists all the users added to the channel's access list. ` +
 		`If no channel specified then list for current channel.`
 	usersNoUsers = `No users for %v`
 	usersHead    = `Showing %v users for %v:`
+	usersHeadOne = `Showing %v user for %v:`
 
 	susersDesc    = `Lists all the users added to the network's access list. `
 	susersNoUsers = `No users for %v`
 	susersHead    = `Showing %v users for %v:`
+	susersHeadOne = `Showing %v user for %v:`
 
 	usersListHeadUser   = `User`
 	usersListHeadAccess = `Access`
@@ -144,11 +237,24 @@ const (
 
 	helpSuccess      = `Cmds:`
 	helpSuccessUsage = `Usage: `
+	helpSubcommands  = `Subcommands: `
+	helpExample      = `Example: `
+	helpAccess       = `Access: requires %v`
+	helpAccessAuth   = `authentication`
+	helpAccessLevel  = `level %v`
+	helpAccessFlags  = `flags %v`
+	helpPage         = `Cmds (page %v of %v):`
+	helpMore         = `Use "help %v" for more.`
+	helpPageFailure  = `No page %v, there are %v page(s).`
 	helpFailure      = `No help available for (%v), try "help" for a list of ` +
 		`all commands.`
-	helpDesc = `Help with no arguments shows all commands, help with an ` +
-		`argument performs a search, if only one match is found gives ` +
-		`detailed information about that command.`
+	helpDesc = `Help with no arguments shows the commands you can use, help ` +
+		`with an argument performs a search, if only one match is found ` +
+		`gives detailed information about that command. Subcommands are ` +
+		`given after the command, ie. help command subcommand. A page ` +
+		`number may be given last, ie. help 2.`
+
+	helpPageSize = 10
 )
 
 type (
@@ -182,6 +288,7 @@ var commands = []struct {
 	{addmask, addmaskDesc, true, false, 0, ``, argv{`mask`, `[*user]`}},
 	{delmask, delmaskDesc, true, false, 0, ``, argv{`mask`, `[*user]`}},
 	{resetpasswd, resetpasswdDesc, true, false, 0, ``, argv{`~nick`, `*user`}},
+	{setlocale, setlocaleDesc, true, true, 0, ``, argv{`[language]`}},
 	{ggive, ggiveDesc, true, true, 0, `G`, argv{`*user`, `levelOrFlags...`}},
 	{sgive, sgiveDesc, true, true, 0, `GS`, argv{`*user`, `levelOrFlags...`}},
 	{give, giveDesc, true, true, 0, `GSC`, argv{`#chan`, `*user`,
@@ -190,7 +297,31 @@ var commands = []struct {
 	{stake, stakeDesc, true, true, 0, `GS`, argv{`*user`, `[allOrFlags]`}},
 	{take, takeDesc, true, true, 0, `GSC`, argv{`#chan`, `*user`,
 		`[allOrFlags]`}},
-	{help, helpDesc, true, true, 0, ``, argv{`[command]`}},
+	{alias, aliasDesc, true, true, 0, ``, argv{`#chan`, `name`, `command...`}},
+	{salias, saliasDesc, true, true, 0, `GS`, argv{`name`, `command...`}},
+	{unalias, unaliasDesc, true, true, 0, ``, argv{`#chan`, `name`}},
+	{sunalias, sunaliasDesc, true, true, 0, `GS`, argv{`name`}},
+	{aliases, aliasesDesc, false, true, 0, ``, argv{`[chan]`}},
+	{audit, auditDesc, true, false, 0, `G`, argv{`-u|--user=`,
+		`-c|--command=`, `--chan=`, `--network=`, `--since=duration(1s..)`,
+		`-s|--stats`, `[count:int(1..25)]`}},
+	{topics, topicsDesc, false, true, 0, ``, argv{`#chan`}},
+	{topiclock, topiclockDesc, true, true, 0, ``, argv{`#chan`}},
+	{topicunlock, topicunlockDesc, true, true, 0, ``, argv{`#chan`}},
+	{topicrestore, topicrestoreDesc, true, true, 0, ``, argv{`#chan`,
+		`[number:int(1..10)]`}},
+	{dumpstate, dumpstateDesc, true, false, 0, `G`, argv{`#chan`}},
+	{help, helpDesc, false, true, 0, ``, argv{`[command]`, `subcommands...`}},
+}
+
+// confirmCommands are the commands that must be confirmed before they're run
+// because they can't be undone.
+var confirmCommands = map[string]bool{
+	deluser: true,
+	delme:   true,
+	gtake:   true,
+	stake:   true,
+	take:    true,
 }
 
 // coreCmds is the bot's command handling struct. The bot itself uses
@@ -208,15 +339,22 @@ func NewCoreCmds(b *Bot) (*coreCmds, error) {
 		if command.Public {
 			privacy = cmd.ALL
 		}
+		// DCC CHAT sessions are authenticated before their lines are
+		// dispatched so there's no need to authenticate within them.
+		msgtype := cmd.PRIVMSG
+		if command.Name != auth && command.Name != register {
+			msgtype |= cmd.DCC
+		}
 		err := b.RegisterCmd(&cmd.Cmd{
 			Cmd:         command.Name,
 			Extension:   extension,
 			Description: command.Desc,
 			Handler:     c,
-			Msgtype:     cmd.PRIVMSG,
+			Msgtype:     msgtype,
 			Msgscope:    privacy,
 			Args:        command.Args,
 			RequireAuth: command.Authed,
+			Confirm:     confirmCommands[command.Name],
 			ReqLevel:    command.Level,
 			ReqFlags:    command.Flags,
 		})
@@ -278,6 +416,8 @@ func (c *coreCmds) Cmd(cmd string, w irc.Writer,
 		internal, external = c.delmask(w, ev)
 	case resetpasswd:
 		internal, external = c.resetpasswd(w, ev)
+	case setlocale:
+		internal, external = c.setlocale(w, ev)
 	case ggive:
 		internal, external = c.ggive(w, ev)
 	case sgive:
@@ -290,6 +430,28 @@ func (c *coreCmds) Cmd(cmd string, w irc.Writer,
 		internal, external = c.stake(w, ev)
 	case take:
 		internal, external = c.take(w, ev)
+	case alias:
+		internal, external = c.alias(w, ev)
+	case salias:
+		internal, external = c.salias(w, ev)
+	case unalias:
+		internal, external = c.unalias(w, ev)
+	case sunalias:
+		internal, external = c.sunalias(w, ev)
+	case aliases:
+		internal, external = c.aliases(w, ev)
+	case audit:
+		internal, external = c.audit(w, ev)
+	case topics:
+		internal, external = c.topics(w, ev)
+	case topiclock:
+		internal, external = c.topiclock(w, ev)
+	case topicunlock:
+		internal, external = c.topicunlock(w, ev)
+	case topicrestore:
+		internal, external = c.topicrestore(w, ev)
+	case dumpstate:
+		internal, external = c.dumpstate(w, ev)
 	case help:
 		internal, external = c.help(w, ev)
 	}
@@ -318,7 +480,7 @@ func (c *coreCmds) register(w irc.Writer,
 		access = ev.GetAuthedUser(ev.NetworkID, ev.User.Host())
 	}
 	if access != nil {
-		return nil, fmt.Errorf(errMsgAuthed)
+		return nil, locale.Errorf(errMsgAuthed)
 	}
 
 	access, internal = ev.FindUser(uname)
@@ -326,7 +488,7 @@ func (c *coreCmds) register(w irc.Writer,
 		return
 	}
 	if access != nil {
-		return nil, fmt.Errorf(registerFailure, uname)
+		return nil, locale.Errorf(registerFailure, uname)
 	}
 
 	access, internal = data.NewStoredUser(uname, pwd)
@@ -337,6 +499,7 @@ func (c *coreCmds) register(w irc.Writer,
 	host, nick := ev.User.Host(), ev.User.Nick()
 
 	ev.Close()
+	defer c.b.refreshPresence()
 	c.b.protectStore.Lock()
 	defer c.b.protectStore.Unlock()
 	store := c.b.store
@@ -478,9 +641,11 @@ func (c *coreCmds) gusers(w irc.Writer, ev *cmd.Event) (
 	}
 
 	usersWidth := userListWidth(list) + 1
-	w.Noticef(nick, gusersHead, len(list))
+	w.Notice(nick, locale.Pluralf(ev.Locale, gusersHeadOne, gusersHead,
+		len(list), len(list)))
 	w.Noticef(nick, usersList, usersWidth,
-		usersListHeadUser, usersListHeadAccess)
+		locale.Translate(ev.Locale, usersListHeadUser),
+		locale.Translate(ev.Locale, usersListHeadAccess))
 
 	for _, ua = range list {
 		ga := ua.GetGlobal()
@@ -510,9 +675,11 @@ func (c *coreCmds) susers(w irc.Writer, ev *cmd.Event) (
 	}
 
 	usersWidth := userListWidth(list) + 1
-	w.Noticef(nick, susersHead, len(list), ev.NetworkID)
+	w.Notice(nick, locale.Pluralf(ev.Locale, susersHeadOne, susersHead,
+		len(list), len(list), ev.NetworkID))
 	w.Noticef(nick, usersList, usersWidth,
-		usersListHeadUser, usersListHeadAccess)
+		locale.Translate(ev.Locale, usersListHeadUser),
+		locale.Translate(ev.Locale, usersListHeadAccess))
 
 	for _, ua = range list {
 		sa := ua.GetNetwork(ev.NetworkID)
@@ -553,9 +720,11 @@ func (c *coreCmds) users(w irc.Writer, ev *cmd.Event) (
 	}
 
 	usersWidth := userListWidth(list) + 1
-	w.Noticef(nick, usersHead, len(list), ch)
+	w.Notice(nick, locale.Pluralf(ev.Locale, usersHeadOne, usersHead,
+		len(list), len(list), ch))
 	w.Noticef(nick, usersList, usersWidth,
-		usersListHeadUser, usersListHeadAccess)
+		locale.Translate(ev.Locale, usersListHeadUser),
+		locale.Translate(ev.Locale, usersListHeadAccess))
 
 	for _, ua = range list {
 		ca := ua.GetChannel(ev.NetworkID, ch)
@@ -578,6 +747,7 @@ func (c *coreCmds) deluser(w irc.Writer, ev *cmd.Event) (
 
 	nick := ev.User.Nick()
 	ev.Close()
+	defer c.b.refreshPresence()
 	c.b.protectStore.Lock()
 	defer c.b.protectStore.Unlock()
 	store := c.b.store
@@ -606,6 +776,7 @@ func (c *coreCmds) delme(w irc.Writer, ev *cmd.Event) (
 	host, nick := ev.User.Host(), ev.User.Nick()
 	uname := ev.StoredUser.Username
 	ev.Close()
+	defer c.b.refreshPresence()
 	c.b.protectStore.Lock()
 	defer c.b.protectStore.Unlock()
 	store := c.b.store
@@ -706,6 +877,7 @@ func (c *coreCmds) addmask(w irc.Writer, ev *cmd.Event) (
 	}
 
 	ev.Close()
+	defer c.b.refreshPresence()
 	c.b.protectStore.Lock()
 	defer c.b.protectStore.Unlock()
 	store := c.b.store
@@ -751,6 +923,7 @@ func (c *coreCmds) delmask(w irc.Writer, ev *cmd.Event) (
 	}
 
 	ev.Close()
+	defer c.b.refreshPresence()
 	c.b.protectStore.Lock()
 	defer c.b.protectStore.Unlock()
 	store := c.b.store
@@ -815,6 +988,57 @@ func (c *coreCmds) resetpasswd(w irc.Writer, ev *cmd.Event) (
 	return
 }
 
+// setlocale shows or sets the language the user is sent messages in.
+func (c *coreCmds) setlocale(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	nick := ev.User.Nick()
+	uname := ev.StoredUser.Username
+	lang := locale.Normalize(ev.GetArg("language"))
+	if len(lang) == 0 {
+		current := ev.Locale
+		if len(current) == 0 {
+			current = locale.Default
+		}
+		w.Noticef(nick, setlocaleCurrent, current)
+		return
+	}
+
+	if lang == setlocaleNone {
+		lang = ""
+	} else if lang != locale.Default && !locale.Has(lang) {
+		return nil, locale.Errorf(setlocaleFailure, lang)
+	}
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+	store := c.b.store
+
+	var access *data.StoredUser
+	access, internal = store.FindUser(uname)
+	if internal != nil {
+		return
+	}
+	if access == nil {
+		internal = fmt.Errorf(errFmtExpired, uname)
+		return
+	}
+	access.SetLocale(lang)
+	internal = store.SaveUser(access)
+	if internal != nil {
+		return
+	}
+
+	if len(lang) == 0 {
+		w.Notice(nick, setlocaleReset)
+	} else {
+		w = locale.NewWriter(w, lang)
+		w.Noticef(nick, setlocaleSuccess, lang)
+	}
+	return
+}
+
 // ggive gives global access to a user.
 func (c *coreCmds) ggive(w irc.Writer, ev *cmd.Event) (
 	internal, external error) {
@@ -826,12 +1050,12 @@ func (c *coreCmds) ggive(w irc.Writer, ev *cmd.Event) (
 			if len(flags) != 0 {
 				filtered := filterFlags(flags, a.HasGlobalFlag)
 				if len(filtered) == 0 && level == 0 {
-					return fmt.Sprintf(giveFailureHas, a.Username,
+					return locale.Sprintf(ev.Locale, giveFailureHas, a.Username,
 						a.Global, flags), false
 				}
 				a.GrantGlobalFlags(filtered)
 			}
-			return fmt.Sprintf(ggiveSuccess, a.Username, a.Global), true
+			return locale.Sprintf(ev.Locale, ggiveSuccess, a.Username, a.Global), true
 		},
 	)
 }
@@ -851,12 +1075,12 @@ func (c *coreCmds) sgive(w irc.Writer, ev *cmd.Event) (
 				})
 
 				if len(filtered) == 0 && level == 0 {
-					return fmt.Sprintf(giveFailureHas, a.Username,
+					return locale.Sprintf(ev.Locale, giveFailureHas, a.Username,
 						a.GetNetwork(network), flags), false
 				}
 				a.GrantNetworkFlags(network, filtered)
 			}
-			return fmt.Sprintf(sgiveSuccess, a.Username, a.GetNetwork(network)),
+			return locale.Sprintf(ev.Locale, sgiveSuccess, a.Username, a.GetNetwork(network)),
 				true
 		},
 	)
@@ -878,12 +1102,12 @@ func (c *coreCmds) give(w irc.Writer, ev *cmd.Event) (
 				})
 
 				if len(filtered) == 0 && level == 0 {
-					return fmt.Sprintf(giveFailureHas, a.Username,
+					return locale.Sprintf(ev.Locale, giveFailureHas, a.Username,
 						a.GetChannel(network, channel), flags), false
 				}
 				a.GrantChannelFlags(network, channel, filtered)
 			}
-			return fmt.Sprintf(giveSuccess, a.Username,
+			return locale.Sprintf(ev.Locale, giveSuccess, a.Username,
 				a.GetChannel(network, channel), channel), true
 		},
 	)
@@ -912,9 +1136,9 @@ func (c *coreCmds) gtake(w irc.Writer, ev *cmd.Event) (
 
 			var rstr = a.Global.String()
 			if save {
-				rstr = fmt.Sprintf(ggiveSuccess, a.Username, rstr)
+				rstr = locale.Sprintf(ev.Locale, ggiveSuccess, a.Username, rstr)
 			} else {
-				rstr = fmt.Sprintf(takeFailureNo, a.Username, rstr)
+				rstr = locale.Sprintf(ev.Locale, takeFailureNo, a.Username, rstr)
 			}
 			return rstr, save
 		},
@@ -947,9 +1171,9 @@ func (c *coreCmds) stake(w irc.Writer, ev *cmd.Event) (
 
 			var rstr = a.GetNetwork(network).String()
 			if save {
-				rstr = fmt.Sprintf(sgiveSuccess, a.Username, rstr)
+				rstr = locale.Sprintf(ev.Locale, sgiveSuccess, a.Username, rstr)
 			} else {
-				rstr = fmt.Sprintf(takeFailureNo, a.Username, rstr)
+				rstr = locale.Sprintf(ev.Locale, takeFailureNo, a.Username, rstr)
 			}
 			return rstr, save
 		},
@@ -983,9 +1207,9 @@ func (c *coreCmds) take(w irc.Writer, ev *cmd.Event) (
 
 			var rstr = a.GetChannel(network, channel).String()
 			if save {
-				rstr = fmt.Sprintf(giveSuccess, a.Username, rstr, channel)
+				rstr = locale.Sprintf(ev.Locale, giveSuccess, a.Username, rstr, channel)
 			} else {
-				rstr = fmt.Sprintf(takeFailureNo, a.Username, rstr)
+				rstr = locale.Sprintf(ev.Locale, takeFailureNo, a.Username, rstr)
 			}
 			return rstr, save
 		},
@@ -1076,7 +1300,7 @@ func (c *coreCmds) takeHelper(w irc.Writer, ev *cmd.Event,
 		if rgxFlags.MatchString(arg) {
 			flags = arg
 		} else {
-			external = fmt.Errorf(takeFailure, arg)
+			external = locale.Errorf(takeFailure, arg)
 		}
 	}
 
@@ -1091,71 +1315,508 @@ func (c *coreCmds) takeHelper(w irc.Writer, ev *cmd.Event,
 	return
 }
 
+// alias creates an alias on a channel.
+func (c *coreCmds) alias(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if !ev.StoredUser.HasFlags(ev.NetworkID, channel, aliasFlags) {
+		return nil, cmd.MakeFlagsError(aliasFlags)
+	}
+	return c.aliasHelper(w, ev, channel)
+}
+
+// salias creates an alias on the network.
+func (c *coreCmds) salias(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+	return c.aliasHelper(w, ev, "")
+}
+
+// aliasHelper saves an alias to a channel, or the network if the channel is
+// empty.
+func (c *coreCmds) aliasHelper(w irc.Writer, ev *cmd.Event,
+	channel string) (internal, external error) {
+
+	name := strings.ToLower(ev.GetArg("name"))
+	expansion := ev.GetArg("command")
+	fields := strings.Fields(expansion)
+	if len(fields) == 0 {
+		usage := salias + " name command..."
+		if len(channel) != 0 {
+			usage = alias + " " + channel + " name command..."
+		}
+		return nil, locale.Errorf(aliasFailureUsage, usage)
+	}
+	target := fields[0]
+
+	var isCmd, targetExists bool
+	cmd.EachCmd(func(command *cmd.Cmd) bool {
+		isCmd = isCmd || command.IsNamed(name)
+		targetExists = targetExists || command.IsNamed(target)
+		return isCmd
+	})
+	if isCmd {
+		return nil, locale.Errorf(aliasFailureCmd, name)
+	}
+	if !targetExists {
+		return nil, locale.Errorf(aliasFailureNoCmd, target)
+	}
+
+	nick, creator := ev.User.Nick(), ev.StoredUser.Username
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+
+	stored := data.NewStoredAlias(name, expansion, creator)
+	internal = c.b.store.SaveAlias(ev.NetworkID, channel, stored)
+	if internal != nil {
+		return
+	}
+
+	w.Noticef(nick, aliasSuccess, name, expansion)
+	return
+}
+
+// unalias removes an alias from a channel.
+func (c *coreCmds) unalias(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if !ev.StoredUser.HasFlags(ev.NetworkID, channel, aliasFlags) {
+		return nil, cmd.MakeFlagsError(aliasFlags)
+	}
+	return c.unaliasHelper(w, ev, channel)
+}
+
+// sunalias removes an alias from the network.
+func (c *coreCmds) sunalias(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+	return c.unaliasHelper(w, ev, "")
+}
+
+// unaliasHelper removes an alias from a channel, or the network if the channel
+// is empty.
+func (c *coreCmds) unaliasHelper(w irc.Writer, ev *cmd.Event,
+	channel string) (internal, external error) {
+
+	name := ev.GetArg("name")
+	nick := ev.User.Nick()
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+
+	var removed bool
+	removed, internal = c.b.store.RemoveAlias(ev.NetworkID, channel, name)
+	if internal != nil {
+		return
+	}
+	if !removed {
+		return nil, locale.Errorf(unaliasFailure, name)
+	}
+
+	w.Noticef(nick, unaliasSuccess, name)
+	return
+}
+
+// aliases lists the aliases for a channel and the network.
+func (c *coreCmds) aliases(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	ch := ev.GetArg("chan")
+	if ch == `` && ev.Channel != nil {
+		ch = ev.Channel.Name()
+	}
+
+	nick := ev.User.Nick()
+
+	scopes := []string{aliasesNetworkScope}
+	if ch != `` {
+		scopes = []string{ch, aliasesNetworkScope}
+	}
+
+	for _, scope := range scopes {
+		channel := scope
+		if scope == aliasesNetworkScope {
+			channel = ``
+			scope = locale.Translate(ev.Locale, scope)
+		}
+
+		var list []*data.StoredAlias
+		list, internal = ev.Aliases(ev.NetworkID, channel)
+		if internal != nil {
+			return
+		}
+
+		if len(list) == 0 {
+			w.Noticef(nick, aliasesNoAliases, scope)
+			continue
+		}
+
+		w.Noticef(nick, aliasesHead, scope)
+		for _, a := range list {
+			w.Noticef(nick, aliasesList, a.Alias, a.Expansion)
+		}
+	}
+
+	return
+}
+
+// topics lists the previous topics of a channel.
+func (c *coreCmds) topics(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if ev.TargetChannel == nil {
+		return nil, locale.Errorf(topicFailureNotOn, channel)
+	}
+
+	nick := ev.Nick()
+	history := ev.TargetChannel.TopicHistory()
+	if len(history) == 0 {
+		w.Noticef(nick, topicsNone, channel)
+		return
+	}
+
+	w.Noticef(nick, topicsHead, channel)
+	for i, entry := range history {
+		if len(entry.SetBy) == 0 || entry.SetAt.IsZero() {
+			w.Noticef(nick, topicsList, i+1, entry.Topic)
+			continue
+		}
+		w.Noticef(nick, topicsListBy, i+1, entry.Topic,
+			irc.Nick(entry.SetBy), entry.SetAt.UTC().Format(topicsTimeFormat))
+	}
+	return
+}
+
+// topiclock locks the current topic of a channel.
+func (c *coreCmds) topiclock(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if !ev.StoredUser.HasFlags(ev.NetworkID, channel, topicFlags) {
+		return nil, cmd.MakeFlagsError(topicFlags)
+	}
+	if ev.TargetChannel == nil {
+		return nil, locale.Errorf(topicFailureNotOn, channel)
+	}
+
+	nick := ev.Nick()
+	topic := ev.TargetChannel.Topic()
+	history := ev.TargetChannel.TopicHistory()
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+
+	var stored *data.StoredChannel
+	stored, internal = c.b.store.FindChannel(ev.NetworkID, channel)
+	if internal != nil {
+		return
+	}
+	if stored == nil {
+		stored = data.NewStoredChannel(ev.NetworkID, channel)
+	}
+
+	stored.LockTopic(topic)
+	if internal = stored.PutTopics(history); internal != nil {
+		return
+	}
+	if internal = c.b.store.SaveChannel(stored); internal != nil {
+		return
+	}
+
+	w.Noticef(nick, topiclockSuccess, channel, topic)
+	return
+}
+
+// topicunlock unlocks the topic of a channel.
+func (c *coreCmds) topicunlock(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if !ev.StoredUser.HasFlags(ev.NetworkID, channel, topicFlags) {
+		return nil, cmd.MakeFlagsError(topicFlags)
+	}
+
+	nick := ev.Nick()
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+
+	var stored *data.StoredChannel
+	stored, internal = c.b.store.FindChannel(ev.NetworkID, channel)
+	if internal != nil {
+		return
+	}
+	if stored == nil {
+		return nil, locale.Errorf(topicunlockFailure, channel)
+	}
+	if _, ok := stored.TopicLock(); !ok {
+		return nil, locale.Errorf(topicunlockFailure, channel)
+	}
+
+	stored.UnlockTopic()
+	if internal = c.b.store.SaveChannel(stored); internal != nil {
+		return
+	}
+
+	w.Noticef(nick, topicunlockSuccess, channel)
+	return
+}
+
+// topicrestore sets the topic of a channel back to one of its previous
+// topics, moving the lock to it if the topic is locked.
+func (c *coreCmds) topicrestore(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if !ev.StoredUser.HasFlags(ev.NetworkID, channel, topicFlags) {
+		return nil, cmd.MakeFlagsError(topicFlags)
+	}
+	if ev.TargetChannel == nil {
+		return nil, locale.Errorf(topicFailureNotOn, channel)
+	}
+
+	number := 1
+	if n := ev.GetInt("number"); n > 0 {
+		number = n
+	}
+	history := ev.TargetChannel.TopicHistory()
+	if number > len(history) {
+		return nil, locale.Errorf(topicrestoreFailure, number, channel)
+	}
+	topic := history[number-1].Topic
+
+	ev.Close()
+	c.b.protectStore.Lock()
+	defer c.b.protectStore.Unlock()
+
+	var stored *data.StoredChannel
+	stored, internal = c.b.store.FindChannel(ev.NetworkID, channel)
+	if internal != nil {
+		return
+	}
+	if stored != nil {
+		if _, ok := stored.TopicLock(); ok {
+			stored.LockTopic(topic)
+			if internal = c.b.store.SaveChannel(stored); internal != nil {
+				return
+			}
+		}
+	}
+
+	w.Sendf("TOPIC %s :%s", channel, topic)
+	return
+}
+
+// dumpstate writes a snapshot of a channel's state to a file.
+func (c *coreCmds) dumpstate(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	channel := ev.GetArg("chan")
+	if ev.State == nil {
+		return nil, locale.Errorf(dumpstateNoState)
+	}
+	snap := ev.State.SnapshotChannel(channel)
+	if snap == nil {
+		return nil, locale.Errorf(dumpstateFailure, channel)
+	}
+
+	nick := ev.Nick()
+	ev.Close()
+
+	storefile, _ := c.b.conf.StoreFile()
+	var name string
+	name, internal = writeSnapshot(filepath.Dir(storefile), ev.NetworkID,
+		channel, snap)
+	if internal != nil {
+		return
+	}
+
+	w.Noticef(nick, dumpstateSuccess, channel, name)
+	return
+}
+
+// audit shows the most recent entries in the audit log, or counts the uses
+// of each command in it.
+func (c *coreCmds) audit(w irc.Writer, ev *cmd.Event) (
+	internal, external error) {
+
+	nick := ev.Nick()
+
+	query := data.AuditQuery{
+		NetworkID: ev.GetFlag("network"),
+		Channel:   ev.GetFlag("chan"),
+		Account:   ev.GetFlag("user"),
+		Command:   ev.GetFlag("command"),
+	}
+	if len(query.NetworkID) == 0 {
+		query.NetworkID = ev.NetworkID
+	}
+	if since := ev.GetDuration("since"); since > 0 {
+		query.Since = time.Now().Add(-since)
+	}
+
+	stats := ev.HasFlag("stats")
+	if !stats {
+		query.Limit = auditCount
+		if count := ev.GetInt("count"); count > 0 {
+			query.Limit = count
+		}
+	}
+
+	var list []*data.AuditEntry
+	if list, internal = ev.AuditLog(query); internal != nil {
+		return
+	}
+
+	if len(list) == 0 {
+		w.Notice(nick, auditNoEntries)
+		return
+	}
+
+	if stats {
+		auditStats(w, ev, list)
+		return
+	}
+
+	w.Notice(nick, locale.Pluralf(ev.Locale, auditHeadOne, auditHead,
+		len(list), len(list)))
+	for _, entry := range list {
+		target := entry.Target
+		if len(target) == 0 {
+			target = locale.Translate(ev.Locale, auditPrivate)
+		}
+		result := entry.Result
+		if len(result) == 0 {
+			result = locale.Translate(ev.Locale, auditSucceeded)
+		}
+		w.Noticef(nick, auditList,
+			entry.Time.Local().Format(auditTimeFormat), target,
+			irc.Nick(entry.Sender), entry.Account, entry.Command,
+			entry.Arguments, result)
+	}
+
+	return
+}
+
+// auditStats counts the uses of each command in a list of audit entries.
+func auditStats(w irc.Writer, ev *cmd.Event, list []*data.AuditEntry) {
+	uses := make(map[string]int)
+	failures := make(map[string]int)
+	var names []string
+	width := 0
+
+	for _, entry := range list {
+		if _, ok := uses[entry.Command]; !ok {
+			names = append(names, entry.Command)
+			if len(entry.Command) > width {
+				width = len(entry.Command)
+			}
+		}
+		uses[entry.Command]++
+		if len(entry.Result) != 0 {
+			failures[entry.Command]++
+		}
+	}
+	sort.Strings(names)
+
+	nick := ev.Nick()
+	w.Notice(nick, locale.Pluralf(ev.Locale, auditStatsOne, auditStatsHead,
+		len(names), len(names)))
+	for _, name := range names {
+		w.Noticef(nick, auditStatsList, width+1, name, uses[name],
+			failures[name])
+	}
+}
+
 // help searches for commands, and also provides details for specific commands
 func (c *coreCmds) help(w irc.Writer, ev *cmd.Event) (
 	internal, external error) {
 
-	search := strings.ToLower(ev.GetArg("command"))
-	nick := ev.User.Nick()
+	nick := ev.Nick()
 
-	var output = make(map[string][]string)
-	var exactMatches []*cmd.Cmd
+	var terms []string
+	if command := ev.GetArg("command"); len(command) > 0 {
+		terms = append(terms, command)
+	}
+	terms = append(terms, ev.SplitArg("subcommands")...)
 
-	cmd.EachCmd(func(command *cmd.Cmd) bool {
-		write := true
+	page := 1
+	if n := len(terms); n > 0 {
+		if p, err := strconv.Atoi(terms[n-1]); err == nil && p > 0 {
+			page = p
+			terms = terms[:n-1]
+		}
+	}
 
+	var search string
+	var subcommands []string
+	if len(terms) > 0 {
+		search = strings.ToLower(terms[0])
+		subcommands = terms[1:]
+	}
+
+	user := ev.StoredUser
+	if user == nil && ev.Store != nil {
+		user = ev.Store.GetAuthedUser(ev.NetworkID, ev.Sender)
+	}
+	var channel string
+	if ev.Channel != nil {
+		channel = ev.Channel.Name()
+	}
+
+	var list, exactMatches []*cmd.Cmd
+	cmd.EachCmd(func(command *cmd.Cmd) bool {
 		if len(search) > 0 {
 			combined := command.Extension + "." + command.Cmd
 			if perfect := combined == search; command.Cmd == search || perfect {
-				if exactMatches == nil || perfect {
-					exactMatches = []*cmd.Cmd{command}
-				} else {
-					exactMatches = append(exactMatches, command)
-					write = false
-				}
 				if perfect {
+					exactMatches = []*cmd.Cmd{command}
 					return true
 				}
+				exactMatches = append(exactMatches, command)
+				return false
 			} else if !strings.Contains(combined, search) {
-				write = false
+				return false
 			}
 		}
 
-		if write {
-			if arr, ok := output[command.Extension]; ok {
-				output[command.Extension] = append(arr, command.Cmd)
-			} else {
-				output[command.Extension] = []string{command.Cmd}
-			}
+		if command.HasAccess(user, ev.NetworkID, channel) {
+			list = append(list, command)
 		}
 		return false
 	})
 
 	if len(exactMatches) > 1 {
 		for _, command := range exactMatches {
-			if arr, ok := output[command.Extension]; ok {
-				output[command.Extension] = append(arr, command.Cmd)
-			} else {
-				output[command.Extension] = []string{command.Cmd}
+			if command.HasAccess(user, ev.NetworkID, channel) {
+				list = append(list, command)
 			}
 		}
 		exactMatches = nil
 	}
 
+	var exactMatch *cmd.Cmd
 	if exactMatches != nil {
-		exactMatch := exactMatches[0]
-		w.Notice(nick, helpSuccess,
-			" ", exactMatch.Extension, ".", exactMatch.Cmd)
-		w.Notice(nick, exactMatch.Description)
-		if len(exactMatch.Args) > 0 {
-			w.Notice(nick, helpSuccessUsage, strings.Join(exactMatch.Args, " "))
-		}
-	} else if len(output) > 0 {
-		for extension, commands := range output {
-			sort.Strings(commands)
-			w.Notice(nick, extension, ":")
-			w.Notice(nick, " ", strings.Join(commands, " "))
+		exactMatch = exactMatches[0]
+		for i := 0; exactMatch != nil && i < len(subcommands); i++ {
+			exactMatch = exactMatch.Subcommand(subcommands[i])
 		}
+	}
+
+	if exactMatch != nil {
+		c.helpCommand(w, nick, ev.Locale, exactMatch, user, ev.NetworkID,
+			channel)
+	} else if len(subcommands) > 0 {
+		w.Noticef(nick, helpFailure,
+			search+" "+strings.Join(subcommands, " "))
+	} else if len(list) > 0 {
+		helpList(w, nick, search, page, list)
 	} else {
 		w.Noticef(nick, helpFailure, search)
 	}
@@ -1163,6 +1824,83 @@ func (c *coreCmds) help(w irc.Writer, ev *cmd.Event) (
 	return
 }
 
+// helpCommand gives the details of a single command. The access required to
+// use the command is only shown if the user doesn't have it.
+func (c *coreCmds) helpCommand(w irc.Writer, nick, lang string,
+	command *cmd.Cmd, user *data.StoredUser, networkID, channel string) {
+
+	w.Notice(nick, helpSuccess, " ", command.Extension, ".", command.FullName())
+	w.Notice(nick, command.Description)
+	if len(command.LongDescription) > 0 {
+		w.Notice(nick, command.LongDescription)
+	}
+	if len(command.Args) > 0 {
+		w.Notice(nick, helpSuccessUsage, command.Usage())
+	}
+	for _, example := range command.Examples {
+		w.Notice(nick, helpExample, example)
+	}
+	if len(command.Subcommands) > 0 {
+		names := make([]string, len(command.Subcommands))
+		for i, sub := range command.Subcommands {
+			names[i] = sub.Cmd
+		}
+		w.Notice(nick, helpSubcommands, strings.Join(names, " "))
+	}
+
+	if command.HasAccess(user, networkID, channel) {
+		return
+	}
+
+	var required []string
+	if user == nil {
+		required = append(required, locale.Translate(lang, helpAccessAuth))
+	}
+	if command.ReqLevel != 0 {
+		required = append(required,
+			locale.Sprintf(lang, helpAccessLevel, command.ReqLevel))
+	}
+	if len(command.ReqFlags) != 0 {
+		required = append(required,
+			locale.Sprintf(lang, helpAccessFlags, command.ReqFlags))
+	}
+	w.Noticef(nick, helpAccess, strings.Join(required, ", "))
+}
+
+// helpList gives the usage of each command in the list a page at a time.
+func helpList(w irc.Writer, nick, search string, page int, list []*cmd.Cmd) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Extension != list[j].Extension {
+			return list[i].Extension < list[j].Extension
+		}
+		return list[i].Cmd < list[j].Cmd
+	})
+
+	pages := (len(list) + helpPageSize - 1) / helpPageSize
+	if page > pages {
+		w.Noticef(nick, helpPageFailure, page, pages)
+		return
+	}
+
+	w.Noticef(nick, helpPage, page, pages)
+	start := (page - 1) * helpPageSize
+	end := start + helpPageSize
+	if end > len(list) {
+		end = len(list)
+	}
+	for _, command := range list[start:end] {
+		w.Notice(nick, command.Extension, ".", command.Usage())
+	}
+
+	if page < pages {
+		next := strconv.Itoa(page + 1)
+		if len(search) > 0 {
+			next = search + " " + next
+		}
+		w.Noticef(nick, helpMore, next)
+	}
+}
+
 // filterFlags removes flags that the user already has
 func filterFlags(flags string, check func(rune) bool) string {
 	buf := bytes.Buffer{}
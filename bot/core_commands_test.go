@@ -2,14 +2,22 @@ package bot
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aarondl/ultimateq/config"
 	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
 )
 
 const (
@@ -23,7 +31,7 @@ const (
 	u2user   = "user2"
 	channel  = "#chan"
 	password = "password"
-	prefix   = '.'
+	prefix   = "."
 )
 
 var (
@@ -31,9 +39,10 @@ var (
 	userKinds, _ = data.NewUserModeKinds("(ov)@+")
 	rgxCreator   = strings.NewReplacer(
 		`(`, `\(`, `)`, `\)`, `]`, `\]`, `[`,
-		`\[`, `\`, `\\`, `/`, `\/`, `%v`, `.*`,
+		`\[`, `\`, `\\`, `/`, `\/`, `%v`, `.*`, `|`, `\|`,
 	)
-	netInfo = irc.NewNetworkInfo()
+	netInfo    = irc.NewNetworkInfo()
+	rgxConfirm = regexp.MustCompile(`: (confirm [0-9a-f]+) `)
 )
 
 type tSetup struct {
@@ -96,12 +105,26 @@ func rspChk(ts *tSetup, expected, sender string, args ...string) error {
 }
 
 func prvRspChk(ts *tSetup, expected, to, sender string, args ...string) error {
-	ts.buffer.Reset()
-	err := ts.b.cmds.Dispatch(netID, 0, ts.writer, irc.NewEvent(
-		netID, netInfo, irc.PRIVMSG, sender, to, strings.Join(args, " ")),
-		ts.locker,
-	)
-	ts.b.cmds.WaitForHandlers()
+	dispatch := func(msg string) error {
+		ts.buffer.Reset()
+		err := ts.b.cmds.Dispatch(netID, "", ts.writer, irc.NewEvent(
+			netID, netInfo, irc.PRIVMSG, sender, to, msg),
+			ts.locker,
+		)
+		ts.b.cmds.WaitForHandlers()
+		return err
+	}
+
+	err := dispatch(strings.Join(args, " "))
+
+	// Commands that must be confirmed are confirmed straight away.
+	confirm := rgxConfirm.FindStringSubmatch(ts.buffer.String())
+	if confirm != nil {
+		if to == channel {
+			confirm[1] = prefix + confirm[1]
+		}
+		err = dispatch(confirm[1])
+	}
 
 	s := ts.buffer.String()
 	if len(s) == 0 {
@@ -294,7 +317,7 @@ func TestCoreCommands_Access(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = pubRspChk(ts, accessSuccess, u1host, string(prefix)+access)
+	err = pubRspChk(ts, accessSuccess, u1host, prefix+access)
 	if err != nil {
 		t.Error(err)
 	}
@@ -448,6 +471,83 @@ func TestCoreCommands_Delme(t *testing.T) {
 	}
 }
 
+func TestCoreCommands_Confirm(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts.buffer.Reset()
+	ts.b.cmds.Dispatch(netID, "", ts.writer, irc.NewEvent(
+		netID, netInfo, irc.PRIVMSG, u1host, botnick, delme), ts.locker,
+	)
+	ts.b.cmds.WaitForHandlers()
+
+	if !rgxConfirm.MatchString(ts.buffer.String()) {
+		t.Error("Expected to be asked to confirm, got:", ts.buffer.String())
+	}
+	if access, _ := ts.store.FindUser(u1user); access == nil {
+		t.Error("User was deleted without being confirmed.")
+	}
+}
+
+func TestCoreCommands_Locale(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	catalog := locale.Catalog{
+		setlocaleSuccess: {"Sprache: %v"},
+		setlocaleCurrent: {"Aktuell: %v"},
+	}
+	locale.Add("x-bot", catalog)
+	defer locale.Remove("x-bot", catalog)
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, fmt.Sprintf(setlocaleCurrent, locale.Default), u1host,
+		setlocale)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, fmt.Sprintf(setlocaleFailure, "x-none"), u1host,
+		setlocale, "x-none")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, "Sprache: x-bot", u1host, setlocale, "X_BOT")
+	if err != nil {
+		t.Error(err)
+	}
+	if access := ts.store.GetAuthedUser(netID, u1host); access == nil {
+		t.Error("User was not authenticated.")
+	} else if lang := access.Locale(); lang != "x-bot" {
+		t.Error("Expected the locale to be set, got:", lang)
+	}
+
+	err = rspChk(ts, "Aktuell: x-bot", u1host, setlocale)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, setlocaleReset, u1host, setlocale, setlocaleNone)
+	if err != nil {
+		t.Error(err)
+	}
+	if access := ts.store.GetAuthedUser(netID, u1host); access == nil {
+		t.Error("User was not authenticated.")
+	} else if lang := access.Locale(); len(lang) != 0 {
+		t.Error("Expected the locale to be removed, got:", lang)
+	}
+}
+
 func TestCoreCommands_Passwd(t *testing.T) {
 	ts := commandsSetup(t)
 	defer commandsTeardown(ts, t)
@@ -858,20 +958,52 @@ func TestCoreCommands_Help(t *testing.T) {
 	defer commandsTeardown(ts, t)
 	var err error
 
+	check := fmt.Sprintf(helpPage, 1, 1) +
+		`NOTICE .* :core.aliases [chan]` +
+		`NOTICE .* :core.auth <password> [username]` +
+		`NOTICE .* :core.gusers` +
+		`NOTICE .* :core.help [command] [subcommands...]` +
+		`NOTICE .* :core.register <password> [username]` +
+		`NOTICE .* :core.susers` +
+		`NOTICE .* :core.users [chan]`
+	err = rspChk(ts, check, u2host, help)
+	if err != nil {
+		t.Error(err)
+	}
+
 	err = rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
 	if err != nil {
 		t.Error(err)
 	}
 
-	check := `core:NOTICE .* (access|addmask|auth){3}.*`
+	pages := (len(commands) + helpPageSize - 1) / helpPageSize
+	check = fmt.Sprintf(helpPage, 1, pages) + `%v` + fmt.Sprintf(helpMore, 2)
 	err = rspChk(ts, check, u1host, help)
 	if err != nil {
 		t.Error(err)
 	}
+	if n := strings.Count(ts.buffer.String(), "NOTICE"); n != helpPageSize+2 {
+		t.Errorf("Expected %v lines, got: %v", helpPageSize+2, n)
+	}
+
+	check = fmt.Sprintf(helpPage, pages, pages) + `%v`
+	err = rspChk(ts, check, u1host, help, strconv.Itoa(pages))
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Contains(ts.buffer.String(), "for more") {
+		t.Error("The last page should not point to another page.")
+	}
+
+	check = fmt.Sprintf(helpPageFailure, pages+1, pages)
+	err = rspChk(ts, check, u1host, help, strconv.Itoa(pages+1))
+	if err != nil {
+		t.Error(err)
+	}
 
 	check = helpSuccess + " " + extension + "." + register +
 		`NOTICE .* :` + registerDesc +
-		`NOTICE .* :` + helpSuccessUsage + strings.Join(commands[0].Args, " ")
+		`NOTICE .* :` + helpSuccessUsage + "register <password> [username]"
 	err = rspChk(ts, check, u1host, help, register)
 	if err != nil {
 		t.Error(err)
@@ -889,7 +1021,29 @@ func TestCoreCommands_Help(t *testing.T) {
 		t.Error(err)
 	}
 
-	check = `core:NOTICE .* (give|ggive|sgive|register){4}`
+	err = rspChk(ts, check+`NOTICE .* :`+fmt.Sprintf(helpAccess, helpAccessAuth),
+		u2host, help, delme)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, registerSuccess, u2host, register, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	check = helpSuccess + " " + extension + "." + ggive + `%v` +
+		`NOTICE .* :` + fmt.Sprintf(helpAccess, fmt.Sprintf(helpAccessFlags, "G"))
+	err = rspChk(ts, check, u2host, help, ggive)
+	if err != nil {
+		t.Error(err)
+	}
+
+	check = fmt.Sprintf(helpPage, 1, 1) +
+		`NOTICE .* :core.ggive %v` +
+		`NOTICE .* :core.give %v` +
+		`NOTICE .* :core.register %v` +
+		`NOTICE .* :core.sgive %v`
 	err = rspChk(ts, check, u1host, help, "gi")
 	if err != nil {
 		t.Error(err)
@@ -899,6 +1053,204 @@ func TestCoreCommands_Help(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+
+	sub := cmd.MkCmd("", "Sub desc.", "sub", testCommand{}, 0, 0, "arg")
+	sub.LongDescription = "Sub long desc."
+	sub.Examples = []string{"grp sub a", "grp sub b"}
+	group := cmd.MkGroup("grpext", "Group desc.", "grp", cmd.ALL, cmd.ALL, sub)
+	if err = ts.b.cmds.Register(cmd.GLOBAL, group); err != nil {
+		t.Fatal(err)
+	}
+	defer ts.b.cmds.Unregister(cmd.GLOBAL, "grp")
+
+	check = helpSuccess + " grpext.grp" +
+		`NOTICE .* :Group desc.` +
+		`NOTICE .* :` + helpSubcommands + "sub"
+	err = rspChk(ts, check, u1host, help, "grp")
+	if err != nil {
+		t.Error(err)
+	}
+
+	check = helpSuccess + " grpext.grp sub" +
+		`NOTICE .* :Sub desc.` +
+		`NOTICE .* :Sub long desc.` +
+		`NOTICE .* :` + helpSuccessUsage + "grp sub <arg>" +
+		`NOTICE .* :` + helpExample + "grp sub a" +
+		`NOTICE .* :` + helpExample + "grp sub b"
+	err = rspChk(ts, check, u1host, help, "grp", "SUB")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, helpFailure, u1host, help, "grp", "nope")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoreCommands_Alias(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+	var err error
+
+	err = rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, registerSuccess, u2host, register, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	flagsErr := cmd.MakeFlagsError(aliasFlags).Error()
+	err = rspChk(ts, flagsErr, u2host, alias, channel, "rules", help)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, aliasSuccess, u1host, alias, channel, "Rules", help,
+		register)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, aliasFailureCmd, u1host, alias, channel, help, help)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, aliasFailureUsage, u1host, alias, channel, "foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, aliasFailureNoCmd, u1host, salias, "x", "nope")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, aliasSuccess, u1host, salias, "r", help, register)
+	if err != nil {
+		t.Error(err)
+	}
+
+	check := fmt.Sprintf(aliasesHead, channel) +
+		`NOTICE .* :` + fmt.Sprintf(aliasesList, "rules", help+" "+register) +
+		`NOTICE .* :` + fmt.Sprintf(aliasesHead, aliasesNetworkScope) +
+		`NOTICE .* :` + fmt.Sprintf(aliasesList, "r", help+" "+register)
+	err = rspChk(ts, check, u2host, aliases, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	check = helpSuccess + " " + extension + "." + register + `.*`
+	err = rspChk(ts, check, u2host, "r")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, flagsErr, u2host, unalias, channel, "rules")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, unaliasSuccess, u1host, unalias, channel, "rules")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, unaliasFailure, u1host, unalias, channel, "rules")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, unaliasSuccess, u1host, sunalias, "r")
+	if err != nil {
+		t.Error(err)
+	}
+
+	check = fmt.Sprintf(aliasesNoAliases, channel) +
+		`NOTICE .* :` + fmt.Sprintf(aliasesNoAliases, aliasesNetworkScope)
+	err = rspChk(ts, check, u2host, aliases, channel)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoreCommands_Audit(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	old := &data.AuditEntry{
+		Time:      time.Now().AddDate(0, 0, -31),
+		NetworkID: netID,
+		Command:   access,
+	}
+	if err := ts.store.SaveAudit(old); err != nil {
+		t.Fatal(err)
+	}
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, auditNoEntries, u1host, audit, "--since", "1h")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, accessSuccess, u1host, access)
+	if err != nil {
+		t.Error(err)
+	}
+
+	check := auditHeadOne + `NOTICE .* :.* ` + auditPrivate + ` ` + u1nick +
+		` [` + u1user + `] ` + access + ` : ` + auditSucceeded
+	err = rspChk(ts, check, u1host, audit, "--command", access)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts.b.conf.Network(netID).SetAudit(config.AuditAll)
+	err = rspChk(ts, errMsgAuthed, u1host, auth, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	list, err := ts.store.AuditLog(data.AuditQuery{Command: auth})
+	if err != nil || len(list) != 1 {
+		t.Fatal("Expected the auth command to be recorded:", list, err)
+	}
+	if list[0].Arguments != auditRedacted || len(list[0].Result) == 0 {
+		t.Error("Expected redacted arguments and a result, got:", list[0])
+	}
+
+	check = fmt.Sprintf(auditStatsHead, 3) +
+		`NOTICE .* :` + access + ` +1 (0 failed)` +
+		`NOTICE .* :` + audit + ` +2 (0 failed)` +
+		`NOTICE .* :` + auth + ` +1 (1 failed)`
+	err = rspChk(ts, check, u1host, audit, "-s")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts.b.conf.Network(netID).SetAudit(config.AuditOff)
+	list, _ = ts.store.AuditLog(data.AuditQuery{})
+	if err = rspChk(ts, accessSuccess, u1host, access); err != nil {
+		t.Error(err)
+	}
+	after, _ := ts.store.AuditLog(data.AuditQuery{})
+	if len(after) != len(list) {
+		t.Error("Expected nothing to be recorded when auditing is off.")
+	}
+
+	for _, entry := range list {
+		if entry.Time.Before(time.Now().AddDate(0, 0, -30)) {
+			t.Error("Expected old entries to be pruned, got:", entry)
+		}
+	}
 }
 
 func TestCoreCommands_Gusers(t *testing.T) {
@@ -1042,3 +1394,144 @@ func TestCoreCommands_Users(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCoreCommands_Topics(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+	err = rspChk(ts, registerSuccess, u2host, register, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, topicsNone, u2host, topics, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.TOPIC, u2host, channel,
+		"first"))
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.TOPIC, u2host, channel,
+		"second"))
+
+	check := fmt.Sprintf(topicsHead, channel) + `NOTICE .* :` +
+		fmt.Sprintf(topicsListBy, 1, "first", u2nick, "%v")
+	err = rspChk(ts, check, u2host, topics, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, topicFailureNotOn, u2host, topics, "#other")
+	if err != nil {
+		t.Error(err)
+	}
+
+	flagsErr := cmd.MakeFlagsError(topicFlags).Error()
+	err = rspChk(ts, flagsErr, u2host, topiclock, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, topiclockSuccess, u1host, topiclock, channel)
+	if err != nil {
+		t.Error(err)
+	}
+	stored, err := ts.store.FindChannel(netID, channel)
+	if err != nil || stored == nil {
+		t.Fatal("Expected the channel to be stored:", err)
+	}
+	if locked, ok := stored.TopicLock(); !ok || locked != "second" {
+		t.Error("Expected the topic to be locked, got:", locked, ok)
+	}
+
+	ts.buffer.Reset()
+	err = ts.b.cmds.Dispatch(netID, "", ts.writer, irc.NewEvent(netID, netInfo,
+		irc.PRIVMSG, u1host, botnick, topicrestore+" "+channel), ts.locker)
+	ts.b.cmds.WaitForHandlers()
+	if exp := "TOPIC " + channel + " :first"; err != nil ||
+		ts.buffer.String() != exp {
+
+		t.Errorf("Expected: %v, got: %v (%v)", exp, ts.buffer.String(), err)
+	}
+	stored, err = ts.store.FindChannel(netID, channel)
+	if locked, ok := stored.TopicLock(); err != nil || locked != "first" {
+		t.Error("Expected the lock to move to the restored topic:", locked, ok)
+	}
+
+	err = rspChk(ts, topicrestoreFailure, u1host, topicrestore, channel, "5")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, topicunlockSuccess, u1host, topicunlock, channel)
+	if err != nil {
+		t.Error(err)
+	}
+	err = rspChk(ts, topicunlockFailure, u1host, topicunlock, channel)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoreCommands_Dumpstate(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	dir, err := ioutil.TempDir("", "ultimateq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ts.b.conf.SetStoreFile(filepath.Join(dir, "store.db"))
+
+	err = rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+	err = rspChk(ts, registerSuccess, u2host, register, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	flagsErr := cmd.MakeFlagsError("G").Error()
+	err = rspChk(ts, flagsErr, u2host, dumpstate, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, dumpstateFailure, u1host, dumpstate, "#other")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = rspChk(ts, dumpstateSuccess, u1host, dumpstate, channel)
+	if err != nil {
+		t.Error(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "state-*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatal("Expected one state file, got:", files, err)
+	}
+	js, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := &data.Snapshot{}
+	if err = json.Unmarshal(js, snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Channels) != 1 || snap.Channels[0].Name != channel {
+		t.Error("Expected only the channel to be dumped, got:", snap.Channels)
+	}
+	if len(snap.Users) != 2 {
+		t.Error("Expected the users on the channel, got:", snap.Users)
+	}
+	if snap.Self.Host != bothost {
+		t.Error("Expected self to be dumped, got:", snap.Self.Host)
+	}
+}
@@ -136,17 +136,61 @@ func (c *coreHandler) HandleRaw(w irc.Writer, ev *irc.Event) {
 		}
 		w.Send("NICK :" + nick)
 
+	case irc.PRIVMSG:
+		if ev.IsCTCP() {
+			c.bot.dccChatRequest(c.getServer(ev.NetworkID), ev)
+		}
+
 	case irc.JOIN:
 		server := c.getServer(ev.NetworkID)
 		server.protectState.RLock()
 		defer server.protectState.RUnlock()
 		if server.state != nil {
 			if ev.Sender == server.state.Self.Host() {
-				w.Send("WHO :", ev.Args[0])
+				server.syncChannel(w, ev.Args[0])
 				w.Send("MODE :", ev.Args[0])
 			}
 		}
 
+	case irc.SELFJOINED:
+		if server := c.getServer(ev.NetworkID); server != nil {
+			server.loadTopics(ev.Args[0])
+		}
+
+	case irc.TOPICCHANGED:
+		if server := c.getServer(ev.NetworkID); server != nil {
+			server.topicChanged(w, ev)
+		}
+
+	case irc.RPL_ENDOFWHO:
+		if len(ev.Args) < 2 {
+			break
+		}
+		if server := c.getServer(ev.NetworkID); server != nil {
+			server.endWho(w, ev.Args[1])
+		}
+
+	case irc.RPL_ENDOFMOTD, irc.ERR_NOMOTD:
+		if server := c.getServer(ev.NetworkID); server != nil {
+			server.startPresence(w)
+		}
+
+	case irc.RPL_MONONLINE, irc.RPL_MONOFFLINE, irc.ERR_MONLISTFULL,
+		irc.RPL_LOGON, irc.RPL_LOGOFF, irc.RPL_NOWON, irc.RPL_NOWOFF,
+		irc.ERR_TOOMANYWATCH, irc.RPL_ISON:
+
+		if server := c.getServer(ev.NetworkID); server != nil {
+			for _, presence := range server.presenceReply(ev) {
+				c.bot.dispatchMessage(server, presence)
+			}
+		}
+
+	case irc.DISCONNECT:
+		if server := c.getServer(ev.NetworkID); server != nil {
+			server.resetWho()
+			server.resetPresence()
+		}
+
 	case irc.RPL_MYINFO:
 		server := c.getServer(ev.NetworkID)
 		server.netInfo.ParseMyInfo(ev)
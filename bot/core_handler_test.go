@@ -228,3 +228,81 @@ func TestCoreHandler_Join(t *testing.T) {
 		t.Errorf("Expected: %s, got: %s", exp, got)
 	}
 }
+
+func TestCoreHandler_WhoSync(t *testing.T) {
+	connProvider := func(srv string) (net.Conn, error) {
+		return nil, nil
+	}
+
+	b, _ := createBot(fakeConfig, connProvider, nil, devNull, true, false)
+	srv := b.servers[netID]
+	srv.state.Self.User = data.NewUser("nick!user@host")
+	self := srv.state.Self.Host()
+
+	endpoint := makeTestPoint(nil)
+	handle := func(name string, args ...string) {
+		sender := self
+		if name == irc.RPL_ENDOFWHO {
+			sender = "irc.test.net"
+		}
+		ev := irc.NewEvent(netID, srv.netInfo, name, sender, args...)
+		srv.state.Update(ev)
+		srv.handler.HandleRaw(endpoint, ev)
+	}
+
+	handle(irc.JOIN, "#chan1")
+	handle(irc.JOIN, "#chan2")
+	exp := "WHO :#chan1MODE :#chan1MODE :#chan2"
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+
+	wait := b.WaitForSync(netID, "#CHAN1")
+	if wait == nil {
+		t.Fatal("Expected a channel to wait on.")
+	}
+	select {
+	case <-wait:
+		t.Error("Expected the channel not to be synced yet.")
+	default:
+	}
+
+	handle(irc.RPL_ENDOFWHO, "nick")
+	endpoint.resetTestWritten()
+	handle(irc.RPL_ENDOFWHO, "nick", "#chan1", "End of /WHO list.")
+	if got, exp := endpoint.gets(), "WHO :#chan2"; got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+	select {
+	case <-wait:
+	default:
+		t.Error("Expected the channel to be synced.")
+	}
+	select {
+	case <-b.WaitForSync(netID, "#chan1"):
+	default:
+		t.Error("Expected a synced channel not to be waited on.")
+	}
+
+	srv.netInfo.ParseISupport(irc.NewEvent(netID, srv.netInfo,
+		irc.RPL_ISUPPORT, "", "nick", "WHOX"))
+	endpoint.resetTestWritten()
+	handle(irc.JOIN, "#chan3")
+	handle(irc.RPL_ENDOFWHO, "nick", "#chan2", "End of /WHO list.")
+	exp = "MODE :#chan3WHO #chan3 " + data.WHOXFields
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+
+	endpoint.resetTestWritten()
+	handle(irc.DISCONNECT, netID)
+	handle(irc.JOIN, "#chan4")
+	exp = "WHO #chan4 " + data.WHOXFields + "MODE :#chan4"
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+
+	if b.WaitForSync("nonexistent", "#chan1") != nil {
+		t.Error("Expected no channel for an unknown network.")
+	}
+}
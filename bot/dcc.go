@@ -0,0 +1,415 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+const (
+	// dccTag is the CTCP tag of DCC requests.
+	dccTag = "DCC"
+	// dccMaxChats is how many DCC CHAT sessions may be open on a network at
+	// once.
+	dccMaxChats = 10
+	// dccMaxChatsPerHost is how many of those sessions may be with users
+	// from the same hostname.
+	dccMaxChatsPerHost = 2
+	// dccRequestInterval is how long a hostname must wait between requests
+	// for sessions.
+	dccRequestInterval = 10 * time.Second
+	// dccMaxLine is the longest line accepted in a DCC CHAT session.
+	dccMaxLine = 2048
+	// dccAuthAttempts is how many times a user may fail to authenticate
+	// before the session is closed.
+	dccAuthAttempts = 3
+	// dccSessionFormat is the host a session is authenticated under in the
+	// store, from the user's host and the number of the session. It can't be
+	// mistaken for a host on the network as those never have a ! after the @.
+	dccSessionFormat = "%s!dcc%d"
+
+	dccAuthPrompt = "To give commands authenticate: " +
+		"auth <password> [username]"
+	dccAuthed = "Authenticated as [%v], " +
+		"commands are given without a prefix."
+	dccAuthFailed  = "Error: Too many failed attempts to authenticate."
+	dccAuthTimeout = "Error: Timed out waiting to authenticate."
+	dccNoStore     = "Error: Authentication is unavailable."
+)
+
+var (
+	errDCCTooMany     = errors.New("bot: Too many DCC CHAT sessions")
+	errDCCTooManyHost = errors.New("bot: Too many DCC CHAT sessions " +
+		"from the hostname")
+	errDCCTooSoon = errors.New("bot: DCC CHAT requested too soon")
+)
+
+// dccRefusedNets are the ranges that aren't on the internet which aren't
+// covered by the checks net.IP has.
+var dccRefusedNets = parseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+)
+
+var (
+	// dccConnectTimeout is how long to wait when connecting to a user.
+	dccConnectTimeout = 30 * time.Second
+	// dccLoginTimeout is how long a user has to authenticate in a session.
+	dccLoginTimeout = time.Minute
+	// dccIdleTimeout is how long a session may be left idle before it's
+	// closed.
+	dccIdleTimeout = 30 * time.Minute
+)
+
+// dccChat is a DCC CHAT session between a user and the bot. Once the user
+// has authenticated with the store the lines they send are given to the cmds
+// as irc.DCCCHAT events, and anything written back to the user by the
+// commands is sent over the session.
+type dccChat struct {
+	bot    *Bot
+	server *Server
+	conn   net.Conn
+
+	// host is the user's full host when the session was requested.
+	host string
+	// session is the host the session is authenticated under in the store,
+	// and the sender of the events given to the cmds. Authenticating in the
+	// session doesn't authenticate the user's host on the network.
+	session string
+	// self is the nick the bot was sent the request on.
+	self string
+}
+
+// dccChatRequest starts a DCC CHAT session if the event is a request for one
+// on a network that accepts them. Only requests where the user is listening
+// are supported, the bot connects to the address given in the request.
+func (b *Bot) dccChatRequest(srv *Server, ev *irc.Event) {
+	if !ev.IsCTCP() || ev.IsTargetChan() {
+		return
+	}
+	tag, args := ev.UnpackCTCP()
+	if !strings.EqualFold(tag, dccTag) {
+		return
+	}
+	if enabled, _ := srv.conf.Network(srv.networkID).DCCChat(); !enabled {
+		return
+	}
+
+	addr, ok := parseDCCChat(args)
+	if !ok {
+		return
+	}
+	if !b.ReadStore(func(*data.Store) {}) {
+		return
+	}
+
+	chat := &dccChat{
+		bot:    b,
+		server: srv,
+		host:   ev.Sender,
+		self:   ev.Target(),
+	}
+	if err := srv.addDCCChat(chat); err != nil {
+		srv.Info("DCC CHAT refused", "host", ev.Sender, "err", err)
+		return
+	}
+
+	var conn net.Conn
+	var err error
+	if b.connProvider == nil {
+		conn, err = net.DialTimeout("tcp", addr, dccConnectTimeout)
+	} else {
+		conn, err = b.connProvider(addr)
+	}
+	if err != nil {
+		srv.removeDCCChat(chat)
+		srv.Info("DCC CHAT failed to connect", "host", ev.Sender,
+			"addr", addr, "err", err)
+		return
+	}
+	if !srv.startDCCChat(chat, conn) {
+		conn.Close()
+		return
+	}
+
+	srv.Info("DCC CHAT started", "host", ev.Sender, "addr", addr)
+	go chat.run()
+}
+
+// parseDCCChat parses the arguments of a DCC CHAT request into the address to
+// connect to: CHAT chat <address> <port>. The address may be an ip or an ipv4
+// address in its integer form. Addresses that aren't on the internet are
+// refused so users can't have the bot connect to its own network.
+func parseDCCChat(args string) (addr string, ok bool) {
+	fields := strings.Fields(args)
+	if len(fields) < 4 || !strings.EqualFold(fields[0], "CHAT") {
+		return "", false
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		n, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return "", false
+		}
+		ip = net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() ||
+		ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+
+		return "", false
+	}
+	for _, refused := range dccRefusedNets {
+		if refused.Contains(ip) {
+			return "", false
+		}
+	}
+
+	port, err := strconv.ParseUint(fields[3], 10, 16)
+	if err != nil || port == 0 {
+		return "", false
+	}
+
+	return net.JoinHostPort(ip.String(), fields[3]), true
+}
+
+// parseCIDRs parses ranges that are known to be valid.
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = ipnet
+	}
+	return nets
+}
+
+// run reads lines from the session until it's closed, the user must be
+// authenticated before a line is given to the cmds.
+func (d *dccChat) run() {
+	defer d.close()
+
+	networkID := d.server.networkID
+	writer := irc.Helper{Writer: d}
+	nick := irc.Nick(d.host)
+
+	scanner := bufio.NewScanner(d.conn)
+	scanner.Buffer(make([]byte, 0, 512), dccMaxLine)
+
+	var access *data.StoredUser
+	writer.Notice(nick, locale.Translate(d.lang(nil), dccAuthPrompt))
+
+	failures := 0
+	for {
+		timeout := dccIdleTimeout
+		if access == nil {
+			timeout = dccLoginTimeout
+		}
+		d.conn.SetReadDeadline(time.Now().Add(timeout))
+
+		if !scanner.Scan() {
+			err, ok := scanner.Err().(net.Error)
+			if ok && err.Timeout() && access == nil {
+				writer.Notice(nick,
+					locale.Translate(d.lang(nil), dccAuthTimeout))
+			}
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		if access = d.authedUser(); access != nil {
+			ev := irc.NewEvent(networkID, d.server.netInfo, irc.DCCCHAT,
+				d.session, d.self, line)
+			d.bot.cmds.Dispatch(networkID, "", writer, ev, d.bot)
+			d.server.cmds.Dispatch(networkID, "", writer, ev, d.bot)
+			continue
+		}
+
+		var err error
+		if access, err = d.auth(line); err != nil {
+			writer.Notice(nick, locale.ErrorString(d.lang(nil), err))
+			if failures++; failures >= dccAuthAttempts {
+				writer.Notice(nick,
+					locale.Translate(d.lang(nil), dccAuthFailed))
+				return
+			}
+			continue
+		}
+		writer.Noticef(nick, locale.Translate(d.lang(access), dccAuthed),
+			access.Username)
+	}
+}
+
+// auth authenticates the session with the store from a line of the form:
+// auth <password> [username]
+func (d *dccChat) auth(line string) (*data.StoredUser, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 ||
+		!strings.EqualFold(fields[0], auth) {
+
+		return nil, errors.New(dccAuthPrompt)
+	}
+
+	uname := strings.TrimLeft(irc.Username(d.host), "~")
+	if len(fields) == 3 {
+		uname = fields[2]
+	}
+
+	d.bot.protectStore.Lock()
+	defer d.bot.protectStore.Unlock()
+	if d.bot.store == nil {
+		return nil, errors.New(dccNoStore)
+	}
+	return d.bot.store.AuthSession(d.server.networkID, d.session, d.host,
+		uname, fields[1])
+}
+
+// authedUser looks up the user the session is authenticated as, nil if
+// there is none.
+func (d *dccChat) authedUser() (access *data.StoredUser) {
+	d.bot.ReadStore(func(store *data.Store) {
+		access = store.GetAuthedUser(d.server.networkID, d.session)
+	})
+	return access
+}
+
+// lang finds the language to send the session's own messages in.
+func (d *dccChat) lang(access *data.StoredUser) string {
+	if access != nil {
+		if lang := access.Locale(); len(lang) != 0 {
+			return lang
+		}
+	}
+	return d.bot.locales(d.server.networkID, "")
+}
+
+// Write sends the text of a PRIVMSG or NOTICE to the user over the session,
+// anything else is written to the network.
+func (d *dccChat) Write(buf []byte) (int, error) {
+	parts := strings.SplitN(string(buf), " ", 3)
+	isMsg := len(parts) == 3 &&
+		(parts[0] == irc.PRIVMSG || parts[0] == irc.NOTICE) &&
+		strings.EqualFold(parts[1], irc.Nick(d.host)) &&
+		strings.HasPrefix(parts[2], ":")
+
+	if isMsg && !irc.IsCTCPString(parts[2][1:]) {
+		if _, err := d.conn.Write([]byte(parts[2][1:] + "\n")); err != nil {
+			return 0, err
+		}
+		return len(buf), nil
+	}
+
+	return d.server.Write(buf)
+}
+
+// close closes the session's connection, logs it out and forgets about it.
+func (d *dccChat) close() {
+	d.conn.Close()
+
+	d.bot.protectStore.Lock()
+	if d.bot.store != nil {
+		d.bot.store.Logout(d.server.networkID, d.session)
+	}
+	d.bot.protectStore.Unlock()
+
+	d.server.removeDCCChat(d)
+
+	d.server.Info("DCC CHAT ended", "host", d.host)
+}
+
+// addDCCChat reserves a session on the server before the bot connects to the
+// user, an error if the user's hostname requested one too recently, or there
+// are too many sessions or too many with users from the same hostname.
+func (s *Server) addDCCChat(chat *dccChat) error {
+	s.protectDCC.Lock()
+	defer s.protectDCC.Unlock()
+
+	now := time.Now()
+	for host, last := range s.dccRequests {
+		if now.Sub(last) >= dccRequestInterval {
+			delete(s.dccRequests, host)
+		}
+	}
+
+	hostname := strings.ToLower(irc.Hostname(chat.host))
+	if _, ok := s.dccRequests[hostname]; ok {
+		return errDCCTooSoon
+	}
+	if s.dccRequests == nil {
+		s.dccRequests = make(map[string]time.Time)
+	}
+	s.dccRequests[hostname] = now
+
+	if len(s.dccChats) >= dccMaxChats {
+		return errDCCTooMany
+	}
+	sameHost := 0
+	for other := range s.dccChats {
+		if strings.EqualFold(irc.Hostname(other.host), hostname) {
+			sameHost++
+		}
+	}
+	if sameHost >= dccMaxChatsPerHost {
+		return errDCCTooManyHost
+	}
+	if s.dccChats == nil {
+		s.dccChats = make(map[*dccChat]struct{})
+	}
+	s.dccChats[chat] = struct{}{}
+	chat.session = fmt.Sprintf(dccSessionFormat, chat.host, s.dccSessions)
+	s.dccSessions++
+	return nil
+}
+
+// startDCCChat gives a reserved session its connection, false if the session
+// was closed while connecting.
+func (s *Server) startDCCChat(chat *dccChat, conn net.Conn) bool {
+	s.protectDCC.Lock()
+	defer s.protectDCC.Unlock()
+
+	if _, ok := s.dccChats[chat]; !ok {
+		return false
+	}
+	chat.conn = conn
+	return true
+}
+
+// removeDCCChat removes a session from the server.
+func (s *Server) removeDCCChat(chat *dccChat) {
+	s.protectDCC.Lock()
+	defer s.protectDCC.Unlock()
+
+	delete(s.dccChats, chat)
+}
+
+// closeDCCChats closes all of the server's sessions, those still connecting
+// are forgotten so they're never started.
+func (s *Server) closeDCCChats() {
+	s.protectDCC.Lock()
+	defer s.protectDCC.Unlock()
+
+	for chat := range s.dccChats {
+		if chat.conn == nil {
+			delete(s.dccChats, chat)
+			continue
+		}
+		chat.conn.Close()
+	}
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestDCC_Parse(t *testing.T) {
+	t.Parallel()
+
+	var table = []struct {
+		Args string
+		Addr string
+		OK   bool
+	}{
+		{"CHAT chat 3405803777 5000", "203.0.113.1:5000", true},
+		{"chat chat 198.51.100.1 5000", "198.51.100.1:5000", true},
+		{"CHAT chat 2001:db8::1 5000", "[2001:db8::1]:5000", true},
+		{"CHAT chat 3405803777 0 123", "", false},
+		{"CHAT chat 2130706433 5000", "", false},
+		{"CHAT chat 0.0.0.0 5000", "", false},
+		{"CHAT chat 3232235777 5000", "", false},
+		{"CHAT chat 10.0.0.1 5000", "", false},
+		{"CHAT chat 172.16.0.1 5000", "", false},
+		{"CHAT chat 169.254.169.254 5000", "", false},
+		{"CHAT chat 100.64.0.1 5000", "", false},
+		{"CHAT chat 0.1.2.3 5000", "", false},
+		{"CHAT chat 255.255.255.255 5000", "", false},
+		{"CHAT chat fd00::1 5000", "", false},
+		{"CHAT chat fe80::1 5000", "", false},
+		{"CHAT chat host.com 5000", "", false},
+		{"CHAT chat 3405803777 70000", "", false},
+		{"SEND file 3405803777 5000", "", false},
+		{"CHAT chat 3405803777", "", false},
+	}
+
+	for _, test := range table {
+		addr, ok := parseDCCChat(test.Args)
+		if addr != test.Addr || ok != test.OK {
+			t.Errorf("%q: Expected: %v %v got: %v %v",
+				test.Args, test.Addr, test.OK, addr, ok)
+		}
+	}
+}
+
+func TestDCC_MaxChats(t *testing.T) {
+	t.Parallel()
+	b, _ := createBot(fakeConfig, nil, nil, devNull, false, false)
+	srv := b.servers[netID]
+
+	add := func(host string, expect error) {
+		t.Helper()
+		// Each test request is from a new hostname or after the interval.
+		srv.dccRequests = nil
+		if err := srv.addDCCChat(&dccChat{host: host}); err != expect {
+			t.Errorf("%v: Expected: %v got: %v", host, expect, err)
+		}
+	}
+
+	for i := 0; i < dccMaxChatsPerHost; i++ {
+		add(fmt.Sprintf("nick%d!user@same.host", i), nil)
+	}
+	add("other!user@SAME.host", errDCCTooManyHost)
+
+	for i := dccMaxChatsPerHost; i < dccMaxChats; i++ {
+		add(fmt.Sprintf("nick%d!user@host%d", i, i), nil)
+	}
+	add("last!user@last.host", errDCCTooMany)
+}
+
+func TestDCC_RequestInterval(t *testing.T) {
+	t.Parallel()
+	b, _ := createBot(fakeConfig, nil, nil, devNull, false, false)
+	srv := b.servers[netID]
+
+	if err := srv.addDCCChat(&dccChat{host: "a!user@flood.host"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	err := srv.addDCCChat(&dccChat{host: "b!user@FLOOD.host"})
+	if err != errDCCTooSoon {
+		t.Error("Expected the second request to be too soon, got:", err)
+	}
+	if err := srv.addDCCChat(&dccChat{host: "a!user@other.host"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	srv.dccRequests["flood.host"] = time.Now().Add(-dccRequestInterval)
+	if err := srv.addDCCChat(&dccChat{host: "a!user@flood.host"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestDCC_ReservedBeforeConnecting(t *testing.T) {
+	t.Parallel()
+	conf := fakeConfig.Clone()
+	conf.Network("").SetNoStore(false).SetDCCChat(true)
+
+	b, err := createBot(conf, nil,
+		func(_ string) (*data.Store, error) {
+			return data.NewStore(data.MemStoreProvider)
+		}, devNull, true, false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	srv := b.servers[netID]
+
+	open := func() int {
+		srv.protectDCC.Lock()
+		defer srv.protectDCC.Unlock()
+		return len(srv.dccChats)
+	}
+
+	dials := 0
+	b.connProvider = func(addr string) (net.Conn, error) {
+		dials++
+		if open() != 1 {
+			t.Error("Expected the session to be reserved while connecting.")
+		}
+		return nil, errors.New("refused")
+	}
+
+	request := func(host string) {
+		ev := irc.NewEvent(netID, netInfo, irc.PRIVMSG, host, botnick,
+			irc.CTCPpackString(dccTag, "CHAT chat 3405803777 5000"))
+		b.dccChatRequest(srv, ev)
+	}
+
+	request("nick!user@host")
+	if dials != 1 {
+		t.Error("Expected a connection attempt, got:", dials)
+	}
+	if n := open(); n != 0 {
+		t.Error("Expected the session to be released, got:", n)
+	}
+
+	request("nick!user@host")
+	if dials != 1 {
+		t.Error("Expected no connection attempt too soon, got:", dials)
+	}
+
+	for i := 0; i < dccMaxChats; i++ {
+		srv.addDCCChat(&dccChat{host: fmt.Sprintf("n!u@full%d", i)})
+	}
+	request("nick!user@another.host")
+	if dials != 1 {
+		t.Error("Expected no connection attempt when full, got:", dials)
+	}
+}
+
+func TestDCC_Chat(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+	ts.store.Logout(netID, u1host)
+
+	srv := ts.b.servers[netID]
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	var dialed string
+	ts.b.connProvider = func(addr string) (net.Conn, error) {
+		dialed = addr
+		return conn, nil
+	}
+
+	request := irc.NewEvent(netID, netInfo, irc.PRIVMSG, u1host, botnick,
+		irc.CTCPpackString(dccTag, "CHAT chat 3405803777 5000"))
+
+	srv.handler.HandleRaw(ts.writer, request)
+	if len(dialed) != 0 {
+		t.Error("Expected no connection when DCC CHAT is disabled.")
+	}
+
+	ts.b.conf.Network(netID).SetDCCChat(true).
+		SetUnknownCmds(config.UnknownCmdsPrivate)
+	srv.handler.HandleRaw(ts.writer, request)
+	if dialed != "203.0.113.1:5000" {
+		t.Error("Expected a connection to the requested address, got:", dialed)
+	}
+
+	reader := bufio.NewReader(client)
+	chat := func(send, expect string) {
+		if len(send) != 0 {
+			fmt.Fprintln(client, send)
+		}
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Errorf("%q: Unexpected error: %v", send, err)
+		} else if line = strings.TrimSpace(line); line != expect {
+			t.Errorf("%q: Expected: %q got: %q", send, expect, line)
+		}
+	}
+
+	chat("", dccAuthPrompt)
+	chat(setlocale, dccAuthPrompt)
+	chat("auth "+password+" "+u1user, fmt.Sprintf(dccAuthed, u1user))
+	session := fmt.Sprintf(dccSessionFormat, u1host, 0)
+	if ts.store.GetAuthedUser(netID, session) == nil {
+		t.Error("Expected the session to be authenticated.")
+	}
+	if ts.store.GetAuthedUser(netID, u1host) != nil {
+		t.Error("Expected the user not to be authenticated on the network.")
+	}
+	chat(setlocale, fmt.Sprintf(setlocaleCurrent, "en"))
+	chat("nocommand", `Error: Command not found (nocommand), try "help".`)
+
+	client.Close()
+	for i := 0; i < 100; i++ {
+		srv.protectDCC.Lock()
+		open := len(srv.dccChats)
+		srv.protectDCC.Unlock()
+		if open == 0 {
+			if ts.store.GetAuthedUser(netID, session) != nil {
+				t.Error("Expected the session to be logged out.")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the session to be closed.")
+}
@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"sort"
+
+	"github.com/aarondl/ultimateq/data"
+)
+
+// Identity finds the users on all the bot's networks that are the same
+// person as a user on one of them, see data.Correlate. It's nil if the
+// network is unknown, its state is disabled or the user is not known to it.
+//
+// The states of all networks are locked for reading, and then the store, so
+// it must not be called while holding any of them, as a command handler does
+// until its event is closed.
+func (b *Bot) Identity(networkID, nickorhost string) *data.Identity {
+	b.protectServers.RLock()
+	servers := make([]*Server, 0, len(b.servers))
+	for _, s := range b.servers {
+		servers = append(servers, s)
+	}
+	b.protectServers.RUnlock()
+
+	// The states are always locked in the same order.
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].networkID < servers[j].networkID
+	})
+
+	states := make(map[string]*data.State, len(servers))
+	for _, s := range servers {
+		s.protectState.RLock()
+		defer s.protectState.RUnlock()
+		if s.state != nil {
+			states[s.networkID] = s.state
+		}
+	}
+
+	b.protectStore.RLock()
+	defer b.protectStore.RUnlock()
+
+	return data.Correlate(networkID, nickorhost, states, b.store)
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestBot_Identity(t *testing.T) {
+	t.Parallel()
+
+	conf := fakeConfig.Clone()
+	conf.NewNetwork("other").SetServers([]string{"irc.other.net"})
+	b, err := createBot(conf, nil, func(_ string) (*data.Store, error) {
+		return data.NewStore(data.MemStoreProvider)
+	}, devNull, false, false)
+	if err != nil {
+		t.Fatal("Unexpected err:", err)
+	}
+	defer b.Close()
+
+	for network, host := range map[string]string{
+		netID: u1host, "other": "bobby!b@b.net",
+	} {
+		st := b.servers[network].state
+		st.Update(irc.NewEvent(network, netInfo, irc.RPL_WELCOME, "", "Hi",
+			bothost))
+		st.Update(irc.NewEvent(network, netInfo, irc.JOIN, bothost, channel))
+		st.Update(irc.NewEvent(network, netInfo, irc.JOIN, host, channel))
+		st.GetUser(host).SetAccount("account")
+	}
+
+	if b.Identity("nonexistent", u1nick) != nil {
+		t.Error("Expected no identity on an unknown network.")
+	}
+
+	id := b.Identity(netID, u1nick)
+	if id == nil {
+		t.Fatal("Expected an identity.")
+	}
+	if len(id.Users) != 2 || id.Users[0].Host != u1host ||
+		id.Users[1].NetworkID != "other" {
+
+		t.Error("Expected the user on both networks, got:", id.Users)
+	}
+}
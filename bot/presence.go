@@ -0,0 +1,426 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+const (
+	// monitorSupport and watchSupport are the ISUPPORT tokens of servers
+	// that understand MONITOR and WATCH, their values are the most nicks
+	// that may be tracked.
+	monitorSupport = "MONITOR"
+	watchSupport   = "WATCH"
+
+	// presenceLineLength is how long the list of nicks in a single MONITOR,
+	// WATCH or ISON may be.
+	presenceLineLength = 400
+
+	errPresenceLoad = "bot: Failed to load the nicks of stored users"
+	errPresenceFull = "bot: Presence list is full, nicks are not tracked"
+)
+
+// How the presence of users is tracked on a network.
+const (
+	presenceOff = iota
+	presenceMonitor
+	presenceWatch
+	presenceISON
+)
+
+// presencePoll is how often ISON is sent on networks that support neither
+// MONITOR nor WATCH.
+var presencePoll = 60 * time.Second
+
+// presence keeps track of which of the nicks of the stored users and the
+// nicks extensions have asked about are online. Nicks are keyed by their
+// lowercased form.
+type presence struct {
+	method int
+	limit  int
+
+	stored  map[string]string
+	watched map[string]string
+	// tracked are the nicks in the server's MONITOR or WATCH list.
+	tracked map[string]bool
+	online  map[string]bool
+	// isons are the nicks asked about in each ISON that's not been answered.
+	isons [][]string
+	stop  chan struct{}
+}
+
+// startPresence starts tracking the presence of users once the server has
+// been connected to, using the best method the server supports.
+func (s *Server) startPresence(w irc.Writer) {
+	stored := s.storedNicks()
+
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	if stored != nil {
+		s.presence.stored = stored
+	}
+	if s.presence.method != presenceOff {
+		s.syncPresence(w)
+		return
+	}
+
+	s.presence.limit = 0
+	if monitor := s.netInfo.Extra(monitorSupport); len(monitor) != 0 {
+		s.presence.method = presenceMonitor
+		s.presence.limit, _ = strconv.Atoi(monitor)
+	} else if watch := s.netInfo.Extra(watchSupport); len(watch) != 0 {
+		s.presence.method = presenceWatch
+		s.presence.limit, _ = strconv.Atoi(watch)
+	} else {
+		s.presence.method = presenceISON
+		stop := make(chan struct{})
+		s.presence.stop = stop
+		go s.pollPresence(w, stop)
+	}
+
+	s.syncPresence(w)
+}
+
+// storedNicks loads the nicks of the stored users, nil if they can't be.
+func (s *Server) storedNicks() map[string]string {
+	s.bot.protectStore.RLock()
+	defer s.bot.protectStore.RUnlock()
+
+	if s.bot.store == nil {
+		return nil
+	}
+	users, err := s.bot.store.Users()
+	if err != nil {
+		s.Error(errPresenceLoad, "err", err)
+		return nil
+	}
+
+	nicks := make(map[string]string)
+	for _, user := range users {
+		for _, nick := range user.Nicks() {
+			nicks[strings.ToLower(nick)] = nick
+		}
+	}
+	return nicks
+}
+
+// refreshPresence reloads the nicks of the stored users after they've
+// changed.
+func (s *Server) refreshPresence() {
+	stored := s.storedNicks()
+	if stored == nil {
+		return
+	}
+
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	s.presence.stored = stored
+	s.syncPresence(s.writer)
+}
+
+// wantedNicks are the nicks that should be tracked, those asked about by
+// extensions first, cut down to the server's limit. protectPresence must be
+// held.
+func (s *Server) wantedNicks() []string {
+	var nicks, stored []string
+	for _, nick := range s.presence.watched {
+		nicks = append(nicks, nick)
+	}
+	for key, nick := range s.presence.stored {
+		if _, ok := s.presence.watched[key]; !ok {
+			stored = append(stored, nick)
+		}
+	}
+	sort.Strings(nicks)
+	sort.Strings(stored)
+	nicks = append(nicks, stored...)
+
+	if s.presence.limit > 0 && len(nicks) > s.presence.limit {
+		s.Warn(errPresenceFull, "limit", s.presence.limit,
+			"nicks", strings.Join(nicks[s.presence.limit:], " "))
+		nicks = nicks[:s.presence.limit]
+	}
+	return nicks
+}
+
+// syncPresence makes the server's MONITOR or WATCH list match the nicks that
+// should be tracked, and forgets whether nicks that are no longer tracked are
+// online. protectPresence must be held.
+func (s *Server) syncPresence(w irc.Writer) {
+	if s.presence.method == presenceOff {
+		return
+	}
+
+	wanted := make(map[string]bool)
+	var adds, removes []string
+	for _, nick := range s.wantedNicks() {
+		key := strings.ToLower(nick)
+		wanted[key] = true
+		if !s.presence.tracked[key] {
+			adds = append(adds, nick)
+		}
+	}
+	for key := range s.presence.online {
+		if !wanted[key] {
+			delete(s.presence.online, key)
+		}
+	}
+	if s.presence.method == presenceISON {
+		return
+	}
+
+	for key := range s.presence.tracked {
+		if !wanted[key] {
+			removes = append(removes, key)
+		}
+	}
+	sort.Strings(removes)
+
+	if s.presence.tracked == nil {
+		s.presence.tracked = make(map[string]bool)
+	}
+	for _, nick := range removes {
+		delete(s.presence.tracked, nick)
+	}
+	for _, nick := range adds {
+		s.presence.tracked[strings.ToLower(nick)] = true
+	}
+
+	if s.presence.method == presenceMonitor {
+		for _, line := range joinNicks(removes, "", ",") {
+			w.Send("MONITOR - ", line)
+		}
+		for _, line := range joinNicks(adds, "", ",") {
+			w.Send("MONITOR + ", line)
+		}
+	} else {
+		for _, line := range joinNicks(removes, "-", " ") {
+			w.Send("WATCH ", line)
+		}
+		for _, line := range joinNicks(adds, "+", " ") {
+			w.Send("WATCH ", line)
+		}
+	}
+}
+
+// pollPresence sends ISONs for the nicks that should be tracked until it's
+// stopped.
+func (s *Server) pollPresence(w irc.Writer, stop chan struct{}) {
+	ticker := time.NewTicker(presencePoll)
+	defer ticker.Stop()
+
+	for {
+		s.protectPresence.Lock()
+		for _, line := range joinNicks(s.wantedNicks(), "", " ") {
+			s.presence.isons = append(s.presence.isons, strings.Fields(line))
+			w.Send("ISON :", line)
+		}
+		s.protectPresence.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// presenceReply updates which users are online from a reply to MONITOR,
+// WATCH or ISON, and returns the presence events to dispatch for the users
+// that came online or went offline.
+func (s *Server) presenceReply(ev *irc.Event) []*irc.Event {
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	var events []*irc.Event
+	online := func(nick, host string, on bool) {
+		key := strings.ToLower(nick)
+		was, known := s.presence.online[key]
+		if s.presence.online == nil {
+			s.presence.online = make(map[string]bool)
+		}
+		s.presence.online[key] = on
+		if was == on || (!known && !on) {
+			return
+		}
+
+		name := irc.USEROFFLINE
+		if on {
+			name = irc.USERONLINE
+		}
+		if len(host) == 0 {
+			host = nick
+		}
+		events = append(events,
+			irc.NewEvent(ev.NetworkID, ev.NetworkInfo, name, host, nick))
+	}
+
+	switch {
+	case len(ev.Args) < 2:
+		return nil
+	case ev.Name == irc.ERR_MONLISTFULL && len(ev.Args) < 3,
+		(ev.Name == irc.RPL_LOGON || ev.Name == irc.RPL_NOWON) &&
+			len(ev.Args) < 4:
+		return nil
+	}
+
+	switch ev.Name {
+	case irc.RPL_MONONLINE:
+		for _, host := range strings.Split(ev.Args[1], ",") {
+			online(irc.Nick(host), host, true)
+		}
+	case irc.RPL_MONOFFLINE:
+		for _, nick := range strings.Split(ev.Args[1], ",") {
+			online(nick, "", false)
+		}
+	case irc.ERR_MONLISTFULL:
+		for _, nick := range strings.Split(ev.Args[2], ",") {
+			delete(s.presence.tracked, strings.ToLower(nick))
+		}
+		s.Warn(errPresenceFull, "limit", ev.Args[1], "nicks", ev.Args[2])
+	case irc.RPL_LOGON, irc.RPL_NOWON:
+		online(ev.Args[1], ev.Args[1]+"!"+ev.Args[2]+"@"+ev.Args[3], true)
+	case irc.RPL_LOGOFF, irc.RPL_NOWOFF:
+		online(ev.Args[1], "", false)
+	case irc.ERR_TOOMANYWATCH:
+		delete(s.presence.tracked, strings.ToLower(ev.Args[1]))
+		s.Warn(errPresenceFull, "nicks", ev.Args[1])
+	case irc.RPL_ISON:
+		if len(s.presence.isons) == 0 {
+			break
+		}
+		asked := s.presence.isons[0]
+		s.presence.isons = s.presence.isons[1:]
+
+		on := make(map[string]bool)
+		for _, nick := range strings.Fields(ev.Args[1]) {
+			on[strings.ToLower(nick)] = true
+		}
+		for _, nick := range asked {
+			online(nick, "", on[strings.ToLower(nick)])
+		}
+	}
+
+	return events
+}
+
+// resetPresence forgets what's known about who's online when the server
+// disconnects, the nicks are tracked again once it reconnects.
+func (s *Server) resetPresence() {
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	if s.presence.stop != nil {
+		close(s.presence.stop)
+		s.presence.stop = nil
+	}
+	s.presence.method = presenceOff
+	s.presence.tracked = nil
+	s.presence.online = nil
+	s.presence.isons = nil
+}
+
+// watch adds or removes nicks from the nicks extensions want to know the
+// presence of.
+func (s *Server) watch(add bool, nicks []string) {
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	if s.presence.watched == nil {
+		s.presence.watched = make(map[string]string)
+	}
+	for _, nick := range nicks {
+		if add {
+			s.presence.watched[strings.ToLower(nick)] = nick
+		} else {
+			delete(s.presence.watched, strings.ToLower(nick))
+		}
+	}
+	s.syncPresence(s.writer)
+}
+
+// joinNicks joins nicks into lines no longer than presenceLineLength, each
+// nick having the prefix and being separated by sep.
+func joinNicks(nicks []string, prefix, sep string) []string {
+	var lines []string
+	var line string
+	for _, nick := range nicks {
+		if len(line) != 0 &&
+			len(line)+len(sep)+len(prefix)+len(nick) > presenceLineLength {
+
+			lines = append(lines, line)
+			line = ""
+		}
+		if len(line) != 0 {
+			line += sep
+		}
+		line += prefix + nick
+	}
+	if len(line) != 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Watch tracks whether users are online on a network, by nick. USERONLINE
+// and USEROFFLINE events are dispatched when they come online or go offline.
+// The nicks of the stored users are always tracked. The returned boolean is
+// whether or not the network is known.
+func (b *Bot) Watch(networkID string, nicks ...string) bool {
+	s := b.getServer(networkID)
+	if s == nil {
+		return false
+	}
+
+	s.watch(true, nicks)
+	return true
+}
+
+// Unwatch stops tracking whether users are online on a network, unless
+// they're stored users. The returned boolean is whether or not the network
+// is known.
+func (b *Bot) Unwatch(networkID string, nicks ...string) bool {
+	s := b.getServer(networkID)
+	if s == nil {
+		return false
+	}
+
+	s.watch(false, nicks)
+	return true
+}
+
+// IsOnline checks if a user being tracked is online on a network. known is
+// false if the user is not tracked or it's not yet known if they're online.
+func (b *Bot) IsOnline(networkID, nick string) (online, known bool) {
+	s := b.getServer(networkID)
+	if s == nil {
+		return false, false
+	}
+
+	s.protectPresence.Lock()
+	defer s.protectPresence.Unlock()
+
+	online, known = s.presence.online[strings.ToLower(nick)]
+	return online, known
+}
+
+// refreshPresence reloads the nicks of the stored users on all networks
+// after they've changed.
+func (b *Bot) refreshPresence() {
+	b.protectServers.RLock()
+	servers := make([]*Server, 0, len(b.servers))
+	for _, s := range b.servers {
+		servers = append(servers, s)
+	}
+	b.protectServers.RUnlock()
+
+	for _, s := range servers {
+		s.refreshPresence()
+	}
+}
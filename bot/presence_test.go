@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func presenceSetup(t *testing.T, support string) (*Bot, *Server,
+	*testPoint) {
+
+	conf := fakeConfig.Clone()
+	conf.Network("").SetNoStore(false)
+
+	b, err := createBot(conf, nil,
+		func(_ string) (*data.Store, error) {
+			return data.NewStore(data.MemStoreProvider)
+		}, devNull, true, false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	user, err := data.NewStoredUser("bob", password, "carl!*@*", "*!*@x")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = b.store.SaveUser(user); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	srv := b.servers[netID]
+	if len(support) != 0 {
+		srv.netInfo.ParseISupport(irc.NewEvent(netID, srv.netInfo,
+			irc.RPL_ISUPPORT, "", "nick", support))
+	}
+	endpoint := makeTestPoint(srv)
+	srv.writer = endpoint
+	return b, srv, endpoint
+}
+
+func TestPresence_Monitor(t *testing.T) {
+	t.Parallel()
+	b, srv, endpoint := presenceSetup(t, "MONITOR=3")
+	defer b.Close()
+
+	if !b.Watch(netID, "alice", "Dave") || b.Watch("nonexistent", "x") {
+		t.Error("Expected only the known network to be watched on.")
+	}
+	if got := endpoint.gets(); len(got) != 0 {
+		t.Error("Expected nothing to be sent before connecting, got:", got)
+	}
+
+	srv.handler.HandleRaw(endpoint, irc.NewEvent(netID, srv.netInfo,
+		irc.RPL_ENDOFMOTD, "irc.test.net", botnick, "End of MOTD"))
+	exp := "MONITOR + Dave,alice,bob"
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+
+	reply := func(name string, args ...string) []*irc.Event {
+		return srv.presenceReply(irc.NewEvent(netID, srv.netInfo, name,
+			"irc.test.net", append([]string{botnick}, args...)...))
+	}
+
+	if _, known := b.IsOnline(netID, "alice"); known {
+		t.Error("Expected alice's presence not to be known yet.")
+	}
+	evs := reply(irc.RPL_MONONLINE, "alice!a@a.net,dave!d@d.net")
+	if len(evs) != 2 || evs[0].Name != irc.USERONLINE ||
+		evs[0].Sender != "alice!a@a.net" || evs[0].Args[0] != "alice" {
+
+		t.Error("Expected online events, got:", evs)
+	}
+	if online, known := b.IsOnline(netID, "ALICE"); !online || !known {
+		t.Error("Expected alice to be online.")
+	}
+	if evs = reply(irc.RPL_MONONLINE, "alice!a@a.net"); len(evs) != 0 {
+		t.Error("Expected no event for a user already online, got:", evs)
+	}
+	if evs = reply(irc.RPL_MONOFFLINE, "bob"); len(evs) != 0 {
+		t.Error("Expected no event for a user not known online, got:", evs)
+	}
+	if online, known := b.IsOnline(netID, "bob"); online || !known {
+		t.Error("Expected bob to be offline.")
+	}
+	evs = reply(irc.RPL_MONOFFLINE, "alice")
+	if len(evs) != 1 || evs[0].Name != irc.USEROFFLINE ||
+		evs[0].Sender != "alice" {
+
+		t.Error("Expected an offline event, got:", evs)
+	}
+	if evs = reply(irc.RPL_MONONLINE); evs != nil {
+		t.Error("Expected no events from a short reply, got:", evs)
+	}
+
+	endpoint.resetTestWritten()
+	b.Unwatch(netID, "dave")
+	exp = "MONITOR - daveMONITOR + carl"
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+	if _, known := b.IsOnline(netID, "dave"); known {
+		t.Error("Expected dave to be forgotten once untracked.")
+	}
+
+	srv.handler.HandleRaw(endpoint, irc.NewEvent(netID, srv.netInfo,
+		irc.DISCONNECT, "", netID))
+	if _, known := b.IsOnline(netID, "bob"); known {
+		t.Error("Expected presence to be forgotten on disconnect.")
+	}
+}
+
+func TestPresence_Watch(t *testing.T) {
+	t.Parallel()
+	b, srv, endpoint := presenceSetup(t, "WATCH=128")
+	defer b.Close()
+
+	srv.startPresence(endpoint)
+	exp := "WATCH +bob +carl"
+	if got := endpoint.gets(); got != exp {
+		t.Errorf("Expected: %s, got: %s", exp, got)
+	}
+
+	reply := func(name string, args ...string) []*irc.Event {
+		return srv.presenceReply(irc.NewEvent(netID, srv.netInfo, name,
+			"irc.test.net", append([]string{botnick}, args...)...))
+	}
+
+	evs := reply(irc.RPL_NOWON, "bob", "b", "b.net", "0", "is online")
+	if len(evs) != 1 || evs[0].Sender != "bob!b@b.net" {
+		t.Error("Expected an online event, got:", evs)
+	}
+	evs = reply(irc.RPL_LOGOFF, "bob", "b", "b.net", "0", "logged offline")
+	if len(evs) != 1 || evs[0].Name != irc.USEROFFLINE {
+		t.Error("Expected an offline event, got:", evs)
+	}
+	if evs = reply(irc.RPL_LOGON, "carl"); evs != nil {
+		t.Error("Expected no events from a short reply, got:", evs)
+	}
+}
+
+func TestPresence_ISON(t *testing.T) {
+	presencePoll = time.Millisecond
+	defer func() { presencePoll = 60 * time.Second }()
+
+	b, srv, endpoint := presenceSetup(t, "")
+	defer b.Close()
+
+	srv.protectPresence.Lock()
+	srv.presence.method = presenceISON
+	srv.presence.stored = srv.storedNicks()
+	srv.protectPresence.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		srv.pollPresence(endpoint, stop)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-done
+
+	if got := endpoint.gets(); !strings.HasPrefix(got, "ISON :bob carl") {
+		t.Error("Expected ISONs to be sent, got:", got)
+	}
+
+	evs := srv.presenceReply(irc.NewEvent(netID, srv.netInfo, irc.RPL_ISON,
+		"irc.test.net", botnick, "Carl"))
+	if len(evs) != 1 || evs[0].Args[0] != "carl" {
+		t.Error("Expected carl to come online, got:", evs)
+	}
+	if online, known := b.IsOnline(netID, "bob"); online || !known {
+		t.Error("Expected bob to be offline.")
+	}
+}
+
+func TestPresence_joinNicks(t *testing.T) {
+	t.Parallel()
+
+	if lines := joinNicks(nil, "+", " "); lines != nil {
+		t.Error("Expected no lines, got:", lines)
+	}
+
+	nick := strings.Repeat("n", 150)
+	lines := joinNicks([]string{nick, nick, nick}, "+", " ")
+	if len(lines) != 2 || lines[0] != "+"+nick+" +"+nick ||
+		lines[1] != "+"+nick {
+
+		t.Error("Expected the nicks to be split over two lines, got:", lines)
+	}
+}
@@ -35,6 +35,8 @@ const (
 	// errServerAlreadyConnected occurs if a server has not been shutdown
 	// before another attempt to connect to it is made.
 	errFmtAlreadyConnected = "bot: %v already connected.\n"
+	// errSaveSeen is logged when a user's last activity can't be saved.
+	errSaveSeen = "bot: Failed to save seen record"
 )
 
 var (
@@ -95,6 +97,21 @@ type Server struct {
 
 	// protects the state from reading and writing.
 	protectState sync.RWMutex
+
+	// DCC CHAT sessions with users, how many there have been, when each
+	// hostname last requested one, and their protection.
+	dccChats    map[*dccChat]struct{}
+	dccSessions uint
+	dccRequests map[string]time.Time
+	protectDCC  sync.Mutex
+
+	// WHOs sent to sync the channels joined, and their protection.
+	who        whoSync
+	protectWho sync.Mutex
+
+	// Who's online of the users being tracked, and its protection.
+	presence        presence
+	protectPresence sync.Mutex
 }
 
 // Write writes to the server's IrcClient.
@@ -113,18 +130,56 @@ func (s *Server) Write(buf []byte) (int, error) {
 }
 
 // createDispatcher uses the server's current ProtoCaps to create a dispatcher.
-func (s *Server) createDispatching(prefix rune, channels []string) {
+func (s *Server) createDispatching(prefix string, sequential bool,
+	channels []string) {
+
 	s.dispatchCore = dispatch.NewDispatchCore(s.Logger, channels...)
 	s.dispatcher = dispatch.NewDispatcher(s.dispatchCore)
+	s.dispatcher.SetSequential(sequential)
 	s.cmds = cmd.NewCmds(prefix, s.dispatchCore)
+	s.cmds.SetSequential(sequential)
 }
 
 // createState uses the server's current ProtoCaps to create a state.
 func (s *Server) createState() (err error) {
 	s.state, err = data.NewState(s.netInfo)
+	if err == nil {
+		s.state.SetSeen(true)
+		s.setScrollback(s.conf.Network(s.networkID))
+	}
 	return err
 }
 
+// setScrollback sets the state's scrollback limits from the network's config.
+// The state must be locked for writing.
+func (s *Server) setScrollback(cfg *config.NetCTX) {
+	lines, _ := cfg.Scrollback()
+	bytes, _ := cfg.ScrollbackBytes()
+	s.state.SetScrollback(lines, bytes)
+}
+
+// saveSeen remembers the last activity of users who have left in the store
+// so it survives the state forgetting about them. The state must not be
+// locked, so a netsplit's worth of saves doesn't hold up the network's
+// commands.
+func (s *Server) saveSeen(seens []*data.StoredSeen) {
+	if len(seens) == 0 {
+		return
+	}
+
+	s.bot.protectStore.Lock()
+	defer s.bot.protectStore.Unlock()
+
+	if s.bot.store == nil {
+		return
+	}
+	for _, seen := range seens {
+		if err := s.bot.store.SaveSeen(s.networkID, seen); err != nil {
+			s.Error(errSaveSeen, "nick", seen.Nick, "err", err)
+		}
+	}
+}
+
 // createIrcClient connects to the configured server, and creates an IrcClient
 // for use with that connection.
 func (s *Server) createIrcClient() (error, bool) {
@@ -3,11 +3,13 @@ package bot
 import (
 	"bytes"
 	"crypto/x509"
+	"fmt"
 	"io"
 	"net"
 	"testing"
 	"time"
 
+	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/irc"
 	"github.com/aarondl/ultimateq/mocks"
 )
@@ -236,3 +238,131 @@ func TestServer_Write(t *testing.T) {
 	for _ = range end {
 	}
 }
+
+func TestServer_saveSeen(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+
+	srv := ts.b.servers[netID]
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.PRIVMSG, u1host, channel,
+		"hello"))
+	_, seens := ts.state.Update(irc.NewEvent(netID, netInfo, irc.QUIT, u1host,
+		"bye"))
+	if len(seens) != 1 {
+		t.Fatal("Expected a seen record for the quit, got:", seens)
+	}
+	srv.saveSeen(seens)
+
+	seen, err := ts.store.FindSeen(netID, u1nick)
+	if err != nil || seen == nil {
+		t.Fatal("Expected the user to be remembered:", seen, err)
+	}
+	if seen.Host != u1host || seen.Action != irc.QUIT ||
+		seen.Reason != "bye" || seen.Said != "hello" ||
+		seen.SaidWhere != channel {
+
+		t.Error("The user was not remembered correctly:", seen)
+	}
+}
+
+func TestServer_topicChanged(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+	srv := ts.b.servers[netID]
+
+	err := rspChk(ts, registerSuccessFirst, u1host, register, password, u1user)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.TOPIC, u1host, channel,
+		"locked"))
+	stored := data.NewStoredChannel(netID, channel)
+	stored.LockTopic("locked")
+	if err = ts.store.SaveChannel(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	var table = []struct {
+		Sender string
+		Expect string
+	}{
+		{u2host, "TOPIC " + channel + " :locked"},
+		{u1host, ""},
+		{bothost, ""},
+	}
+
+	for i, test := range table {
+		changes, _ := ts.state.Update(irc.NewEvent(netID, netInfo, irc.TOPIC,
+			test.Sender, channel, fmt.Sprint("changed ", i)))
+		if len(changes) != 1 {
+			t.Fatalf("%v) Expected a topic change, got: %v", i, changes)
+		}
+
+		endpoint := makeTestPoint(nil)
+		srv.topicChanged(endpoint, changes[0])
+		if got := endpoint.gets(); got != test.Expect {
+			t.Errorf("%v) Expected: %q, got: %q", i, test.Expect, got)
+		}
+	}
+
+	stored, err = ts.store.FindChannel(netID, channel)
+	if err != nil || stored == nil {
+		t.Fatal("Expected the channel to be stored:", err)
+	}
+	topics, err := stored.Topics()
+	if err != nil || len(topics) != 3 || topics[0].Topic != "changed 1" ||
+		topics[0].SetBy != u1host {
+
+		t.Error("Expected the topic history to be saved:", topics, err)
+	}
+
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.JOIN, bothost, "#other"))
+	stored = data.NewStoredChannel(netID, "#other")
+	stored.PutTopics(topics)
+	if err = ts.store.SaveChannel(stored); err != nil {
+		t.Fatal(err)
+	}
+	srv.loadTopics("#other")
+	history := ts.state.GetChannel("#other").TopicHistory()
+	if len(history) != 3 || history[2].Topic != "locked" {
+		t.Error("Expected the topic history to be loaded:", history)
+	}
+}
+
+func TestServer_topicJoined(t *testing.T) {
+	ts := commandsSetup(t)
+	defer commandsTeardown(ts, t)
+	srv := ts.b.servers[netID]
+
+	topics := []data.TopicEntry{{Topic: "older", SetBy: u1host}}
+	stored := data.NewStoredChannel(netID, "#joined")
+	stored.PutTopics(topics)
+	if err := ts.store.SaveChannel(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.state.Update(irc.NewEvent(netID, netInfo, irc.JOIN, bothost, "#joined"))
+	changes, _ := ts.state.Update(irc.NewEvent(netID, netInfo, irc.RPL_TOPIC,
+		"irc.test.net", botnick, "#joined", "current"))
+	if len(changes) != 1 {
+		t.Fatal("Expected a topic change, got:", changes)
+	}
+
+	// The topic given on join is handled before the history is loaded.
+	srv.topicChanged(makeTestPoint(nil), changes[0])
+	srv.loadTopics("#joined")
+
+	stored, err := ts.store.FindChannel(netID, "#joined")
+	if err != nil || stored == nil {
+		t.Fatal("Expected the channel to be stored:", err)
+	}
+	saved, err := stored.Topics()
+	if err != nil || len(saved) != 1 || saved[0].Topic != "older" {
+		t.Error("Expected the stored topic history to be kept:", saved, err)
+	}
+	history := ts.state.GetChannel("#joined").TopicHistory()
+	if len(history) != 1 || history[0].Topic != "older" {
+		t.Error("Expected the topic history to be loaded:", history)
+	}
+}
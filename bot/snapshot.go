@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+)
+
+// snapshotFileFormat is the name of the file a channel's state is dumped to,
+// from the network, channel and time.
+const snapshotFileFormat = "state-%s-%s-%d.json"
+
+// SnapshotState copies everything the state of a network knows so it can
+// be serialized. It's nil if the network is unknown or its state is
+// disabled.
+func (b *Bot) SnapshotState(networkID string) (snap *data.Snapshot) {
+	b.ReadState(networkID, func(st *data.State) {
+		snap = st.Snapshot()
+	})
+	return snap
+}
+
+// RestoreState replaces everything the state of a network knows with a
+// snapshot. The returned boolean is whether or not the network has a state
+// to restore into.
+func (b *Bot) RestoreState(networkID string, snap *data.Snapshot) bool {
+	s := b.getServer(networkID)
+	if s == nil {
+		return false
+	}
+
+	s.protectState.Lock()
+	defer s.protectState.Unlock()
+
+	if s.state == nil {
+		return false
+	}
+	s.state.Restore(snap)
+	return true
+}
+
+// writeSnapshot writes a snapshot of a channel's state as JSON to a file in
+// dir, and returns the file's name.
+func writeSnapshot(dir, networkID, channel string,
+	snap *data.Snapshot) (string, error) {
+
+	js, err := json.MarshalIndent(snap, "", "\t")
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf(snapshotFileFormat, networkID,
+		strings.TrimLeft(channel, "#&!+"), time.Now().Unix())
+	name = filepath.Join(dir, strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name))
+
+	if err = ioutil.WriteFile(name, js, 0600); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestBot_SnapshotState(t *testing.T) {
+	t.Parallel()
+
+	b, err := createBot(fakeConfig.Clone(), nil, nil, devNull, false, false)
+	if err != nil {
+		t.Fatal("Unexpected err:", err)
+	}
+
+	if b.SnapshotState("nonexistent") != nil {
+		t.Error("Expected no snapshot of an unknown network.")
+	}
+	if b.RestoreState("nonexistent", &data.Snapshot{}) {
+		t.Error("Expected not to restore into an unknown network.")
+	}
+
+	st := b.servers[netID].state
+	st.Update(irc.NewEvent(netID, netInfo, irc.RPL_WELCOME, "", "Hi",
+		bothost))
+	st.Update(irc.NewEvent(netID, netInfo, irc.JOIN, bothost, channel))
+
+	snap := b.SnapshotState(netID)
+	if snap == nil || len(snap.Channels) != 1 {
+		t.Fatal("Expected a snapshot with the channel, got:", snap)
+	}
+
+	st.Update(irc.NewEvent(netID, netInfo, irc.PART, bothost, channel))
+	if st.GetChannel(channel) != nil {
+		t.Fatal("Expected the channel to be gone.")
+	}
+
+	if !b.RestoreState(netID, snap) {
+		t.Error("Expected the state to be restored.")
+	}
+	if st.GetChannel(channel) == nil || st.GetUser(botnick) == nil {
+		t.Error("Expected the channel and self to be restored.")
+	}
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+const (
+	// topicFlags are the flags that allow a user to change a locked topic,
+	// and to lock, unlock and restore topics.
+	topicFlags = `GSC`
+
+	errTopicSave = "bot: Failed to save topic history"
+	errTopicLoad = "bot: Failed to load topic history"
+)
+
+// topicChanged saves the topic history of a channel if it's stored, and
+// reverts the change if the topic is locked and it was changed by someone
+// without access. When there was no topic before the history is unchanged and
+// isn't saved, this is also the case for the topic given when the bot joins,
+// which may arrive before the stored history has been loaded.
+func (s *Server) topicChanged(w irc.Writer, ev *irc.Event) {
+	channel, old, topic := ev.Args[0], ev.Args[1], ev.Args[2]
+
+	var self string
+	var history []data.TopicEntry
+	s.protectState.RLock()
+	if s.state != nil {
+		self = s.state.Self.Host()
+		if ch := s.state.GetChannel(channel); ch != nil {
+			history = ch.TopicHistory()
+		}
+	}
+	s.protectState.RUnlock()
+
+	s.bot.protectStore.Lock()
+	defer s.bot.protectStore.Unlock()
+
+	store := s.bot.store
+	if store == nil {
+		return
+	}
+	stored, err := store.FindChannel(s.networkID, channel)
+	if err == nil && stored != nil && len(old) != 0 {
+		if err = stored.PutTopics(history); err == nil {
+			err = store.SaveChannel(stored)
+		}
+	}
+	if err != nil {
+		s.Error(errTopicSave, "chan", channel, "err", err)
+	}
+	if stored == nil {
+		return
+	}
+
+	locked, ok := stored.TopicLock()
+	if !ok || locked == topic || ev.Sender == self {
+		return
+	}
+	access := store.GetAuthedUser(s.networkID, ev.Sender)
+	if access != nil && access.HasFlags(s.networkID, channel, topicFlags) {
+		return
+	}
+
+	w.Sendf("TOPIC %s :%s", channel, locked)
+}
+
+// loadTopics restores the stored topic history of a channel the bot has
+// joined, unless the state has already started a new one.
+func (s *Server) loadTopics(channel string) {
+	var topics []data.TopicEntry
+	var err error
+
+	s.bot.protectStore.RLock()
+	if s.bot.store != nil {
+		var stored *data.StoredChannel
+		stored, err = s.bot.store.FindChannel(s.networkID, channel)
+		if err == nil && stored != nil {
+			topics, err = stored.Topics()
+		}
+	}
+	s.bot.protectStore.RUnlock()
+
+	if err != nil {
+		s.Error(errTopicLoad, "chan", channel, "err", err)
+		return
+	}
+	if len(topics) == 0 {
+		return
+	}
+
+	s.protectState.Lock()
+	defer s.protectState.Unlock()
+
+	if s.state == nil {
+		return
+	}
+	if ch := s.state.GetChannel(channel); ch != nil &&
+		len(ch.TopicHistory()) == 0 {
+
+		ch.SetTopicHistory(topics)
+	}
+}
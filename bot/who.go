@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// whoxSupport is the ISUPPORT token of servers that understand WHOX.
+const whoxSupport = "WHOX"
+
+// whoTimeout is how long to wait for the end of a WHO before giving up on it
+// and sending the next one.
+var whoTimeout = 30 * time.Second
+
+// whoSync keeps track of the WHOs sent to learn the users of the channels
+// the bot joins. Only one is sent at a time so that joining many channels
+// does not flood the server, the rest wait in the queue.
+type whoSync struct {
+	pending string
+	queue   []string
+	timer   *time.Timer
+	waiters map[string][]chan struct{}
+}
+
+// syncChannel sends a WHO for a channel the bot has joined, or queues it
+// while another channel is still being synced.
+func (s *Server) syncChannel(w irc.Writer, channel string) {
+	s.protectWho.Lock()
+	defer s.protectWho.Unlock()
+
+	if len(s.who.pending) != 0 {
+		s.who.queue = append(s.who.queue, channel)
+		return
+	}
+	s.sendWho(w, channel)
+}
+
+// sendWho sends a WHO for a channel, asking for the users' accounts as well
+// if the server supports WHOX. protectWho must be held.
+func (s *Server) sendWho(w irc.Writer, channel string) {
+	if len(s.netInfo.Extra(whoxSupport)) != 0 {
+		w.Sendf("WHO %s %s", channel, data.WHOXFields)
+	} else {
+		w.Send("WHO :", channel)
+	}
+
+	s.who.pending = channel
+	s.who.timer = time.AfterFunc(whoTimeout, func() {
+		s.endWho(w, channel)
+	})
+}
+
+// endWho is called when the server is done replying to a WHO, or it's timed
+// out. It wakes up anyone waiting on the channel if it's synced and sends
+// the next queued WHO.
+func (s *Server) endWho(w irc.Writer, channel string) {
+	synced := s.isSynced(channel)
+
+	s.protectWho.Lock()
+	defer s.protectWho.Unlock()
+
+	if synced {
+		key := strings.ToLower(channel)
+		for _, waiter := range s.who.waiters[key] {
+			close(waiter)
+		}
+		delete(s.who.waiters, key)
+	}
+
+	if len(s.who.pending) == 0 || !strings.EqualFold(s.who.pending, channel) {
+		return
+	}
+	s.who.timer.Stop()
+	s.who.pending = ""
+
+	if len(s.who.queue) != 0 {
+		next := s.who.queue[0]
+		s.who.queue = s.who.queue[1:]
+		s.sendWho(w, next)
+	}
+}
+
+// resetWho forgets the pending and queued WHOs when the server disconnects.
+// Anyone waiting on a channel keeps waiting until it's synced after the bot
+// joins it again.
+func (s *Server) resetWho() {
+	s.protectWho.Lock()
+	defer s.protectWho.Unlock()
+
+	if s.who.timer != nil {
+		s.who.timer.Stop()
+	}
+	s.who.pending = ""
+	s.who.queue = nil
+}
+
+// isSynced checks if the state has seen the end of a WHO of the channel.
+func (s *Server) isSynced(channel string) bool {
+	s.protectState.RLock()
+	defer s.protectState.RUnlock()
+
+	if s.state == nil {
+		return false
+	}
+	ch := s.state.GetChannel(channel)
+	return ch != nil && ch.IsSynced()
+}
+
+// waitForSync returns a channel that's closed once the channel is synced,
+// at once if it already is. It's nil if the state is disabled.
+func (s *Server) waitForSync(channel string) <-chan struct{} {
+	// The state lock is held until the waiter is added so the channel can't
+	// become synced in between.
+	s.protectState.RLock()
+	defer s.protectState.RUnlock()
+
+	if s.state == nil {
+		return nil
+	}
+
+	s.protectWho.Lock()
+	defer s.protectWho.Unlock()
+
+	waiter := make(chan struct{})
+	if ch := s.state.GetChannel(channel); ch != nil && ch.IsSynced() {
+		close(waiter)
+		return waiter
+	}
+
+	if s.who.waiters == nil {
+		s.who.waiters = make(map[string][]chan struct{})
+	}
+	key := strings.ToLower(channel)
+	s.who.waiters[key] = append(s.who.waiters[key], waiter)
+	return waiter
+}
+
+// WaitForSync returns a channel that's closed once the bot knows the full
+// hosts of all the users of a channel after joining it. It's closed at once
+// if it's already synced, and is nil if the network is unknown or its state
+// is disabled. It's never closed if the bot doesn't get into the channel so
+// callers should give up after a while.
+func (b *Bot) WaitForSync(networkID, channel string) <-chan struct{} {
+	s := b.getServer(networkID)
+	if s == nil {
+		return nil
+	}
+
+	return s.waitForSync(channel)
+}
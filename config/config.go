@@ -11,6 +11,8 @@ An example configuration looks like this:
 	nocorecmds = false
 	loglevel = "debug"
 	logfile = "/path/to/file.log"
+	# How many days the record of commands used is kept for.
+	auditretention = 30
 
 	# Most of the configuration values below have healthy defaults which means
 	# you don't have to set any of them. servers, nick, username, realname is
@@ -38,6 +40,11 @@ An example configuration looks like this:
 		# How many seconds after connect or while banned to wait to rejoin.
 		joindelay = 5
 
+		# How many of the latest messages to remember on each channel, and
+		# how many bytes they may take up at most. 0 disables the scrollback.
+		scrollback = 100
+		scrollbackbytes = 16384
+
 		# Flood control fine tuning knobs.
 		floodlenpenalty = 120
 		floodtimeout = 10.0
@@ -50,13 +57,42 @@ An example configuration looks like this:
 		noreconnect = false
 		reconnecttimeout = 20
 
-		# For fallback of channels below.
+		# For fallback of channels below. May be more than one character.
 		prefix = "."
 
+		# Allow commands to be given by addressing the bot by its nickname
+		# instead of the prefix, ie. Nick: help or Nick, help.
+		nickaddressing = false
+		nickseparators = ":,"
+
+		# Handle events and commands in the order they arrive for each
+		# channel, rather than all at once.
+		sequential = false
+
+		# How to answer commands that don't exist, with suggestions of
+		# similar commands: "ignore", "private" or "public".
+		unknowncmds = "ignore"
+
+		# The language messages are sent to users in, a user may choose
+		# their own with the locale command.
+		locale = "en"
+
+		# Accept DCC CHAT requests from users, commands may then be given in
+		# the chat session once the user has authenticated.
+		dccchat = false
+
+		# Which commands to keep a record of: "off", "privileged" for
+		# commands that require authentication, or "all". The arguments of
+		# the commands in auditredact are never recorded.
+		audit = "privileged"
+		auditredact = ["auth", "register", "passwd"]
+
 		[[networks.ircnet.channels]]
 			name = "#channel1"
 			password = "pass1"
 			prefix = "!"
+			unknowncmds = "public"
+			locale = "de"
 		[[networks.ircnet.channels]]
 			name = "#channel2"
 			password = "pass2"
@@ -131,6 +167,11 @@ const (
 	// defaultJoinDelay is how many seconds to wait before auto (re)joining a
 	// channel.
 	defaultJoinDelay = uint(5)
+	// defaultScrollback is how many messages are remembered on each channel.
+	defaultScrollback = uint(100)
+	// defaultScrollbackBytes is how many bytes the messages remembered on each
+	// channel may take up.
+	defaultScrollbackBytes = uint(16384)
 	// defaultFloodLenPenalty is how many characters in a message by default
 	// warrant an extra second wait time.
 	defaultFloodLenPenalty = uint(120)
@@ -146,7 +187,41 @@ const (
 	// defaultReconnectTimeout is how many seconds to wait between reconns.
 	defaultReconnectTimeout = uint(20)
 	// defaultPrefix is the command prefix by default
-	defaultPrefix = '.'
+	defaultPrefix = "."
+	// defaultNickSeparators are the characters that may follow the bot's
+	// nickname when it's being addressed.
+	defaultNickSeparators = ":,"
+	// defaultUnknownCmds is how commands that are not found are answered.
+	defaultUnknownCmds = UnknownCmdsIgnore
+	// defaultLocale is the language messages are sent to users in.
+	defaultLocale = "en"
+	// defaultAudit is which commands a record is kept of.
+	defaultAudit = AuditPrivileged
+	// defaultAuditRetention is how many days the record of commands is kept.
+	defaultAuditRetention = uint(30)
+)
+
+// defaultAuditRedact are the commands whose arguments are not recorded.
+var defaultAuditRedact = []string{"auth", "register", "passwd"}
+
+// The values audit may be set to.
+const (
+	// AuditOff keeps no record of commands.
+	AuditOff = "off"
+	// AuditPrivileged records commands that require authentication.
+	AuditPrivileged = "privileged"
+	// AuditAll records every command.
+	AuditAll = "all"
+)
+
+// The values unknowncmds may be set to.
+const (
+	// UnknownCmdsIgnore ignores commands that are not found.
+	UnknownCmdsIgnore = "ignore"
+	// UnknownCmdsPrivate notices the user with similar commands.
+	UnknownCmdsPrivate = "private"
+	// UnknownCmdsPublic answers in the channel with similar commands.
+	UnknownCmdsPublic = "public"
 )
 
 // The following format strings are for formatting various config errors.
@@ -413,6 +488,32 @@ func (c *Config) SetNoCoreCmds(val bool) *Config {
 	return c
 }
 
+// AuditRetention gets how many days the record of commands is kept for or
+// defaultAuditRetention.
+func (c *Config) AuditRetention() (uint, bool) {
+	c.protect.RLock()
+	defer c.protect.RUnlock()
+
+	if val, ok := c.values["auditretention"]; ok {
+		switch days := val.(type) {
+		case int64:
+			return uint(days), true
+		case uint:
+			return days, true
+		}
+	}
+	return defaultAuditRetention, false
+}
+
+// SetAuditRetention sets how many days the record of commands is kept for.
+func (c *Config) SetAuditRetention(val uint) *Config {
+	c.protect.Lock()
+	defer c.protect.Unlock()
+
+	c.values["auditretention"] = interface{}(val)
+	return c
+}
+
 // NewNetwork creates a network and returns the network's context.
 // If the network exists, the context will be nil.
 func (c *Config) NewNetwork(name string) *NetCTX {
@@ -36,6 +36,7 @@ storefile = "/path/to/store/file.db"
 nocorecmds = false
 loglevel = "debug"
 logfile = "/path/to/file.log"
+auditretention = 7
 
 nick = "Nick"
 altnick = "Altnick"
@@ -73,6 +74,8 @@ password = "Password"
 	name = "#channel1"
 	password = "pass1"
 	prefix = "!"
+	unknowncmds = "public"
+	locale = "de"
 
 	[[networks.ircnet.channels]]
 	name = "#channel2"
@@ -118,7 +121,6 @@ func verifyFakeConfig(t *testing.T, conf *Config) {
 	var expb bool
 	var expu uint
 	var expf float64
-	var expr rune
 
 	exps = "/path/to/store/file.db"
 	if got, ok := conf.StoreFile(); !ok || exps != got {
@@ -140,6 +142,11 @@ func verifyFakeConfig(t *testing.T, conf *Config) {
 		t.Errorf("Expected: %v, got: %v", expb, got)
 	}
 
+	expu = 7
+	if got, ok := conf.AuditRetention(); !ok || expu != got {
+		t.Errorf("Expected: %v, got: %v", expu, got)
+	}
+
 	net1 := conf.Network("ircnet")
 	if net1 == nil {
 		t.Error("Expected ircnet to be configured.")
@@ -235,9 +242,9 @@ func verifyFakeConfig(t *testing.T, conf *Config) {
 		t.Errorf("Expected: %v, got: %v", expu, got)
 	}
 
-	expr = '.'
-	if got, ok := net1.Prefix(); !ok || expr != got {
-		t.Errorf("Expected: %v, got: %v", expr, got)
+	exps = "."
+	if got, ok := net1.Prefix(); !ok || exps != got {
+		t.Errorf("Expected: %v, got: %v", exps, got)
 	}
 
 	if chans, ok := net1.Channels(); ok {
@@ -252,6 +259,12 @@ func verifyFakeConfig(t *testing.T, conf *Config) {
 		if exp, got := "!", c1.Prefix; exp != got {
 			t.Errorf("Expected: %v, got: %v", exp, got)
 		}
+		if exp, got := "public", c1.UnknownCmds; exp != got {
+			t.Errorf("Expected: %v, got: %v", exp, got)
+		}
+		if exp, got := "de", c1.Locale; exp != got {
+			t.Errorf("Expected: %v, got: %v", exp, got)
+		}
 
 		if exp, got := "#channel2", c2.Name; exp != got {
 			t.Errorf("Expected: %v, got: %v", exp, got)
@@ -62,7 +62,7 @@ func TestConfig_Clone(t *testing.T) {
 
 	c.NewNetwork("othernet").
 		SetServers([]string{"str"}).
-		SetChannels([]Channel{{"a", "b", "c"}})
+		SetChannels([]Channel{{"a", "b", "c", "d", "e"}})
 
 	nc := c.Clone()
 
@@ -237,4 +237,13 @@ func TestConfig_Config_GetSet(t *testing.T) {
 	if v, ok := c.NoCoreCmds(); !ok || v != true {
 		t.Error("Expected store file to be set, and to get a, got:", v)
 	}
+
+	if v, ok := c.AuditRetention(); ok || v != defaultAuditRetention {
+		t.Error("Expected audit retention not to be set, and to get default:",
+			v)
+	}
+	c.SetAuditRetention(5)
+	if v, ok := c.AuditRetention(); !ok || v != 5 {
+		t.Error("Expected audit retention to be set, and to get 5, got:", v)
+	}
 }
@@ -145,6 +145,30 @@ func (n *NetCTX) SetJoinDelay(val uint) *NetCTX {
 	return n
 }
 
+func (n *NetCTX) Scrollback() (uint, bool) {
+	if scrollback, ok := getUint(n, "scrollback", true); ok {
+		return scrollback, true
+	}
+	return defaultScrollback, false
+}
+
+func (n *NetCTX) SetScrollback(val uint) *NetCTX {
+	setVal(n, "scrollback", val)
+	return n
+}
+
+func (n *NetCTX) ScrollbackBytes() (uint, bool) {
+	if scrollbackBytes, ok := getUint(n, "scrollbackbytes", true); ok {
+		return scrollbackBytes, true
+	}
+	return defaultScrollbackBytes, false
+}
+
+func (n *NetCTX) SetScrollbackBytes(val uint) *NetCTX {
+	setVal(n, "scrollbackbytes", val)
+	return n
+}
+
 func (n *NetCTX) FloodLenPenalty() (uint, bool) {
 	if floodLenPenalty, ok := getUint(n, "floodlenpenalty", true); ok {
 		return floodLenPenalty, true
@@ -214,25 +238,116 @@ func (n *NetCTX) SetReconnectTimeout(val uint) *NetCTX {
 	return n
 }
 
-func (n *NetCTX) Prefix() (rune, bool) {
+func (n *NetCTX) Sequential() (bool, bool) {
+	return getBool(n, "sequential", true)
+}
+
+func (n *NetCTX) SetSequential(val bool) *NetCTX {
+	setVal(n, "sequential", val)
+	return n
+}
+
+func (n *NetCTX) Prefix() (string, bool) {
 	if prefix, ok := getStr(n, "prefix", true); ok {
 		if len(prefix) > 0 {
-			return rune(prefix[0]), ok
+			return prefix, ok
 		}
 	}
 	return defaultPrefix, false
 }
 
-func (n *NetCTX) SetPrefix(val rune) *NetCTX {
-	setVal(n, "prefix", string(val))
+func (n *NetCTX) SetPrefix(val string) *NetCTX {
+	setVal(n, "prefix", val)
+	return n
+}
+
+func (n *NetCTX) NickAddressing() (bool, bool) {
+	return getBool(n, "nickaddressing", true)
+}
+
+func (n *NetCTX) SetNickAddressing(val bool) *NetCTX {
+	setVal(n, "nickaddressing", val)
+	return n
+}
+
+func (n *NetCTX) DCCChat() (bool, bool) {
+	return getBool(n, "dccchat", true)
+}
+
+func (n *NetCTX) SetDCCChat(val bool) *NetCTX {
+	setVal(n, "dccchat", val)
+	return n
+}
+
+func (n *NetCTX) Audit() (string, bool) {
+	if audit, ok := getStr(n, "audit", true); ok {
+		return audit, ok
+	}
+	return defaultAudit, false
+}
+
+func (n *NetCTX) SetAudit(val string) *NetCTX {
+	setVal(n, "audit", val)
+	return n
+}
+
+func (n *NetCTX) AuditRedact() ([]string, bool) {
+	if redact, ok := getStrArr(n, "auditredact", true); ok {
+		return redact, ok
+	}
+	return defaultAuditRedact, false
+}
+
+func (n *NetCTX) SetAuditRedact(val []string) *NetCTX {
+	setVal(n, "auditredact", val)
+	return n
+}
+
+func (n *NetCTX) NickSeparators() (string, bool) {
+	if separators, ok := getStr(n, "nickseparators", true); ok {
+		if len(separators) > 0 {
+			return separators, ok
+		}
+	}
+	return defaultNickSeparators, false
+}
+
+func (n *NetCTX) SetNickSeparators(val string) *NetCTX {
+	setVal(n, "nickseparators", val)
+	return n
+}
+
+func (n *NetCTX) UnknownCmds() (string, bool) {
+	if unknownCmds, ok := getStr(n, "unknowncmds", true); ok {
+		return unknownCmds, ok
+	}
+	return defaultUnknownCmds, false
+}
+
+func (n *NetCTX) SetUnknownCmds(val string) *NetCTX {
+	setVal(n, "unknowncmds", val)
+	return n
+}
+
+func (n *NetCTX) Locale() (string, bool) {
+	if locale, ok := getStr(n, "locale", true); ok && len(locale) > 0 {
+		return locale, ok
+	}
+	return defaultLocale, false
+}
+
+func (n *NetCTX) SetLocale(val string) *NetCTX {
+	setVal(n, "locale", val)
 	return n
 }
 
 // Channel is the configuration for a single channel.
 type Channel struct {
-	Name     string
-	Password string
-	Prefix   string
+	Name        string
+	Password    string
+	Prefix      string
+	UnknownCmds string
+	Locale      string
 }
 
 func (n *NetCTX) Channels() ([]Channel, bool) {
@@ -268,6 +383,16 @@ func (n *NetCTX) Channels() ([]Channel, bool) {
 					ret[i].Prefix = prefix
 				}
 			}
+			if unknownVal, ok := ch["unknowncmds"]; ok {
+				if unknown, ok := unknownVal.(string); ok {
+					ret[i].UnknownCmds = unknown
+				}
+			}
+			if localeVal, ok := ch["locale"]; ok {
+				if locale, ok := localeVal.(string); ok {
+					ret[i].Locale = locale
+				}
+			}
 		}
 
 		return ret, true
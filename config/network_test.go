@@ -37,6 +37,12 @@ func TestConfig_Network_GetSet(t *testing.T) {
 	check("JoinDelay", defaultJoinDelay, uint(20), uint(30),
 		glb, net, t)
 
+	check("Scrollback", defaultScrollback, uint(20), uint(30),
+		glb, net, t)
+
+	check("ScrollbackBytes", defaultScrollbackBytes, uint(20), uint(30),
+		glb, net, t)
+
 	check("FloodLenPenalty", defaultFloodLenPenalty, uint(20), uint(30),
 		glb, net, t)
 
@@ -51,7 +57,25 @@ func TestConfig_Network_GetSet(t *testing.T) {
 	check("ReconnectTimeout", defaultReconnectTimeout,
 		uint(20), uint(30), glb, net, t)
 
-	check("Prefix", '.', '!', '@', glb, net, t)
+	check("Sequential", false, false, true, glb, net, t)
+
+	check("Prefix", ".", "!", "@@", glb, net, t)
+
+	check("NickAddressing", false, false, true, glb, net, t)
+
+	check("DCCChat", false, false, true, glb, net, t)
+
+	check("Audit", defaultAudit, AuditAll, AuditOff, glb, net, t)
+
+	check("AuditRedact", defaultAuditRedact, []string{"a"},
+		[]string{"b", "c"}, glb, net, t)
+
+	check("NickSeparators", defaultNickSeparators, ":", ",", glb, net, t)
+
+	check("UnknownCmds", defaultUnknownCmds, UnknownCmdsPrivate,
+		UnknownCmdsPublic, glb, net, t)
+
+	check("Locale", defaultLocale, "de", "es", glb, net, t)
 
 	if srvs, ok := net.Servers(); ok || len(srvs) != 0 {
 		t.Error("Expected servers to be empty.")
@@ -72,8 +96,8 @@ func TestConfig_Network_GetSetChannels(t *testing.T) {
 	c := NewConfig()
 	glb := c.Network("")
 	net := c.NewNetwork("net")
-	ch1 := Channel{"a", "b", "c"}
-	ch2 := Channel{"a", "b", "c"}
+	ch1 := Channel{"a", "b", "c", "d", "e"}
+	ch2 := Channel{"a", "b", "c", "d", "e"}
 
 	if chans, ok := glb.Channels(); ok || len(chans) != 0 {
 		t.Error("Expected servers to be empty.")
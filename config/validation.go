@@ -16,6 +16,7 @@ type validatorRules struct {
 
 var globalValidator = validatorRules{
 	stringVals: []string{"storefile", "loglevel", "logfile"},
+	uintVals:   []string{"auditretention"},
 	mapVals:    []string{"ext", "exts", "networks"},
 	boolVals:   []string{"nocorecmds"},
 }
@@ -23,20 +24,27 @@ var globalValidator = validatorRules{
 var networkValidator = validatorRules{
 	stringVals: []string{
 		"nick", "altnick", "username", "realname", "password",
-		"sslcert", "prefix",
+		"sslcert", "prefix", "unknowncmds", "nickseparators", "locale",
+		"audit",
 	},
-	stringSliceVals: []string{"servers"},
+	stringSliceVals: []string{"servers", "auditredact"},
 	boolVals: []string{
 		"ssl", "nostate", "nostore", "noautojoin",
-		"noreconnect", "noverifycert",
+		"noreconnect", "noverifycert", "sequential", "nickaddressing",
+		"dccchat",
+	},
+	floatVals: []string{"floodtimeout", "floodstep", "keepalive"},
+	uintVals: []string{
+		"reconnecttimeout", "floodlenpenalty", "joindelay",
+		"scrollback", "scrollbackbytes",
 	},
-	floatVals:  []string{"floodtimeout", "floodstep", "keepalive"},
-	uintVals:   []string{"reconnecttimeout", "floodlenpenalty", "joindelay"},
 	mapArrVals: []string{"channels"},
 }
 
 var channelValidator = validatorRules{
-	stringVals: []string{"name", "prefix", "password"},
+	stringVals: []string{
+		"name", "prefix", "password", "unknowncmds", "locale",
+	},
 }
 
 var extCommonValidator = validatorRules{
@@ -139,10 +147,41 @@ func (c *Config) validateRequired(ers *errList) {
 			if n, ok := ctx.Realname(); !ok || len(n) == 0 {
 				ers.addError("(%s) Realname is required.", name)
 			}
+			if u, _ := ctx.UnknownCmds(); !isUnknownCmds(u) {
+				ers.addError("(%s) Invalid unknowncmds, given: %v", name, u)
+			}
+			if a, _ := ctx.Audit(); !isAudit(a) {
+				ers.addError("(%s) Invalid audit, given: %v", name, a)
+			}
+			chans, _ := ctx.Channels()
+			for _, ch := range chans {
+				if len(ch.UnknownCmds) != 0 && !isUnknownCmds(ch.UnknownCmds) {
+					ers.addError("(%s %s) Invalid unknowncmds, given: %v",
+						name, ch.Name, ch.UnknownCmds)
+				}
+			}
 		}
 	}
 }
 
+// isUnknownCmds checks that a value is one of the values of unknowncmds.
+func isUnknownCmds(value string) bool {
+	switch value {
+	case UnknownCmdsIgnore, UnknownCmdsPrivate, UnknownCmdsPublic:
+		return true
+	}
+	return false
+}
+
+// isAudit checks that a value is one of the values of audit.
+func isAudit(value string) bool {
+	switch value {
+	case AuditOff, AuditPrivileged, AuditAll:
+		return true
+	}
+	return false
+}
+
 // validateTypes checks the types of all of the map's objects.
 func (c *Config) validateTypes(ers *errList) {
 	globalValidator.validateMap("global", c.values, ers)
@@ -111,6 +111,49 @@ func TestValidation_RequiredServers(t *testing.T) {
 	requiredTestHelper(cfg, expects, t)
 }
 
+func TestValidation_RequiredUnknownCmds(t *testing.T) {
+	t.Parallel()
+
+	cfg := `
+	[networks.hello]
+		servers = ["a.com"]
+		nick = "a"
+		username = "a"
+		realname = "a"
+		unknowncmds = "loud"
+		[[networks.hello.channels]]
+			name = "#a"
+			unknowncmds = "public"
+		[[networks.hello.channels]]
+			name = "#b"
+			unknowncmds = "quiet"`
+
+	expects := []rexpect{
+		{"hello", "Invalid unknowncmds, given: loud"},
+		{"hello #b", "Invalid unknowncmds, given: quiet"},
+	}
+
+	requiredTestHelper(cfg, expects, t)
+}
+
+func TestValidation_RequiredAudit(t *testing.T) {
+	t.Parallel()
+
+	cfg := `
+	[networks.hello]
+		servers = ["a.com"]
+		nick = "a"
+		username = "a"
+		realname = "a"
+		audit = "some"`
+
+	expects := []rexpect{
+		{"hello", "Invalid audit, given: some"},
+	}
+
+	requiredTestHelper(cfg, expects, t)
+}
+
 func TestValidation_RequiredTypes(t *testing.T) {
 	t.Parallel()
 
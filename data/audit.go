@@ -0,0 +1,185 @@
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// auditKeyPrefix is the prefix of all keys used to store audit entries.
+const auditKeyPrefix = "audit:"
+
+// auditSequence tells apart audit entries made at the same time.
+var auditSequence uint32
+
+// AuditEntry is a record of a command being used.
+type AuditEntry struct {
+	// Time is when the command was used.
+	Time time.Time
+	// NetworkID is the network the command was used on.
+	NetworkID string
+	// Target is the channel the command was used in, empty when it was sent
+	// directly to the bot.
+	Target string
+	// Sender is the full host of the user who used the command.
+	Sender string
+	// Account is the username of the user if they were authenticated.
+	Account string
+	// Command is the full name of the command, including its parents.
+	Command string
+	// Arguments are the arguments the command was given. They may have been
+	// redacted.
+	Arguments string
+	// Result is the error the user was given, empty if the command
+	// succeeded.
+	Result string
+}
+
+// AuditQuery chooses the entries returned by Store.AuditLog. Fields that
+// are empty match every entry.
+type AuditQuery struct {
+	NetworkID string
+	Channel   string
+	Account   string
+	Command   string
+	// Since excludes entries from before this time.
+	Since time.Time
+	// Limit is the most entries to return, the most recent are kept.
+	Limit int
+}
+
+// match checks if an entry is chosen by the query.
+func (q AuditQuery) match(entry *AuditEntry) bool {
+	return (len(q.NetworkID) == 0 || q.NetworkID == entry.NetworkID) &&
+		(len(q.Channel) == 0 || strings.EqualFold(q.Channel, entry.Target)) &&
+		(len(q.Account) == 0 || strings.EqualFold(q.Account, entry.Account)) &&
+		(len(q.Command) == 0 || strings.EqualFold(q.Command, entry.Command))
+}
+
+// makeAuditScope creates the prefix of the keys of all entries from a time
+// onwards.
+func makeAuditScope(t time.Time) string {
+	if t.IsZero() {
+		return auditKeyPrefix
+	}
+	return fmt.Sprintf("%s%020d", auditKeyPrefix, t.UnixNano())
+}
+
+// makeAuditID is used to create a key to store an entry by, they sort in the
+// order they were made.
+func makeAuditID(entry *AuditEntry) string {
+	return fmt.Sprintf("%s:%010d", makeAuditScope(entry.Time),
+		atomic.AddUint32(&auditSequence, 1))
+}
+
+// serialize turns the AuditEntry into bytes for storage.
+func (a *AuditEntry) serialize() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buffer)
+	err := encoder.Encode(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// deserializeAudit reverses the Serialize process.
+func deserializeAudit(serialized []byte) (*AuditEntry, error) {
+	buffer := &bytes.Buffer{}
+	decoder := gob.NewDecoder(buffer)
+	if _, err := buffer.Write(serialized); err != nil {
+		return nil, err
+	}
+
+	dec := &AuditEntry{}
+	err := decoder.Decode(dec)
+	return dec, err
+}
+
+// SaveAudit adds an entry to the audit log. If the entry has no time it's
+// given the current time.
+func (s *Store) SaveAudit(entry *AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+
+	serialized, err := entry.serialize()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set([]byte(makeAuditID(entry)), serialized)
+}
+
+// AuditLog returns the entries in the audit log chosen by the query, the most
+// recent first.
+func (s *Store) AuditLog(query AuditQuery) ([]*AuditEntry, error) {
+	list := make([]*AuditEntry, 0)
+	prefix := []byte(auditKeyPrefix)
+
+	e, _, err := s.db.Seek([]byte(makeAuditScope(query.Since)))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		key, val, err := e.Next()
+		if err == io.EOF || !bytes.HasPrefix(key, prefix) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		entry, err := deserializeAudit(val)
+		if err == nil && query.match(entry) {
+			list = append(list, entry)
+		}
+	}
+
+	if query.Limit > 0 && len(list) > query.Limit {
+		list = list[len(list)-query.Limit:]
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+
+	return list, nil
+}
+
+// PruneAudit removes the entries in the audit log from before a time, and
+// returns how many were removed.
+func (s *Store) PruneAudit(before time.Time) (int, error) {
+	prefix := []byte(auditKeyPrefix)
+	end := []byte(makeAuditScope(before))
+
+	e, _, err := s.db.Seek(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var keys [][]byte
+	for {
+		key, _, err := e.Next()
+		if err == io.EOF || !bytes.HasPrefix(key, prefix) ||
+			bytes.Compare(key, end) >= 0 {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		keys = append(keys, append([]byte(nil), key...))
+	}
+
+	for i, key := range keys {
+		if err = s.db.Delete(key); err != nil {
+			return i, err
+		}
+	}
+
+	return len(keys), nil
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditEntry_SerializeDeserialize(t *testing.T) {
+	t.Parallel()
+
+	a := &AuditEntry{
+		Time:      time.Date(2014, 1, 2, 3, 4, 5, 6, time.UTC),
+		NetworkID: "netID",
+		Target:    "#chan",
+		Sender:    "nick!user@host",
+		Account:   uname,
+		Command:   "quote add",
+		Arguments: "hello",
+		Result:    "Error: Failed.",
+	}
+
+	serialized, err := a.serialize()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(serialized) == 0 {
+		t.Error("Serialization did not yield a serialized copy.")
+	}
+
+	b, err := deserializeAudit(serialized)
+	if err != nil {
+		t.Fatal("Deserialization failed.")
+	}
+
+	if !a.Time.Equal(b.Time) {
+		t.Error("Time not deserialized correctly:", b.Time)
+	}
+	b.Time = a.Time
+	if *a != *b {
+		t.Error("Entry not deserialized correctly:", b)
+	}
+}
+
+func TestStore_Audit(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := NewStoredUser(uname, password, "*!*@host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.GrantGlobalLevel(100)
+	if err = s.SaveUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	entries := []*AuditEntry{
+		{Time: start, NetworkID: "net1", Command: "auth"},
+		{Time: start.Add(time.Minute), NetworkID: "net1", Target: "#chan",
+			Account: uname, Command: "give"},
+		{Time: start.Add(time.Minute), NetworkID: "net2", Account: uname,
+			Command: "deluser"},
+		{Time: start.Add(time.Hour), NetworkID: "net1", Account: "other",
+			Command: "give"},
+	}
+	for _, entry := range entries {
+		if err = s.SaveAudit(entry); err != nil {
+			t.Fatal("Error saving entry:", err)
+		}
+	}
+
+	var table = []struct {
+		Query  AuditQuery
+		Expect []*AuditEntry
+	}{
+		{AuditQuery{}, []*AuditEntry{
+			entries[3], entries[2], entries[1], entries[0]}},
+		{AuditQuery{Limit: 2}, []*AuditEntry{entries[3], entries[2]}},
+		{AuditQuery{NetworkID: "net1"}, []*AuditEntry{
+			entries[3], entries[1], entries[0]}},
+		{AuditQuery{Channel: "#CHAN"}, []*AuditEntry{entries[1]}},
+		{AuditQuery{Account: "USER"}, []*AuditEntry{entries[2], entries[1]}},
+		{AuditQuery{Command: "give"}, []*AuditEntry{entries[3], entries[1]}},
+		{AuditQuery{Since: start.Add(time.Second)}, []*AuditEntry{
+			entries[3], entries[2], entries[1]}},
+	}
+
+	for i, test := range table {
+		list, err := s.AuditLog(test.Query)
+		if err != nil {
+			t.Errorf("%v) Unexpected error: %v", i, err)
+			continue
+		}
+		if len(list) != len(test.Expect) {
+			t.Errorf("%v) Expected %v entries, got: %v",
+				i, len(test.Expect), len(list))
+			continue
+		}
+		for j, entry := range list {
+			if entry.Command != test.Expect[j].Command ||
+				!entry.Time.Equal(test.Expect[j].Time) ||
+				entry.NetworkID != test.Expect[j].NetworkID {
+				t.Errorf("%v) Expected entry %v to be: %v, got: %v",
+					i, j, test.Expect[j], entry)
+			}
+		}
+	}
+
+	users, err := s.GlobalUsers()
+	if err != nil || len(users) != 1 {
+		t.Error("Expected audit entries not to be read as users:", users, err)
+	}
+
+	removed, err := s.PruneAudit(start.Add(time.Minute))
+	if err != nil || removed != 1 {
+		t.Error("Expected one entry to be pruned, got:", removed, err)
+	}
+	removed, err = s.PruneAudit(start.Add(2 * time.Hour))
+	if err != nil || removed != 3 {
+		t.Error("Expected three entries to be pruned, got:", removed, err)
+	}
+	if list, err := s.AuditLog(AuditQuery{}); err != nil || len(list) != 0 {
+		t.Error("Expected the audit log to be empty, got:", list, err)
+	}
+	if u, err := s.FindUser(uname); err != nil || u == nil {
+		t.Error("Expected the user to remain after pruning:", err)
+	}
+}
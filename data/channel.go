@@ -2,6 +2,7 @@ package data
 
 import (
 	"strings"
+	"time"
 
 	"github.com/aarondl/ultimateq/irc"
 )
@@ -9,12 +10,42 @@ import (
 const (
 	// banMode is the universal irc mode for bans
 	banMode = 'b'
+	// exceptMode is the common irc mode for ban exceptions.
+	exceptMode = 'e'
+	// invexMode is the common irc mode for invite exceptions.
+	invexMode = 'I'
+	// quietMode is the irc mode for quiets on networks where it's a list.
+	quietMode = 'q'
+	// topicHistoryLength is how many of a channel's previous topics are kept.
+	topicHistoryLength = 10
 )
 
+// TopicEntry is a topic a channel has had, along with who set it and when.
+// SetBy and SetAt are empty when that's not known.
+type TopicEntry struct {
+	Topic string
+	SetBy string
+	SetAt time.Time
+}
+
+// ListEntry is a mask on one of a channel's list modes, like a ban. SetBy
+// and SetAt are empty when it's not known who set it and when.
+type ListEntry struct {
+	Mask  string
+	SetBy string
+	SetAt time.Time
+}
+
 // Channel encapsulates all the data associated with a channel.
 type Channel struct {
-	name  string
-	topic string
+	name   string
+	topic  string
+	synced bool
+
+	topicSetBy   string
+	topicSetAt   time.Time
+	topicHistory []TopicEntry
+
 	*ChannelModes
 }
 
@@ -37,9 +68,56 @@ func (c *Channel) Name() string {
 	return c.name
 }
 
-// SetTopic sets the topic of the channel.
+// SetTopic sets the topic of the channel. If it's different the old topic is
+// added to the history and it's forgotten who set the topic and when.
 func (c *Channel) SetTopic(topic string) {
+	if topic == c.topic {
+		return
+	}
+
+	if len(c.topic) != 0 {
+		old := TopicEntry{c.topic, c.topicSetBy, c.topicSetAt}
+		c.topicHistory = append([]TopicEntry{old}, c.topicHistory...)
+		if len(c.topicHistory) > topicHistoryLength {
+			c.topicHistory = c.topicHistory[:topicHistoryLength]
+		}
+	}
+
 	c.topic = topic
+	c.topicSetBy = ""
+	c.topicSetAt = time.Time{}
+}
+
+// SetTopicInfo sets who set the current topic and when.
+func (c *Channel) SetTopicInfo(setBy string, setAt time.Time) {
+	c.topicSetBy = setBy
+	c.topicSetAt = setAt
+}
+
+// TopicInfo gets the current topic along with who set it and when.
+func (c *Channel) TopicInfo() TopicEntry {
+	return TopicEntry{c.topic, c.topicSetBy, c.topicSetAt}
+}
+
+// TopicHistory gets the previous topics of the channel, the most recent
+// first.
+func (c *Channel) TopicHistory() []TopicEntry {
+	if len(c.topicHistory) == 0 {
+		return nil
+	}
+	history := make([]TopicEntry, len(c.topicHistory))
+	copy(history, c.topicHistory)
+	return history
+}
+
+// SetTopicHistory replaces the previous topics of the channel, the most
+// recent first. Only the most recent are kept.
+func (c *Channel) SetTopicHistory(history []TopicEntry) {
+	if len(history) > topicHistoryLength {
+		history = history[:topicHistoryLength]
+	}
+	c.topicHistory = make([]TopicEntry, len(history))
+	copy(c.topicHistory, history)
 }
 
 // Topic gets the topic of the channel.
@@ -47,14 +125,59 @@ func (c *Channel) Topic() string {
 	return c.topic
 }
 
-// IsBanned checks a host to see if it's banned.
+// IsSynced checks if the end of a WHO of the channel has been seen since the
+// client joined it, after which all of its users' hosts are known.
+func (c *Channel) IsSynced() bool {
+	return c.synced
+}
+
+// IsBanned checks a host to see if it's banned and not exempt from the ban
+// by an exception. Extbans on accounts are not matched as the host alone
+// doesn't tell if the user is logged in.
 func (c *Channel) IsBanned(host irc.Host) bool {
+	return c.isBanned(host, nil)
+}
+
+// IsUserBanned checks a user to see if they're banned and not exempt from
+// the ban by an exception, matching extbans on their account as well.
+func (c *Channel) IsUserBanned(user *User) bool {
+	return c.isBanned(irc.Host(user.Host()), user)
+}
+
+// IsQuieted checks a user to see if they're quieted and not exempt from it
+// by an exception.
+func (c *Channel) IsQuieted(user *User) bool {
+	host := irc.Host(user.Host())
+	return c.isListed(quietMode, host, user) &&
+		!c.isListed(exceptMode, host, user)
+}
+
+// IsInvited checks a user to see if an invite exception lets them join the
+// channel while it's invite only.
+func (c *Channel) IsInvited(user *User) bool {
+	return c.isListed(invexMode, irc.Host(user.Host()), user)
+}
+
+// isBanned checks a host against the bans and exceptions, the user may be
+// nil if it's unknown.
+func (c *Channel) isBanned(host irc.Host, user *User) bool {
 	if !strings.ContainsAny(string(host), "!@") {
 		host += "!@"
 	}
-	bans := c.GetAddresses(banMode)
-	for i := 0; i < len(bans); i++ {
-		if irc.Mask(bans[i]).Match(host) {
+	return c.isListed(banMode, host, user) &&
+		!c.isListed(exceptMode, host, user)
+}
+
+// isListed checks if a host matches any of the masks of a list mode. The
+// user is used to match extbans and may be nil.
+func (c *Channel) isListed(mode rune, host irc.Host, user *User) bool {
+	masks := c.GetAddresses(mode)
+	for i := 0; i < len(masks); i++ {
+		if matched, isExtban := matchExtban(masks[i], user); isExtban {
+			if matched {
+				return true
+			}
+		} else if irc.Mask(masks[i]).Match(host) {
 			return true
 		}
 	}
@@ -62,12 +185,116 @@ func (c *Channel) IsBanned(host irc.Host) bool {
 	return false
 }
 
+// matchExtban checks if a mask is an extban, and if it matches the user.
+// Extbans look like $a:account or ~a:account depending on the server, the
+// type may be negated like $~a. Only account extbans (a, R or account) can be
+// matched, others and a nil user never match.
+func matchExtban(mask string, user *User) (matched, isExtban bool) {
+	if strings.ContainsAny(mask, "!@") {
+		return false, false
+	}
+
+	ext := mask
+	if len(ext) > 0 && (ext[0] == '$' || ext[0] == '~') {
+		ext = ext[1:]
+	} else if !strings.ContainsRune(ext, ':') {
+		return false, false
+	}
+
+	negated := strings.HasPrefix(ext, "~")
+	if negated {
+		ext = ext[1:]
+	}
+	kind, arg := ext, ""
+	if i := strings.IndexRune(ext, ':'); i >= 0 {
+		kind, arg = ext[:i], ext[i+1:]
+	}
+
+	switch kind {
+	case "a", "R", "account":
+	default:
+		return false, true
+	}
+	if user == nil {
+		return false, true
+	}
+
+	account := strings.ToLower(user.Account())
+	if len(arg) == 0 {
+		matched = len(account) != 0
+	} else {
+		matched = len(account) != 0 &&
+			irc.Mask(strings.ToLower(arg)).Match(irc.Host(account))
+	}
+	return matched != negated, true
+}
+
 // SetBans sets the bans of the channel.
 func (c *Channel) SetBans(bans []string) {
-	delete(c.modes, banMode)
-	for i := 0; i < len(bans); i++ {
-		c.setAddress(banMode, bans[i])
+	c.SetList(banMode, bans)
+}
+
+// SetList replaces the masks of one of the channel's list modes.
+func (c *Channel) SetList(mode rune, masks []string) {
+	for _, mask := range c.List(mode) {
+		c.unsetAddress(mode, mask)
+	}
+	for i := 0; i < len(masks); i++ {
+		c.setAddress(mode, masks[i])
+	}
+}
+
+// AddListEntry adds a mask to one of the channel's list modes, remembering
+// who set it and when.
+func (c *Channel) AddListEntry(mode rune, mask, setBy string,
+	setAt time.Time) {
+
+	c.setAddressInfo(mode, mask, setBy, setAt)
+}
+
+// DeleteListEntry deletes a mask from one of the channel's list modes.
+func (c *Channel) DeleteListEntry(mode rune, mask string) {
+	c.unsetAddress(mode, mask)
+}
+
+// List gets the masks of one of the channel's list modes.
+func (c *Channel) List(mode rune) []string {
+	addresses := c.GetAddresses(mode)
+	if addresses == nil {
+		return nil
 	}
+	masks := make([]string, len(addresses))
+	copy(masks, addresses)
+	return masks
+}
+
+// ListEntries gets the masks of one of the channel's list modes along with
+// who set them and when.
+func (c *Channel) ListEntries(mode rune) []ListEntry {
+	addresses := c.GetAddresses(mode)
+	if addresses == nil {
+		return nil
+	}
+	entries := make([]ListEntry, len(addresses))
+	for i := 0; i < len(addresses); i++ {
+		entries[i] = c.getAddressInfo(mode, addresses[i])
+	}
+	return entries
+}
+
+// Exceptions gets the ban exceptions of the channel.
+func (c *Channel) Exceptions() []string {
+	return c.List(exceptMode)
+}
+
+// Invexes gets the invite exceptions of the channel.
+func (c *Channel) Invexes() []string {
+	return c.List(invexMode)
+}
+
+// Quiets gets the quiets of the channel.
+func (c *Channel) Quiets() []string {
+	return c.List(quietMode)
 }
 
 // AddBan adds to the channel's bans.
@@ -77,13 +304,7 @@ func (c *Channel) AddBan(ban string) {
 
 // Bans gets the bans of the channel.
 func (c *Channel) Bans() []string {
-	getBans := c.GetAddresses(banMode)
-	if getBans == nil {
-		return nil
-	}
-	bans := make([]string, len(getBans))
-	copy(bans, getBans)
-	return bans
+	return c.List(banMode)
 }
 
 // HasBan checks to see if a specific mask is present in the banlist.
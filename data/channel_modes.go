@@ -2,6 +2,7 @@ package data
 
 import (
 	"strings"
+	"time"
 )
 
 // ChannelModes encapsulates flag-based modestrings, setting and getting any
@@ -13,6 +14,7 @@ type ChannelModes struct {
 	modes        map[rune]bool
 	argModes     map[rune]string
 	addressModes map[rune][]string
+	addressInfo  map[rune]map[string]ListEntry
 
 	*ChannelModeKinds
 	userModeKinds *UserModeKinds
@@ -287,6 +289,30 @@ func (m *ChannelModes) setAddress(mode rune, address string) {
 	}
 }
 
+// setAddressInfo sets an address for a mode and remembers who set it and
+// when. The info is forgotten when the address is unset.
+func (m *ChannelModes) setAddressInfo(mode rune, address, setBy string,
+	setAt time.Time) {
+
+	m.setAddress(mode, address)
+	if m.addressInfo == nil {
+		m.addressInfo = make(map[rune]map[string]ListEntry)
+	}
+	if m.addressInfo[mode] == nil {
+		m.addressInfo[mode] = make(map[string]ListEntry)
+	}
+	m.addressInfo[mode][address] = ListEntry{address, setBy, setAt}
+}
+
+// getAddressInfo gets what's known about an address set for a mode, only
+// the Mask is filled in if it's not known who set it.
+func (m *ChannelModes) getAddressInfo(mode rune, address string) ListEntry {
+	if info, ok := m.addressInfo[mode][address]; ok {
+		return info
+	}
+	return ListEntry{Mask: address}
+}
+
 // unsetAddress unsets an address for a mode.
 func (m *ChannelModes) unsetAddress(mode rune, address string) {
 	if addresses, has := m.addressModes[mode]; has {
@@ -294,6 +320,7 @@ func (m *ChannelModes) unsetAddress(mode rune, address string) {
 		for ; i < lenaddr && addresses[i] != address; i++ {
 		}
 		if i < lenaddr {
+			delete(m.addressInfo[mode], address)
 			if lenaddr == 1 {
 				delete(m.addressModes, mode)
 				m.addresses--
@@ -2,6 +2,8 @@ package data
 
 import (
 	"strings"
+
+	"github.com/aarondl/ultimateq/irc"
 )
 
 // ModeDiff encapsulates a difference of modes, a combination of both positive
@@ -25,6 +27,28 @@ func NewModeDiff(
 	}
 }
 
+// NewModeDiffFromChange creates the ModeDiff of an irc.MODECHANGED state
+// change event, using the event's network information to parse it.
+func NewModeDiffFromChange(ev *irc.Event) (*ModeDiff, error) {
+	if ev.NetworkInfo == nil {
+		return nil, errProtoCapsMissing
+	}
+	kinds, err := NewChannelModeKindsCSV(ev.NetworkInfo.Chanmodes())
+	if err != nil {
+		return nil, err
+	}
+	userKinds, err := NewUserModeKinds(ev.NetworkInfo.Prefix())
+	if err != nil {
+		return nil, err
+	}
+
+	diff := NewModeDiff(kinds, userKinds)
+	if len(ev.Args) >= 2 {
+		diff.Apply(ev.Args[1])
+	}
+	return diff, nil
+}
+
 // IsSet checks if applying this diff will set the given simple modestrs.
 func (d *ModeDiff) IsSet(modestrs ...string) bool {
 	return d.pos.IsSet(modestrs...)
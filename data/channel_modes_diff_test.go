@@ -1,6 +1,7 @@
 package data
 
 import (
+	"github.com/aarondl/ultimateq/irc"
 	. "gopkg.in/check.v1"
 )
 
@@ -63,6 +64,19 @@ func (s *s) TestModeDiff_Apply(c *C) {
 	c.Check(d.IsUnset("z"), Equals, false)
 }
 
+func (s *s) TestModeDiff_FromChange(c *C) {
+	ev := irc.NewEvent("netID", netInfo, irc.MODECHANGED, "nick!user@host",
+		"#chan", "+mb-n *!*@host")
+	d, err := NewModeDiffFromChange(ev)
+	c.Check(err, IsNil)
+	c.Check(d.IsSet("m", "b *!*@host"), Equals, true)
+	c.Check(d.IsUnset("n"), Equals, true)
+
+	ev.NetworkInfo = nil
+	_, err = NewModeDiffFromChange(ev)
+	c.Check(err, Equals, errProtoCapsMissing)
+}
+
 func (s *s) TestModeDiff_String(c *C) {
 	diff := NewModeDiff(testChannelKinds, testUserKinds)
 	diff.pos.Set("a", "b host1", "c 1")
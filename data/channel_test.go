@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -26,6 +28,36 @@ func (s *s) TestChannel_GettersSetters(c *C) {
 	c.Check(ch.Topic(), Equals, topic)
 }
 
+func (s *s) TestChannel_TopicHistory(c *C) {
+	ch := NewChannel("name", testChannelKinds, testUserKinds)
+	setAt := time.Unix(1367197165, 0)
+
+	c.Check(ch.TopicHistory(), IsNil)
+	ch.SetTopic("first")
+	ch.SetTopicInfo("nick", setAt)
+	c.Check(ch.TopicInfo(), Equals, TopicEntry{"first", "nick", setAt})
+
+	ch.SetTopic("first")
+	c.Check(ch.TopicHistory(), IsNil)
+	ch.SetTopic("second")
+	c.Check(ch.TopicInfo(), Equals, TopicEntry{Topic: "second"})
+	c.Check(ch.TopicHistory(), DeepEquals,
+		[]TopicEntry{{"first", "nick", setAt}})
+
+	for i := 0; i < topicHistoryLength+5; i++ {
+		ch.SetTopic(string(rune('a' + i)))
+	}
+	history := ch.TopicHistory()
+	c.Check(len(history), Equals, topicHistoryLength)
+	c.Check(history[0].Topic, Equals, string(rune('a'+topicHistoryLength+3)))
+
+	ch.SetTopicHistory([]TopicEntry{{Topic: "restored"}})
+	c.Check(ch.TopicHistory(), DeepEquals, []TopicEntry{{Topic: "restored"}})
+	ch.SetTopic("")
+	c.Check(ch.TopicHistory()[0].Topic, Equals,
+		string(rune('a'+topicHistoryLength+4)))
+}
+
 func (s *s) TestChannel_Bans(c *C) {
 	bans := []string{"ban1", "ban2"}
 	ch := NewChannel("name", testChannelKinds, testUserKinds)
@@ -58,6 +90,72 @@ func (s *s) TestChannel_IsBanned(c *C) {
 	c.Check(ch.IsBanned("notnick!user@host.com"), Equals, true)
 }
 
+func (s *s) TestChannel_IsBannedExceptions(c *C) {
+	ch := NewChannel("name", testChannelKinds, testUserKinds)
+	ch.SetBans([]string{"*!*@host.com", "$a:bad*", "~R:evil", "$~a"})
+	ch.SetList('e', []string{"nick!*@*", "$a:good"})
+
+	c.Check(ch.IsBanned("other!user@host.com"), Equals, true)
+	c.Check(ch.IsBanned("nick!user@host.com"), Equals, false)
+	c.Check(ch.IsBanned("other!user@host.net"), Equals, false)
+
+	user := NewUser("other!user@host.net")
+	c.Check(ch.IsUserBanned(user), Equals, true)
+	user.SetAccount("Badger")
+	c.Check(ch.IsUserBanned(user), Equals, true)
+	user.SetAccount("evil")
+	c.Check(ch.IsUserBanned(user), Equals, true)
+	user.SetAccount("nice")
+	c.Check(ch.IsUserBanned(user), Equals, false)
+
+	user = NewUser("other!user@host.com")
+	user.SetAccount("good")
+	c.Check(ch.IsUserBanned(user), Equals, false)
+}
+
+func (s *s) TestChannel_QuietsInvexes(c *C) {
+	ch := NewChannel("name", testChannelKinds, testUserKinds)
+	ch.SetList('q', []string{"*!*@host.com"})
+	ch.SetList('I', []string{"$a:friend"})
+	ch.SetList('e', []string{"nick!*@*"})
+
+	c.Check(ch.Quiets(), DeepEquals, []string{"*!*@host.com"})
+	c.Check(ch.Invexes(), DeepEquals, []string{"$a:friend"})
+	c.Check(ch.Exceptions(), DeepEquals, []string{"nick!*@*"})
+
+	c.Check(ch.IsQuieted(NewUser("other!user@host.com")), Equals, true)
+	c.Check(ch.IsQuieted(NewUser("nick!user@host.com")), Equals, false)
+	c.Check(ch.IsQuieted(NewUser("other!user@host.net")), Equals, false)
+
+	user := NewUser("other!user@host.net")
+	c.Check(ch.IsInvited(user), Equals, false)
+	user.SetAccount("friend")
+	c.Check(ch.IsInvited(user), Equals, true)
+}
+
+func (s *s) TestChannel_ListEntries(c *C) {
+	ch := NewChannel("name", testChannelKinds, testUserKinds)
+	setAt := time.Unix(1367197165, 0)
+
+	c.Check(ch.ListEntries('e'), IsNil)
+	ch.AddListEntry('e', "*!*@host", "nick", setAt)
+	ch.SetList('b', []string{"ban1"})
+	ch.AddBan("ban2")
+
+	c.Check(ch.ListEntries('e'), DeepEquals,
+		[]ListEntry{{"*!*@host", "nick", setAt}})
+	c.Check(ch.ListEntries('b'), DeepEquals,
+		[]ListEntry{{Mask: "ban1"}, {Mask: "ban2"}})
+
+	ch.SetList('b', []string{"ban3"})
+	c.Check(ch.Bans(), DeepEquals, []string{"ban3"})
+
+	ch.DeleteListEntry('e', "*!*@host")
+	c.Check(ch.ListEntries('e'), IsNil)
+	ch.AddListEntry('e', "*!*@host", "", time.Time{})
+	c.Check(ch.ListEntries('e'), DeepEquals, []ListEntry{{Mask: "*!*@host"}})
+}
+
 func (s *s) TestChannel_DeleteBanWild(c *C) {
 	bans := []string{"*!*@host.com", "nick!*@*", "nick2!*@*"}
 	ch := NewChannel("name", testChannelKinds, testUserKinds)
@@ -1,9 +1,35 @@
 package data
 
+import "time"
+
+// ChannelActivity is what's known about what a user has done on a channel.
+// It's shared by the ChannelUser and UserChannel of the user and channel.
+type ChannelActivity struct {
+	// Joined is when the user joined the channel, or when they were first
+	// seen on it if they were there before the client.
+	Joined time.Time
+	// LastMessage is when the user last sent a message to the channel, zero
+	// if they have not since they joined.
+	LastMessage time.Time
+	// LastText is the last message the user sent to the channel.
+	LastText string
+}
+
+// Idle returns how long it's been since the user last sent a message to the
+// channel, or since they joined if they have not.
+func (a *ChannelActivity) Idle(now time.Time) time.Duration {
+	if a.LastMessage.After(a.Joined) {
+		return now.Sub(a.LastMessage)
+	}
+	return now.Sub(a.Joined)
+}
+
 // ChannelUser represents a user that's on a channel.
 type ChannelUser struct {
 	User *User
 	*UserModes
+	// Activity is nil unless the ChannelUser was created by State.
+	Activity *ChannelActivity
 }
 
 // NewChannelUser creates a channel user that represents a channel that
@@ -19,6 +45,8 @@ func NewChannelUser(u *User, m *UserModes) *ChannelUser {
 type UserChannel struct {
 	Channel *Channel
 	*UserModes
+	// Activity is nil unless the UserChannel was created by State.
+	Activity *ChannelActivity
 }
 
 // NewUserChannel creates a user channel that represents a user that is
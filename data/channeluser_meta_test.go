@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -33,3 +35,12 @@ func (s *s) TestUserChannel(c *C) {
 	c.Check(uc.Channel, Equals, ch)
 	c.Check(uc.UserModes, Equals, modes)
 }
+
+func (s *s) TestChannelActivity_Idle(c *C) {
+	now := time.Now()
+	a := &ChannelActivity{Joined: now.Add(-time.Hour)}
+	c.Check(a.Idle(now), Equals, time.Hour)
+
+	a.LastMessage = now.Add(-time.Minute)
+	c.Check(a.Idle(now), Equals, time.Minute)
+}
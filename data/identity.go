@@ -0,0 +1,134 @@
+package data
+
+import (
+	"sort"
+	"strings"
+)
+
+// Identity is a user correlated with the users on other networks that are
+// the same person: users authenticated to the same StoredUser, or logged in
+// to services accounts of the same name.
+type Identity struct {
+	// Username is the StoredUser the user is authenticated as, empty if
+	// they're not.
+	Username string
+	// Account is the services account the user is logged in to, empty if
+	// they're not or it's not known.
+	Account string
+	// Users are the users that are the same person, the user the identity
+	// was looked up for first and the rest sorted by network.
+	Users []NetworkUser
+}
+
+// NetworkUser is a copy of what's known about a user on a network.
+type NetworkUser struct {
+	NetworkID string
+	Host      string
+	// Username is the StoredUser the user is authenticated as on the
+	// network, empty if they're not.
+	Username string
+	// Account is the services account the user is logged in to on the
+	// network, empty if they're not or it's not known.
+	Account string
+	// Channels are the channels the user is on that the client is also on.
+	Channels []string
+}
+
+// Networks returns the networks the user is on, the network the identity
+// was looked up on first.
+func (id *Identity) Networks() []string {
+	var networks []string
+	seen := make(map[string]bool)
+	for _, u := range id.Users {
+		if !seen[u.NetworkID] {
+			seen[u.NetworkID] = true
+			networks = append(networks, u.NetworkID)
+		}
+	}
+	return networks
+}
+
+// Correlate finds the users on all the networks whose states are given that
+// are the same person as a user on one of them. It returns nil if the user is
+// not known to the network's state. The store may be nil, in which case only
+// services accounts are correlated. The states and store must be locked for
+// reading by the caller.
+func Correlate(networkID, nickorhost string, states map[string]*State,
+	store *Store) *Identity {
+
+	state := states[networkID]
+	if state == nil {
+		return nil
+	}
+	user := state.GetUser(nickorhost)
+	if user == nil {
+		return nil
+	}
+
+	first := newNetworkUser(networkID, state, user, store)
+	id := &Identity{
+		Username: first.Username,
+		Account:  first.Account,
+		Users:    []NetworkUser{first},
+	}
+	if len(id.Username) == 0 && len(id.Account) == 0 {
+		return id
+	}
+
+	networks := make([]string, 0, len(states))
+	for network := range states {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	for _, network := range networks {
+		st := states[network]
+		if st == nil {
+			continue
+		}
+
+		var found []NetworkUser
+		for _, u := range st.users {
+			if network == networkID && u == user {
+				continue
+			}
+			nu := newNetworkUser(network, st, u, store)
+			if id.matches(nu) {
+				found = append(found, nu)
+			}
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].Host < found[j].Host
+		})
+		id.Users = append(id.Users, found...)
+	}
+
+	return id
+}
+
+// matches checks if a user is the same person as the identity.
+func (id *Identity) matches(nu NetworkUser) bool {
+	if len(id.Username) != 0 && nu.Username == id.Username {
+		return true
+	}
+	return len(id.Account) != 0 && strings.EqualFold(nu.Account, id.Account)
+}
+
+// newNetworkUser copies what's known about a user on a network.
+func newNetworkUser(networkID string, state *State, user *User,
+	store *Store) NetworkUser {
+
+	nu := NetworkUser{
+		NetworkID: networkID,
+		Host:      user.Host(),
+		Account:   user.Account(),
+		Channels:  state.GetUserChans(user.Host()),
+	}
+	sort.Strings(nu.Channels)
+	if store != nil {
+		if access := store.GetAuthedUser(networkID, nu.Host); access != nil {
+			nu.Username = access.Username
+		}
+	}
+	return nu
+}
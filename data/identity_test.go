@@ -0,0 +1,73 @@
+package data
+
+import (
+	"github.com/aarondl/ultimateq/irc"
+	. "gopkg.in/check.v1"
+)
+
+func (s *s) TestCorrelate(c *C) {
+	newState := func(hosts ...string) *State {
+		st, err := NewState(netInfo)
+		c.Assert(err, IsNil)
+		st.Self = self
+		st.addChannel(channels[0])
+		for _, h := range hosts {
+			st.addUser(h)
+			st.addToChannel(h, channels[0])
+		}
+		return st
+	}
+
+	net1 := newState("bob!b@b.net", "eve!e@e.net")
+	net2 := newState("robert!r@r.net", "bob!x@x.net", "alice!a@a.net")
+	net3 := newState("bobby!y@y.net")
+	net2.GetUser("alice").SetAccount("BOB")
+	net3.GetUser("bobby").SetAccount("bob")
+	states := map[string]*State{"net1": net1, "net2": net2, "net3": net3}
+
+	store, err := NewStore(MemStoreProvider)
+	c.Assert(err, IsNil)
+	defer store.Close()
+	user, err := NewStoredUser("bobuser", "pass", "*!*@*")
+	c.Assert(err, IsNil)
+	c.Assert(store.SaveUser(user), IsNil)
+	_, err = store.AuthUser("net1", "bob!b@b.net", "bobuser", "pass")
+	c.Assert(err, IsNil)
+	_, err = store.AuthUser("net2", "robert!r@r.net", "bobuser", "pass")
+	c.Assert(err, IsNil)
+
+	c.Check(Correlate("net4", "bob", states, store), IsNil)
+	c.Check(Correlate("net1", "nobody", states, store), IsNil)
+
+	id := Correlate("net1", "eve", states, store)
+	c.Check(id.Users, HasLen, 1)
+	c.Check(id.Username, Equals, "")
+
+	// The nick bob on net2 is someone else.
+	id = Correlate("net1", "bob", states, store)
+	c.Check(id.Username, Equals, "bobuser")
+	c.Check(id.Account, Equals, "")
+	c.Check(id.Networks(), DeepEquals, []string{"net1", "net2"})
+	c.Check(id.Users, DeepEquals, []NetworkUser{
+		{"net1", "bob!b@b.net", "bobuser", "", []string{channels[0]}},
+		{"net2", "robert!r@r.net", "bobuser", "", []string{channels[0]}},
+	})
+
+	net1.GetUser("bob").SetAccount("Bob")
+	id = Correlate("net1", "bob!b@b.net", states, store)
+	c.Check(id.Account, Equals, "Bob")
+	c.Check(id.Networks(), DeepEquals, []string{"net1", "net2", "net3"})
+	c.Check(id.Users, HasLen, 4)
+	c.Check(id.Users[2].Host, Equals, "robert!r@r.net")
+	c.Check(id.Users[1].Host, Equals, "alice!a@a.net")
+
+	id = Correlate("net3", "bobby", states, nil)
+	c.Check(id.Users, HasLen, 3)
+	c.Check(id.Users[0].NetworkID, Equals, "net3")
+	c.Check(id.Users[0].Username, Equals, "")
+
+	net2.Update(&irc.Event{Name: irc.QUIT, Sender: "alice!a@a.net",
+		Args: []string{"bye"}, NetworkInfo: netInfo})
+	id = Correlate("net3", "bobby", states, nil)
+	c.Check(id.Networks(), DeepEquals, []string{"net3", "net1"})
+}
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// ctcpAction is the CTCP tag of a /me.
+const ctcpAction = "ACTION"
+
+// Line is a message said on a channel that's kept in its scrollback.
+type Line struct {
+	// Time is when the message was received.
+	Time time.Time
+	// Sender is the fullhost of the user who said it.
+	Sender string
+	// Kind is irc.PRIVMSG, irc.NOTICE or ACTION for a /me.
+	Kind string
+	// Text is the message, without the CTCP delimiters for an ACTION.
+	Text string
+}
+
+// Nick returns the nick of the user who said the line.
+func (l Line) Nick() string {
+	return irc.Nick(l.Sender)
+}
+
+// size is how many bytes the line takes up towards the scrollback's limit.
+func (l Line) size() uint {
+	return uint(len(l.Sender) + len(l.Kind) + len(l.Text))
+}
+
+// ScrollbackQuery narrows down the lines returned from a channel's
+// scrollback. Fields left as their zero value match every line.
+type ScrollbackQuery struct {
+	// Nick matches lines said by the user, case insensitively. It may be a
+	// fullhost.
+	Nick string
+	// Pattern matches lines whose text it matches.
+	Pattern *regexp.Regexp
+	// Since and Until match lines said in the time range, both inclusive.
+	Since time.Time
+	Until time.Time
+	// Limit is the most lines to return.
+	Limit int
+}
+
+// match checks if the query matches the line.
+func (q ScrollbackQuery) match(l Line) bool {
+	if len(q.Nick) != 0 && !strings.EqualFold(irc.Nick(q.Nick), l.Nick()) {
+		return false
+	}
+	if !q.Since.IsZero() && l.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && l.Time.After(q.Until) {
+		return false
+	}
+	return q.Pattern == nil || q.Pattern.MatchString(l.Text)
+}
+
+// scrollback is a ring buffer of the latest lines said on a channel. Lines
+// are dropped oldest first once there are too many of them or they take up
+// too many bytes.
+type scrollback struct {
+	lines []Line
+	start int
+	count int
+	bytes uint
+}
+
+// add adds a line to the scrollback, dropping the oldest lines to make room.
+// maxBytes of 0 means there's no limit on bytes.
+func (sb *scrollback) add(l Line, maxBytes uint) {
+	if len(sb.lines) == 0 {
+		return
+	}
+	if sb.count == len(sb.lines) {
+		sb.drop()
+	}
+	for maxBytes != 0 && sb.count > 0 && sb.bytes+l.size() > maxBytes {
+		sb.drop()
+	}
+
+	sb.lines[(sb.start+sb.count)%len(sb.lines)] = l
+	sb.count++
+	sb.bytes += l.size()
+}
+
+// drop removes the oldest line.
+func (sb *scrollback) drop() {
+	sb.bytes -= sb.lines[sb.start].size()
+	sb.lines[sb.start] = Line{}
+	sb.start = (sb.start + 1) % len(sb.lines)
+	sb.count--
+}
+
+// get returns the i'th oldest line.
+func (sb *scrollback) get(i int) Line {
+	return sb.lines[(sb.start+i)%len(sb.lines)]
+}
+
+// resize changes how many lines the scrollback holds, dropping the oldest
+// lines if it holds fewer than before, and then drops the oldest lines until
+// they fit into maxBytes.
+func (sb *scrollback) resize(maxLines, maxBytes uint) {
+	for uint(sb.count) > maxLines {
+		sb.drop()
+	}
+	for maxBytes != 0 && sb.count > 0 && sb.bytes > maxBytes {
+		sb.drop()
+	}
+
+	lines := make([]Line, maxLines)
+	for i := 0; i < sb.count; i++ {
+		lines[i] = sb.get(i)
+	}
+	sb.lines = lines
+	sb.start = 0
+}
+
+// SetScrollback sets how many of the latest messages are remembered on each
+// channel and how many bytes they may take up, 0 bytes meaning there's no
+// limit. 0 lines disables the scrollback and forgets the messages remembered
+// so far.
+func (s *State) SetScrollback(lines, bytes uint) {
+	s.scrollbackLines, s.scrollbackBytes = lines, bytes
+
+	if lines == 0 {
+		s.scrollbacks = make(map[string]*scrollback)
+		return
+	}
+	for _, sb := range s.scrollbacks {
+		sb.resize(lines, bytes)
+	}
+}
+
+// Scrollback returns the lines remembered on a channel that match the query,
+// newest first.
+func (s *State) Scrollback(channel string, query ScrollbackQuery) []Line {
+	sb, ok := s.scrollbacks[strings.ToLower(channel)]
+	if !ok {
+		return nil
+	}
+
+	var lines []Line
+	for i := sb.count - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(lines) >= query.Limit {
+			break
+		}
+		if l := sb.get(i); query.match(l) {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// addScrollback remembers a PRIVMSG or NOTICE to a channel in its
+// scrollback. CTCPs other than ACTION are not remembered.
+func (s *State) addScrollback(ev *irc.Event) {
+	if s.scrollbackLines == 0 || len(ev.Args) < 2 {
+		return
+	}
+
+	l := Line{Time: ev.Time, Sender: ev.Sender, Kind: ev.Name, Text: ev.Args[1]}
+	if l.Time.IsZero() {
+		l.Time = s.now()
+	}
+	if ev.IsCTCP() {
+		tag, data := ev.UnpackCTCP()
+		if ev.Name != irc.PRIVMSG || tag != ctcpAction {
+			return
+		}
+		l.Kind, l.Text = ctcpAction, data
+	}
+
+	key := strings.ToLower(ev.Args[0])
+	sb, ok := s.scrollbacks[key]
+	if !ok {
+		sb = &scrollback{lines: make([]Line, s.scrollbackLines)}
+		s.scrollbacks[key] = sb
+	}
+	sb.add(l, s.scrollbackBytes)
+}
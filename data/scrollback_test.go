@@ -0,0 +1,114 @@
+package data
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+	. "gopkg.in/check.v1"
+)
+
+func (s *s) TestState_Scrollback(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = self
+	st.addChannel(channels[0])
+	st.SetScrollback(10, 0)
+
+	start := time.Unix(1367197165, 0)
+	msgs := []struct {
+		name, sender, text string
+	}{
+		{irc.PRIVMSG, users[0], "hello there"},
+		{irc.NOTICE, users[1], "a notice"},
+		{irc.PRIVMSG, users[1], "\x01ACTION waves\x01"},
+		{irc.PRIVMSG, users[0], "\x01VERSION\x01"},
+		{irc.PRIVMSG, users[0], "hello again"},
+	}
+	for i, msg := range msgs {
+		st.Update(&irc.Event{
+			Name:        msg.name,
+			Sender:      msg.sender,
+			Args:        []string{channels[0], msg.text},
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			NetworkInfo: netInfo,
+		})
+	}
+	st.Update(&irc.Event{Name: irc.PRIVMSG, Sender: users[0],
+		Args: []string{channels[1], "not joined"}, NetworkInfo: netInfo})
+
+	c.Check(st.Scrollback(channels[1], ScrollbackQuery{}), IsNil)
+
+	lines := st.Scrollback(channels[0], ScrollbackQuery{})
+	c.Check(lines, DeepEquals, []Line{
+		{start.Add(4 * time.Minute), users[0], irc.PRIVMSG, "hello again"},
+		{start.Add(2 * time.Minute), users[1], ctcpAction, "waves"},
+		{start.Add(time.Minute), users[1], irc.NOTICE, "a notice"},
+		{start, users[0], irc.PRIVMSG, "hello there"},
+	})
+
+	lines = st.Scrollback(channels[0], ScrollbackQuery{Nick: "NICK1"})
+	c.Check(lines, HasLen, 2)
+	lines = st.Scrollback(channels[0], ScrollbackQuery{Nick: users[1]})
+	c.Check(lines, HasLen, 2)
+
+	lines = st.Scrollback(channels[0], ScrollbackQuery{
+		Pattern: regexp.MustCompile(`^hello`),
+		Limit:   1,
+	})
+	c.Check(lines, HasLen, 1)
+	c.Check(lines[0].Text, Equals, "hello again")
+
+	lines = st.Scrollback(channels[0], ScrollbackQuery{
+		Since: start.Add(time.Minute),
+		Until: start.Add(2 * time.Minute),
+	})
+	c.Check(lines, HasLen, 2)
+	c.Check(lines[0].Nick(), Equals, nicks[1])
+
+	st.Update(&irc.Event{Name: irc.PART, Sender: self.Host(),
+		Args: []string{channels[0]}})
+	c.Check(st.Scrollback(channels[0], ScrollbackQuery{}), IsNil)
+}
+
+func (s *s) TestState_ScrollbackLimits(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	say := func(text string) {
+		st.Update(&irc.Event{Name: irc.PRIVMSG, Sender: users[0],
+			Args: []string{channels[0], text}, NetworkInfo: netInfo})
+	}
+	texts := func() (t []string) {
+		for _, l := range st.Scrollback(channels[0], ScrollbackQuery{}) {
+			t = append(t, l.Text)
+		}
+		return t
+	}
+
+	say("disabled")
+	c.Check(texts(), IsNil)
+
+	st.SetScrollback(3, 0)
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		say(text)
+	}
+	c.Check(texts(), DeepEquals, []string{"5", "4", "3"})
+
+	st.SetScrollback(2, 0)
+	c.Check(texts(), DeepEquals, []string{"5", "4"})
+	st.SetScrollback(4, 0)
+	say("6")
+	say("7")
+	c.Check(texts(), DeepEquals, []string{"7", "6", "5", "4"})
+
+	size := Line{Sender: users[0], Kind: irc.PRIVMSG, Text: "8"}.size()
+	st.SetScrollback(4, 2*size)
+	c.Check(texts(), DeepEquals, []string{"7", "6"})
+	say("8")
+	c.Check(texts(), DeepEquals, []string{"8", "7"})
+
+	st.SetScrollback(0, 0)
+	c.Check(texts(), IsNil)
+}
@@ -0,0 +1,310 @@
+package data
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is a copy of everything a State knows that can be serialized, to
+// be restored into a State later or inspected offline.
+type Snapshot struct {
+	// Time is when the snapshot was taken.
+	Time     time.Time
+	Self     SelfSnapshot
+	Users    []UserSnapshot
+	Channels []ChannelSnapshot
+}
+
+// SelfSnapshot is a copy of the client's own user and user modes.
+type SelfSnapshot struct {
+	Host  string
+	Modes string
+}
+
+// UserSnapshot is a copy of a User.
+type UserSnapshot struct {
+	Host        string
+	Realname    string
+	Away        bool
+	AwayMsg     string
+	Account     string
+	Bot         bool
+	Oper        bool
+	Secure      bool
+	OldNick     string
+	NickChanged time.Time
+}
+
+// ChannelSnapshot is a copy of a Channel, the users on it and its
+// scrollback.
+type ChannelSnapshot struct {
+	Name         string
+	Topic        TopicEntry
+	TopicHistory []TopicEntry
+	Synced       bool
+	// Modes are the modes set on the channel that have no argument.
+	Modes string
+	// Args are the modes set on the channel that have an argument.
+	Args map[string]string
+	// Lists are the masks on each of the channel's list modes, like bans.
+	Lists      map[string][]ListEntry
+	Users      []ChannelUserSnapshot
+	Scrollback []Line
+}
+
+// ChannelUserSnapshot is a copy of a user's modes and activity on a channel.
+type ChannelUserSnapshot struct {
+	Nick     string
+	Modes    string
+	Activity ChannelActivity
+}
+
+// Snapshot copies everything the State knows.
+func (s *State) Snapshot() *Snapshot {
+	snap := s.snapshotSelf()
+	for _, user := range s.users {
+		snap.Users = append(snap.Users, snapshotUser(user))
+	}
+	for key := range s.channels {
+		snap.Channels = append(snap.Channels, s.snapshotChannel(key))
+	}
+	sortSnapshot(snap)
+	return snap
+}
+
+// SnapshotChannel copies what the State knows about a channel and the users
+// on it, nil if the channel is not known.
+func (s *State) SnapshotChannel(channel string) *Snapshot {
+	key := strings.ToLower(channel)
+	if _, ok := s.channels[key]; !ok {
+		return nil
+	}
+
+	snap := s.snapshotSelf()
+	for _, cu := range s.channelUsers[key] {
+		snap.Users = append(snap.Users, snapshotUser(cu.User))
+	}
+	snap.Channels = append(snap.Channels, s.snapshotChannel(key))
+	sortSnapshot(snap)
+	return snap
+}
+
+// sortSnapshot sorts the users and channels of a snapshot by name so that
+// snapshots of the same State are the same.
+func sortSnapshot(snap *Snapshot) {
+	sort.Slice(snap.Users, func(i, j int) bool {
+		return snap.Users[i].Host < snap.Users[j].Host
+	})
+	sort.Slice(snap.Channels, func(i, j int) bool {
+		return snap.Channels[i].Name < snap.Channels[j].Name
+	})
+	for _, ch := range snap.Channels {
+		sort.Slice(ch.Users, func(i, j int) bool {
+			return ch.Users[i].Nick < ch.Users[j].Nick
+		})
+	}
+}
+
+// snapshotSelf creates a snapshot of only the client's self.
+func (s *State) snapshotSelf() *Snapshot {
+	snap := &Snapshot{Time: s.now()}
+	if s.Self.User != nil {
+		snap.Self.Host = s.Self.Host()
+	}
+	if s.Self.ChannelModes != nil {
+		snap.Self.Modes = flagModes(s.Self.ChannelModes)
+	}
+	return snap
+}
+
+// flagModes returns the modes without arguments that are set, in order.
+func flagModes(m *ChannelModes) string {
+	modes := make([]rune, 0, len(m.modes))
+	for mode := range m.modes {
+		modes = append(modes, mode)
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i] < modes[j] })
+	return string(modes)
+}
+
+// snapshotUser copies a user.
+func snapshotUser(u *User) UserSnapshot {
+	return UserSnapshot{
+		Host:        u.Host(),
+		Realname:    u.name,
+		Away:        u.away,
+		AwayMsg:     u.awayMsg,
+		Account:     u.account,
+		Bot:         u.bot,
+		Oper:        u.oper,
+		Secure:      u.secure,
+		OldNick:     u.oldNick,
+		NickChanged: u.nickChanged,
+	}
+}
+
+// snapshotChannel copies a channel by its lowercased name.
+func (s *State) snapshotChannel(key string) ChannelSnapshot {
+	ch := s.channels[key]
+	snap := ChannelSnapshot{
+		Name:         ch.Name(),
+		Topic:        ch.TopicInfo(),
+		TopicHistory: ch.TopicHistory(),
+		Synced:       ch.synced,
+	}
+
+	snap.Modes = flagModes(ch.ChannelModes)
+	for mode, arg := range ch.argModes {
+		if snap.Args == nil {
+			snap.Args = make(map[string]string)
+		}
+		snap.Args[string(mode)] = arg
+	}
+	for mode := range ch.addressModes {
+		if snap.Lists == nil {
+			snap.Lists = make(map[string][]ListEntry)
+		}
+		snap.Lists[string(mode)] = ch.ListEntries(mode)
+	}
+
+	for _, cu := range s.channelUsers[key] {
+		cus := ChannelUserSnapshot{
+			Nick:  cu.User.Nick(),
+			Modes: cu.UserModes.String(),
+		}
+		if cu.Activity != nil {
+			cus.Activity = *cu.Activity
+		}
+		snap.Users = append(snap.Users, cus)
+	}
+
+	if sb, ok := s.scrollbacks[key]; ok {
+		for i := 0; i < sb.count; i++ {
+			snap.Scrollback = append(snap.Scrollback, sb.get(i))
+		}
+	}
+
+	return snap
+}
+
+// Restore replaces everything the State knows with a snapshot. The State's
+// network information and scrollback limits are kept, so a snapshot is best
+// restored into a State for the same network it was taken from.
+func (s *State) Restore(snap *Snapshot) {
+	s.channels = make(map[string]*Channel)
+	s.users = make(map[string]*User)
+	s.channelUsers = make(map[string]map[string]*ChannelUser)
+	s.userChannels = make(map[string]map[string]*UserChannel)
+	s.scrollbacks = make(map[string]*scrollback)
+
+	for _, us := range snap.Users {
+		if user := restoreUser(us); user != nil {
+			s.users[strings.ToLower(user.Nick())] = user
+		}
+	}
+
+	s.Self.User = nil
+	if len(snap.Self.Host) != 0 {
+		s.addUser(snap.Self.Host)
+		s.Self.User = s.GetUser(snap.Self.Host)
+	}
+	s.Self.ChannelModes = NewChannelModes(&ChannelModeKinds{}, nil)
+	for _, mode := range snap.Self.Modes {
+		s.Self.setMode(mode)
+	}
+
+	for _, cs := range snap.Channels {
+		s.restoreChannel(cs)
+	}
+}
+
+// restoreUser creates a user from a snapshot.
+func restoreUser(us UserSnapshot) *User {
+	user := NewUser(us.Host)
+	if user == nil {
+		return nil
+	}
+	user.name = us.Realname
+	user.away = us.Away
+	user.awayMsg = us.AwayMsg
+	user.account = us.Account
+	user.bot = us.Bot
+	user.oper = us.Oper
+	user.secure = us.Secure
+	user.oldNick = us.OldNick
+	user.nickChanged = us.NickChanged
+	return user
+}
+
+// restoreChannel adds a channel from a snapshot along with the users on it.
+func (s *State) restoreChannel(cs ChannelSnapshot) {
+	ch := s.addChannel(cs.Name)
+	if ch == nil {
+		return
+	}
+
+	ch.topicHistory = cs.TopicHistory
+	ch.topic = cs.Topic.Topic
+	ch.topicSetBy = cs.Topic.SetBy
+	ch.topicSetAt = cs.Topic.SetAt
+	ch.synced = cs.Synced
+
+	for _, mode := range cs.Modes {
+		ch.setMode(mode)
+	}
+	for mode, arg := range cs.Args {
+		for _, m := range mode {
+			ch.setArg(m, arg)
+		}
+	}
+	for mode, entries := range cs.Lists {
+		for _, m := range mode {
+			for _, entry := range entries {
+				ch.AddListEntry(m, entry.Mask, entry.SetBy, entry.SetAt)
+			}
+		}
+	}
+
+	for _, cus := range cs.Users {
+		s.addUser(cus.Nick)
+		s.addToChannel(cus.Nick, cs.Name)
+		modes := s.GetUsersChannelModes(cus.Nick, cs.Name)
+		if modes == nil {
+			continue
+		}
+		for _, mode := range cus.Modes {
+			modes.SetMode(mode)
+		}
+		activity := s.GetUsersChannelActivity(cus.Nick, cs.Name)
+		if activity != nil {
+			*activity = cus.Activity
+		}
+	}
+
+	if s.scrollbackLines != 0 && len(cs.Scrollback) != 0 {
+		sb := &scrollback{lines: make([]Line, s.scrollbackLines)}
+		for _, l := range cs.Scrollback {
+			sb.add(l, s.scrollbackBytes)
+		}
+		s.scrollbacks[strings.ToLower(cs.Name)] = sb
+	}
+}
+
+// MarshalJSON serializes a snapshot of the State.
+func (s *State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Snapshot())
+}
+
+// UnmarshalJSON restores a serialized snapshot into the State. The State
+// should be created with NewState first so it has the network information
+// needed to make sense of the modes in the snapshot.
+func (s *State) UnmarshalJSON(b []byte) error {
+	snap := &Snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return err
+	}
+	s.Restore(snap)
+	return nil
+}
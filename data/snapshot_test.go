@@ -0,0 +1,107 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+	. "gopkg.in/check.v1"
+)
+
+func (s *s) TestState_Snapshot(c *C) {
+	ni := irc.NewNetworkInfo()
+	ni.ParseISupport(&irc.Event{Args: []string{
+		"NICK", "CHANMODES=be,k,l,imnt", "PREFIX=(ov)@+",
+	}})
+
+	st, err := NewState(ni)
+	c.Check(err, IsNil)
+	now := time.Unix(1367197165, 0).UTC()
+	st.now = func() time.Time { return now }
+	st.SetScrollback(10, 0)
+
+	update := func(name, sender string, args ...string) {
+		ev := irc.NewEvent("", ni, name, sender, args...)
+		ev.Time = now
+		st.Update(ev)
+	}
+	update(irc.RPL_WELCOME, network, self.Nick(), "Welcome "+self.Host())
+	update(irc.MODE, self.Host(), self.Nick(), "+iw")
+	update(irc.JOIN, self.Host(), channels[0])
+	update(irc.JOIN, users[0], channels[0])
+	update(irc.JOIN, users[1], channels[0])
+	update(irc.JOIN, self.Host(), channels[1])
+	update(irc.JOIN, users[1], channels[1])
+	update(irc.MODE, users[0], channels[0], "+ntkl-v+ob", "key", "10",
+		nicks[1], nicks[0], "*!*@bad")
+	update(irc.TOPIC, users[0], channels[0], "a topic")
+	update(irc.PRIVMSG, users[1], channels[0], "hello")
+	st.GetUser(users[1]).SetAccount("acct")
+
+	snap := st.Snapshot()
+	c.Check(snap.Time, Equals, now)
+	c.Check(snap.Self, Equals, SelfSnapshot{self.Host(), "iw"})
+	c.Check(snap.Users, HasLen, 3)
+	c.Check(snap.Channels, HasLen, 2)
+	ch := snap.Channels[0]
+	c.Check(ch.Name, Equals, channels[0])
+	c.Check(ch.Modes, Equals, "nt")
+	c.Check(ch.Args, DeepEquals, map[string]string{"k": "key", "l": "10"})
+	c.Check(ch.Lists, DeepEquals, map[string][]ListEntry{
+		"b": {{"*!*@bad", users[0], now}},
+	})
+	c.Check(ch.Topic, Equals, TopicEntry{"a topic", users[0], now})
+	c.Check(ch.Users, HasLen, 3)
+	c.Check(ch.Scrollback, HasLen, 1)
+
+	js, err := json.Marshal(st)
+	c.Check(err, IsNil)
+
+	restored, err := NewState(ni)
+	c.Check(err, IsNil)
+	restored.SetScrollback(10, 0)
+	c.Check(json.Unmarshal(js, restored), IsNil)
+
+	restored.now = st.now
+	c.Check(restored.Snapshot(), DeepEquals, snap)
+
+	c.Check(restored.Self.Nick(), Equals, self.Nick())
+	c.Check(restored.GetUser(self.Nick()), Equals, restored.Self.User)
+	c.Check(restored.Self.IsSet("i"), Equals, true)
+	c.Check(restored.GetUser(users[1]).Account(), Equals, "acct")
+	c.Check(restored.IsOn(nicks[1], channels[1]), Equals, true)
+	c.Check(restored.GetUsersChannelModes(nicks[0], channels[0]).
+		HasMode('o'), Equals, true)
+	rch := restored.GetChannel(channels[0])
+	c.Check(rch.IsSet("k key", "l 10", "n", "t"), Equals, true)
+	c.Check(rch.IsUserBanned(NewUser("x!y@bad")), Equals, true)
+	lines := restored.Scrollback(channels[0], ScrollbackQuery{})
+	c.Check(lines, HasLen, 1)
+	c.Check(lines[0].Text, Equals, "hello")
+
+	update(irc.PART, users[1], channels[0])
+	c.Check(st.IsOn(nicks[1], channels[0]), Equals, false)
+	c.Check(restored.IsOn(nicks[1], channels[0]), Equals, true)
+}
+
+func (s *s) TestState_SnapshotChannel(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = self
+	st.addUser(self.Host())
+	st.addChannel(channels[0])
+	st.addChannel(channels[1])
+	st.addUser(users[0])
+	st.addUser(users[1])
+	st.addToChannel(users[0], channels[0])
+	st.addToChannel(users[1], channels[1])
+
+	c.Check(st.SnapshotChannel("#other"), IsNil)
+
+	snap := st.SnapshotChannel(channels[0])
+	c.Check(snap.Self.Host, Equals, self.Host())
+	c.Check(snap.Channels, HasLen, 1)
+	c.Check(snap.Channels[0].Name, Equals, channels[0])
+	c.Check(snap.Users, HasLen, 1)
+	c.Check(snap.Users[0].Host, Equals, users[0])
+}
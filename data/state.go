@@ -115,7 +115,9 @@ package data
 
 import (
 	"errors"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aarondl/ultimateq/irc"
 )
@@ -124,6 +126,21 @@ var (
 	errProtoCapsMissing = errors.New("data: Protocaps missing")
 )
 
+const (
+	// WHOXFields are the fields of a WHOX reply that the state understands,
+	// servers that support WHOX can be asked for them with:
+	// WHO <mask> WHOXFields
+	WHOXFields = "%tcuhnfar," + whoxToken
+	// whoxToken marks the WHOX replies that were asked for with WHOXFields.
+	// It's shorter than a numeric so it's never mistaken for one.
+	whoxToken = "42"
+	// whoxNoAccount is the account given by WHOX for users not logged in.
+	whoxNoAccount = "0"
+	// noAccount is the account given by extended-join and account-notify for
+	// users not logged in.
+	noAccount = "*"
+)
+
 // Self is the client's user, a special case since user modes must be stored.
 // Despite using the ChannelModes type, these are actually irc user modes that
 // have nothing to do with channels. For example +i or +x on some networks.
@@ -145,6 +162,23 @@ type State struct {
 
 	kinds  ChannelModeKinds
 	umodes UserModeKinds
+	// botMode is the user mode that marks users as bots, 0 if the network
+	// has none.
+	botMode rune
+
+	now func() time.Time
+	// seen is whether records of users' last activity are kept as they
+	// leave, seens are those made by the event being applied.
+	seen  bool
+	seens []*StoredSeen
+
+	// scrollbacks are the latest messages said on each channel.
+	scrollbacks     map[string]*scrollback
+	scrollbackLines uint
+	scrollbackBytes uint
+
+	// changes are the state change events made by the event being applied.
+	changes []*irc.Event
 }
 
 // NewState creates a state from an irc protocaps instance.
@@ -159,6 +193,8 @@ func NewState(netInfo *irc.NetworkInfo) (*State, error) {
 	state.users = make(map[string]*User)
 	state.channelUsers = make(map[string]map[string]*ChannelUser)
 	state.userChannels = make(map[string]map[string]*UserChannel)
+	state.scrollbacks = make(map[string]*scrollback)
+	state.now = time.Now
 
 	return state, nil
 }
@@ -179,6 +215,10 @@ func (s *State) SetNetworkInfo(ni *irc.NetworkInfo) error {
 
 	s.kinds = *kinds
 	s.umodes = *modes
+	s.botMode = 0
+	if bot := ni.Extra("BOT"); len(bot) == 1 {
+		s.botMode = rune(bot[0])
+	}
 	return nil
 }
 
@@ -208,6 +248,97 @@ func (s *State) GetUsersChannelModes(nickorhost, channel string) *UserModes {
 	return nil
 }
 
+// GetUsersChannelActivity gets the user's activity on the channel or nil if
+// they could not be found.
+func (s *State) GetUsersChannelActivity(nickorhost,
+	channel string) *ChannelActivity {
+
+	nick := strings.ToLower(irc.Nick(nickorhost))
+	channel = strings.ToLower(channel)
+
+	if nicks, ok := s.channelUsers[channel]; ok {
+		if cu, ok := nicks[nick]; ok {
+			return cu.Activity
+		}
+	}
+
+	return nil
+}
+
+// GetIdleChanUsers returns a string array of the users on a channel who have
+// not sent a message to it for at least the idle duration, see
+// ChannelActivity.Idle. The client itself is never included.
+func (s *State) GetIdleChanUsers(channel string, idle time.Duration) []string {
+	channel = strings.ToLower(channel)
+	cus, ok := s.channelUsers[channel]
+	if !ok {
+		return nil
+	}
+
+	self := ""
+	if s.Self.User != nil {
+		self = strings.ToLower(s.Self.Nick())
+	}
+
+	now := s.now()
+	ret := make([]string, 0)
+	for nick, cu := range cus {
+		if nick == self || cu.Activity == nil {
+			continue
+		}
+		if cu.Activity.Idle(now) >= idle {
+			ret = append(ret, cu.User.Host())
+		}
+	}
+	return ret
+}
+
+// SetSeen sets whether Update returns records of users' last activity as
+// they leave: when they part or are kicked from a channel, quit, or change
+// their nick. They can be remembered with Store.SaveSeen.
+func (s *State) SetSeen(on bool) {
+	s.seen = on
+}
+
+// Seen creates a record of a user's last activity, nil if the user is not
+// known. The action, channel and reason describe what the user is doing.
+func (s *State) Seen(nickorhost, action, channel, reason string) *StoredSeen {
+	user := s.GetUser(nickorhost)
+	if user == nil {
+		return nil
+	}
+
+	seen := &StoredSeen{
+		Nick:   user.Nick(),
+		Host:   user.Host(),
+		Action: action,
+		Where:  channel,
+		Reason: reason,
+		Left:   s.now(),
+	}
+
+	s.EachUserChan(nickorhost, func(uc *UserChannel) {
+		if uc.Activity != nil && uc.Activity.LastMessage.After(seen.SaidTime) {
+			seen.Said = uc.Activity.LastText
+			seen.SaidWhere = uc.Channel.Name()
+			seen.SaidTime = uc.Activity.LastMessage
+		}
+	})
+
+	return seen
+}
+
+// emitSeen keeps a record of a user's last activity to be returned from
+// Update.
+func (s *State) emitSeen(nickorhost, action, channel, reason string) {
+	if !s.seen {
+		return
+	}
+	if seen := s.Seen(nickorhost, action, channel, reason); seen != nil {
+		s.seens = append(s.seens, seen)
+	}
+}
+
 // GetNUsers returns the number of users in the database.
 func (s *State) GetNUsers() int {
 	return len(s.users)
@@ -392,6 +523,7 @@ func (s *State) removeChannel(channel string) {
 
 	delete(s.channelUsers, channel)
 	delete(s.channels, channel)
+	delete(s.scrollbacks, channel)
 }
 
 // addToChannel adds a user by nick or fullhost to the channel
@@ -430,8 +562,11 @@ func (s *State) addToChannel(nickorhost, channel string) {
 	}
 
 	modes := NewUserModes(&s.umodes)
+	activity := &ChannelActivity{Joined: s.now()}
 	cu[nick] = NewChannelUser(user, modes)
+	cu[nick].Activity = activity
 	uc[channel] = NewUserChannel(ch, modes)
+	uc[channel].Activity = activity
 	s.channelUsers[channel] = cu
 	s.userChannels[nick] = uc
 }
@@ -454,8 +589,14 @@ func (s *State) removeFromChannel(nickorhost, channel string) {
 	}
 }
 
-// Update uses the irc.IrcMessage to modify the database accordingly.
-func (s *State) Update(ev *irc.Event) {
+// Update uses the irc.IrcMessage to modify the database accordingly. It
+// returns the state change events (irc.USERJOINED, irc.TOPICCHANGED etc.)
+// that describe what was changed, so they can be dispatched once the state
+// is no longer being written to. The records of users who left are returned
+// the same way, so they can be saved without holding the state (see SetSeen).
+func (s *State) Update(ev *irc.Event) (changes []*irc.Event,
+	seen []*StoredSeen) {
+
 	if len(ev.Sender) > 0 {
 		s.addUser(ev.Sender)
 	}
@@ -476,6 +617,8 @@ func (s *State) Update(ev *irc.Event) {
 		s.topic(ev)
 	case irc.RPL_TOPIC:
 		s.rplTopic(ev)
+	case irc.RPL_TOPICWHOTIME:
+		s.rplTopicWhoTime(ev)
 	case irc.PRIVMSG, irc.NOTICE:
 		s.msg(ev)
 	case irc.RPL_WELCOME:
@@ -484,13 +627,45 @@ func (s *State) Update(ev *irc.Event) {
 		s.rplNameReply(ev)
 	case irc.RPL_WHOREPLY:
 		s.rplWhoReply(ev)
+	case irc.RPL_ENDOFWHO:
+		s.rplEndOfWho(ev)
 	case irc.RPL_CHANNELMODEIS:
 		s.rplChannelModeIs(ev)
 	case irc.RPL_BANLIST:
-		s.rplBanList(ev)
+		s.rplList(ev, banMode, 2)
+	case irc.RPL_EXCEPTLIST:
+		s.rplList(ev, exceptMode, 2)
+	case irc.RPL_INVITELIST:
+		s.rplList(ev, invexMode, 2)
+	case irc.RPL_QUIETLIST:
+		s.rplList(ev, quietMode, 3)
+	case irc.AWAY:
+		s.away(ev)
+	case irc.ACCOUNT:
+		s.account(ev)
+	case irc.CHGHOST:
+		s.chghost(ev)
+	case irc.SETNAME:
+		s.setname(ev)
+	case irc.RPL_AWAY:
+		s.rplAway(ev)
+	case irc.RPL_UNAWAY, irc.RPL_NOWAWAY:
+		s.rplNowAway(ev)
+	case irc.RPL_WHOSPCRPL:
+		s.rplWhoxReply(ev)
+	case irc.RPL_WHOISACCOUNT:
+		s.rplWhoisAccount(ev)
+	case irc.RPL_WHOISOPERATOR:
+		s.rplWhoisOperator(ev)
+	case irc.RPL_WHOISSECURE:
+		s.rplWhoisSecure(ev)
 
 		// TODO: Handle Whois
 	}
+
+	changes, s.changes = s.changes, nil
+	seen, s.seens = s.seens, nil
+	return changes, seen
 }
 
 // nick alters the state of the database when a NICK message is received.
@@ -499,10 +674,15 @@ func (s *State) nick(ev *irc.Event) {
 	newnick := ev.Args[0]
 	newuser := irc.Host(newnick + "!" + username + "@" + host)
 
+	s.emitSeen(nick, irc.NICK, "", newnick)
+	s.change(ev, irc.NICKCHANGED, ev.Sender, nick, newnick)
+
 	nick = strings.ToLower(nick)
 	newnick = strings.ToLower(newnick)
 
 	if user, ok := s.users[nick]; ok {
+		user.oldNick = user.Nick()
+		user.nickChanged = s.now()
 		user.host = newuser
 		for _, cus := range s.channelUsers {
 			if _, ok := cus[nick]; ok {
@@ -520,35 +700,69 @@ func (s *State) nick(ev *irc.Event) {
 }
 
 // join alters the state of the database when a JOIN message is received.
+// With extended-join the message also carries the user's account and real
+// name.
 func (s *State) join(ev *irc.Event) {
 	if ev.Sender == s.Self.Host() {
 		s.addChannel(ev.Args[0])
+		s.change(ev, irc.SELFJOINED, ev.Sender, ev.Args[0])
+	} else {
+		s.change(ev, irc.USERJOINED, ev.Sender, ev.Args[0])
 	}
 	s.addToChannel(ev.Sender, ev.Args[0])
+
+	if len(ev.Args) >= 3 {
+		if user := s.GetUser(ev.Sender); user != nil {
+			setAccount(user, ev.Args[1], noAccount)
+			user.SetRealname(ev.Args[2])
+		}
+	}
 }
 
 // part alters the state of the database when a PART message is received.
 func (s *State) part(ev *irc.Event) {
+	reason := ""
+	if len(ev.Args) >= 2 {
+		reason = ev.Args[1]
+	}
+
 	if ev.Sender == s.Self.Host() {
 		s.removeChannel(ev.Args[0])
+		s.change(ev, irc.SELFPARTED, ev.Sender, ev.Args[0], reason)
 	} else {
+		s.emitSeen(ev.Sender, irc.PART, ev.Args[0], reason)
 		s.removeFromChannel(ev.Sender, ev.Args[0])
+		s.change(ev, irc.USERPARTED, ev.Sender, ev.Args[0], reason)
 	}
 }
 
 // quit alters the state of the database when a QUIT message is received.
 func (s *State) quit(ev *irc.Event) {
 	if ev.Sender != s.Self.Host() {
+		reason := ""
+		if len(ev.Args) >= 1 {
+			reason = ev.Args[0]
+		}
+		s.emitSeen(ev.Sender, irc.QUIT, "", reason)
 		s.removeUser(ev.Sender)
+		s.change(ev, irc.USERQUIT, ev.Sender, reason)
 	}
 }
 
 // kick alters the state of the database when a KICK message is received.
 func (s *State) kick(ev *irc.Event) {
+	reason := ""
+	if len(ev.Args) >= 3 {
+		reason = ev.Args[2]
+	}
+
 	if ev.Args[1] == s.Self.Nick() {
 		s.removeChannel(ev.Args[0])
+		s.change(ev, irc.SELFKICKED, ev.Sender, ev.Args[0], ev.Args[1], reason)
 	} else {
+		s.emitSeen(ev.Args[1], irc.KICK, ev.Args[0], reason)
 		s.removeFromChannel(ev.Args[1], ev.Args[0])
+		s.change(ev, irc.USERKICKED, ev.Sender, ev.Args[0], ev.Args[1], reason)
 	}
 }
 
@@ -557,7 +771,16 @@ func (s *State) mode(ev *irc.Event) {
 	target := strings.ToLower(ev.Args[0])
 	if ev.IsTargetChan() {
 		if ch, ok := s.channels[target]; ok {
-			pos, neg := ch.Apply(strings.Join(ev.Args[1:], " "))
+			modestring := strings.Join(ev.Args[1:], " ")
+			diff := NewModeDiff(&s.kinds, &s.umodes)
+			diff.Apply(modestring)
+
+			pos, neg := ch.Apply(modestring)
+			for mode, masks := range diff.pos.addressModes {
+				for i := 0; i < len(masks); i++ {
+					ch.AddListEntry(mode, masks[i], ev.Sender, s.now())
+				}
+			}
 			for i := 0; i < len(pos); i++ {
 				nick := strings.ToLower(pos[i].Arg)
 				s.channelUsers[target][nick].SetMode(pos[i].Mode)
@@ -566,6 +789,18 @@ func (s *State) mode(ev *irc.Event) {
 				nick := strings.ToLower(neg[i].Arg)
 				s.channelUsers[target][nick].UnsetMode(neg[i].Mode)
 			}
+
+			if changed := diff.String(); len(changed) != 0 {
+				s.change(ev, irc.MODECHANGED, ev.Sender, ev.Args[0], changed)
+			}
+			for i := 0; i < len(pos); i++ {
+				s.change(ev, irc.USERMODECHANGED, ev.Sender, ev.Args[0],
+					pos[i].Arg, "+"+string(pos[i].Mode))
+			}
+			for i := 0; i < len(neg); i++ {
+				s.change(ev, irc.USERMODECHANGED, ev.Sender, ev.Args[0],
+					neg[i].Arg, "-"+string(neg[i].Mode))
+			}
 		}
 	} else if target == s.Self.Nick() {
 		s.Self.Apply(ev.Args[1])
@@ -574,31 +809,78 @@ func (s *State) mode(ev *irc.Event) {
 
 // topic alters the state of the database when a TOPIC message is received.
 func (s *State) topic(ev *irc.Event) {
-	chname := strings.ToLower(ev.Args[0])
-	if ch, ok := s.channels[chname]; ok {
-		if len(ev.Args) >= 2 {
-			ch.SetTopic(ev.Args[1])
-		} else {
-			ch.SetTopic("")
-		}
+	topic := ""
+	if len(ev.Args) >= 2 {
+		topic = ev.Args[1]
+	}
+	s.setTopic(ev, ev.Args[0], topic)
+	if ch := s.GetChannel(ev.Args[0]); ch != nil {
+		ch.SetTopicInfo(ev.Sender, s.now())
 	}
 }
 
 // rplTopic alters the state of the database when a RPL_TOPIC message is
 // received.
 func (s *State) rplTopic(ev *irc.Event) {
-	chname := strings.ToLower(ev.Args[1])
-	if ch, ok := s.channels[chname]; ok {
-		ch.SetTopic(ev.Args[2])
+	s.setTopic(ev, ev.Args[1], ev.Args[2])
+}
+
+// rplTopicWhoTime alters the state of the database when a RPL_TOPICWHOTIME
+// message is received.
+func (s *State) rplTopicWhoTime(ev *irc.Event) {
+	if len(ev.Args) < 4 {
+		return
+	}
+	ch := s.GetChannel(ev.Args[1])
+	if ch == nil {
+		return
+	}
+
+	var setAt time.Time
+	if unix, err := strconv.ParseInt(ev.Args[3], 10, 64); err == nil {
+		setAt = time.Unix(unix, 0)
+	}
+	ch.SetTopicInfo(ev.Args[2], setAt)
+}
+
+// setTopic sets the topic of a channel, noting the change if it's different.
+func (s *State) setTopic(ev *irc.Event, channel, topic string) {
+	ch, ok := s.channels[strings.ToLower(channel)]
+	if !ok {
+		return
+	}
+
+	old := ch.Topic()
+	ch.SetTopic(topic)
+	if old != topic {
+		s.change(ev, irc.TOPICCHANGED, ev.Sender, ch.Name(), old, topic)
 	}
 }
 
+// change notes a state change event made by the event being applied.
+func (s *State) change(ev *irc.Event, name, sender string, args ...string) {
+	s.changes = append(s.changes,
+		irc.NewEvent(ev.NetworkID, ev.NetworkInfo, name, sender, args...))
+}
+
 // msg alters the state of the database when a PRIVMSG or NOTICE message is
-// received.
+// received, records the message as the user's last on the channel and adds
+// it to the channel's scrollback.
 func (s *State) msg(ev *irc.Event) {
-	if ev.IsTargetChan() {
-		s.addToChannel(ev.Sender, ev.Args[0])
+	if !ev.IsTargetChan() {
+		return
+	}
+	if s.GetChannel(ev.Args[0]) == nil {
+		return
 	}
+
+	s.addToChannel(ev.Sender, ev.Args[0])
+	activity := s.GetUsersChannelActivity(ev.Sender, ev.Args[0])
+	if activity != nil && len(ev.Args) >= 2 {
+		activity.LastMessage = s.now()
+		activity.LastText = ev.Args[1]
+	}
+	s.addScrollback(ev)
 }
 
 // rplWelcome alters the state of the database when a RPL_WELCOME message is
@@ -651,7 +933,9 @@ func (s *State) rplWhoReply(ev *irc.Event) {
 
 	s.addUser(fullhost)
 	s.addToChannel(fullhost, channel)
-	s.GetUser(fullhost).SetRealname(realname)
+	user := s.GetUser(fullhost)
+	user.SetRealname(realname)
+	s.whoFlags(user, modes)
 	for _, modechar := range modes {
 		if mode := s.umodes.GetMode(modechar); mode != 0 {
 			if uc := s.GetUsersChannelModes(fullhost, channel); uc != nil {
@@ -661,6 +945,17 @@ func (s *State) rplWhoReply(ev *irc.Event) {
 	}
 }
 
+// rplEndOfWho marks a channel as synced when a RPL_ENDOFWHO message for it
+// is received.
+func (s *State) rplEndOfWho(ev *irc.Event) {
+	if len(ev.Args) < 2 {
+		return
+	}
+	if ch := s.GetChannel(ev.Args[1]); ch != nil {
+		ch.synced = true
+	}
+}
+
 // rplChannelModeIs alters the state of the database when a RPL_CHANNELMODEIS
 // message is received.
 func (s *State) rplChannelModeIs(ev *irc.Event) {
@@ -671,11 +966,174 @@ func (s *State) rplChannelModeIs(ev *irc.Event) {
 	}
 }
 
-// rplBanList alters the state of the database when a RPL_BANLIST message is
+// rplList alters the state of the database when a RPL_BANLIST,
+// RPL_EXCEPTLIST, RPL_INVITELIST or RPL_QUIETLIST message is received. The
+// mask is at index in the arguments, optionally followed by who set it and
+// the unix time it was set at.
+func (s *State) rplList(ev *irc.Event, mode rune, index int) {
+	if len(ev.Args) <= index {
+		return
+	}
+	ch := s.GetChannel(ev.Args[1])
+	if ch == nil {
+		return
+	}
+
+	mask, setBy, setAt := ev.Args[index], "", time.Time{}
+	if len(ev.Args) > index+2 {
+		setBy = ev.Args[index+1]
+		unix, err := strconv.ParseInt(ev.Args[index+2], 10, 64)
+		if err == nil {
+			setAt = time.Unix(unix, 0)
+		}
+	}
+	ch.AddListEntry(mode, mask, setBy, setAt)
+}
+
+// rplWhoxReply alters the state of the database when a RPL_WHOSPCRPL message
+// that was asked for with WHOXFields is received.
+func (s *State) rplWhoxReply(ev *irc.Event) {
+	if len(ev.Args) < 9 || ev.Args[1] != whoxToken {
+		return
+	}
+	channel := ev.Args[2]
+	fullhost := ev.Args[5] + "!" + ev.Args[3] + "@" + ev.Args[4]
+	modes := ev.Args[6]
+
+	user := s.addUser(fullhost)
+	if user == nil {
+		return
+	}
+	setAccount(user, ev.Args[7], whoxNoAccount)
+	user.SetRealname(ev.Args[8])
+	s.whoFlags(user, modes)
+
+	s.addToChannel(fullhost, channel)
+	for _, modechar := range modes {
+		if mode := s.umodes.GetMode(modechar); mode != 0 {
+			if uc := s.GetUsersChannelModes(fullhost, channel); uc != nil {
+				uc.SetMode(mode)
+			}
+		}
+	}
+}
+
+// whoFlags updates a user from the flags in a WHO reply: H or G for here or
+// gone, * for irc operators, and the network's bot mode for bots.
+func (s *State) whoFlags(user *User, flags string) {
+	user.SetOper(strings.ContainsRune(flags, '*'))
+	user.SetBot(s.botMode != 0 && strings.ContainsRune(flags, s.botMode))
+
+	switch {
+	case strings.HasPrefix(flags, "H"):
+		user.SetBack()
+	case strings.HasPrefix(flags, "G") && !user.IsAway():
+		user.SetAway("")
+	}
+}
+
+// setAccount sets the account of a user, none is the account given for users
+// that are not logged in.
+func setAccount(user *User, account, none string) {
+	if account == none {
+		account = ""
+	}
+	user.SetAccount(account)
+}
+
+// away alters the state of the database when an AWAY message is received,
+// an AWAY without a message means the user is back.
+func (s *State) away(ev *irc.Event) {
+	user := s.GetUser(ev.Sender)
+	if user == nil {
+		return
+	}
+	if len(ev.Args) > 0 && len(ev.Args[0]) > 0 {
+		user.SetAway(ev.Args[0])
+	} else {
+		user.SetBack()
+	}
+}
+
+// account alters the state of the database when an ACCOUNT message is
 // received.
-func (s *State) rplBanList(ev *irc.Event) {
-	channel := ev.Args[1]
-	if ch := s.GetChannel(channel); ch != nil {
-		ch.AddBan(ev.Args[2])
+func (s *State) account(ev *irc.Event) {
+	if user := s.GetUser(ev.Sender); user != nil && len(ev.Args) > 0 {
+		setAccount(user, ev.Args[0], noAccount)
+	}
+}
+
+// chghost alters the state of the database when a CHGHOST message is
+// received.
+func (s *State) chghost(ev *irc.Event) {
+	user := s.GetUser(ev.Sender)
+	if user == nil || len(ev.Args) < 2 {
+		return
+	}
+	user.host = irc.Host(user.Nick() + "!" + ev.Args[0] + "@" + ev.Args[1])
+}
+
+// setname alters the state of the database when a SETNAME message is
+// received.
+func (s *State) setname(ev *irc.Event) {
+	if user := s.GetUser(ev.Sender); user != nil && len(ev.Args) > 0 {
+		user.SetRealname(ev.Args[0])
+	}
+}
+
+// rplAway alters the state of the database when a RPL_AWAY message is
+// received.
+func (s *State) rplAway(ev *irc.Event) {
+	if len(ev.Args) < 3 {
+		return
+	}
+	if user := s.GetUser(ev.Args[1]); user != nil {
+		user.SetAway(ev.Args[2])
+	}
+}
+
+// rplNowAway alters the state of the database when a RPL_NOWAWAY or
+// RPL_UNAWAY message is received.
+func (s *State) rplNowAway(ev *irc.Event) {
+	if s.Self.User == nil {
+		return
+	}
+	if ev.Name == irc.RPL_NOWAWAY {
+		s.Self.SetAway(s.Self.AwayMessage())
+	} else {
+		s.Self.SetBack()
+	}
+}
+
+// rplWhoisAccount alters the state of the database when a RPL_WHOISACCOUNT
+// message is received.
+func (s *State) rplWhoisAccount(ev *irc.Event) {
+	if len(ev.Args) < 3 {
+		return
+	}
+	if user := s.GetUser(ev.Args[1]); user != nil {
+		user.SetAccount(ev.Args[2])
+	}
+}
+
+// rplWhoisOperator alters the state of the database when a
+// RPL_WHOISOPERATOR message is received.
+func (s *State) rplWhoisOperator(ev *irc.Event) {
+	if len(ev.Args) < 2 {
+		return
+	}
+	if user := s.GetUser(ev.Args[1]); user != nil {
+		user.SetOper(true)
+	}
+}
+
+// rplWhoisSecure alters the state of the database when a RPL_WHOISSECURE
+// message is received.
+func (s *State) rplWhoisSecure(ev *irc.Event) {
+	if len(ev.Args) < 2 {
+		return
+	}
+	if user := s.GetUser(ev.Args[1]); user != nil {
+		user.SetSecure(true)
 	}
 }
@@ -3,6 +3,7 @@ package data
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"code.google.com/p/go.crypto/bcrypt"
 	"github.com/aarondl/ultimateq/irc"
@@ -687,6 +688,96 @@ func (s *s) TestState_UpdateModeSelf(c *C) {
 	c.Check(st.Self.IsSet("o"), Equals, false)
 }
 
+func (s *s) TestState_Changes(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = self
+
+	var table = []struct {
+		Event  *irc.Event
+		Expect [][]string
+	}{
+		{&irc.Event{Name: irc.JOIN, Sender: self.Host(),
+			Args: []string{channels[0]}},
+			[][]string{{irc.SELFJOINED, self.Host(), channels[0]}}},
+		{&irc.Event{Name: irc.JOIN, Sender: users[0],
+			Args: []string{channels[0]}},
+			[][]string{{irc.USERJOINED, users[0], channels[0]}}},
+		{&irc.Event{Name: irc.JOIN, Sender: users[1],
+			Args: []string{channels[0]}},
+			[][]string{{irc.USERJOINED, users[1], channels[0]}}},
+		{&irc.Event{Name: irc.MODE, Sender: users[0],
+			Args: []string{channels[0], "+mo-v", nicks[1], nicks[1]}},
+			[][]string{
+				{irc.MODECHANGED, users[0], channels[0], "+m"},
+				{irc.USERMODECHANGED, users[0], channels[0], nicks[1], "+o"},
+				{irc.USERMODECHANGED, users[0], channels[0], nicks[1], "-v"},
+			}},
+		{&irc.Event{Name: irc.MODE, Sender: users[0],
+			Args: []string{channels[0], "+o", nicks[1]}},
+			[][]string{
+				{irc.USERMODECHANGED, users[0], channels[0], nicks[1], "+o"},
+			}},
+		{&irc.Event{Name: irc.TOPIC, Sender: users[0],
+			Args: []string{channels[0], "topic"}},
+			[][]string{{irc.TOPICCHANGED, users[0], channels[0], "", "topic"}}},
+		{&irc.Event{Name: irc.TOPIC, Sender: users[0],
+			Args: []string{channels[0], "topic"}}, nil},
+		{&irc.Event{Name: irc.PRIVMSG, Sender: users[0],
+			Args: []string{channels[0], "hi"}}, nil},
+		{&irc.Event{Name: irc.NICK, Sender: users[1],
+			Args: []string{"newnick"}},
+			[][]string{{irc.NICKCHANGED, users[1], nicks[1], "newnick"}}},
+		{&irc.Event{Name: irc.KICK, Sender: users[0],
+			Args: []string{channels[0], "newnick", "bye"}},
+			[][]string{
+				{irc.USERKICKED, users[0], channels[0], "newnick", "bye"}}},
+		{&irc.Event{Name: irc.PART, Sender: users[0],
+			Args: []string{channels[0]}},
+			[][]string{{irc.USERPARTED, users[0], channels[0], ""}}},
+		{&irc.Event{Name: irc.QUIT, Sender: users[0],
+			Args: []string{"quit"}},
+			[][]string{{irc.USERQUIT, users[0], "quit"}}},
+		{&irc.Event{Name: irc.KICK, Sender: users[0],
+			Args: []string{channels[0], self.Nick()}},
+			[][]string{
+				{irc.SELFKICKED, users[0], channels[0], self.Nick(), ""}}},
+		{&irc.Event{Name: irc.JOIN, Sender: self.Host(),
+			Args: []string{channels[1]}},
+			[][]string{{irc.SELFJOINED, self.Host(), channels[1]}}},
+		{&irc.Event{Name: irc.PART, Sender: self.Host(),
+			Args: []string{channels[1], "leaving"}},
+			[][]string{
+				{irc.SELFPARTED, self.Host(), channels[1], "leaving"}}},
+	}
+
+	for i, test := range table {
+		test.Event.NetworkID = "netID"
+		test.Event.NetworkInfo = netInfo
+		changes, _ := st.Update(test.Event)
+		c.Check(len(changes), Equals, len(test.Expect),
+			Commentf("%v) %v", i, changes))
+		for j := 0; j < len(changes) && j < len(test.Expect); j++ {
+			got := append([]string{changes[j].Name, changes[j].Sender},
+				changes[j].Args...)
+			c.Check(got, DeepEquals, test.Expect[j], Commentf("%v)", i))
+			c.Check(changes[j].NetworkID, Equals, "netID")
+		}
+	}
+}
+
+func (s *s) TestState_ChangesRplTopic(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	changes, _ := st.Update(&irc.Event{Name: irc.RPL_TOPIC, Sender: network,
+		Args: []string{self.Nick(), channels[0], "topic"}})
+	c.Assert(len(changes), Equals, 1)
+	c.Check(changes[0].Name, Equals, irc.TOPICCHANGED)
+	c.Check(changes[0].Args, DeepEquals, []string{channels[0], "", "topic"})
+}
+
 func (s *s) TestState_UpdateTopic(c *C) {
 	st, err := NewState(netInfo)
 	st.Self = self
@@ -705,6 +796,29 @@ func (s *s) TestState_UpdateTopic(c *C) {
 	c.Check(st.GetChannel(channels[0]).Topic(), Equals, "topic topic")
 }
 
+func (s *s) TestState_UpdateTopicInfo(c *C) {
+	st, err := NewState(netInfo)
+	st.Self = self
+	c.Check(err, IsNil)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+	st.addChannel(channels[0])
+
+	st.Update(&irc.Event{Name: irc.RPL_TOPIC, Sender: network,
+		Args: []string{self.Nick(), channels[0], "old"}})
+	st.Update(&irc.Event{Name: irc.RPL_TOPICWHOTIME, Sender: network,
+		Args: []string{self.Nick(), channels[0], users[0], "1367197165"}})
+	c.Check(st.GetChannel(channels[0]).TopicInfo(), Equals,
+		TopicEntry{"old", users[0], time.Unix(1367197165, 0)})
+
+	st.Update(&irc.Event{Name: irc.TOPIC, Sender: users[1],
+		Args: []string{channels[0], "new"}})
+	c.Check(st.GetChannel(channels[0]).TopicInfo(), Equals,
+		TopicEntry{"new", users[1], now})
+	c.Check(st.GetChannel(channels[0]).TopicHistory(), DeepEquals,
+		[]TopicEntry{{"old", users[0], time.Unix(1367197165, 0)}})
+}
+
 func (s *s) TestState_UpdateRplTopic(c *C) {
 	st, err := NewState(netInfo)
 	st.Self = self
@@ -869,6 +983,30 @@ func (s *s) TestState_RplWhoReply(c *C) {
 		st.GetUsersChannelModes(users[0], channels[0]).String(), Equals, "o")
 }
 
+func (s *s) TestState_RplEndOfWho(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Update(&irc.Event{Name: irc.RPL_WELCOME, Sender: network,
+		Args: []string{self.Nick(), "Welcome " + self.Host()}})
+	st.Update(&irc.Event{Name: irc.JOIN, Sender: self.Host(),
+		Args: []string{channels[0]}})
+
+	c.Check(st.GetChannel(channels[0]).IsSynced(), Equals, false)
+	st.Update(&irc.Event{Name: irc.RPL_ENDOFWHO, Sender: network,
+		Args: []string{self.Nick(), nicks[0], "End of /WHO list."}})
+	c.Check(st.GetChannel(channels[0]).IsSynced(), Equals, false)
+	st.Update(&irc.Event{Name: irc.RPL_ENDOFWHO, Sender: network,
+		Args: []string{self.Nick(), strings.ToUpper(channels[0]),
+			"End of /WHO list."}})
+	c.Check(st.GetChannel(channels[0]).IsSynced(), Equals, true)
+
+	st.Update(&irc.Event{Name: irc.PART, Sender: self.Host(),
+		Args: []string{channels[0]}})
+	st.Update(&irc.Event{Name: irc.JOIN, Sender: self.Host(),
+		Args: []string{channels[0]}})
+	c.Check(st.GetChannel(channels[0]).IsSynced(), Equals, false)
+}
+
 func (s *s) TestState_UpdateRplMode(c *C) {
 	st, err := NewState(netInfo)
 	c.Check(err, IsNil)
@@ -902,3 +1040,371 @@ func (s *s) TestState_UpdateRplBanlist(c *C) {
 	st.Update(ev)
 	c.Check(st.GetChannel(channels[0]).HasBan(nicks[0]+"!*@*"), Equals, true)
 }
+
+func (s *s) TestState_UpdateRplLists(c *C) {
+	st, err := NewState(netInfo)
+	st.Self = self
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	setAt := time.Unix(1367197165, 0)
+	for _, ev := range []*irc.Event{
+		{Name: irc.RPL_EXCEPTLIST, Sender: network, Args: []string{
+			self.Nick(), channels[0], "*!*@e", nicks[1], "1367197165"}},
+		{Name: irc.RPL_INVITELIST, Sender: network, Args: []string{
+			self.Nick(), channels[0], "*!*@i"}},
+		{Name: irc.RPL_QUIETLIST, Sender: network, Args: []string{
+			self.Nick(), channels[0], "q", "*!*@q", nicks[1], "bad"}},
+		{Name: irc.RPL_BANLIST, Sender: network, Args: []string{
+			self.Nick(), channels[1], "*!*@b"}},
+	} {
+		st.Update(ev)
+	}
+
+	ch := st.GetChannel(channels[0])
+	c.Check(ch.ListEntries('e'), DeepEquals,
+		[]ListEntry{{"*!*@e", nicks[1], setAt}})
+	c.Check(ch.ListEntries('I'), DeepEquals, []ListEntry{{Mask: "*!*@i"}})
+	c.Check(ch.ListEntries('q'), DeepEquals,
+		[]ListEntry{{Mask: "*!*@q", SetBy: nicks[1]}})
+	c.Check(ch.Bans(), IsNil)
+}
+
+func (s *s) TestState_UpdateModeLists(c *C) {
+	st, err := NewState(netInfo)
+	st.Self = self
+	c.Check(err, IsNil)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+	st.addChannel(channels[0])
+
+	st.Update(&irc.Event{Name: irc.MODE, Sender: users[0],
+		Args:        []string{channels[0], "+beI", "*!*@b", "*!*@e", "*!*@i"},
+		NetworkInfo: netInfo})
+
+	ch := st.GetChannel(channels[0])
+	c.Check(ch.ListEntries('b'), DeepEquals,
+		[]ListEntry{{"*!*@b", users[0], now}})
+	c.Check(ch.ListEntries('e'), DeepEquals,
+		[]ListEntry{{"*!*@e", users[0], now}})
+	c.Check(ch.ListEntries('I'), DeepEquals,
+		[]ListEntry{{"*!*@i", users[0], now}})
+
+	st.Update(&irc.Event{Name: irc.MODE, Sender: users[0],
+		Args: []string{channels[0], "-e", "*!*@e"}, NetworkInfo: netInfo})
+	c.Check(ch.ListEntries('e'), IsNil)
+	c.Check(ch.IsBanned("nick!user@b"), Equals, true)
+}
+
+func (s *s) TestState_UpdateAway(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addUser(users[0])
+
+	st.Update(&irc.Event{
+		Name: irc.AWAY, Sender: users[0], Args: []string{"gone fishing"},
+	})
+	c.Check(st.GetUser(users[0]).IsAway(), Equals, true)
+	c.Check(st.GetUser(users[0]).AwayMessage(), Equals, "gone fishing")
+
+	st.Update(&irc.Event{Name: irc.AWAY, Sender: users[0]})
+	c.Check(st.GetUser(users[0]).IsAway(), Equals, false)
+
+	st.Update(&irc.Event{
+		Name: irc.RPL_AWAY, Sender: network,
+		Args: []string{self.Nick(), nicks[0], "back soon"},
+	})
+	c.Check(st.GetUser(users[0]).AwayMessage(), Equals, "back soon")
+}
+
+func (s *s) TestState_UpdateRplNowAway(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = Self{User: NewUser("me!my@host.com")}
+
+	st.Update(&irc.Event{
+		Name: irc.RPL_NOWAWAY, Sender: network,
+		Args: []string{st.Self.Nick(), "You have been marked as being away"},
+	})
+	c.Check(st.Self.IsAway(), Equals, true)
+
+	st.Update(&irc.Event{
+		Name: irc.RPL_UNAWAY, Sender: network,
+		Args: []string{st.Self.Nick(), "You are no longer marked as away"},
+	})
+	c.Check(st.Self.IsAway(), Equals, false)
+}
+
+func (s *s) TestState_UpdateAccount(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addUser(users[0])
+
+	st.Update(&irc.Event{
+		Name: irc.ACCOUNT, Sender: users[0], Args: []string{"account"},
+	})
+	c.Check(st.GetUser(users[0]).Account(), Equals, "account")
+
+	st.Update(&irc.Event{
+		Name: irc.ACCOUNT, Sender: users[0], Args: []string{"*"},
+	})
+	c.Check(st.GetUser(users[0]).Account(), Equals, "")
+}
+
+func (s *s) TestState_UpdateJoinExtended(c *C) {
+	st, err := NewState(netInfo)
+	st.Self = self
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	st.Update(&irc.Event{
+		Name: irc.JOIN, Sender: users[0],
+		Args: []string{channels[0], "account", "real name"},
+	})
+	c.Check(st.IsOn(users[0], channels[0]), Equals, true)
+	c.Check(st.GetUser(users[0]).Account(), Equals, "account")
+	c.Check(st.GetUser(users[0]).Realname(), Equals, "real name")
+
+	st.Update(&irc.Event{
+		Name: irc.JOIN, Sender: users[1],
+		Args: []string{channels[0], "*", "other name"},
+	})
+	c.Check(st.GetUser(users[1]).Account(), Equals, "")
+	c.Check(st.GetUser(users[1]).Realname(), Equals, "other name")
+}
+
+func (s *s) TestState_UpdateChghost(c *C) {
+	st, err := NewState(netInfo)
+	st.Self = self
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+	st.addUser(users[0])
+	st.addToChannel(users[0], channels[0])
+
+	st.Update(&irc.Event{
+		Name: irc.CHGHOST, Sender: users[0],
+		Args: []string{"newuser", "new.host"},
+	})
+	c.Check(st.GetUser(nicks[0]).Host(), Equals, nicks[0]+"!newuser@new.host")
+	c.Check(st.IsOn(nicks[0], channels[0]), Equals, true)
+}
+
+func (s *s) TestState_UpdateSetname(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addUser(users[0])
+
+	st.Update(&irc.Event{
+		Name: irc.SETNAME, Sender: users[0], Args: []string{"new name"},
+	})
+	c.Check(st.GetUser(users[0]).Realname(), Equals, "new name")
+}
+
+func (s *s) TestState_RplWhoReplyFlags(c *C) {
+	ni := irc.NewNetworkInfo()
+	ni.ParseISupport(&irc.Event{Args: []string{"NICK", "BOT=B"}})
+	st, err := NewState(ni)
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	who := func(flags string) *User {
+		st.Update(&irc.Event{
+			Name:   irc.RPL_WHOREPLY,
+			Sender: network,
+			Args: []string{
+				self.Nick(), channels[0], irc.Username(users[0]),
+				irc.Hostname(users[0]), "*.network.net", nicks[0], flags,
+				"3 real name",
+			},
+		})
+		return st.GetUser(users[0])
+	}
+
+	user := who("G*B@")
+	c.Check(user.IsAway(), Equals, true)
+	c.Check(user.IsOper(), Equals, true)
+	c.Check(user.IsBot(), Equals, true)
+	c.Check(st.GetUsersChannelModes(users[0], channels[0]).String(),
+		Equals, "o")
+
+	user.SetAway("gone")
+	user = who("G")
+	c.Check(user.AwayMessage(), Equals, "gone")
+	c.Check(user.IsOper(), Equals, false)
+	c.Check(user.IsBot(), Equals, false)
+
+	user = who("H")
+	c.Check(user.IsAway(), Equals, false)
+}
+
+func (s *s) TestState_RplWhoxReply(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addChannel(channels[0])
+
+	ev := &irc.Event{
+		Name:   irc.RPL_WHOSPCRPL,
+		Sender: network,
+		Args: []string{
+			self.Nick(), whoxToken, channels[0], irc.Username(users[0]),
+			irc.Hostname(users[0]), nicks[0], "G*@", "account", "real name",
+		},
+	}
+
+	c.Check(WHOXFields, Equals, "%tcuhnfar,"+whoxToken)
+	st.Update(ev)
+	user := st.GetUser(users[0])
+	c.Assert(user, NotNil)
+	c.Check(user.Host(), Equals, users[0])
+	c.Check(user.Account(), Equals, "account")
+	c.Check(user.Realname(), Equals, "real name")
+	c.Check(user.IsAway(), Equals, true)
+	c.Check(user.IsOper(), Equals, true)
+	c.Check(st.IsOn(users[0], channels[0]), Equals, true)
+	c.Check(st.GetUsersChannelModes(users[0], channels[0]).String(),
+		Equals, "o")
+
+	ev.Args[7] = whoxNoAccount
+	st.Update(ev)
+	c.Check(user.Account(), Equals, "")
+
+	ev.Args[1] = "1"
+	ev.Args[7] = "other"
+	st.Update(ev)
+	c.Check(user.Account(), Equals, "")
+}
+
+func (s *s) TestState_UpdateWhois(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.addUser(users[0])
+
+	st.Update(&irc.Event{
+		Name: irc.RPL_WHOISACCOUNT, Sender: network,
+		Args: []string{self.Nick(), nicks[0], "account", "is logged in as"},
+	})
+	st.Update(&irc.Event{
+		Name: irc.RPL_WHOISOPERATOR, Sender: network,
+		Args: []string{self.Nick(), nicks[0], "is an IRC operator"},
+	})
+	st.Update(&irc.Event{
+		Name: irc.RPL_WHOISSECURE, Sender: network,
+		Args: []string{self.Nick(), nicks[0], "is using a secure connection"},
+	})
+
+	user := st.GetUser(users[0])
+	c.Check(user.Account(), Equals, "account")
+	c.Check(user.IsOper(), Equals, true)
+	c.Check(user.IsSecure(), Equals, true)
+}
+
+func (s *s) TestState_Activity(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = self
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	st.addChannel(channels[0])
+	st.addUser(self.Host())
+	st.addToChannel(self.Host(), channels[0])
+	st.Update(&irc.Event{
+		Name: irc.JOIN, Sender: users[0], Args: []string{channels[0]},
+	})
+	activity := st.GetUsersChannelActivity(users[0], channels[0])
+	c.Assert(activity, NotNil)
+	c.Check(activity.Joined, Equals, now)
+	c.Check(st.GetUsersChannelActivity(users[1], channels[0]), IsNil)
+
+	now = now.Add(time.Minute)
+	st.Update(&irc.Event{
+		Name: irc.PRIVMSG, Sender: users[1], Args: []string{channels[0], "hi"},
+		NetworkInfo: netInfo,
+	})
+	activity = st.GetUsersChannelActivity(users[1], channels[0])
+	c.Assert(activity, NotNil)
+	c.Check(activity.LastMessage, Equals, now)
+	c.Check(activity.LastText, Equals, "hi")
+
+	now = now.Add(time.Hour)
+	c.Check(st.GetIdleChanUsers(channels[0], time.Hour+time.Second), DeepEquals,
+		[]string{users[0]})
+	c.Check(len(st.GetIdleChanUsers(channels[0], time.Minute)), Equals, 2)
+	c.Check(st.GetIdleChanUsers(channels[1], time.Minute), IsNil)
+
+	st.Update(&irc.Event{
+		Name: irc.NICK, Sender: users[0], Args: []string{"newnick"},
+	})
+	oldNick, changed := st.GetUser("newnick").LastNickChange()
+	c.Check(oldNick, Equals, nicks[0])
+	c.Check(changed, Equals, now)
+}
+
+func (s *s) TestState_Seen(c *C) {
+	st, err := NewState(netInfo)
+	c.Check(err, IsNil)
+	st.Self = self
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	var seen []*StoredSeen
+	update := func(ev *irc.Event) {
+		_, records := st.Update(ev)
+		seen = append(seen, records...)
+	}
+	st.SetSeen(true)
+
+	st.addChannel(channels[0])
+	st.addChannel(channels[1])
+	for _, ch := range channels {
+		for _, u := range users {
+			update(&irc.Event{
+				Name: irc.JOIN, Sender: u, Args: []string{ch},
+			})
+		}
+	}
+	update(&irc.Event{
+		Name: irc.PRIVMSG, Sender: users[0], Args: []string{channels[1], "hi"},
+		NetworkInfo: netInfo,
+	})
+
+	now = now.Add(time.Minute)
+	update(&irc.Event{
+		Name: irc.PART, Sender: users[0], Args: []string{channels[0], "bye"},
+	})
+	update(&irc.Event{
+		Name: irc.KICK, Sender: users[1],
+		Args: []string{channels[0], nicks[1], "out"},
+	})
+	update(&irc.Event{
+		Name: irc.NICK, Sender: users[1], Args: []string{"newnick"},
+	})
+	update(&irc.Event{
+		Name: irc.QUIT, Sender: users[0], Args: []string{"gone"},
+	})
+
+	c.Assert(len(seen), Equals, 4)
+	c.Check(*seen[0], Equals, StoredSeen{
+		Nick: nicks[0], Host: users[0], Action: irc.PART,
+		Where: channels[0], Reason: "bye", Left: now,
+		Said: "hi", SaidWhere: channels[1], SaidTime: now.Add(-time.Minute),
+	})
+	c.Check(seen[1].Nick, Equals, nicks[1])
+	c.Check(seen[1].Action, Equals, irc.KICK)
+	c.Check(seen[1].Where, Equals, channels[0])
+	c.Check(seen[1].Reason, Equals, "out")
+	c.Check(seen[1].Said, Equals, "")
+	c.Check(seen[2].Nick, Equals, nicks[1])
+	c.Check(seen[2].Action, Equals, irc.NICK)
+	c.Check(seen[2].Reason, Equals, "newnick")
+	c.Check(seen[3].Action, Equals, irc.QUIT)
+	c.Check(seen[3].Reason, Equals, "gone")
+	c.Check(seen[3].Said, Equals, "hi")
+
+	st.SetSeen(false)
+	update(&irc.Event{
+		Name: irc.QUIT, Sender: "newnick!user2@host2", Args: []string{"gone"},
+	})
+	c.Check(len(seen), Equals, 4)
+	c.Check(st.Seen("nobody", irc.QUIT, "", ""), IsNil)
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -87,6 +88,13 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// Users gets all the users.
+func (s *Store) Users() ([]*StoredUser, error) {
+	return iterate(s.db, func(ua *StoredUser) bool {
+		return true
+	})
+}
+
 // GlobalUsers gets users with global access
 func (s *Store) GlobalUsers() ([]*StoredUser, error) {
 	return iterate(s.db, func(ua *StoredUser) bool {
@@ -123,8 +131,11 @@ func iterate(db *kv.DB, filter func(*StoredUser) bool) ([]*StoredUser, error) {
 	}
 
 	var stop error
-	var val []byte
-	for ; stop == nil; _, val, stop = e.Next() {
+	var key, val []byte
+	for ; stop == nil; key, val, stop = e.Next() {
+		if isRecordKey(key) {
+			continue
+		}
 		if ua, err := deserializeUser(val); err == nil && filter(ua) {
 			list = append(list, ua)
 		}
@@ -133,6 +144,20 @@ func iterate(db *kv.DB, filter func(*StoredUser) bool) ([]*StoredUser, error) {
 	return list, nil
 }
 
+// isRecordKey checks if a key is that of an audit entry, alias or seen
+// record, which share the database with the users and channels and are
+// skipped when iterating them.
+func isRecordKey(key []byte) bool {
+	for _, prefix := range []string{
+		auditKeyPrefix, aliasKeyPrefix, seenKeyPrefix,
+	} {
+		if bytes.HasPrefix(key, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
 // SaveUser saves a user to the database.
 func (s *Store) SaveUser(ua *StoredUser) error {
 	var err error
@@ -176,12 +201,29 @@ func (s *Store) RemoveUser(username string) (removed bool, err error) {
 func (s *Store) AuthUser(
 	network, host, username, password string) (*StoredUser, error) {
 
+	return s.authUser(network, host, host, username, password)
+}
+
+// AuthSession authenticates a user whose masks are checked against host, as
+// in AuthUser, but they're remembered as authenticated under session instead
+// of host. This keeps a session the user opened with the bot, like a DCC
+// CHAT, from authenticating the host on the network as well.
+func (s *Store) AuthSession(network, session, host, username,
+	password string) (*StoredUser, error) {
+
+	return s.authUser(network, session, host, username, password)
+}
+
+// authUser authenticates a user against host, and remembers them under key.
+func (s *Store) authUser(
+	network, key, host, username, password string) (*StoredUser, error) {
+
 	username = strings.ToLower(username)
 	var user *StoredUser
 	var ok bool
 	var err error
 
-	if user, ok = s.authed[network+host]; ok {
+	if user, ok = s.authed[network+key]; ok {
 		return user, nil
 	}
 
@@ -214,7 +256,7 @@ func (s *Store) AuthUser(
 		}
 	}
 
-	s.authed[network+host] = user
+	s.authed[network+key] = user
 	return user, nil
 }
 
@@ -289,7 +331,7 @@ func (s *Store) SaveChannel(sc *StoredChannel) error {
 		return err
 	}
 
-	s.db.Set([]byte(sc.makeID()), serialized)
+	err = s.db.Set([]byte(sc.makeID()), serialized)
 	if err != nil {
 		return err
 	}
@@ -346,8 +388,11 @@ func (s *Store) Channels() ([]*StoredChannel, error) {
 	}
 
 	var stop error
-	var val []byte
-	for ; stop == nil; _, val, stop = e.Next() {
+	var key, val []byte
+	for ; stop == nil; key, val, stop = e.Next() {
+		if isRecordKey(key) {
+			continue
+		}
 		if ua, err := deserializeChannel(val); err == nil {
 			list = append(list, ua)
 		}
@@ -356,6 +401,80 @@ func (s *Store) Channels() ([]*StoredChannel, error) {
 	return list, nil
 }
 
+// SaveAlias saves an alias for a network, or a channel on a network when
+// channel is not empty.
+func (s *Store) SaveAlias(netID, channel string, alias *StoredAlias) error {
+	serialized, err := alias.serialize()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set([]byte(makeAliasID(netID, channel, alias.Alias)),
+		serialized)
+}
+
+// RemoveAlias removes an alias from the database, returns true if successful.
+func (s *Store) RemoveAlias(netID, channel, name string) (removed bool,
+	err error) {
+
+	var exists *StoredAlias
+	exists, err = s.FindAlias(netID, channel, name)
+	if err != nil || exists == nil {
+		return
+	}
+
+	err = s.db.Delete([]byte(makeAliasID(netID, channel, name)))
+	if err != nil {
+		return
+	}
+	removed = true
+	return
+}
+
+// FindAlias looks up an alias for a network, or a channel on a network when
+// channel is not empty. Network aliases are not returned when looking up a
+// channel alias.
+func (s *Store) FindAlias(netID, channel, name string) (alias *StoredAlias,
+	err error) {
+
+	var serialized []byte
+	key := makeAliasID(netID, channel, name)
+	serialized, err = s.db.Get(nil, []byte(key))
+	if err != nil || serialized == nil {
+		return
+	}
+
+	alias, err = deserializeAlias(serialized)
+	return
+}
+
+// Aliases returns a slice of the aliases for a network, or a channel on a
+// network when channel is not empty. They are sorted by name.
+func (s *Store) Aliases(netID, channel string) ([]*StoredAlias, error) {
+	list := make([]*StoredAlias, 0)
+	scope := []byte(makeAliasScope(netID, channel))
+
+	e, _, err := s.db.Seek(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		key, val, err := e.Next()
+		if err == io.EOF || !bytes.HasPrefix(key, scope) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if alias, err := deserializeAlias(val); err == nil {
+			list = append(list, alias)
+		}
+	}
+
+	return list, nil
+}
+
 // checkCacheLimits verifies if adding one to the size of the cache will
 // cross it's boundaries, if so, it dumps the cache.
 func (s *Store) checkCacheLimits() {
@@ -193,6 +193,42 @@ func TestStore_AuthUser(t *testing.T) {
 	}
 }
 
+func TestStore_AuthSession(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ua1, err := NewStoredUser(uname, password, `*!*@host`)
+	if err != nil {
+		t.Fatal("Error creating user:", err)
+	}
+	err = s.SaveUser(ua1)
+	if err != nil {
+		t.Fatal("Error adding user:", err)
+	}
+
+	session := host + "!session"
+	user, err := s.AuthSession(network, session, `nick!user@host.com`, uname,
+		password)
+	if user != nil || err == nil {
+		t.Error("Failed to reject bad authentication.")
+	}
+
+	user, err = s.AuthSession(network, session, host, uname, password)
+	if err != nil || user == nil {
+		t.Error("Rejected good authentication:", err)
+	}
+	if s.GetAuthedUser(network, session) == nil {
+		t.Error("The session is not authenticated.")
+	}
+	if s.GetAuthedUser(network, host) != nil {
+		t.Error("The host should not be authenticated.")
+	}
+}
+
 func TestStore_AuthLogout(t *testing.T) {
 	t.Parallel()
 	s, err := NewStore(MemStoreProvider)
@@ -348,6 +384,88 @@ func TestStore_IsFirst(t *testing.T) {
 	}
 }
 
+func TestStore_Users(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	list, err := s.Users()
+	if list != nil || err != nil {
+		t.Error("When db is empty both return params should be nil.")
+	}
+
+	err = s.SaveUser(&StoredUser{Username: uname})
+	if err != nil {
+		t.Fatal("Error adding user:", err)
+	}
+	err = s.SaveUser(&StoredUser{Username: uname + uname})
+	if err != nil {
+		t.Fatal("Error adding user:", err)
+	}
+
+	list, err = s.Users()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if len(list) != 2 {
+		t.Error("There should be exactly 2 users now.")
+	}
+}
+
+func TestStore_IterateSkipsRecords(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = s.SaveUser(&StoredUser{Username: uname}); err != nil {
+		t.Fatal("Error adding user:", err)
+	}
+	if err = s.SaveChannel(NewStoredChannel(network, channel)); err != nil {
+		t.Fatal("Error adding channel:", err)
+	}
+	users, err := s.Users()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	channels, err := s.Channels()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	err = s.SaveAlias(network, "", NewStoredAlias("a", "b", uname))
+	if err != nil {
+		t.Fatal("Error adding alias:", err)
+	}
+	if err = s.SaveSeen(network, &StoredSeen{Nick: nicks[0]}); err != nil {
+		t.Fatal("Error adding seen:", err)
+	}
+	if err = s.SaveAudit(&AuditEntry{NetworkID: network}); err != nil {
+		t.Fatal("Error adding audit entry:", err)
+	}
+
+	if list, err := s.Users(); err != nil || len(list) != len(users) {
+		t.Error("Expected the records not to be users, got:", list, err)
+	}
+	if list, err := s.Channels(); err != nil || len(list) != len(channels) {
+		t.Error("Expected the records not to be channels, got:", list, err)
+	}
+
+	for _, key := range []string{"audit:1", "alias:net::a", "seen:net:n"} {
+		if !isRecordKey([]byte(key)) {
+			t.Error("Expected a record key:", key)
+		}
+	}
+	if isRecordKey([]byte(uname)) {
+		t.Error("Expected a username not to be a record key.")
+	}
+}
+
 func TestStore_GlobalUsers(t *testing.T) {
 	t.Parallel()
 	s, err := NewStore(MemStoreProvider)
@@ -623,3 +741,94 @@ func TestStore_Channels(t *testing.T) {
 		t.Error("ua2 not found.")
 	}
 }
+
+func TestStore_Aliases(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	netID, channel := "netID", "#Chan"
+	err = s.SaveChannel(&StoredChannel{NetID: netID, Name: channel})
+	if err != nil {
+		t.Fatal("Error adding channel:", err)
+	}
+
+	aliases := []struct {
+		Channel string
+		Alias   *StoredAlias
+	}{
+		{channel, NewStoredAlias("rules", "say Rules.", uname)},
+		{channel, NewStoredAlias("faq", "say FAQ.", uname)},
+		{"", NewStoredAlias("rules", "say Network rules.", uname)},
+		{"#other", NewStoredAlias("other", "say Other.", uname)},
+		{"", NewStoredAlias("q", "quote", uname)},
+	}
+	for _, a := range aliases {
+		if err = s.SaveAlias(netID, a.Channel, a.Alias); err != nil {
+			t.Fatal("Error adding alias:", err)
+		}
+	}
+
+	alias, err := s.FindAlias(netID, "#chan", "RULES")
+	if err != nil {
+		t.Fatal("Cannot get alias", err)
+	}
+	if alias == nil || alias.Expansion != "say Rules." {
+		t.Error("Wrong alias:", alias)
+	}
+
+	alias, err = s.FindAlias(netID, "", "rules")
+	if err != nil {
+		t.Fatal("Cannot get alias", err)
+	}
+	if alias == nil || alias.Expansion != "say Network rules." {
+		t.Error("Wrong alias:", alias)
+	}
+
+	if alias, err = s.FindAlias(netID, channel, "q"); err != nil {
+		t.Fatal("Cannot get alias", err)
+	} else if alias != nil {
+		t.Error("Network aliases should not be found on channels.")
+	}
+
+	list, err := s.Aliases(netID, channel)
+	if err != nil {
+		t.Fatal("Cannot list aliases", err)
+	}
+	if len(list) != 2 || list[0].Alias != "faq" || list[1].Alias != "rules" {
+		t.Error("Wrong channel aliases:", list)
+	}
+
+	list, err = s.Aliases(netID, "")
+	if err != nil {
+		t.Fatal("Cannot list aliases", err)
+	}
+	if len(list) != 2 || list[0].Alias != "q" || list[1].Alias != "rules" {
+		t.Error("Wrong network aliases:", list)
+	}
+
+	channels, err := s.Channels()
+	if err != nil {
+		t.Fatal("Cannot list channels", err)
+	}
+	if len(channels) != 1 {
+		t.Error("Aliases should not be listed as channels:", channels)
+	}
+
+	removed, err := s.RemoveAlias(netID, channel, "rules")
+	if err != nil {
+		t.Fatal("Error removing alias:", err)
+	}
+	if !removed {
+		t.Error("Alias was not reported as removed.")
+	}
+	if removed, _ = s.RemoveAlias(netID, channel, "rules"); removed {
+		t.Error("Alias should not be removed twice.")
+	}
+	if alias, _ = s.FindAlias(netID, "", "rules"); alias == nil {
+		t.Error("Network alias should not have been removed.")
+	}
+}
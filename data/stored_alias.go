@@ -0,0 +1,66 @@
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+)
+
+// aliasKeyPrefix is the prefix of all keys used to store aliases.
+const aliasKeyPrefix = "alias:"
+
+// StoredAlias is a user defined command that expands into another command.
+// An alias belongs to a network, or a channel on a network.
+type StoredAlias struct {
+	// Alias is the name of the command that is being created.
+	Alias string
+	// Expansion is the command and arguments that the alias expands to.
+	Expansion string
+	// Creator is the username of the user who created the alias.
+	Creator string
+}
+
+// NewStoredAlias creates a new stored alias.
+func NewStoredAlias(alias, expansion, creator string) *StoredAlias {
+	return &StoredAlias{
+		Alias:     strings.ToLower(alias),
+		Expansion: expansion,
+		Creator:   creator,
+	}
+}
+
+// makeAliasScope creates the prefix of the keys for all aliases belonging to
+// a network and channel. The channel is empty for network aliases.
+func makeAliasScope(netID, channel string) string {
+	return strings.ToLower(aliasKeyPrefix + netID + ":" + channel + ":")
+}
+
+// makeAliasID is used to create a key to store an alias by.
+func makeAliasID(netID, channel, alias string) string {
+	return makeAliasScope(netID, channel) + strings.ToLower(alias)
+}
+
+// serialize turns the StoredAlias into bytes for storage.
+func (s *StoredAlias) serialize() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buffer)
+	err := encoder.Encode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// deserializeAlias reverses the Serialize process.
+func deserializeAlias(serialized []byte) (*StoredAlias, error) {
+	buffer := &bytes.Buffer{}
+	decoder := gob.NewDecoder(buffer)
+	if _, err := buffer.Write(serialized); err != nil {
+		return nil, err
+	}
+
+	dec := &StoredAlias{}
+	err := decoder.Decode(dec)
+	return dec, err
+}
@@ -0,0 +1,47 @@
+package data
+
+import "testing"
+
+func TestStoredAlias(t *testing.T) {
+	t.Parallel()
+
+	a := NewStoredAlias("Rules", "say Read the topic.", "user")
+	if a == nil {
+		t.Error("Failed creating new stored alias.")
+	}
+
+	if a.Alias != "rules" || a.Expansion != "say Read the topic." ||
+		a.Creator != "user" {
+		t.Error("Values not set correctly.")
+	}
+}
+
+func TestStoredAlias_SerializeDeserialize(t *testing.T) {
+	t.Parallel()
+
+	a := NewStoredAlias("rules", "say Read the topic.", "user")
+
+	serialized, err := a.serialize()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(serialized) == 0 {
+		t.Error("Serialization did not yield a serialized copy.")
+	}
+
+	b, err := deserializeAlias(serialized)
+	if err != nil {
+		t.Fatal("Deserialization failed.")
+	}
+
+	if *a != *b {
+		t.Error("Alias not deserialized correctly:", b)
+	}
+
+	if _, err = deserializeChannel(serialized); err == nil {
+		t.Error("Aliases should not deserialize as channels.")
+	}
+	if _, err = deserializeUser(serialized); err == nil {
+		t.Error("Aliases should not deserialize as users.")
+	}
+}
@@ -7,6 +7,13 @@ import (
 	"strings"
 )
 
+const (
+	// topicsKey is the key the topic history is stored under.
+	topicsKey = "topics"
+	// topicLockKey is the key the locked topic is stored under.
+	topicLockKey = "topiclock"
+)
+
 // StoredChannel stores attributes for channels.
 type StoredChannel struct {
 	NetID string
@@ -48,3 +55,29 @@ func deserializeChannel(serialized []byte) (*StoredChannel, error) {
 	err := decoder.Decode(dec)
 	return dec, err
 }
+
+// PutTopics stores the topic history of the channel.
+func (s *StoredChannel) PutTopics(topics []TopicEntry) error {
+	return s.PutJSON(topicsKey, topics)
+}
+
+// Topics gets the stored topic history of the channel, nil if there is none.
+func (s *StoredChannel) Topics() (topics []TopicEntry, err error) {
+	_, err = s.GetJSON(topicsKey, &topics)
+	return
+}
+
+// LockTopic locks the topic of the channel, changes to it should be reverted.
+func (s *StoredChannel) LockTopic(topic string) {
+	s.Put(topicLockKey, topic)
+}
+
+// UnlockTopic unlocks the topic of the channel.
+func (s *StoredChannel) UnlockTopic() {
+	delete(s.JSONStorer, topicLockKey)
+}
+
+// TopicLock gets the locked topic of the channel if it is locked.
+func (s *StoredChannel) TopicLock() (topic string, locked bool) {
+	return s.Get(topicLockKey)
+}
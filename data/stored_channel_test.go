@@ -1,6 +1,9 @@
 package data
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestStoredChannel(t *testing.T) {
 	t.Parallel()
@@ -45,3 +48,39 @@ func TestStoredChannel_SerializeDeserialize(t *testing.T) {
 		t.Error("NetID not deserlialize correctly.")
 	}
 }
+
+func TestStoredChannel_Topics(t *testing.T) {
+	t.Parallel()
+
+	sc := NewStoredChannel("netID", "#bots")
+	if topics, err := sc.Topics(); err != nil || topics != nil {
+		t.Error("Expected no topics, got:", topics, err)
+	}
+
+	setAt := time.Unix(1367197165, 0).UTC()
+	history := []TopicEntry{{"new", "nick", setAt}, {Topic: "old"}}
+	if err := sc.PutTopics(history); err != nil {
+		t.Fatal(err)
+	}
+	topics, err := sc.Topics()
+	if err != nil || len(topics) != 2 {
+		t.Fatal("Expected the topics back, got:", topics, err)
+	}
+	if topics[0].Topic != "new" || topics[0].SetBy != "nick" ||
+		!topics[0].SetAt.Equal(setAt) || topics[1] != history[1] {
+
+		t.Error("The topics were not stored correctly:", topics)
+	}
+
+	if _, locked := sc.TopicLock(); locked {
+		t.Error("Expected the topic not to be locked.")
+	}
+	sc.LockTopic("new")
+	if topic, locked := sc.TopicLock(); !locked || topic != "new" {
+		t.Error("Expected the topic to be locked, got:", topic, locked)
+	}
+	sc.UnlockTopic()
+	if _, locked := sc.TopicLock(); locked {
+		t.Error("Expected the topic to be unlocked.")
+	}
+}
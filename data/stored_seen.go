@@ -0,0 +1,91 @@
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// seenKeyPrefix is the prefix of all keys used to store seen records.
+const seenKeyPrefix = "seen:"
+
+// StoredSeen is a record of the last time a user was seen before they left,
+// so that it's remembered after the State has forgotten about them.
+type StoredSeen struct {
+	// Nick is the nick the user was seen with.
+	Nick string
+	// Host is the full host the user was seen with.
+	Host string
+	// Action is the event the user was last seen in: irc.PART, irc.KICK,
+	// irc.QUIT or irc.NICK.
+	Action string
+	// Where is the channel the user left, empty when they quit or changed
+	// their nick.
+	Where string
+	// Reason is the part, kick or quit message, or the new nick.
+	Reason string
+	// Left is when the user was last seen.
+	Left time.Time
+	// Said is the last message the user sent to a channel the client was on.
+	Said string
+	// SaidWhere is the channel the last message was sent to.
+	SaidWhere string
+	// SaidTime is when the last message was sent, zero if there was none.
+	SaidTime time.Time
+}
+
+// makeSeenID is used to create a key to store a seen record by.
+func makeSeenID(netID, nick string) string {
+	return fmt.Sprintf("%s%s:%s", seenKeyPrefix, netID, strings.ToLower(nick))
+}
+
+// serialize turns the StoredSeen into bytes for storage.
+func (s *StoredSeen) serialize() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buffer)
+	err := encoder.Encode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// deserializeSeen reverses the Serialize process.
+func deserializeSeen(serialized []byte) (*StoredSeen, error) {
+	buffer := &bytes.Buffer{}
+	decoder := gob.NewDecoder(buffer)
+	if _, err := buffer.Write(serialized); err != nil {
+		return nil, err
+	}
+
+	dec := &StoredSeen{}
+	err := decoder.Decode(dec)
+	return dec, err
+}
+
+// SaveSeen saves the seen record of a user on a network, replacing the last
+// one kept for their nick.
+func (s *Store) SaveSeen(netID string, seen *StoredSeen) error {
+	serialized, err := seen.serialize()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set([]byte(makeSeenID(netID, seen.Nick)), serialized)
+}
+
+// FindSeen looks up the seen record of a nick on a network, nil if there is
+// none.
+func (s *Store) FindSeen(netID, nick string) (seen *StoredSeen, err error) {
+	var serialized []byte
+	serialized, err = s.db.Get(nil, []byte(makeSeenID(netID, nick)))
+	if err != nil || serialized == nil {
+		return
+	}
+
+	seen, err = deserializeSeen(serialized)
+	return
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoredSeen_SerializeDeserialize(t *testing.T) {
+	t.Parallel()
+
+	a := &StoredSeen{
+		Nick:      "nick",
+		Host:      host,
+		Action:    "PART",
+		Where:     "#chan",
+		Reason:    "bye",
+		Left:      time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+		Said:      "hello",
+		SaidWhere: "#chan",
+		SaidTime:  time.Date(2014, 1, 2, 3, 0, 0, 0, time.UTC),
+	}
+
+	serialized, err := a.serialize()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	b, err := deserializeSeen(serialized)
+	if err != nil {
+		t.Fatal("Deserialization failed.")
+	}
+	if !a.Left.Equal(b.Left) || !a.SaidTime.Equal(b.SaidTime) {
+		t.Error("Times not deserialized correctly:", b)
+	}
+	b.Left, b.SaidTime = a.Left, a.SaidTime
+	if *a != *b {
+		t.Error("Seen not deserialized correctly:", b)
+	}
+
+	if _, err = deserializeChannel(serialized); err == nil {
+		t.Error("Seen records should not deserialize as channels.")
+	}
+	if _, err = deserializeUser(serialized); err == nil {
+		t.Error("Seen records should not deserialize as users.")
+	}
+}
+
+func TestStore_Seen(t *testing.T) {
+	t.Parallel()
+	s, err := NewStore(MemStoreProvider)
+	defer s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen, err := s.FindSeen(network, "Nick"); err != nil || seen != nil {
+		t.Error("Expected nothing to be found:", seen, err)
+	}
+
+	err = s.SaveSeen(network, &StoredSeen{Nick: "Nick", Action: "QUIT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SaveSeen(network, &StoredSeen{Nick: "nick", Action: "PART"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err := s.FindSeen(network, "NICK")
+	if err != nil || seen == nil || seen.Action != "PART" {
+		t.Error("Expected the most recent record to be found:", seen, err)
+	}
+	if seen, err := s.FindSeen("other", "nick"); err != nil || seen != nil {
+		t.Error("Expected records to be kept per network:", seen, err)
+	}
+
+	if users, err := s.GlobalUsers(); err != nil || len(users) != 0 {
+		t.Error("Expected seen records not to be read as users:", users)
+	}
+}
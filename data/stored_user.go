@@ -25,6 +25,9 @@ var (
 	errDuplicateMask = errors.New("data: Duplicate mask in user creation")
 )
 
+// localeKey is the key in the JSONStorer that holds the user's locale.
+const localeKey = "locale"
+
 const (
 	nNewPasswordLen          = 10
 	newPasswordStart         = 48
@@ -234,6 +237,29 @@ func (a *StoredUser) DelMask(mask string) (deleted bool) {
 	return
 }
 
+// Nicks returns the nicks this user is likely to go by: the username, and the
+// nick of each mask that names one rather than using wildcards.
+func (a *StoredUser) Nicks() []string {
+	nicks := []string{a.Username}
+	for _, mask := range a.Masks {
+		nick, _, _ := irc.Mask(mask).Split()
+		if len(nick) == 0 || strings.ContainsAny(nick, "*?") {
+			continue
+		}
+		found := false
+		for _, n := range nicks {
+			if strings.EqualFold(n, nick) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			nicks = append(nicks, nick)
+		}
+	}
+	return nicks
+}
+
 // ValidateMask checks to see if this user has the given masks.
 func (a *StoredUser) ValidateMask(mask string) (has bool) {
 	if len(a.Masks) == 0 {
@@ -620,3 +646,20 @@ func (a *StoredUser) String(network, channel string) (str string) {
 	}
 	return
 }
+
+// Locale gets the language the user wants messages to be sent in, empty if
+// the user has not chosen one.
+func (a *StoredUser) Locale() string {
+	locale, _ := a.Get(localeKey)
+	return locale
+}
+
+// SetLocale sets the language the user wants messages to be sent in, an empty
+// string removes the user's choice.
+func (a *StoredUser) SetLocale(locale string) {
+	if len(locale) == 0 {
+		delete(a.JSONStorer, localeKey)
+		return
+	}
+	a.Put(localeKey, locale)
+}
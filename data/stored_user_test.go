@@ -144,6 +144,24 @@ func TestStoredUser_DelMasks(t *testing.T) {
 	}
 }
 
+func TestStoredUser_Nicks(t *testing.T) {
+	t.Parallel()
+	s := createStoredUser(`*!*@host`, `nick!*@*`, `Nick!user@host`,
+		`ni*k!*@*`, `other!*@*`)
+	s.Username = uname
+
+	nicks := s.Nicks()
+	exp := []string{uname, "nick", "other"}
+	if len(nicks) != len(exp) {
+		t.Fatal("Expected:", exp, "got:", nicks)
+	}
+	for i := range exp {
+		if nicks[i] != exp[i] {
+			t.Error("Expected:", exp, "got:", nicks)
+		}
+	}
+}
+
 func TestStoredUser_ValidateMasks(t *testing.T) {
 	t.Parallel()
 	masks := []string{`*!*@host`, `*!user@*`}
@@ -587,3 +605,23 @@ func TestStoredUser_ResetPassword(t *testing.T) {
 		t.Error("New password was malformed:", newpasswd)
 	}
 }
+
+func TestStoredUser_Locale(t *testing.T) {
+	t.Parallel()
+	s, err := NewStoredUser(uname, password)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if locale := s.Locale(); len(locale) != 0 {
+		t.Error("Expected no locale, got:", locale)
+	}
+	s.SetLocale("de")
+	if locale := s.Locale(); locale != "de" {
+		t.Error("Expected locale to be de, got:", locale)
+	}
+	s.SetLocale("")
+	if _, ok := s.Get(localeKey); ok {
+		t.Error("Expected locale to be removed.")
+	}
+}
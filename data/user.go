@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	"github.com/aarondl/ultimateq/irc"
 )
 
@@ -8,6 +10,16 @@ import (
 type User struct {
 	host irc.Host
 	name string
+
+	away    bool
+	awayMsg string
+	account string
+	bot     bool
+	oper    bool
+	secure  bool
+
+	oldNick     string
+	nickChanged time.Time
 }
 
 // NewUser creates a user object from a nickname or fullhost.
@@ -51,6 +63,78 @@ func (u *User) Realname() string {
 	return u.name
 }
 
+// SetAway marks the user as away with a message, the message may be empty
+// when it's not known.
+func (u *User) SetAway(message string) {
+	u.away = true
+	u.awayMsg = message
+}
+
+// SetBack marks the user as no longer away.
+func (u *User) SetBack() {
+	u.away = false
+	u.awayMsg = ""
+}
+
+// IsAway checks if the user is away.
+func (u *User) IsAway() bool {
+	return u.away
+}
+
+// AwayMessage returns the user's away message, empty if they're not away or
+// the message is not known.
+func (u *User) AwayMessage() string {
+	return u.awayMsg
+}
+
+// SetAccount sets the services account the user is logged in to, empty if
+// they're not logged in.
+func (u *User) SetAccount(account string) {
+	u.account = account
+}
+
+// Account returns the services account the user is logged in to, empty if
+// they're not logged in or it's not known.
+func (u *User) Account() string {
+	return u.account
+}
+
+// SetBot sets whether the user has marked themselves as a bot.
+func (u *User) SetBot(bot bool) {
+	u.bot = bot
+}
+
+// IsBot checks if the user has marked themselves as a bot.
+func (u *User) IsBot() bool {
+	return u.bot
+}
+
+// SetOper sets whether the user is an irc operator.
+func (u *User) SetOper(oper bool) {
+	u.oper = oper
+}
+
+// IsOper checks if the user is an irc operator.
+func (u *User) IsOper() bool {
+	return u.oper
+}
+
+// SetSecure sets whether the user is connected securely.
+func (u *User) SetSecure(secure bool) {
+	u.secure = secure
+}
+
+// IsSecure checks if the user is connected securely.
+func (u *User) IsSecure() bool {
+	return u.secure
+}
+
+// LastNickChange returns the nick the user had before their last nick change
+// and when it happened, the nick is empty if they have not changed it.
+func (u *User) LastNickChange() (oldNick string, changed time.Time) {
+	return u.oldNick, u.nickChanged
+}
+
 // String returns a one-line representation of this user.
 func (u *User) String() string {
 	str := u.host.Nick()
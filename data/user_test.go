@@ -47,3 +47,31 @@ func (s *s) TestUser_String(c *C) {
 	str = fmt.Sprint(u)
 	c.Check(str, Equals, "nick nick!user@host realname realname")
 }
+
+func (s *s) TestUser_Away(c *C) {
+	u := NewUser("nick!user@host")
+	c.Check(u.IsAway(), Equals, false)
+	u.SetAway("gone fishing")
+	c.Check(u.IsAway(), Equals, true)
+	c.Check(u.AwayMessage(), Equals, "gone fishing")
+	u.SetBack()
+	c.Check(u.IsAway(), Equals, false)
+	c.Check(u.AwayMessage(), Equals, "")
+}
+
+func (s *s) TestUser_Flags(c *C) {
+	u := NewUser("nick!user@host")
+	c.Check(u.Account(), Equals, "")
+	c.Check(u.IsBot(), Equals, false)
+	c.Check(u.IsOper(), Equals, false)
+	c.Check(u.IsSecure(), Equals, false)
+
+	u.SetAccount("account")
+	u.SetBot(true)
+	u.SetOper(true)
+	u.SetSecure(true)
+	c.Check(u.Account(), Equals, "account")
+	c.Check(u.IsBot(), Equals, true)
+	c.Check(u.IsOper(), Equals, true)
+	c.Check(u.IsSecure(), Equals, true)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// address holds what's needed to know if the bot is being addressed by its
+// nickname on a network.
+type address struct {
+	nick       string
+	separators string
+}
+
+// SetAddressing allows commands to be given on a network by addressing the
+// bot by its nickname instead of using the prefix, ie. botnick: help or
+// botnick, help. The separators are the characters that may follow the
+// nickname, an empty string turns addressing off. The bot's nickname is
+// learned from the welcome message and followed through nick changes.
+func (c *Cmds) SetAddressing(networkID, separators string) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	addr, ok := c.addressing[networkID]
+	if !ok {
+		addr = &address{}
+		c.addressing[networkID] = addr
+	}
+	addr.separators = separators
+}
+
+// trackNick keeps track of the bot's nickname on a network using the
+// welcome message and nick changes.
+func (c *Cmds) trackNick(networkID string, ev *irc.Event) {
+	if len(ev.Args) == 0 {
+		return
+	}
+
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	addr, ok := c.addressing[networkID]
+	if !ok {
+		addr = &address{}
+		c.addressing[networkID] = addr
+	}
+
+	switch ev.Name {
+	case irc.RPL_WELCOME:
+		addr.nick = ev.Args[0]
+	case irc.NICK:
+		if equalFold(ev.NetworkInfo, irc.Nick(ev.Sender), addr.nick) {
+			addr.nick = ev.Args[0]
+		}
+	}
+}
+
+// stripAddress checks if a message begins by addressing the bot by its
+// nickname followed by a separator, if so they're removed from the message.
+func (c *Cmds) stripAddress(networkID string, netInfo *irc.NetworkInfo,
+	msg string) (string, bool) {
+
+	c.protectCmds.RLock()
+	addr, ok := c.addressing[networkID]
+	var nick, separators string
+	if ok {
+		nick, separators = addr.nick, addr.separators
+	}
+	c.protectCmds.RUnlock()
+
+	if len(nick) == 0 || len(separators) == 0 || len(msg) <= len(nick) {
+		return msg, false
+	}
+
+	if !equalFold(netInfo, msg[:len(nick)], nick) ||
+		!strings.ContainsRune(separators, rune(msg[len(nick)])) {
+		return msg, false
+	}
+
+	return strings.TrimLeftFunc(msg[len(nick)+1:], unicode.IsSpace), true
+}
+
+// equalFold compares two nicks using the network's casemapping if it's known.
+func equalFold(netInfo *irc.NetworkInfo, a, b string) bool {
+	if netInfo == nil {
+		return strings.EqualFold(a, b)
+	}
+	return netInfo.EqualFold(a, b)
+}
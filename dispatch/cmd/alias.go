@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/aarondl/ultimateq/data"
+)
+
+// Variables that can be used in the expansion of an alias.
+const (
+	aliasVarAll  = "*"
+	aliasVarNick = "nick"
+	aliasVarChan = "chan"
+)
+
+// findAlias looks up a user defined alias in the store, first on the channel
+// if there is one, then on the network. The expansion is returned if an alias
+// was found.
+func findAlias(locker data.Locker, networkID, channel, name string) (
+	expansion string, found bool) {
+
+	locker.ReadStore(func(store *data.Store) {
+		if store == nil {
+			return
+		}
+
+		var alias *data.StoredAlias
+		if len(channel) != 0 {
+			alias, _ = store.FindAlias(networkID, channel, name)
+		}
+		if alias == nil {
+			alias, _ = store.FindAlias(networkID, "", name)
+		}
+		if alias != nil {
+			expansion, found = alias.Expansion, true
+		}
+	})
+
+	return
+}
+
+// expandAlias substitutes the variables in an alias' expansion. The variables
+// are: $1 to $9 for each argument, $* for all of the arguments, $nick for the
+// nick of the user and $chan for the channel. $$ is a literal $. If the
+// expansion has no argument variables the arguments are added to the end.
+func expandAlias(expansion, args, nick, channel string) string {
+	fields := strings.Fields(args)
+	var buf bytes.Buffer
+	var usedArgs bool
+
+	for i := 0; i < len(expansion); i++ {
+		if expansion[i] != '$' || i+1 == len(expansion) {
+			buf.WriteByte(expansion[i])
+			continue
+		}
+
+		rest := expansion[i+1:]
+		switch {
+		case rest[0] == '$':
+			buf.WriteByte('$')
+			i++
+		case rest[0] >= '1' && rest[0] <= '9':
+			if n := int(rest[0] - '1'); n < len(fields) {
+				buf.WriteString(fields[n])
+			}
+			usedArgs = true
+			i++
+		case strings.HasPrefix(rest, aliasVarAll):
+			buf.WriteString(strings.Join(fields, " "))
+			usedArgs = true
+			i += len(aliasVarAll)
+		case hasAliasVar(rest, aliasVarNick):
+			buf.WriteString(nick)
+			i += len(aliasVarNick)
+		case hasAliasVar(rest, aliasVarChan):
+			buf.WriteString(channel)
+			i += len(aliasVarChan)
+		default:
+			buf.WriteByte('$')
+		}
+	}
+
+	if !usedArgs && len(fields) != 0 {
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Join(fields, " "))
+	}
+
+	return buf.String()
+}
+
+// hasAliasVar checks if str begins with the name of a variable that is not
+// followed by more letters.
+func hasAliasVar(str, name string) bool {
+	if !strings.HasPrefix(str, name) {
+		return false
+	}
+	return len(str) == len(name) || !unicode.IsLetter(rune(str[len(name)]))
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+var (
+	// rgxArgType splits a type declaration of the form: type or type(params)
+	rgxArgType = regexp.MustCompile(`^([a-zA-Z]+)(?:\((.*)\))?$`)
+)
+
+// Names of the types that can be given to an argument.
+const (
+	argTypeInt      = "int"
+	argTypeFloat    = "float"
+	argTypeDuration = "duration"
+	argTypeBool     = "bool"
+	argTypeEnum     = "enum"
+	argTypeRegex    = "regex"
+	argTypeURL      = "url"
+	argTypeMask     = "mask"
+
+	argRangeSep  = ".."
+	argChoiceSep = "|"
+)
+
+// argConverter validates a user supplied argument and converts it to the
+// value that's handed to the command's handler.
+type argConverter interface {
+	convert(name, value string) (interface{}, error)
+}
+
+// parseArgType creates the converter for a type declaration.
+func parseArgType(decl string) (argConverter, error) {
+	fragments := rgxArgType.FindStringSubmatch(decl)
+	if fragments == nil {
+		return nil, fmt.Errorf(errFmtArgumentType, decl)
+	}
+
+	kind, params := strings.ToLower(fragments[1]), fragments[2]
+	hasParams := strings.HasSuffix(decl, ")")
+
+	switch kind {
+	case argTypeInt:
+		conv := &intArg{min: math.MinInt64, max: math.MaxInt64}
+		if hasParams && !parseRange(params, func(s string, max bool) error {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if max {
+				conv.max = n
+			} else {
+				conv.min = n
+			}
+			return err
+		}) || conv.min > conv.max {
+			return nil, fmt.Errorf(errFmtArgumentType, decl)
+		}
+		return conv, nil
+	case argTypeFloat:
+		conv := &floatArg{min: math.Inf(-1), max: math.Inf(1)}
+		if hasParams && !parseRange(params, func(s string, max bool) error {
+			n, err := strconv.ParseFloat(s, 64)
+			if max {
+				conv.max = n
+			} else {
+				conv.min = n
+			}
+			return err
+		}) || conv.min > conv.max {
+			return nil, fmt.Errorf(errFmtArgumentType, decl)
+		}
+		return conv, nil
+	case argTypeDuration:
+		conv := &durationArg{min: math.MinInt64, max: math.MaxInt64}
+		if hasParams && !parseRange(params, func(s string, max bool) error {
+			n, err := time.ParseDuration(s)
+			if max {
+				conv.max = n
+			} else {
+				conv.min = n
+			}
+			return err
+		}) || conv.min > conv.max {
+			return nil, fmt.Errorf(errFmtArgumentType, decl)
+		}
+		return conv, nil
+	case argTypeEnum:
+		if len(params) == 0 {
+			return nil, fmt.Errorf(errFmtArgumentType, decl)
+		}
+		choices := strings.Split(params, argChoiceSep)
+		for _, choice := range choices {
+			if len(choice) == 0 {
+				return nil, fmt.Errorf(errFmtArgumentType, decl)
+			}
+		}
+		return enumArg(choices), nil
+	}
+
+	if hasParams {
+		return nil, fmt.Errorf(errFmtArgumentType, decl)
+	}
+
+	switch kind {
+	case argTypeBool:
+		return boolArg{}, nil
+	case argTypeRegex:
+		return regexArg{}, nil
+	case argTypeURL:
+		return urlArg{}, nil
+	case argTypeMask:
+		return maskArg{}, nil
+	}
+
+	return nil, fmt.Errorf(errFmtArgumentType, decl)
+}
+
+// parseRange parses params of the form: min..max where either min or max may
+// be omitted to leave that side of the range unbounded. The set function is
+// called for each bound that is present. Returns false if the range is
+// malformed or set returns an error, the caller must check the bounds aren't
+// inverted.
+func parseRange(params string, set func(bound string, max bool) error) bool {
+	parts := strings.Split(params, argRangeSep)
+	if len(parts) != 2 || (len(parts[0]) == 0 && len(parts[1]) == 0) {
+		return false
+	}
+
+	for i, bound := range parts {
+		if len(bound) == 0 {
+			continue
+		}
+		if err := set(bound, i == 1); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// outOfRange creates an error for a value that falls outside of a range,
+// omitting the bounds that were left open.
+func outOfRange(name, value string, min, max interface{},
+	hasMin, hasMax bool) error {
+
+	switch {
+	case hasMin && hasMax:
+		return locale.Errorf(errFmtArgumentBetween, name, min, max, value)
+	case hasMin:
+		return locale.Errorf(errFmtArgumentAtLeast, name, min, value)
+	default:
+		return locale.Errorf(errFmtArgumentAtMost, name, max, value)
+	}
+}
+
+// intArg is an integer with an inclusive range.
+type intArg struct {
+	min, max int64
+}
+
+func (i *intArg) convert(name, value string) (interface{}, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, locale.Errorf(errFmtArgumentNotType, name, "an integer", value)
+	}
+	if n < i.min || n > i.max {
+		return nil, outOfRange(name, value, i.min, i.max,
+			i.min != math.MinInt64, i.max != math.MaxInt64)
+	}
+	return int(n), nil
+}
+
+// floatArg is a floating point number with an inclusive range.
+type floatArg struct {
+	min, max float64
+}
+
+func (f *floatArg) convert(name, value string) (interface{}, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(n) {
+		return nil, locale.Errorf(errFmtArgumentNotType, name, "a number", value)
+	}
+	if n < f.min || n > f.max {
+		return nil, outOfRange(name, value, f.min, f.max,
+			!math.IsInf(f.min, -1), !math.IsInf(f.max, 1))
+	}
+	return n, nil
+}
+
+// durationArg is a duration in the form of time.ParseDuration with an
+// inclusive range.
+type durationArg struct {
+	min, max time.Duration
+}
+
+func (d *durationArg) convert(name, value string) (interface{}, error) {
+	n, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, locale.Errorf(errFmtArgumentNotType, name,
+			"a duration (ex. 1h30m)", value)
+	}
+	if n < d.min || n > d.max {
+		return nil, outOfRange(name, value, d.min, d.max,
+			d.min != math.MinInt64, d.max != math.MaxInt64)
+	}
+	return n, nil
+}
+
+// boolArg accepts the common ways of saying yes or no.
+type boolArg struct{}
+
+func (boolArg) convert(name, value string) (interface{}, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "y", "1":
+		return true, nil
+	case "false", "no", "off", "n", "0":
+		return false, nil
+	}
+	return nil, locale.Errorf(errFmtArgumentNotType, name,
+		"true or false", value)
+}
+
+// enumArg is one of a list of choices, compared without regard to case.
+type enumArg []string
+
+func (e enumArg) convert(name, value string) (interface{}, error) {
+	for _, choice := range e {
+		if strings.EqualFold(choice, value) {
+			return choice, nil
+		}
+	}
+	return nil, locale.Errorf(errFmtArgumentNotChoice, name,
+		strings.Join(e, ", "), value)
+}
+
+// regexArg is a regular expression that must compile.
+type regexArg struct{}
+
+func (regexArg) convert(name, value string) (interface{}, error) {
+	rgx, err := regexp.Compile(value)
+	if err != nil {
+		return nil, locale.Errorf(errFmtArgumentNotType, name,
+			"a valid regular expression", value)
+	}
+	return rgx, nil
+}
+
+// urlArg is an absolute url.
+type urlArg struct{}
+
+func (urlArg) convert(name, value string) (interface{}, error) {
+	u, err := url.Parse(value)
+	if err != nil || !u.IsAbs() || len(u.Host) == 0 {
+		return nil, locale.Errorf(errFmtArgumentNotType, name, "a url", value)
+	}
+	return u, nil
+}
+
+// maskArg is a host mask of the form nick!user@host.
+type maskArg struct{}
+
+func (maskArg) convert(name, value string) (interface{}, error) {
+	mask := irc.Mask(value)
+	if !mask.IsValid() {
+		return nil, locale.Errorf(errFmtArgumentNotType, name,
+			"a host mask (nick!user@host)", value)
+	}
+	return mask, nil
+}
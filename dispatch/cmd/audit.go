@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+// AuditFunc is given an entry for each command a user tries to use, once the
+// command has returned or has been refused. It's called after the event's
+// State and Store have been closed.
+type AuditFunc func(command *Cmd, entry *data.AuditEntry)
+
+// SetAudit sets the function that's given an entry for each command used, nil
+// turns auditing off.
+func (c *Cmds) SetAudit(fn AuditFunc) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	c.audit = fn
+}
+
+// newAuditEntry creates an entry for a command if auditing is on, nil if
+// it's not. The store may be nil.
+func (c *Cmds) newAuditEntry(networkID string, command *Cmd, ch string,
+	isChan bool, args string, ev *irc.Event,
+	store *data.Store) *data.AuditEntry {
+
+	c.protectCmds.RLock()
+	audit := c.audit
+	c.protectCmds.RUnlock()
+	if audit == nil {
+		return nil
+	}
+
+	entry := &data.AuditEntry{
+		Time:      time.Now(),
+		NetworkID: networkID,
+		Sender:    ev.Sender,
+		Command:   command.FullName(),
+		Arguments: args,
+	}
+	if isChan {
+		entry.Target = ch
+	}
+	if store != nil {
+		if access := store.GetAuthedUser(networkID, ev.Sender); access != nil {
+			entry.Account = access.Username
+		}
+	}
+
+	return entry
+}
+
+// emitAudit gives an entry to the audit function along with the result of
+// the command. The event must already be closed.
+func (c *Cmds) emitAudit(command *Cmd, entry *data.AuditEntry, err error) {
+	if entry == nil {
+		return
+	}
+
+	c.protectCmds.RLock()
+	audit := c.audit
+	c.protectCmds.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	if err != nil {
+		entry.Result = locale.ErrorString("", err)
+	}
+	audit(command, entry)
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/aarondl/ultimateq/data"
 )
 
 var (
@@ -11,6 +14,11 @@ var (
 	// forms: arg #arg [arg] or arg...
 	rgxArgs = regexp.MustCompile(
 		`(?i)^(\[[~\*]?[a-z0-9]+\]|[~\*]?[a-z0-9]+(\.\.\.)?|#[a-z0-9]+)$`)
+	// rgxFlag checks a single flag to see if it matches the forms:
+	// --flag -f -f|--flag and any of those followed by = or =type. Short
+	// flags are letters so they can't be mistaken for negative numbers.
+	rgxFlag = regexp.MustCompile(
+		`^(?:-([a-zA-Z])\|)?(--[a-zA-Z0-9][a-zA-Z0-9\-]*|-[a-zA-Z])(=.*)?$`)
 )
 
 type argType int
@@ -36,18 +44,43 @@ type argument struct {
 	Original string
 	Name     string
 	Type     argType
+	// Conv is set when the argument was declared with a type.
+	Conv argConverter
+}
+
+// flag is a type to hold flag information.
+type flag struct {
+	Name  string
+	Short string
+	Long  string
+	// Value is whether the flag takes a value or is a switch.
+	Value bool
+	// Decl is the type declaration of the flag's value if it has one.
+	Decl string
+	// Conv is set when the flag's value was declared with a type.
+	Conv argConverter
 }
 
 // Cmd holds all the information about a command.
 type Cmd struct {
 	// The name of the command.
 	Cmd string
+	// Aliases are other names the command can be invoked by. They're
+	// registered along with the command and must be unique in the same way.
+	Aliases []string
 	// Extension is the name of the extension registering this command.
 	Extension string
 	// Description is a description of the command's function.
 	Description string
+	// LongDescription is shown in addition to the Description when help is
+	// given for only this command.
+	LongDescription string
+	// Examples are shown when help is given for only this command. Each is a
+	// complete use of the command without the prefix, ie. quote add hello.
+	Examples []string
 	// Msgtype is the type of messages this command reacts to, may be the
-	// any of the constants: PRIVMSG, NOTICE or ALL.
+	// any of the constants: PRIVMSG, NOTICE, CTCP, DCC or ALL, combined with
+	// bitwise or.
 	Msgtype int
 	// Msgscope is the scope of the messages this command reacts to. May be
 	// any of the constants: PRIVATE, PUBLIC or ALL.
@@ -83,17 +116,75 @@ type Cmd struct {
 	//     by a *, then it looks up the user based on username directly. If
 	//     the user is not found (via nickname), not authed (via username)
 	//     the command will fail.
+	// Required and [optional] arguments without flags may also declare a type
+	// by following their name with a colon and the type, for example:
+	// count:int or [timeout:duration(1s..1h)]. The argument is validated and
+	// converted before the handler is called and an error is sent to the user
+	// if it's invalid. The converted value is retrieved with the typed getters
+	// on Event. The types available are:
+	// int, float, duration: Numbers and time.ParseDuration strings. They may
+	//     be given an inclusive range like: int(1..10), float(0..) or
+	//     duration(..24h).
+	// bool: Accepts true/false, yes/no, on/off, y/n and 1/0.
+	// enum(a|b|c): Must be one of the choices given, case insensitive. GetArg
+	//     returns the choice as it was declared.
+	// regex: Must be a valid regular expression.
+	// url: Must be an absolute url.
+	// mask: Must be a valid host mask of the form nick!user@host.
+	// Flags may also be given in any position, they're not counted as
+	// arguments and the user may give them anywhere in the command. Flags have
+	// the following forms:
+	// --name or -n: A switch that is either present or not, see HasFlag.
+	// -n|--name: A switch with both a short and long form.
+	// --name= or -n|--name=: A flag that takes a value, either as --name=value
+	//     or --name value, see GetFlag.
+	// --name=type: A flag that takes a value of a type as described above,
+	//     for example: --count=int(1..10).
+	// A flag is referred to by its long name without dashes if it has one,
+	// otherwise its short name. A -- given by the user ends flag parsing.
+	// Declaring flags implies QuotedArgs.
 	Args []string
+	// QuotedArgs turns on shell-like parsing of the arguments given by the
+	// user. Words can be grouped into a single argument with single or double
+	// quotes, and a backslash escapes the character after it.
+	QuotedArgs bool
 	// RequireAuth is whether or not this command requires authentication.
 	RequireAuth bool
 	// ReqLevel is the required level for use.
 	ReqLevel uint8
 	// ReqFlags is the required flags for use.
 	ReqFlags string
+	// Limits are the rate limits for the command. They're checked after the
+	// user's access and arguments, and a use is only counted against the
+	// limits when all of them allow it.
+	Limits []RateLimit
+	// LimitExempt is the flags that allow a user to ignore the rate limits.
+	// Only authenticated users can be exempt.
+	LimitExempt string
+	// LimitSilent ignores rate limited uses of the command instead of telling
+	// the user how long until they may use it again.
+	LimitSilent bool
+	// Confirm makes the user confirm the command before it's invoked. Once
+	// their access and arguments have been checked they're given a token and
+	// the command is only invoked if they reply: confirm <token> soon after.
+	// The token can only be confirmed by the same user in the same channel.
+	Confirm bool
 	// Handler the handler structure that will handle events for this command.
 	Handler CmdHandler
+	// Subcommands makes this command a group of commands. When the first
+	// argument given by a user is the name of a subcommand the subcommand is
+	// invoked with the remaining arguments instead. Subcommands have their own
+	// Args, Description and access requirements, but inherit the Extension,
+	// Msgtype, Msgscope and Handler of their parent when they are not set.
+	// A group that has no Handler requires a subcommand to be given.
+	// Subcommands are invoked by cmdNameDispatch using the names of each
+	// command in the group, ie. quote add is dispatched to QuoteAdd.
+	Subcommands []*Cmd
+	// parent is set on subcommands when they are registered.
+	parent *Cmd
 	// args stores data about each argument after it's parsed.
 	args    []argument
+	flags   []flag
 	reqArgs int
 	optArgs int
 }
@@ -113,6 +204,16 @@ func MkCmd(ext, desc, cmd string, handler CmdHandler, msgtype, msgscope int,
 	}
 }
 
+// MkGroup is a helper method to easily create a Cmd that is only a group
+// of subcommands. See the documentation for Cmd on what each parameter is.
+func MkGroup(ext, desc, cmd string, msgtype, msgscope int,
+	subcommands ...*Cmd) *Cmd {
+
+	command := MkCmd(ext, desc, cmd, nil, msgtype, msgscope)
+	command.Subcommands = subcommands
+	return command
+}
+
 // MkAuthCmd is a helper method to easily create an authenticated Cmd. See
 // the documentation on Cmd for what each parameter is.
 func MkAuthCmd(ext, desc, cmd string, handler CmdHandler,
@@ -126,9 +227,202 @@ func MkAuthCmd(ext, desc, cmd string, handler CmdHandler,
 	return command
 }
 
-// parseArgs parses and sets the arguments for a command.
+// FullName is the name of the command including the names of the groups it
+// belongs to, ie. quote add
+func (c *Cmd) FullName() string {
+	if c.parent == nil {
+		return c.Cmd
+	}
+	return c.parent.FullName() + " " + c.Cmd
+}
+
+// Parent returns the group this command belongs to, or nil if it's not a
+// subcommand.
+func (c *Cmd) Parent() *Cmd {
+	return c.parent
+}
+
+// Subcommand finds a subcommand by name or alias, nil if it does not exist.
+func (c *Cmd) Subcommand(name string) *Cmd {
+	for _, sub := range c.Subcommands {
+		if sub.IsNamed(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// IsNamed checks if the name given is the name or an alias of the command
+// without regard to case.
+func (c *Cmd) IsNamed(name string) bool {
+	if strings.EqualFold(c.Cmd, name) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage creates a line describing how to use the command from its name and
+// arguments, ie. quote add [#chan] <text...> [--count=<int>]. Arguments in
+// <> are required and those in [] are optional. The command must have been
+// registered for its arguments to have been parsed.
+func (c *Cmd) Usage() string {
+	parts := []string{c.FullName()}
+	if c.args == nil && c.flags == nil && len(c.Args) != 0 {
+		return strings.Join(append(parts, c.Args...), " ")
+	}
+
+	for _, arg := range c.args {
+		name := arg.Name
+		if index := strings.IndexByte(arg.Original, ':'); index >= 0 {
+			name += ":" + strings.TrimSuffix(arg.Original[index+1:], "]")
+		}
+
+		switch {
+		case arg.Type&CHANNEL != 0:
+			parts = append(parts, "[#"+name+"]")
+		case arg.Type&VARIADIC != 0:
+			parts = append(parts, "["+name+"...]")
+		case arg.Type&OPTIONAL != 0:
+			parts = append(parts, "["+name+"]")
+		default:
+			parts = append(parts, "<"+name+">")
+		}
+	}
+
+	if len(c.Subcommands) != 0 {
+		names := make([]string, len(c.Subcommands))
+		for i, sub := range c.Subcommands {
+			names[i] = sub.Cmd
+		}
+		if c.Handler == nil {
+			parts = append(parts, "<"+strings.Join(names, "|")+">")
+		} else {
+			parts = append(parts, "["+strings.Join(names, "|")+"]")
+		}
+	}
+
+	for _, f := range c.flags {
+		var names []string
+		if len(f.Short) != 0 {
+			names = append(names, "-"+f.Short)
+		}
+		if len(f.Long) != 0 {
+			names = append(names, "--"+f.Long)
+		}
+		spec := strings.Join(names, "|")
+		if f.Value {
+			value := "value"
+			if len(f.Decl) != 0 {
+				value = f.Decl
+			}
+			spec += "=<" + value + ">"
+		}
+		parts = append(parts, "["+spec+"]")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// HasAccess checks if a user has the access required to use the command on
+// a network and channel. The user is nil if they're not authenticated.
+func (c *Cmd) HasAccess(user *data.StoredUser, networkID, channel string) bool {
+	if !c.RequireAuth {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	if c.ReqLevel != 0 && !user.HasLevel(networkID, channel, c.ReqLevel) {
+		return false
+	}
+	if len(c.ReqFlags) != 0 && !user.HasFlags(networkID, channel, c.ReqFlags) {
+		return false
+	}
+	return true
+}
+
+// prepare validates a command and parses its arguments, as well as those of
+// all its subcommands which inherit missing values from it.
+func (c *Cmd) prepare() error {
+	switch {
+	case len(c.Cmd) == 0:
+		return errors.New(errMsgCmdRequired)
+	case len(c.Extension) == 0:
+		return errors.New(errMsgExtRequired)
+	case len(c.Description) == 0:
+		return errors.New(errMsgDescRequired)
+	case c.Handler == nil && len(c.Subcommands) == 0:
+		return errors.New(errMsgHandlerRequired)
+	}
+
+	if err := c.parseArgs(); err != nil {
+		return err
+	}
+
+	for _, limit := range c.Limits {
+		if limit.Scope < LIMITUSER || limit.Scope > LIMITGLOBAL ||
+			limit.Uses <= 0 || limit.Per <= 0 {
+			return fmt.Errorf(errFmtRateLimit, c.FullName())
+		}
+	}
+
+	for i, sub := range c.Subcommands {
+		for j := 0; j < i; j++ {
+			other := c.Subcommands[j]
+			if other.IsNamed(sub.Cmd) {
+				return fmt.Errorf(errFmtDuplicateSubcmd, sub.FullName())
+			}
+			for _, alias := range sub.Aliases {
+				if other.IsNamed(alias) {
+					return fmt.Errorf(errFmtDuplicateSubcmd, alias)
+				}
+			}
+		}
+
+		sub.parent = c
+		if len(sub.Extension) == 0 {
+			sub.Extension = c.Extension
+		}
+		if sub.Msgtype == 0 {
+			sub.Msgtype = c.Msgtype
+		}
+		if sub.Msgscope == 0 {
+			sub.Msgscope = c.Msgscope
+		}
+		if sub.Handler == nil {
+			sub.Handler = c.Handler
+		}
+
+		if err := sub.prepare(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseArgs parses and sets the arguments and flags for a command.
 func (c *Cmd) parseArgs() error {
-	nArgs := len(c.Args)
+	c.args, c.flags = nil, nil
+	c.reqArgs, c.optArgs = 0, 0
+
+	var positional []string
+	for _, arg := range c.Args {
+		if len(arg) > 0 && arg[0] == '-' {
+			if err := c.parseFlag(arg); err != nil {
+				return err
+			}
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	nArgs := len(positional)
 	if nArgs == 0 {
 		return nil
 	}
@@ -138,19 +432,28 @@ func (c *Cmd) parseArgs() error {
 	var chanArg, required, optional, variadic bool
 
 	for i := 0; i < nArgs; i++ {
-		arg := strings.ToLower(c.Args[i])
+		name, conv, err := splitArgType(positional[i])
+		if err != nil {
+			return err
+		}
+
+		arg := strings.ToLower(name)
 		if !rgxArgs.MatchString(arg) {
-			return fmt.Errorf(errFmtArgumentForm, arg)
+			return fmt.Errorf(errFmtArgumentForm, positional[i])
 		}
 
 		argMeta := &c.args[i]
-		argMeta.Original = arg
-		argMeta.Name = strings.Trim(c.Args[i], argStripChars)
+		argMeta.Original = strings.ToLower(positional[i])
+		argMeta.Name = strings.Trim(name, argStripChars)
+		argMeta.Conv = conv
 		for j := 0; j < i; j++ {
 			if c.args[j].Name == argMeta.Name {
 				return fmt.Errorf(errFmtArgumentDupName, argMeta.Name)
 			}
 		}
+		if c.findFlag(argMeta.Name) != nil {
+			return fmt.Errorf(errFmtArgumentDupName, argMeta.Name)
+		}
 
 		modifier := arg[0]
 		if modifier == '[' {
@@ -197,3 +500,111 @@ func (c *Cmd) parseArgs() error {
 
 	return nil
 }
+
+// splitArgType removes a type declaration from an argument if it has one and
+// creates the converter for it. The argument is returned without the type.
+func splitArgType(arg string) (string, argConverter, error) {
+	index := strings.IndexByte(arg, ':')
+	if index < 0 {
+		return arg, nil, nil
+	}
+
+	name, decl := arg[:index], arg[index+1:]
+	if len(name) > 0 && name[0] == '[' {
+		if !strings.HasSuffix(decl, "]") {
+			return "", nil, fmt.Errorf(errFmtArgumentForm, arg)
+		}
+		decl = decl[:len(decl)-1]
+		name += "]"
+	}
+
+	if strings.HasSuffix(decl, "...") {
+		return "", nil, fmt.Errorf(errFmtArgumentTypeVargs, arg)
+	}
+	if strings.ContainsAny(name, "#~*") {
+		return "", nil, fmt.Errorf(errFmtArgumentTypeFlag, arg)
+	}
+
+	conv, err := parseArgType(decl)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, conv, nil
+}
+
+// parseFlag parses and adds a flag to the command.
+func (c *Cmd) parseFlag(spec string) error {
+	fragments := rgxFlag.FindStringSubmatch(spec)
+	if fragments == nil {
+		return fmt.Errorf(errFmtArgumentFlag, spec)
+	}
+
+	f := flag{Short: fragments[1]}
+	if strings.HasPrefix(fragments[2], "--") {
+		f.Long = fragments[2][2:]
+		f.Name = f.Long
+	} else if len(f.Short) != 0 {
+		return fmt.Errorf(errFmtArgumentFlag, spec)
+	} else {
+		f.Short = fragments[2][1:]
+		f.Name = f.Short
+	}
+
+	if len(fragments[3]) != 0 {
+		f.Value = true
+		if decl := fragments[3][1:]; len(decl) != 0 {
+			f.Decl = decl
+			conv, err := parseArgType(f.Decl)
+			if err != nil {
+				return err
+			}
+			f.Conv = conv
+		}
+	}
+
+	for _, other := range c.flags {
+		if other.Name == f.Name || (len(f.Short) != 0 && other.Short == f.Short) ||
+			(len(f.Long) != 0 && other.Long == f.Long) {
+			return fmt.Errorf(errFmtArgumentDupName, f.Name)
+		}
+	}
+
+	c.flags = append(c.flags, f)
+	return nil
+}
+
+// findFlag finds a flag by its name.
+func (c *Cmd) findFlag(name string) *flag {
+	for i := range c.flags {
+		if c.flags[i].Name == name {
+			return &c.flags[i]
+		}
+	}
+	return nil
+}
+
+// lookupFlag finds a flag as it was given by a user, ie. --name or -n.
+func (c *Cmd) lookupFlag(given string) *flag {
+	for i := range c.flags {
+		f := &c.flags[i]
+		if (len(f.Long) != 0 && given == "--"+f.Long) ||
+			(len(f.Short) != 0 && given == "-"+f.Short) {
+			return f
+		}
+	}
+	return nil
+}
+
+// quoted checks if the command's arguments should be tokenized.
+func (c *Cmd) quoted() bool {
+	return c.QuotedArgs || len(c.flags) != 0
+}
+
+// splitArgs splits the arguments given by a user into fields, or tokenizes
+// them if the command uses quoted arguments.
+func (c *Cmd) splitArgs(args string) ([]string, error) {
+	if c.quoted() {
+		return tokenize(args)
+	}
+	return strings.Fields(args), nil
+}
@@ -16,10 +16,12 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/dispatch"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
 )
 
 // Constants used for defining the targets/scope of a command.
@@ -30,6 +32,12 @@ const (
 	PRIVMSG = 0x1
 	// NOTICE only listens to irc.NOTICE events.
 	NOTICE = 0x2
+	// CTCP only listens to CTCP requests, the CTCP tag is the command and
+	// a prefix is never required. Commands should answer with a CTCPReply.
+	CTCP = 0x4
+	// DCC only listens to lines sent in a DCC CHAT session with the bot
+	// (see irc.DCCCHAT), these are always PRIVATE.
+	DCC = 0x8
 	// PRIVATE only listens to PRIVMSG or NOTICE sent directly to the bot.
 	PRIVATE = 0x1
 	// PUBLIC only listens to PRIVMSG or NOTICE sent to a channel.
@@ -50,6 +58,10 @@ const (
 	errMsgExtRequired     = `cmd: Extension name cannot be empty.`
 	errMsgDescRequired    = `cmd: Description cannot be empty.`
 	errMsgHandlerRequired = `cmd: Handler required for command registration.`
+	errFmtDuplicateSubcmd = `cmd: ` +
+		`Duplicate subcommand registration attempted (%v)`
+	errFmtRateLimit = `cmd: Rate limits must have a valid scope and ` +
+		`allow at least one use per positive duration (%v)`
 
 	errMsgStoreDisabled = "Access Denied: Cannot use authenticated commands, " +
 		"nick or user parameters when store is disabled."
@@ -67,19 +79,44 @@ const (
 	errFmtInsuffServerFlags  = "Access Denied: (%v) server flag(s) required."
 	errFmtInsuffChannelFlags = "Access Denied: (%v) channel flag(s) required."
 	errFmtCmdNotFound        = "Error: Command not found (%v), try \"help\"."
+	errFmtSubcmdRequired     = "Error: Expected a subcommand of (%v): %v"
+	errFmtRateLimited        = "Error: Command (%v) is rate limited, " +
+		"try again in %v."
 	errFmtUserNotRegistered  = "Error: User [%v] is not registered."
 	errFmtUserNotAuthed      = "Error: User [%v] is not authenticated."
 	errFmtUserNotFound       = "Error: User [%v] could not be found."
 	errMsgMissingUsername    = "Error: Username must follow *, found nothing."
 	errMsgUnexpectedArgument = "Error: No arguments expected."
-	errFmtNArguments         = "Error: Expected %v %v arguments. (%v)"
+	errFmtArgAtLeast         = "Error: Expected at least %v argument. (%v)"
+	errFmtArgsAtLeast        = "Error: Expected at least %v arguments. (%v)"
+	errFmtArgAtMost          = "Error: Expected at most %v argument. (%v)"
+	errFmtArgsAtMost         = "Error: Expected at most %v arguments. (%v)"
 	errFmtArgumentNotChannel = "Error: Expected a valid channel. (given: %v)"
-	errAtLeast               = "at least"
-	errExactly               = "exactly"
-	errAtMost                = "at most"
+
+	errFmtArgumentNotType   = "Error: Expected %v to be %v. (given: %v)"
+	errFmtArgumentNotChoice = "Error: Expected %v to be one of: %v. " +
+		"(given: %v)"
+	errFmtArgumentBetween = "Error: Expected %v to be between %v and %v. " +
+		"(given: %v)"
+	errFmtArgumentAtLeast = "Error: Expected %v to be at least %v. (given: %v)"
+	errFmtArgumentAtMost  = "Error: Expected %v to be at most %v. (given: %v)"
+
+	errMsgUnterminatedQuote = "Error: Unterminated quote in arguments."
+	errFmtFlagUnknown       = "Error: Unknown flag (%v)."
+	errFmtFlagNeedsValue    = "Error: Flag (%v) requires a value."
+	errFmtFlagHasValue      = "Error: Flag (%v) does not take a value."
+
+	errFmtCmdSuggest  = "Error: Command not found (%v), did you mean: %v?"
+	errFmtPipeTooLong = "Error: Pipelines may have at most %v commands."
+
+	errFmtConfirmRequired = "Command (%v) must be confirmed, to confirm it " +
+		"reply with: confirm %v (within %v)"
+	errMsgConfirmNotFound = "Error: Nothing to confirm with that token, " +
+		"it may have expired."
 
 	errFmtArgumentForm = `cmd: Arguments must look like: ` +
-		`#name OR [~|*]name OR [[~|*]name] OR [~|*]name... (given: %v)`
+		`#name OR [~|*]name OR [[~|*]name] OR [~|*]name... OR ` +
+		`name:type OR [name:type] (given: %v)`
 	errFmtArgumentOrderReq = `cmd: Required arguments must come before ` +
 		`all [optional] and varargs... arguments. (given: %v)`
 	errFmtArgumentOrderOpt = `cmd: Optional arguments must come before ` +
@@ -92,6 +129,16 @@ const (
 		`first. (given: %v)`
 	errFmtArgumentDupChan = `cmd: Only one #channel argument is ` +
 		`allowed (given: %v)`
+	errFmtArgumentType = `cmd: Argument types must be one of: ` +
+		`int[(min..max)] float[(min..max)] duration[(min..max)] bool ` +
+		`enum(a|b) regex url mask (given: %v)`
+	errFmtArgumentTypeVargs = `cmd: Varargs... arguments cannot have a ` +
+		`type (given: %v)`
+	errFmtArgumentTypeFlag = `cmd: #channel, ~nick and *user arguments ` +
+		`cannot have a type (given: %v)`
+	errFmtArgumentFlag = `cmd: Flags must look like: ` +
+		`--name OR -n OR -n|--name optionally followed by = OR =type ` +
+		`(given: %v)`
 )
 
 var (
@@ -108,7 +155,11 @@ func EachCmd(fn func(*Cmd) bool) {
 	protectGlobalReg.RLock()
 	defer protectGlobalReg.RUnlock()
 
-	for _, cmd := range globalCmdRegistry {
+	for name, cmd := range globalCmdRegistry {
+		// Skip the entries for aliases so each command is seen only once.
+		if !strings.HasSuffix(name, ":"+cmd.Cmd) {
+			continue
+		}
 		if fn(cmd) {
 			break
 		}
@@ -129,7 +180,9 @@ func EachCmd(fn func(*Cmd) bool) {
 //	func (b *Handler) Supercommand(d *data.DataEndpoint,
 //	    c *cmd.Event) error { return nil }
 //
-// !supercommand in a channel would invoke the bottom handler.
+// !supercommand in a channel would invoke the bottom handler. Subcommands use
+// the name of each command in their group, so !supercommand sub would invoke
+// a method named SupercommandSub.
 type CmdHandler interface {
 	Cmd(string, irc.Writer, *Event) error
 }
@@ -141,20 +194,55 @@ type commandTable map[string]*Cmd
 // and provides a rich programming interface for command handling.
 type Cmds struct {
 	*dispatch.DispatchCore
-	prefix      rune
+	prefix      string
 	commands    commandTable
+	sequencer   *dispatch.Sequencer
+	limiter     *rateLimiter
+	confirms    *confirmer
+	unknownCmds UnknownCmdsFunc
+	locales     LocaleFunc
+	audit       AuditFunc
+	identity    IdentityFunc
+	addressing  map[string]*address
 	protectCmds sync.RWMutex
 }
 
-// NewCmds initializes a cmds.
-func NewCmds(prefix rune, core *dispatch.DispatchCore) *Cmds {
+// NewCmds initializes a cmds. The prefix is what must begin a command given
+// in a channel, it may be more than one character.
+func NewCmds(prefix string, core *dispatch.DispatchCore) *Cmds {
 	return &Cmds{
 		DispatchCore: core,
 		prefix:       prefix,
 		commands:     make(commandTable),
+		limiter:      newRateLimiter(),
+		confirms:     newConfirmer(),
+		addressing:   make(map[string]*address),
 	}
 }
 
+// SetSequential turns sequential mode on or off. While on, a command handler
+// is not started until the handlers for all the previous commands issued in
+// the same channel (or by the same nick in private) on the same network
+// have returned. Commands for different channels are still run in parallel.
+func (c *Cmds) SetSequential(sequential bool) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	if !sequential {
+		c.sequencer = nil
+	} else if c.sequencer == nil {
+		c.sequencer = dispatch.NewSequencer()
+	}
+}
+
+// IsSequential checks if the cmds is in sequential mode.
+func (c *Cmds) IsSequential() bool {
+	c.protectCmds.RLock()
+	defer c.protectCmds.RUnlock()
+
+	return c.sequencer != nil
+}
+
 // Register register's a command with the bot. See documentation for
 // Cmd for information about how to use this method, as well as see
 // the documentation for CmdHandler for how to respond to commands
@@ -165,32 +253,27 @@ func NewCmds(prefix rune, core *dispatch.DispatchCore) *Cmds {
 // global to the bot. This ensures that no command can be registered to a single
 // server twice.
 func (c *Cmds) Register(server string, cmd *Cmd) error {
-	regName := makeIdentifier(server, cmd.Cmd)
-	globalRegName := makeIdentifier(GLOBAL, cmd.Cmd)
+	names := append([]string{cmd.Cmd}, cmd.Aliases...)
 
 	protectGlobalReg.RLock()
-	_, hasServer := globalCmdRegistry[regName]
-	_, hasGlobal := globalCmdRegistry[globalRegName]
-	protectGlobalReg.RUnlock()
-	if hasServer {
-		return fmt.Errorf(errFmtDuplicateCmd, regName)
-	}
-	if hasGlobal {
-		return fmt.Errorf(errFmtDuplicateCmd, globalRegName)
-	}
-
-	switch {
-	case len(cmd.Cmd) == 0:
-		return errors.New(errMsgCmdRequired)
-	case len(cmd.Extension) == 0:
-		return errors.New(errMsgExtRequired)
-	case len(cmd.Description) == 0:
-		return errors.New(errMsgDescRequired)
-	case cmd.Handler == nil:
-		return errors.New(errMsgHandlerRequired)
+	for _, name := range names {
+		regName := makeIdentifier(server, name)
+		globalRegName := makeIdentifier(GLOBAL, name)
+
+		_, hasServer := globalCmdRegistry[regName]
+		_, hasGlobal := globalCmdRegistry[globalRegName]
+		if hasServer {
+			protectGlobalReg.RUnlock()
+			return fmt.Errorf(errFmtDuplicateCmd, regName)
+		}
+		if hasGlobal {
+			protectGlobalReg.RUnlock()
+			return fmt.Errorf(errFmtDuplicateCmd, globalRegName)
+		}
 	}
+	protectGlobalReg.RUnlock()
 
-	if err := cmd.parseArgs(); err != nil {
+	if err := cmd.prepare(); err != nil {
 		return err
 	}
 
@@ -198,82 +281,136 @@ func (c *Cmds) Register(server string, cmd *Cmd) error {
 	c.protectCmds.Lock()
 	defer protectGlobalReg.Unlock()
 	defer c.protectCmds.Unlock()
-	globalCmdRegistry[regName] = cmd
-	c.commands[cmd.Cmd] = cmd
+	for _, name := range names {
+		globalCmdRegistry[makeIdentifier(server, name)] = cmd
+		c.commands[name] = cmd
+	}
 	return nil
 }
 
 // Unregister unregisters a command from the bot. server should be the name
-// of a server it was registered to, or the GLOBAL constant.
+// of a server it was registered to, or the GLOBAL constant. The command may be
+// given by name or alias, either way all its aliases are unregistered.
 func (c *Cmds) Unregister(server, cmd string) (found bool) {
 	protectGlobalReg.Lock()
 	c.protectCmds.Lock()
 	defer c.protectCmds.Unlock()
 	defer protectGlobalReg.Unlock()
 
-	globalCmd := makeIdentifier(server, cmd)
-
-	if _, has := globalCmdRegistry[globalCmd]; has {
-		delete(globalCmdRegistry, globalCmd)
-		found = true
+	names := []string{cmd}
+	if command, ok := c.commands[cmd]; ok {
+		names = append([]string{command.Cmd}, command.Aliases...)
+	} else if command, ok := globalCmdRegistry[makeIdentifier(server, cmd)]; ok {
+		names = append([]string{command.Cmd}, command.Aliases...)
 	}
-	if _, has := c.commands[cmd]; has {
-		delete(c.commands, cmd)
-		found = true
+
+	for _, name := range names {
+		globalCmd := makeIdentifier(server, name)
+
+		if _, has := globalCmdRegistry[globalCmd]; has {
+			delete(globalCmdRegistry, globalCmd)
+			found = true
+		}
+		if _, has := c.commands[name]; has {
+			delete(c.commands, name)
+			found = true
+		}
 	}
 	return
 }
 
-// Dispatch dispatches an IrcEvent into the cmds event handlers.
-func (c *Cmds) Dispatch(networkID string, overridePrefix rune,
+// Dispatch dispatches an IrcEvent into the cmds event handlers. Commands in
+// a channel must begin with the prefix, or the overridePrefix instead if it's
+// not empty, unless the bot is addressed by its nickname (see SetAddressing).
+// Commands separated by | form a pipeline, ie. .google golang | .tinyurl, in
+// which the output of each command is given as arguments to the next. If
+// what follows a | is not a command the | is an argument instead. The tag
+// of a CTCP request is its command, and lines from a DCC CHAT session
+// (irc.DCCCHAT events) are handled like private messages.
+func (c *Cmds) Dispatch(networkID string, overridePrefix string,
 	writer irc.Writer, ev *irc.Event, locker data.Locker) (err error) {
 
-	// Filter non privmsg/notice
+	// Filter non privmsg/notice/ctcp/dcc
 	msgtype := 0
 	switch ev.Name {
 	case irc.PRIVMSG:
 		msgtype = PRIVMSG
+		if ev.IsCTCP() {
+			msgtype = CTCP
+		}
 	case irc.NOTICE:
-		msgtype = NOTICE
+		if !ev.IsCTCP() {
+			msgtype = NOTICE
+		}
+	case irc.DCCCHAT:
+		msgtype = DCC
+	case irc.RPL_WELCOME, irc.NICK:
+		c.trackNick(networkID, ev)
 	}
 
 	if msgtype == 0 {
 		return nil
 	}
 
-	// Get command name or die trying
-	fields := strings.Fields(ev.Args[1])
-	if len(fields) == 0 {
-		return nil
-	}
-	cmd := strings.ToLower(fields[0])
-
 	ch := ""
 	nick := irc.Nick(ev.Sender)
 	msgscope := PRIVATE
 	isChan, hasChan := c.CheckTarget(ev)
 
+	var msg string
+	var addressed bool
+	if msgtype == CTCP {
+		tag, data := ev.UnpackCTCP()
+		msg, addressed = strings.TrimSpace(tag+" "+data), true
+	} else {
+		msg = strings.TrimLeftFunc(ev.Args[1], unicode.IsSpace)
+		msg, addressed = c.stripAddress(networkID, ev.NetworkInfo, msg)
+	}
+
+	prefix := c.prefix
+	if len(overridePrefix) != 0 {
+		prefix = overridePrefix
+	}
+
 	// If it's a channel message, ensure we're active on the channel and
-	// that the user has supplied the prefix in his command.
+	// that the user has supplied the prefix in his command or addressed us.
 	if isChan {
-		firstChar := rune(cmd[0])
-		missingOverride := overridePrefix == 0 || firstChar != overridePrefix
-		missingPrefix := overridePrefix != 0 || firstChar != c.prefix
-		if !hasChan || (missingOverride && missingPrefix) {
+		if !hasChan {
 			return nil
 		}
 
-		cmd = cmd[1:]
+		if !addressed {
+			if len(prefix) == 0 || !strings.HasPrefix(msg, prefix) {
+				return nil
+			}
+			msg = msg[len(prefix):]
+			if len(msg) == 0 || unicode.IsSpace(rune(msg[0])) {
+				return nil
+			}
+		}
+
 		ch = ev.Target()
 		msgscope = PUBLIC
 	}
 
-	var command *Cmd
-	var ok bool
-	c.protectCmds.RLock()
-	defer c.protectCmds.RUnlock()
-	if command, ok = c.commands[cmd]; !ok {
-		//writer.Noticef(nick, errFmtCmdNotFound, cmd)
+	// Get command name or die trying
+	stages := splitPipeline(msg, prefix)
+	if len(stages) > 1 && !c.isPipeline(networkID, ch, nick, stages, locker) {
+		stages = []string{msg}
+	}
+	if len(stages) == 1 {
+		handled, err := c.confirm(networkID, ch, stages[0], writer, ev, locker)
+		if handled {
+			return err
+		}
+	}
+
+	command, cmd, args, known := c.findCmd(networkID, ch, nick, stages[0],
+		locker)
+	if command == nil {
+		if len(cmd) != 0 && !known && 0 != msgtype&(PRIVMSG|DCC) {
+			c.unknownCmd(networkID, cmd, ch, msgscope, writer, ev, locker)
+		}
 		return nil
 	}
 
@@ -281,37 +418,211 @@ func (c *Cmds) Dispatch(networkID string, overridePrefix rune,
 		return nil
 	}
 
-	var cmdEv = &Event{
-		locker: locker,
-		Event:  ev,
+	pipeline := []pipeStage{{command, cmd, args}}
+	if len(stages) > 1 {
+		pipeline, err = c.pipeline(networkID, ch, msgtype, msgscope,
+			pipeline[0], stages, ev, locker)
+		if err != nil {
+			lang := c.lookupLocale(networkID, ch, ev, locker)
+			writer.Notice(nick, locale.ErrorString(lang, err))
+			return err
+		}
+	}
+
+	return c.start(networkID, ch, isChan, pipeline, true, writer, ev, locker)
+}
+
+// start creates the event for the first command in a pipeline and runs the
+// pipeline in the background, or once the commands before it have finished
+// in sequential mode. If confirm is true and any of the commands must be
+// confirmed the user is asked to confirm them instead.
+func (c *Cmds) start(networkID, ch string, isChan bool, pipeline []pipeStage,
+	confirm bool, writer irc.Writer, ev *irc.Event,
+	locker data.Locker) (err error) {
+
+	var pending []pipeStage
+	if confirm {
+		pending = pipeline
 	}
+	first := pipeline[0]
+
+	c.protectCmds.RLock()
+	sequencer := c.sequencer
+	c.protectCmds.RUnlock()
+
+	if sequencer == nil {
+		var cmdEv *Event
+		cmdEv, err = c.newEvent(networkID, first.command, ch, isChan,
+			first.args, nil, pending, writer, ev, locker)
+		if err != nil || cmdEv == nil {
+			return err
+		}
+
+		c.HandlerStarted()
+		go c.run(networkID, ch, isChan, pipeline, cmdEv, writer, ev, locker)
+		return nil
+	}
+
+	// In sequential mode even the access and argument checks are deferred
+	// so that the locks are not held while waiting on the previous commands.
+	key := dispatch.MakeSequenceKey(networkID, irc.Nick(ev.Sender))
+	if isChan {
+		key = dispatch.MakeSequenceKey(networkID, ch)
+	}
+
+	c.HandlerStarted()
+	sequencer.Run(key, func() {
+		defer c.HandlerFinished()
+		cmdEv, err := c.newEvent(networkID, first.command, ch, isChan,
+			first.args, nil, pending, writer, ev, locker)
+		if err != nil || cmdEv == nil {
+			return
+		}
+
+		c.HandlerStarted()
+		c.run(networkID, ch, isChan, pipeline, cmdEv, writer, ev, locker)
+	})
+
+	return nil
+}
+
+// findCmd looks up the command at the beginning of a message, expanding
+// aliases and following subcommands. It returns the command along with its
+// full name and the arguments that follow it. If the command is not found
+// cmd is the name that was given, and known is true if it was an alias.
+func (c *Cmds) findCmd(networkID, ch, nick, msg string, locker data.Locker) (
+	command *Cmd, cmd, args string, known bool) {
 
-	var args []string
-	if len(fields) > 1 {
-		args = fields[1:]
+	cmd, args = splitFirstField(msg)
+	if len(cmd) == 0 {
+		return nil, "", "", false
 	}
+	cmd = strings.ToLower(cmd)
+
+	c.protectCmds.RLock()
+	command, ok := c.commands[cmd]
+	c.protectCmds.RUnlock()
+	if !ok {
+		expansion, found := findAlias(locker, networkID, ch, cmd)
+		if !found {
+			return nil, cmd, args, false
+		}
+
+		name, rest := splitFirstField(expandAlias(expansion, args, nick, ch))
+		c.protectCmds.RLock()
+		command, ok = c.commands[strings.ToLower(name)]
+		c.protectCmds.RUnlock()
+		if !ok {
+			return nil, cmd, args, true
+		}
+		args = rest
+	}
+
+	c.protectCmds.RLock()
+	defer c.protectCmds.RUnlock()
+	for len(command.Subcommands) != 0 {
+		name, rest := splitFirstField(args)
+		sub := command.Subcommand(name)
+		if sub == nil {
+			break
+		}
+		command, args = sub, rest
+	}
+
+	return command, strings.ToLower(command.FullName()), args, true
+}
+
+// run invokes a single command, or each command in turn for a pipeline.
+// HandlerStarted must be called before run.
+func (c *Cmds) run(networkID, ch string, isChan bool, pipeline []pipeStage,
+	cmdEv *Event, writer irc.Writer, ev *irc.Event, locker data.Locker) {
+
+	if len(pipeline) == 1 {
+		c.invoke(pipeline[0].command, pipeline[0].cmd, writer, cmdEv)
+		return
+	}
+	c.runPipeline(networkID, ch, isChan, pipeline, cmdEv, writer, ev, locker)
+}
+
+// newEvent opens the state and store and creates the event for a command
+// after checking the user's access and parsing the arguments. If an error
+// occurs it is sent to the user, and the state and store are closed. If any
+// of the commands in pending must be confirmed the user is asked to confirm
+// them and no event is returned. The arguments in input are added after args
+// as they are, without being tokenized.
+func (c *Cmds) newEvent(networkID string, command *Cmd, ch string,
+	isChan bool, args string, input []string, pending []pipeStage,
+	writer irc.Writer, ev *irc.Event, locker data.Locker) (
+	cmdEv *Event, err error) {
+
+	nick := irc.Nick(ev.Sender)
+	if command.Handler == nil {
+		names := make([]string, len(command.Subcommands))
+		for i, sub := range command.Subcommands {
+			names[i] = sub.Cmd
+		}
+		err = locale.Errorf(errFmtSubcmdRequired, command.FullName(),
+			strings.Join(names, " "))
+		lang := c.lookupLocale(networkID, ch, ev, locker)
+		writer.Notice(nick, locale.ErrorString(lang, err))
+		return nil, err
+	}
+
+	c.protectCmds.RLock()
+	cmdEv = &Event{
+		locker:   locker,
+		identity: c.identity,
+		Event:    ev,
+	}
+	c.protectCmds.RUnlock()
 
 	state := locker.OpenState(networkID)
 	store := locker.OpenReadStore()
 	cmdEv.State = state
 	cmdEv.Store = store
+	cmdEv.Locale = c.userLocale(networkID, ch, ev, store)
+	cmdEv.audit = c.newAuditEntry(networkID, command, ch, isChan, args, ev,
+		store)
 
 	if command.RequireAuth {
 		if cmdEv.StoredUser, err = filterAccess(store, command, networkID,
 			ch, ev); err != nil {
 
 			cmdEv.Close()
-			writer.Notice(nick, err.Error())
-			return err
+			c.emitAudit(command, cmdEv.audit, err)
+			writer.Notice(nick, locale.ErrorString(cmdEv.Locale, err))
+			return nil, err
 		}
 	}
 
-	if err = c.filterArgs(networkID, command, ch, isChan, args, cmdEv, ev,
-		state, store); err != nil {
+	var msgArgs []string
+	if msgArgs, err = command.splitArgs(args); err == nil {
+		msgArgs = append(msgArgs, input...)
+		err = c.filterArgs(networkID, command, ch, isChan, msgArgs, cmdEv, ev,
+			state, store)
+	}
+	if err != nil {
+		cmdEv.Close()
+		c.emitAudit(command, cmdEv.audit, err)
+		writer.Notice(nick, locale.ErrorString(cmdEv.Locale, err))
+		return nil, err
+	}
 
+	if mustConfirm(pending) {
 		cmdEv.Close()
-		writer.Notice(nick, err.Error())
-		return err
+		return nil, c.askConfirm(networkID, ch, isChan, pending, writer, ev,
+			cmdEv.Locale)
+	}
+
+	if len(command.Limits) != 0 {
+		if err = c.filterLimits(networkID, command, ch, cmdEv, store); err != nil {
+			cmdEv.Close()
+			c.emitAudit(command, cmdEv.audit, err)
+			if !command.LimitSilent {
+				writer.Notice(nick, locale.ErrorString(cmdEv.Locale, err))
+			}
+			return nil, err
+		}
 	}
 
 	if state != nil {
@@ -324,31 +635,62 @@ func (c *Cmds) Dispatch(networkID string, overridePrefix rune,
 		}
 	}
 
-	c.HandlerStarted()
-	go func() {
-		defer c.PanicHandler()
-		defer c.HandlerFinished()
-		defer cmdEv.Close()
-		ok, err := cmdNameDispatch(command.Handler, cmd, writer, cmdEv)
-		if !ok {
-			err = command.Handler.Cmd(cmd, writer, cmdEv)
-		}
-		if err != nil {
-			writer.Notice(nick, err.Error())
-		}
+	return cmdEv, nil
+}
+
+// invoke calls the command's handler and reports any error it returns to the
+// user. HandlerStarted must be called before invoke.
+func (c *Cmds) invoke(command *Cmd, cmd string, writer irc.Writer,
+	cmdEv *Event) {
+
+	defer c.PanicHandler()
+	defer c.HandlerFinished()
+
+	if err := c.call(command, cmd, writer, cmdEv); err != nil {
+		writer.Notice(cmdEv.Nick(), locale.ErrorString(cmdEv.Locale, err))
+	}
+}
+
+// call calls the command's handler and closes the event once it returns,
+// the result is then given to the audit function.
+func (c *Cmds) call(command *Cmd, cmd string, writer irc.Writer,
+	cmdEv *Event) (err error) {
+
+	defer func() {
+		cmdEv.Close()
+		c.emitAudit(command, cmdEv.audit, err)
 	}()
 
-	return nil
+	writer = locale.NewWriter(writer, cmdEv.Locale)
+	var ok bool
+	if ok, err = cmdNameDispatch(command.Handler, cmd, writer, cmdEv); !ok {
+		err = command.Handler.Cmd(cmd, writer, cmdEv)
+	}
+	return err
+}
+
+// splitFirstField splits the first whitespace separated field from a string
+// returning it and the remainder of the string.
+func splitFirstField(str string) (first, rest string) {
+	str = strings.TrimLeftFunc(str, unicode.IsSpace)
+	if index := strings.IndexFunc(str, unicode.IsSpace); index >= 0 {
+		return str[:index], str[index:]
+	}
+	return str, ""
 }
 
 // cmdNameDispatch attempts to dispatch an event to a function named the same
-// as the command with an uppercase letter (no camel case). The arguments
+// as the command with an uppercase letter (no camel case). For subcommands
+// each name in the group is uppercased and joined together. The arguments
 // must be the exact same as the CmdHandler.Cmd with the cmd string
 // argument removed for this to work.
 func cmdNameDispatch(handler CmdHandler, cmd string, writer irc.Writer,
 	ev *Event) (dispatched bool, err error) {
 
-	methodName := strings.ToUpper(cmd[:1]) + cmd[1:]
+	var methodName string
+	for _, name := range strings.Fields(cmd) {
+		methodName += strings.ToUpper(name[:1]) + name[1:]
+	}
 
 	var fn reflect.Method
 	handleType := reflect.TypeOf(handler)
@@ -396,15 +738,46 @@ func filterAccess(store *data.Store, command *Cmd, server, channel string,
 		return nil, errors.New(errMsgNotAuthed)
 	}
 	if hasLevel && !access.HasLevel(server, channel, command.ReqLevel) {
-		return nil, fmt.Errorf(errFmtInsuffLevel, command.ReqLevel)
+		return nil, locale.Errorf(errFmtInsuffLevel, command.ReqLevel)
 	}
 	if hasFlags && !access.HasFlags(server, channel, command.ReqFlags) {
-		return nil, fmt.Errorf(errFmtInsuffFlags, command.ReqFlags)
+		return nil, locale.Errorf(errFmtInsuffFlags, command.ReqFlags)
 	}
 
 	return access, nil
 }
 
+// filterLimits counts a use of the command against its rate limits unless the
+// user is exempt, returning an error if any of the limits have been reached.
+func (c *Cmds) filterLimits(networkID string, command *Cmd, channel string,
+	ev *Event, store *data.Store) error {
+
+	access := ev.StoredUser
+	if access == nil && store != nil {
+		access = store.GetAuthedUser(networkID, ev.Event.Sender)
+	}
+	if access != nil && len(command.LimitExempt) != 0 &&
+		access.HasFlags(networkID, channel, command.LimitExempt) {
+		return nil
+	}
+
+	user := irc.Hostname(ev.Event.Sender)
+	if access != nil {
+		user = "*" + access.Username
+	}
+
+	name := strings.ToLower(command.FullName())
+	keys := make([]string, len(command.Limits))
+	for i, limit := range command.Limits {
+		keys[i] = makeLimitKey(limit.Scope, name, networkID, channel, user)
+	}
+
+	if wait := c.limiter.take(keys, command.Limits); wait > 0 {
+		return locale.Errorf(errFmtRateLimited, name, roundWait(wait))
+	}
+	return nil
+}
+
 // filterArgs parses all the arguments. It looks up channel and user arguments
 // using the state and store, and generally populates the Event struct
 // with argument information.
@@ -414,6 +787,12 @@ func (c *Cmds) filterArgs(server string, command *Cmd, channel string,
 
 	ev.args = make(map[string]string)
 
+	if len(command.flags) != 0 {
+		if msgArgs, err = ev.parseFlags(command, msgArgs); err != nil {
+			return
+		}
+	}
+
 	i, j := 0, 0
 	for i = 0; i < len(command.args); i, j = i+1, j+1 {
 		arg := &command.args[i]
@@ -439,20 +818,27 @@ func (c *Cmds) filterArgs(server string, command *Cmd, channel string,
 				if command.args[0].Type&CHANNEL != 0 && isChan {
 					nReq--
 				}
-				return fmt.Errorf(errFmtNArguments, errAtLeast, nReq,
-					strings.Join(command.Args, " "))
+				return locale.PluralErrorf(errFmtArgAtLeast, errFmtArgsAtLeast,
+					nReq, nReq, strings.Join(command.Args, " "))
+			}
+			if err = ev.setArg(arg, msgArgs[j]); err != nil {
+				return
 			}
-			ev.args[arg.Name] = msgArgs[j]
 		case opt:
 			if j >= len(msgArgs) {
 				return
 			}
-			ev.args[arg.Name] = msgArgs[j]
+			if err = ev.setArg(arg, msgArgs[j]); err != nil {
+				return
+			}
 		case varg:
 			if j >= len(msgArgs) {
 				return
 			}
 			ev.args[arg.Name] = strings.Join(msgArgs[j:], " ")
+			if command.quoted() {
+				ev.setSplitArg(arg.Name, msgArgs[j:])
+			}
 		}
 
 		if nick || user {
@@ -478,9 +864,9 @@ func (c *Cmds) filterArgs(server string, command *Cmd, channel string,
 		if j == 0 {
 			return errors.New(errMsgUnexpectedArgument)
 		}
-		return fmt.Errorf(errFmtNArguments, errAtMost,
-			command.reqArgs+command.optArgs,
-			strings.Join(command.Args, " "))
+		nMax := command.reqArgs + command.optArgs
+		return locale.PluralErrorf(errFmtArgAtMost, errFmtArgsAtMost, nMax,
+			nMax, strings.Join(command.Args, " "))
 	}
 	return nil
 }
@@ -496,8 +882,8 @@ func (c *Cmds) parseChanArg(command *Cmd, ev *Event,
 	if index < len(msgArgs) {
 		isFirstChan = ev.Event.NetworkInfo.IsChannel(msgArgs[index])
 	} else if !isChan {
-		return false, fmt.Errorf(errFmtNArguments, errAtLeast,
-			command.reqArgs, strings.Join(command.Args, " "))
+		return false, locale.PluralErrorf(errFmtArgAtLeast, errFmtArgsAtLeast,
+			command.reqArgs, command.reqArgs, strings.Join(command.Args, " "))
 	}
 
 	name := command.args[index].Name
@@ -517,7 +903,7 @@ func (c *Cmds) parseChanArg(command *Cmd, ev *Event,
 		return true, nil
 	}
 
-	return false, fmt.Errorf(errFmtArgumentNotChannel, msgArgs[index])
+	return false, locale.Errorf(errFmtArgumentNotChannel, msgArgs[index])
 }
 
 // parseUserArg takes user arguments and assigns them to the correct structures
@@ -587,7 +973,7 @@ func (c *Cmds) parseUserArg(ev *Event, state *data.State,
 }
 
 // GetPrefix returns the prefix used by this cmds instance.
-func (c *Cmds) GetPrefix() rune {
+func (c *Cmds) GetPrefix() string {
 	return c.prefix
 }
 
@@ -600,65 +986,65 @@ func makeIdentifier(server, cmd string) string {
 // MakeLevelError creates an error to be shown to the user about required
 // access.
 func MakeLevelError(levelRequired uint8) error {
-	return fmt.Errorf(errFmtInsuffLevel, levelRequired)
+	return locale.Errorf(errFmtInsuffLevel, levelRequired)
 }
 
 // MakeGlobalLevelError creates an error to be shown to the user about required
 // access.
 func MakeGlobalLevelError(levelRequired uint8) error {
-	return fmt.Errorf(errFmtInsuffGlobalLevel, levelRequired)
+	return locale.Errorf(errFmtInsuffGlobalLevel, levelRequired)
 }
 
 // MakeServerLevelError creates an error to be shown to the user about required
 // access.
 func MakeServerLevelError(levelRequired uint8) error {
-	return fmt.Errorf(errFmtInsuffServerLevel, levelRequired)
+	return locale.Errorf(errFmtInsuffServerLevel, levelRequired)
 }
 
 // MakeChannelLevelError creates an error to be shown to the user about required
 // access.
 func MakeChannelLevelError(levelRequired uint8) error {
-	return fmt.Errorf(errFmtInsuffChannelLevel, levelRequired)
+	return locale.Errorf(errFmtInsuffChannelLevel, levelRequired)
 }
 
 // MakeFlagsError creates an error to be shown to the user about required
 // access.
 func MakeFlagsError(flagsRequired string) error {
-	return fmt.Errorf(errFmtInsuffFlags, flagsRequired)
+	return locale.Errorf(errFmtInsuffFlags, flagsRequired)
 }
 
 // MakeGlobalFlagsError creates an error to be shown to the user about required
 // access.
 func MakeGlobalFlagsError(flagsRequired string) error {
-	return fmt.Errorf(errFmtInsuffGlobalFlags, flagsRequired)
+	return locale.Errorf(errFmtInsuffGlobalFlags, flagsRequired)
 }
 
 // MakeServerFlagsError creates an error to be shown to the user about required
 // access.
 func MakeServerFlagsError(flagsRequired string) error {
-	return fmt.Errorf(errFmtInsuffServerFlags, flagsRequired)
+	return locale.Errorf(errFmtInsuffServerFlags, flagsRequired)
 }
 
 // MakeChannelFlagsError creates an error to be shown to the user about required
 // access.
 func MakeChannelFlagsError(flagsRequired string) error {
-	return fmt.Errorf(errFmtInsuffChannelFlags, flagsRequired)
+	return locale.Errorf(errFmtInsuffChannelFlags, flagsRequired)
 }
 
 // MakeUserNotAuthedError creates an error to be shown to the user about their
 // target user not being authenticated.
 func MakeUserNotAuthedError(user string) error {
-	return fmt.Errorf(errFmtUserNotAuthed, user)
+	return locale.Errorf(errFmtUserNotAuthed, user)
 }
 
 // MakeUserNotFoundError creates an error to be shown to the user about their
 // target user not being found.
 func MakeUserNotFoundError(user string) error {
-	return fmt.Errorf(errFmtUserNotFound, user)
+	return locale.Errorf(errFmtUserNotFound, user)
 }
 
 // MakeUserNotRegisteredError creates an error to be shown to the user about
 // the target user not being registered.
 func MakeUserNotRegisteredError(user string) error {
-	return fmt.Errorf(errFmtUserNotRegistered, user)
+	return locale.Errorf(errFmtUserNotRegistered, user)
 }
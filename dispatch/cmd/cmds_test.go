@@ -2,14 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/dispatch"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
 	"github.com/inconshreveable/log15"
 )
 
@@ -171,7 +175,7 @@ var (
 	rgxCreator = strings.NewReplacer(
 		`(`, `\(`, `)`, `\)`, `]`, `\]`, `[`,
 		`\[`, `\`, `\\`, `/`, `\/`, `%v`, `.*`,
-		`*`, `\*`,
+		`*`, `\*`, `|`, `\|`,
 	)
 )
 
@@ -226,7 +230,7 @@ func setupForAuth() (state *data.State, store *data.Store,
 }
 
 var core = dispatch.NewDispatchCore(nil)
-var prefix = '.'
+var prefix = "."
 
 func TestCmds(t *testing.T) {
 	c := NewCmds(prefix, core)
@@ -367,6 +371,62 @@ func TestCmds_Register(t *testing.T) {
 		t.Error(err)
 	}
 
+	for _, bad := range []string{"n:", "n:nope", "n:int(", "n:int()",
+		"n:int(a..b)", "n:int(..)", "n:bool(1..2)", "n:enum()", "n:enum(a||b)",
+		"n:duration(1..2)", "n:int(10..1)", "n:float(1.5..-1)",
+		"n:duration(1h..1m)", "[n:int"} {
+
+		err = c.Register(GLOBAL, helper(bad))
+		if bad == "[n:int" {
+			err = chkErr(err, errFmtArgumentForm)
+		} else {
+			err = chkErr(err, errFmtArgumentType)
+		}
+		if err != nil {
+			t.Error(bad, err)
+		}
+	}
+
+	err = c.Register(GLOBAL, helper("n:int..."))
+	err = chkErr(err, errFmtArgumentTypeVargs)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Register(GLOBAL, helper("~n:int"))
+	err = chkErr(err, errFmtArgumentTypeFlag)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, bad := range []string{"-", "--", "-ab", "-a|-b", "--a|-b", "-a|",
+		"-1", "-1|--one"} {
+
+		err = c.Register(GLOBAL, helper(bad))
+		err = chkErr(err, errFmtArgumentFlag)
+		if err != nil {
+			t.Error(bad, err)
+		}
+	}
+
+	err = c.Register(GLOBAL, helper("--flag=nope"))
+	err = chkErr(err, errFmtArgumentType)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Register(GLOBAL, helper("-f|--flag", "-f"))
+	err = chkErr(err, errFmtArgumentDupName)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = c.Register(GLOBAL, helper("--name", "name"))
+	err = chkErr(err, errFmtArgumentDupName)
+	if err != nil {
+		t.Error(err)
+	}
+
 	err = c.Register(GLOBAL, helper())
 	if err != nil {
 		t.Error("Registration failed:", err)
@@ -448,9 +508,9 @@ func TestCmds_Dispatch(t *testing.T) {
 	arg1chan1req := []string{"#chan", "arg"}
 	arg1chan1req1opt := []string{"#chan", "arg", "[opt]"}
 
-	argErr := errFmtNArguments
+	argErr := "Error: Expected %v argument%v"
 	chanErr := errFmtArgumentNotChannel
-	atLeastOneArgErr := fmt.Sprintf(errFmtNArguments, errAtLeast, 1, "%v")
+	atLeastOneArgErr := fmt.Sprintf(errFmtArgAtLeast, 1, "%v")
 
 	var table = []struct {
 		CmdArgs []string
@@ -543,7 +603,7 @@ func TestCmds_Dispatch(t *testing.T) {
 			Args:        test.MsgArgs,
 			NetworkInfo: netInfo,
 		}
-		err = c.Dispatch(server, 0, writer, ev, locker)
+		err = c.Dispatch(server, "", writer, ev, locker)
 		c.WaitForHandlers()
 		if handler.called != test.Called {
 			if handler.called {
@@ -662,11 +722,11 @@ func TestCmds_DispatchAuthed(t *testing.T) {
 		ev := &irc.Event{
 			Sender:      test.Sender,
 			Name:        irc.PRIVMSG,
-			Args:        []string{channel, string(prefix) + cmd},
+			Args:        []string{channel, prefix + cmd},
 			NetworkInfo: netInfo,
 		}
 
-		err = c.Dispatch(server, 0, writer, ev, locker)
+		err = c.Dispatch(server, "", writer, ev, locker)
 		c.WaitForHandlers()
 		if handler.called != test.Called {
 			if handler.called {
@@ -737,7 +797,7 @@ func TestCmds_DispatchNils(t *testing.T) {
 	ev := &irc.Event{
 		Sender:      host,
 		Name:        irc.PRIVMSG,
-		Args:        []string{channel, string(prefix) + cmd},
+		Args:        []string{channel, prefix + cmd},
 		NetworkInfo: netInfo,
 		NetworkID:   netID,
 	}
@@ -749,7 +809,7 @@ func TestCmds_DispatchNils(t *testing.T) {
 	if err != nil {
 		t.Error("Unexpected error:", err)
 	}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgStoreDisabled)
 	if err != nil {
@@ -763,7 +823,7 @@ func TestCmds_DispatchNils(t *testing.T) {
 	if err != nil {
 		t.Error("Unexpected error:", err)
 	}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if handler.channel != nil {
 		t.Error("Channel should just be nil when state is disabled.")
@@ -787,7 +847,7 @@ func TestCmds_DispatchReturns(t *testing.T) {
 	ev := &irc.Event{
 		Sender:      host,
 		Name:        irc.PRIVMSG,
-		Args:        []string{channel, string(prefix) + cmd},
+		Args:        []string{channel, prefix + cmd},
 		NetworkInfo: netInfo,
 	}
 
@@ -818,7 +878,7 @@ func TestCmds_DispatchReturns(t *testing.T) {
 	for _, test := range errors {
 		buffer.Reset()
 		handler.Error = test.Error
-		err = c.Dispatch(server, 0, writer, ev, locker)
+		err = c.Dispatch(server, "", writer, ev, locker)
 		c.WaitForHandlers()
 		err = chkStr(string(buffer.Bytes()), `NOTICE nick :`+test.ErrorMsg)
 		if err != nil {
@@ -853,8 +913,8 @@ func TestCmds_DispatchChannel(t *testing.T) {
 		t.Error("Unexpected error:", err)
 	}
 
-	ev.Args = []string{channel, string(prefix) + cmd}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	ev.Args = []string{channel, prefix + cmd}
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -868,8 +928,8 @@ func TestCmds_DispatchChannel(t *testing.T) {
 
 	handler.targChan = nil
 	handler.args = nil
-	ev.Args = []string{channel, string(prefix) + cmd + " " + channel}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	ev.Args = []string{channel, prefix + cmd + " " + channel}
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -884,15 +944,15 @@ func TestCmds_DispatchChannel(t *testing.T) {
 	handler.targChan = nil
 	handler.args = nil
 	ev.Args = []string{nick, cmd}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
-	err = chkErr(err, errFmtNArguments)
+	err = chkErr(err, errFmtArgAtLeast)
 	if err != nil {
 		t.Error(err)
 	}
 
 	ev.Args = []string{nick, cmd + " " + channel}
-	err = c.Dispatch(server, 0, writer, ev, badLocker{nil, store})
+	err = c.Dispatch(server, "", writer, ev, badLocker{nil, store})
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgStateDisabled)
 	if err != nil {
@@ -902,7 +962,7 @@ func TestCmds_DispatchChannel(t *testing.T) {
 	handler.targChan = nil
 	handler.args = nil
 	ev.Args = []string{nick, cmd + " " + channel}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -914,18 +974,18 @@ func TestCmds_DispatchChannel(t *testing.T) {
 		t.Error("The channel argument was not set.")
 	}
 
-	ev.Args = []string{channel, string(prefix) + cmd + " " + channel + " arg"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	ev.Args = []string{channel, prefix + cmd + " " + channel + " arg"}
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
-	err = chkErr(err, fmt.Sprintf(errFmtNArguments, errAtMost, 1, "%v"))
+	err = chkErr(err, fmt.Sprintf(errFmtArgAtMost, 1, "%v"))
 	if err != nil {
 		t.Error(err)
 	}
 
 	ev.Args = []string{nick, cmd}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
-	err = chkErr(err, fmt.Sprintf(errFmtNArguments, errAtLeast, 1, "%v"))
+	err = chkErr(err, fmt.Sprintf(errFmtArgAtLeast, 1, "%v"))
 	if err != nil {
 		t.Error(err)
 	}
@@ -958,7 +1018,7 @@ func TestCmds_DispatchUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -975,7 +1035,7 @@ func TestCmds_DispatchUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *user nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -989,7 +1049,7 @@ func TestCmds_DispatchUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *user nick *user"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -1006,7 +1066,7 @@ func TestCmds_DispatchUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *user nick *user nick nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -1033,6 +1093,40 @@ func TestCmds_DispatchUsers(t *testing.T) {
 	}
 }
 
+func TestCmds_DispatchEmptyUsers(t *testing.T) {
+	c := NewCmds(prefix, core)
+
+	buffer, writer := newWriter()
+	state, store, _ := setupForAuth()
+	locker := badLocker{state, store}
+
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG,
+		NetworkInfo: netInfo,
+	}
+
+	handler := &commandHandler{}
+	command := MkCmd(ext, dsc, cmd, handler, ALL, ALL, "*user1", "[~user2]")
+	command.QuotedArgs = true
+	if err := c.Register(GLOBAL, command); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for _, args := range []string{`""`, `*user ""`} {
+		buffer.Reset()
+		ev.Args = []string{nick, cmd + " " + args}
+		err := c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+		if e := chkErr(err, errFmtUserNotFound); e != nil {
+			t.Error(args, e)
+		}
+	}
+
+	if !c.Unregister(GLOBAL, cmd) {
+		t.Error("Handler could not be unregistered.")
+	}
+}
+
 func TestCmds_DispatchErrors(t *testing.T) {
 	c := NewCmds(prefix, core)
 
@@ -1054,7 +1148,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *baduser nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotRegistered, "baduser"))
 	if err != nil {
@@ -1062,7 +1156,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " * nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgMissingUsername)
 	if err != nil {
@@ -1070,7 +1164,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " self nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotAuthed, "self"))
 	if err != nil {
@@ -1078,7 +1172,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick badnick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotFound, "badnick"))
 	if err != nil {
@@ -1086,7 +1180,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick nick badnick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotFound, "badnick"))
 	if err != nil {
@@ -1094,7 +1188,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *user nick"}
-	err = c.Dispatch(server, 0, writer, ev, badLocker{state, nil})
+	err = c.Dispatch(server, "", writer, ev, badLocker{state, nil})
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgStoreDisabled)
 	if err != nil {
@@ -1102,7 +1196,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick"}
-	err = c.Dispatch(server, 0, writer, ev, badLocker{nil, store})
+	err = c.Dispatch(server, "", writer, ev, badLocker{nil, store})
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgStateDisabled)
 	if err != nil {
@@ -1120,7 +1214,7 @@ func TestCmds_DispatchErrors(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick"}
-	err = c.Dispatch(server, 0, writer, ev, badLocker{nil, store})
+	err = c.Dispatch(server, "", writer, ev, badLocker{nil, store})
 	c.WaitForHandlers()
 	err = chkErr(err, errMsgStateDisabled)
 	if err != nil {
@@ -1155,7 +1249,7 @@ func TestCmds_DispatchVariadicUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " *user nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error("There was an unexpected error:", err)
@@ -1188,7 +1282,7 @@ func TestCmds_DispatchVariadicUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick badnick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotFound, "badnick"))
 	if err != nil {
@@ -1196,7 +1290,7 @@ func TestCmds_DispatchVariadicUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick self"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotAuthed, "self"))
 	if err != nil {
@@ -1204,7 +1298,7 @@ func TestCmds_DispatchVariadicUsers(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " nick nick *badusername"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	err = chkErr(err, fmt.Sprintf(errFmtUserNotRegistered, "badusername"))
 	if err != nil {
@@ -1239,7 +1333,7 @@ func TestCmds_DispatchMixUserAndChan(t *testing.T) {
 	}
 
 	ev.Args = []string{nick, cmd + " " + channel + " nick"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 	if err != nil {
 		t.Error(err)
@@ -1279,7 +1373,7 @@ func TestCmds_DispatchReflection(t *testing.T) {
 		Args:        []string{"a", "reflect"},
 		NetworkInfo: netInfo,
 	}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if handler.CalledBad {
@@ -1294,7 +1388,7 @@ func TestCmds_DispatchReflection(t *testing.T) {
 
 	handler.Called, handler.CalledBad = false, false
 	ev.Args = []string{"a", "badargnum"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if !handler.CalledBad {
@@ -1306,7 +1400,7 @@ func TestCmds_DispatchReflection(t *testing.T) {
 
 	handler.Called, handler.CalledBad = false, false
 	ev.Args = []string{"a", "noreturn"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if !handler.CalledBad {
@@ -1318,7 +1412,7 @@ func TestCmds_DispatchReflection(t *testing.T) {
 
 	handler.Called, handler.CalledBad = false, false
 	ev.Args = []string{"a", "badargs"}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if !handler.CalledBad {
@@ -1356,8 +1450,8 @@ func TestCmds_DispatchOverridePrefix(t *testing.T) {
 	}
 
 	handler.called = false
-	ev.Args = []string{channel, string(prefix) + cmd}
-	err = c.Dispatch(server, 0, writer, ev, locker)
+	ev.Args = []string{channel, prefix + cmd}
+	err = c.Dispatch(server, "", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if !handler.called {
@@ -1365,8 +1459,8 @@ func TestCmds_DispatchOverridePrefix(t *testing.T) {
 	}
 
 	handler.called = false
-	ev.Args = []string{channel, string(prefix) + cmd}
-	err = c.Dispatch(server, '!', writer, ev, locker)
+	ev.Args = []string{channel, prefix + cmd}
+	err = c.Dispatch(server, "!", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if handler.called {
@@ -1375,7 +1469,7 @@ func TestCmds_DispatchOverridePrefix(t *testing.T) {
 
 	handler.called = false
 	ev.Args = []string{channel, "!" + cmd}
-	err = c.Dispatch(server, '!', writer, ev, locker)
+	err = c.Dispatch(server, "!", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if !handler.called {
@@ -1384,7 +1478,7 @@ func TestCmds_DispatchOverridePrefix(t *testing.T) {
 
 	handler.called = false
 	ev.Args = []string{channel, ":" + cmd}
-	err = c.Dispatch(server, '!', writer, ev, locker)
+	err = c.Dispatch(server, "!", writer, ev, locker)
 	c.WaitForHandlers()
 
 	if handler.called {
@@ -1397,92 +1491,1850 @@ func TestCmds_DispatchOverridePrefix(t *testing.T) {
 	}
 }
 
-func TestCmds_EachCmd(t *testing.T) {
-	c := NewCmds(prefix, core)
-	var err error
+func TestCmds_DispatchLongPrefix(t *testing.T) {
+	c := NewCmds("!!", core)
 
-	handler := &errorHandler{}
+	_, writer := newWriter()
+	state, _ := setup()
+	locker := badLocker{state, nil}
 
-	err = c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL))
+	handler := &commandHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL))
 	if err != nil {
-		t.Error("Unexpected:", err)
+		t.Error("Unexpected:", cmd, err)
 	}
-	err = c.Register(GLOBAL, MkCmd(ext, dsc, "other", handler, ALL, ALL))
-	if err != nil {
-		t.Error("Unexpected:", err)
+
+	var table = []struct {
+		Override string
+		Msg      string
+		Called   bool
+	}{
+		{"", "!!" + cmd, true},
+		{"", "!" + cmd, false},
+		{"", "!! " + cmd, false},
+		{"", "!!", false},
+		{"@@", "@@" + cmd, true},
+		{"@@", "!!" + cmd, false},
+		{"@@", "@" + cmd, false},
 	}
 
-	visited := 0
-	EachCmd(func(command *Cmd) bool {
-		visited++
-		return true
-	})
+	for _, test := range table {
+		handler.called = false
+		ev := &irc.Event{
+			Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+			Args: []string{channel, test.Msg},
+		}
+		c.Dispatch(server, test.Override, writer, ev, locker)
+		c.WaitForHandlers()
 
-	if visited != 1 {
-		t.Error("Expected to stop after one iteration.")
+		if handler.called != test.Called {
+			t.Errorf("%q (%q): Expected called to be %v",
+				test.Msg, test.Override, test.Called)
+		}
 	}
 
-	success := c.Unregister(GLOBAL, cmd)
-	if !success {
+	if !c.Unregister(GLOBAL, cmd) {
 		t.Error(cmd, "handler could not be unregistered.")
 	}
-	success = c.Unregister(GLOBAL, "other")
-	if !success {
-		t.Error("other handler could not be unregistered.")
-	}
 }
 
-type lockWriter struct {
-	*bytes.Buffer
-	write chan struct{}
+func TestCmds_DispatchAddressing(t *testing.T) {
+	c := NewCmds(prefix, core)
+
+	_, writer := newWriter()
+	state, _ := setup()
+	locker := badLocker{state, nil}
+
+	info := irc.NewNetworkInfo()
+	info.ParseISupport(&irc.Event{
+		Args: []string{"bot", "CASEMAPPING=rfc1459"},
+	})
+
+	handler := &commandHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL))
+	if err != nil {
+		t.Error("Unexpected:", cmd, err)
+	}
+
+	dispatch := func(target, msg string) bool {
+		handler.called = false
+		ev := &irc.Event{
+			Name: irc.PRIVMSG, Sender: host, NetworkInfo: info,
+			Args: []string{target, msg},
+		}
+		c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+		return handler.called
+	}
+
+	c.Dispatch(server, "", writer, &irc.Event{
+		Name: irc.RPL_WELCOME, Sender: server, NetworkInfo: info,
+		Args: []string{"bot[1]", "Welcome"},
+	}, locker)
+
+	if dispatch(channel, "bot[1]: "+cmd) {
+		t.Error("Expected no call to Cmd before addressing is set.")
+	}
+
+	c.SetAddressing(server, ":,")
+
+	var table = []struct {
+		Target string
+		Msg    string
+		Called bool
+	}{
+		{channel, "bot[1]: " + cmd, true},
+		{channel, "bot[1]:" + cmd, true},
+		{channel, "BOT{1}, " + cmd, true},
+		{channel, "bot[1] " + cmd, false},
+		{channel, "bot[1]; " + cmd, false},
+		{channel, "bot[1]: ", false},
+		{channel, "bot: " + cmd, false},
+		{channel, "bot[12]: " + cmd, false},
+		{channel, prefix + cmd, true},
+		{nick, "bot[1]: " + cmd, true},
+		{nick, cmd, true},
+	}
+
+	for _, test := range table {
+		if called := dispatch(test.Target, test.Msg); called != test.Called {
+			t.Errorf("%q (%v): Expected called to be %v",
+				test.Msg, test.Target, test.Called)
+		}
+	}
+
+	c.Dispatch(server, "", writer, &irc.Event{
+		Name: irc.NICK, Sender: "other!user@host", NetworkInfo: info,
+		Args: []string{"other2"},
+	}, locker)
+	c.Dispatch(server, "", writer, &irc.Event{
+		Name: irc.NICK, Sender: "Bot{1}!bot@host", NetworkInfo: info,
+		Args: []string{"newbot"},
+	}, locker)
+
+	if dispatch(channel, "bot[1]: "+cmd) {
+		t.Error("Expected no call to Cmd with the old nickname.")
+	}
+	if !dispatch(channel, "newbot, "+cmd) {
+		t.Error("Expected a call to Cmd with the new nickname.")
+	}
+
+	c.SetAddressing(server, "")
+	if dispatch(channel, "newbot, "+cmd) {
+		t.Error("Expected no call to Cmd when addressing is off.")
+	}
+
+	if !c.Unregister(GLOBAL, cmd) {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
 }
 
-func (l *lockWriter) Write(b []byte) (int, error) {
-	n, err := l.Buffer.Write(b)
-	l.write <- struct{}{}
-	return n, err
+func TestCmds_DispatchCTCPAndDCC(t *testing.T) {
+	c := NewCmds(prefix, core)
+
+	buffer, writer := newWriter()
+	state, _ := setup()
+	locker := badLocker{state, nil}
+
+	handler := &commandHandler{}
+	command := MkCmd(ext, dsc, cmd, handler, ALL, ALL, "[arg]")
+	if err := c.Register(GLOBAL, command); err != nil {
+		t.Error("Unexpected:", cmd, err)
+	}
+
+	ctcp := irc.CTCPpackString(strings.ToUpper(cmd), "value")
+	var table = []struct {
+		Msgtype int
+		Name    string
+		Target  string
+		Msg     string
+		Called  bool
+	}{
+		{CTCP, irc.PRIVMSG, nick, ctcp, true},
+		{CTCP, irc.PRIVMSG, channel, ctcp, true},
+		{CTCP, irc.NOTICE, nick, ctcp, false},
+		{CTCP, irc.PRIVMSG, nick, cmd, false},
+		{CTCP, irc.DCCCHAT, nick, cmd, false},
+		{ALL, irc.PRIVMSG, nick, ctcp, false},
+		{ALL, irc.NOTICE, nick, ctcp, false},
+		{ALL, irc.PRIVMSG, nick, "", false},
+		{ALL, irc.PRIVMSG, nick, "\x01", false},
+		{DCC, irc.DCCCHAT, nick, cmd + " value", true},
+		{DCC, irc.DCCCHAT, nick, prefix + cmd, false},
+		{DCC, irc.PRIVMSG, nick, cmd, false},
+		{PRIVMSG | DCC, irc.PRIVMSG, nick, cmd + " value", true},
+	}
+
+	for _, test := range table {
+		command.Msgtype = test.Msgtype
+		handler.called = false
+		ev := &irc.Event{
+			Name: test.Name, Sender: host, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if handler.called != test.Called {
+			t.Errorf("%q (%v %v): Expected called to be %v",
+				test.Msg, test.Name, test.Msgtype, test.Called)
+		} else if handler.called && handler.args["arg"] != "value" {
+			t.Errorf("%q (%v %v): Expected the argument to be value, got: %v",
+				test.Msg, test.Name, test.Msgtype, handler.args["arg"])
+		}
+	}
+
+	c.SetUnknownCmds(func(_, _ string) int { return PRIVATE })
+	for _, name := range []string{irc.DCCCHAT, irc.PRIVMSG} {
+		buffer.Reset()
+		c.Dispatch(server, "", writer, &irc.Event{
+			Name: name, Sender: host, NetworkInfo: netInfo,
+			Args: []string{nick, "nocmd"},
+		}, locker)
+		if !strings.Contains(buffer.String(), "nocmd") {
+			t.Errorf("%v: Expected an unknown command error, got: %q",
+				name, buffer.String())
+		}
+	}
+
+	buffer.Reset()
+	c.Dispatch(server, "", writer, &irc.Event{
+		Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+		Args: []string{nick, irc.CTCPpackString("NOCMD", "")},
+	}, locker)
+	if buffer.Len() != 0 {
+		t.Error("Expected no unknown command error for CTCP, got:",
+			buffer.String())
+	}
+
+	if !c.Unregister(GLOBAL, cmd) {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
 }
 
-func TestCmds_Panic(t *testing.T) {
-	ch := make(chan struct{}, 1)
-	lk := &lockWriter{&bytes.Buffer{}, ch}
-	logger := log15.New()
-	logger.SetHandler(log15.StreamHandler(lk, log15.LogfmtFormat()))
-	logCore := dispatch.NewDispatchCore(logger)
+type typedHandler struct {
+	ev *Event
+}
 
-	c := NewCmds(prefix, logCore)
-	panicMsg := "dispatch panic"
+func (h *typedHandler) Cmd(_ string, _ irc.Writer, ev *Event) error {
+	h.ev = ev
+	return nil
+}
 
+func TestCmds_DispatchTyped(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
 	state, store := setup()
 	locker := badLocker{state, store}
 
-	handler := panicHandler{
-		panicMsg,
+	handler := &typedHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL,
+		"count:int(1..10)", "Ratio:float", "[wait:duration(..1h)]",
+		"[ok:BOOL]", "[mode:Enum(Add|del)]", "[rgx:regex]", "[link:url]",
+		"[mask:mask]"))
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	tmpCmd := MkCmd("panic", "panic desc", "panic", handler, ALL, ALL)
-	c.Register(GLOBAL, tmpCmd)
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, cmd + " 5 0.5 30m yes add ^a+$ " +
+			"http://example.com/ nick!*@*"},
+	}
+	if err = c.Dispatch(server, "", writer, ev, locker); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	c.WaitForHandlers()
 
-	ev := irc.NewEvent("", netInfo, irc.PRIVMSG, host, self, "panic")
-	err := c.Dispatch(server, 0, nil, ev, locker)
-	if err != nil {
-		t.Error(err)
+	if handler.ev == nil {
+		t.Fatal("Handler was not called.")
+	}
+	got := handler.ev
+	if n := got.GetInt("count"); n != 5 {
+		t.Error("Wrong int:", n)
+	}
+	if f := got.GetFloat("Ratio"); f != 0.5 {
+		t.Error("Wrong float:", f)
+	}
+	if d := got.GetDuration("wait"); d != 30*time.Minute {
+		t.Error("Wrong duration:", d)
+	}
+	if !got.GetBool("ok") {
+		t.Error("Wrong bool.")
+	}
+	if m := got.GetArg("mode"); m != "Add" {
+		t.Error("Wrong enum:", m)
+	}
+	if rgx := got.GetRegexp("rgx"); rgx == nil || !rgx.MatchString("aaa") {
+		t.Error("Wrong regexp:", rgx)
+	}
+	if u := got.GetURL("link"); u == nil || u.Host != "example.com" {
+		t.Error("Wrong url:", u)
+	}
+	if m := got.GetMask("mask"); m != "nick!*@*" {
+		t.Error("Wrong mask:", m)
+	}
+	if got.GetInt("nothere") != 0 || got.GetURL("nothere") != nil {
+		t.Error("Missing arguments should be zero values.")
 	}
 
-	c.WaitForHandlers()
-	<-ch
-	logStr := lk.String()
+	var table = []struct {
+		Args   string
+		ErrMsg string
+	}{
+		{"5 1", ""},
+		{"x 1", errFmtArgumentNotType},
+		{"0 1", errFmtArgumentBetween},
+		{"11 1", errFmtArgumentBetween},
+		{"5 x", errFmtArgumentNotType},
+		{"5 1 2h", errFmtArgumentAtMost},
+		{"5 1 x", errFmtArgumentNotType},
+		{"5 1 1s maybe", errFmtArgumentNotType},
+		{"5 1 1s no DEL", ""},
+		{"5 1 1s no list", errFmtArgumentNotChoice},
+		{"5 1 1s no add (", errFmtArgumentNotType},
+		{"5 1 1s no add . example.com", errFmtArgumentNotType},
+		{"5 1 1s no add . http://a.com nick", errFmtArgumentNotType},
+	}
 
-	if logStr == "" {
-		t.Error("Expected not empty log.")
+	for _, test := range table {
+		buffer.Reset()
+		handler.ev = nil
+		ev.Args = []string{nick, cmd + " " + test.Args}
+		err = c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if test.ErrMsg == "" {
+			if err != nil {
+				t.Errorf("Unexpected error: %v (%v)", err, test.Args)
+			}
+			if handler.ev == nil {
+				t.Error("Handler was not called:", test.Args)
+			}
+			continue
+		}
+
+		if e := chkErr(err, test.ErrMsg); e != nil {
+			t.Error(test.Args, e)
+		}
+		if e := chkStr(string(buffer.Bytes()),
+			"NOTICE nick :"+test.ErrMsg); e != nil {
+			t.Error(test.Args, e)
+		}
+		if handler.ev != nil {
+			t.Error("Handler should not be called:", test.Args)
+		}
 	}
 
-	logBytes := lk.Bytes()
-	if !bytes.Contains(logBytes, []byte(panicMsg)) {
-		t.Errorf("Log does not contain: %s\n%s", panicMsg, logBytes)
+	success := c.Unregister(GLOBAL, cmd)
+	if !success {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+}
+
+func TestCmds_Tokenize(t *testing.T) {
+
+	var table = []struct {
+		Args   string
+		Tokens []string
+		ErrMsg string
+	}{
+		{"", nil, ""},
+		{"  a  b\tc ", []string{"a", "b", "c"}, ""},
+		{`"two words" three`, []string{"two words", "three"}, ""},
+		{`'single "quoted"'`, []string{`single "quoted"`}, ""},
+		{`"double 'quoted'"`, []string{`double 'quoted'`}, ""},
+		{`mid"dle quo"te`, []string{"middle quote"}, ""},
+		{`"" ''`, []string{"", ""}, ""},
+		{`esc\ aped \"q\"`, []string{"esc aped", `"q"`}, ""},
+		{`"in \"quotes\""`, []string{`in "quotes"`}, ""},
+		{`'no \escape'`, []string{`no \escape`}, ""},
+		{`trailing\`, []string{`trailing\`}, ""},
+		{`"open`, nil, errMsgUnterminatedQuote},
+		{`don't`, nil, errMsgUnterminatedQuote},
 	}
 
-	if !bytes.Contains(logBytes, []byte("cmds_test.go")) {
-		t.Error("Does not contain a reference to file that panic'd")
+	for _, test := range table {
+		tokens, err := tokenize(test.Args)
+		if test.ErrMsg != "" {
+			if e := chkErr(err, test.ErrMsg); e != nil {
+				t.Error(test.Args, e)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error: %v (%v)", err, test.Args)
+		}
+		if !reflect.DeepEqual(tokens, test.Tokens) {
+			t.Errorf("Expected: %q got: %q (%v)", test.Tokens, tokens,
+				test.Args)
+		}
 	}
 }
+
+func TestCmds_DispatchFlags(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store := setup()
+	locker := badLocker{state, store}
+
+	handler := &typedHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL,
+		"text", "-a|--author=", "-v|--verbose", "--count=int(1..5)",
+		"tags..."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, cmd + ` "two  words" --author "bob smith" ` +
+			`-v tag1 "tag 2" --count=3`},
+	}
+	if err = c.Dispatch(server, "", writer, ev, locker); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	c.WaitForHandlers()
+
+	if handler.ev == nil {
+		t.Fatal("Handler was not called.")
+	}
+	got := handler.ev
+	if text := got.GetArg("text"); text != "two  words" {
+		t.Error("Wrong argument:", text)
+	}
+	if author := got.GetFlag("author"); author != "bob smith" {
+		t.Error("Wrong flag value:", author)
+	}
+	if !got.HasFlag("verbose") || got.GetFlag("verbose") != "" {
+		t.Error("Switch was not set.")
+	}
+	if n := got.GetInt("count"); n != 3 || got.GetFlag("count") != "3" {
+		t.Error("Wrong typed flag:", n)
+	}
+	if tags := got.SplitArg("tags"); !reflect.DeepEqual(tags,
+		[]string{"tag1", "tag 2"}) {
+		t.Errorf("Wrong varargs: %q", tags)
+	}
+
+	var table = []struct {
+		Args   string
+		ErrMsg string
+	}{
+		{"text", ""},
+		{"text -a=bob", ""},
+		{"-- --author", ""},
+		{"-5", ""},
+		{"text --nope", errFmtFlagUnknown},
+		{"text -x", errFmtFlagUnknown},
+		{"text --author", errFmtFlagNeedsValue},
+		{"text --verbose=yes", errFmtFlagHasValue},
+		{"text --count 9", errFmtArgumentBetween},
+		{`"text`, errMsgUnterminatedQuote},
+		{"--verbose", errFmtArgAtLeast},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		handler.ev = nil
+		ev.Args = []string{nick, cmd + " " + test.Args}
+		err = c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if test.ErrMsg == "" {
+			if err != nil {
+				t.Errorf("Unexpected error: %v (%v)", err, test.Args)
+			}
+			if handler.ev == nil {
+				t.Error("Handler was not called:", test.Args)
+			}
+			continue
+		}
+
+		if e := chkErr(err, test.ErrMsg); e != nil {
+			t.Error(test.Args, e)
+		}
+		if e := chkStr(string(buffer.Bytes()),
+			"NOTICE nick :"+test.ErrMsg); e != nil {
+			t.Error(test.Args, e)
+		}
+		if handler.ev != nil {
+			t.Error("Handler should not be called:", test.Args)
+		}
+	}
+
+	handler.ev = nil
+	ev.Args = []string{nick, cmd + " -- --author"}
+	c.Dispatch(server, "", writer, ev, locker)
+	c.WaitForHandlers()
+	if handler.ev == nil || handler.ev.GetArg("text") != "--author" ||
+		handler.ev.HasFlag("author") {
+		t.Error("Arguments after -- should not be flags.")
+	}
+
+	success := c.Unregister(GLOBAL, cmd)
+	if !success {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+}
+
+func TestCmds_DispatchUnquoted(t *testing.T) {
+	c := NewCmds(prefix, core)
+	_, writer := newWriter()
+	state, store := setup()
+	locker := badLocker{state, store}
+
+	handler := &typedHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL,
+		"first", "rest..."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, cmd + ` "two words" --x 'y`},
+	}
+	if err = c.Dispatch(server, "", writer, ev, locker); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	c.WaitForHandlers()
+
+	if handler.ev == nil {
+		t.Fatal("Handler was not called.")
+	}
+	if first := handler.ev.GetArg("first"); first != `"two` {
+		t.Error("Commands without quoted args should split on spaces:", first)
+	}
+	if rest := handler.ev.SplitArg("rest"); !reflect.DeepEqual(rest,
+		[]string{`words"`, "--x", "'y"}) {
+		t.Errorf("Wrong varargs: %q", rest)
+	}
+
+	success := c.Unregister(GLOBAL, cmd)
+	if !success {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+}
+
+type groupHandler struct {
+	called string
+	ev     *Event
+}
+
+func (g *groupHandler) Cmd(cmd string, _ irc.Writer, ev *Event) error {
+	g.called = "Cmd:" + cmd
+	g.ev = ev
+	return nil
+}
+
+func (g *groupHandler) GrpSub(_ irc.Writer, ev *Event) error {
+	g.called = "GrpSub"
+	g.ev = ev
+	return nil
+}
+
+func TestCmds_RegisterSubcommands(t *testing.T) {
+	c := NewCmds(prefix, core)
+	handler := &groupHandler{}
+
+	group := MkGroup(ext, dsc, cmd, ALL, ALL,
+		MkCmd("", dsc, "sub", nil, 0, 0))
+	err := chkErr(c.Register(GLOBAL, group), errMsgHandlerRequired)
+	if err != nil {
+		t.Error(err)
+	}
+
+	group = MkGroup(ext, dsc, cmd, ALL, ALL,
+		MkCmd("", "", "sub", handler, 0, 0))
+	err = chkErr(c.Register(GLOBAL, group), errMsgDescRequired)
+	if err != nil {
+		t.Error(err)
+	}
+
+	group = MkGroup(ext, dsc, cmd, ALL, ALL,
+		MkCmd("", dsc, "sub", handler, 0, 0),
+		MkCmd("", dsc, "SUB", handler, 0, 0))
+	err = chkErr(c.Register(GLOBAL, group), errFmtDuplicateSubcmd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	group = MkGroup(ext, dsc, cmd, ALL, ALL,
+		MkCmd("", dsc, "sub", handler, 0, 0, "!!!"))
+	err = chkErr(c.Register(GLOBAL, group), errFmtArgumentForm)
+	if err != nil {
+		t.Error(err)
+	}
+
+	sub := MkCmd("", dsc, "sub", nil, 0, 0)
+	group = MkGroup(ext, dsc, cmd, PRIVMSG, PUBLIC,
+		MkGroup("", dsc, "nested", 0, 0, sub))
+	group.Handler = handler
+	if err = c.Register(GLOBAL, group); err != nil {
+		t.Fatal("Registration failed:", err)
+	}
+
+	if sub.Extension != ext || sub.Msgtype != PRIVMSG ||
+		sub.Msgscope != PUBLIC || sub.Handler != handler {
+		t.Error("Subcommands should inherit from their parents.")
+	}
+	if name := sub.FullName(); name != cmd+" nested sub" {
+		t.Error("Wrong full name:", name)
+	}
+	if sub.Parent() != group.Subcommand("NESTED") {
+		t.Error("Parent was not set.")
+	}
+	if group.Subcommand("nope") != nil {
+		t.Error("Subcommand should not find missing subcommands.")
+	}
+
+	if !c.Unregister(GLOBAL, cmd) {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+}
+
+func TestCmds_DispatchSubcommands(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store := setup()
+	locker := badLocker{state, store}
+
+	handler := &groupHandler{}
+	err := c.Register(GLOBAL, MkGroup(ext, dsc, "grp", ALL, ALL,
+		MkCmd("", dsc, "sub", handler, 0, 0, "arg"),
+		MkCmd("", dsc, "other", handler, 0, PUBLIC),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := MkCmd(ext, dsc, cmd, handler, ALL, ALL, "[arg]")
+	group.Subcommands = []*Cmd{MkCmd("", dsc, "sub", nil, 0, 0)}
+	if err = c.Register(GLOBAL, group); err != nil {
+		t.Fatal(err)
+	}
+
+	var table = []struct {
+		Msg    string
+		Called string
+		Arg    string
+		ErrMsg string
+	}{
+		{"grp sub hello", "GrpSub", "hello", ""},
+		{"GRP SUB hello", "GrpSub", "hello", ""},
+		{"grp sub", "", "", errFmtArgAtLeast},
+		{"grp other", "", "", ""},
+		{"grp", "", "", errFmtSubcmdRequired},
+		{"grp nope", "", "", errFmtSubcmdRequired},
+		{"cmd sub", "Cmd:cmd sub", "", ""},
+		{"cmd hello", "Cmd:cmd", "hello", ""},
+		{"cmd", "Cmd:cmd", "", ""},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		handler.called, handler.ev = "", nil
+		ev := &irc.Event{
+			Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+			Args: []string{nick, test.Msg},
+		}
+		err = c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if handler.called != test.Called {
+			t.Errorf("Expected call: %q got: %q (%v)", test.Called,
+				handler.called, test.Msg)
+		}
+		if handler.ev != nil && handler.ev.GetArg("arg") != test.Arg {
+			t.Errorf("Expected arg: %q got: %q (%v)", test.Arg,
+				handler.ev.GetArg("arg"), test.Msg)
+		}
+
+		if test.ErrMsg == "" {
+			if err != nil {
+				t.Errorf("Unexpected error: %v (%v)", err, test.Msg)
+			}
+			continue
+		}
+		if e := chkErr(err, test.ErrMsg); e != nil {
+			t.Error(test.Msg, e)
+		}
+		if e := chkStr(string(buffer.Bytes()),
+			"NOTICE nick :"+test.ErrMsg); e != nil {
+			t.Error(test.Msg, e)
+		}
+	}
+
+	if !c.Unregister(GLOBAL, "grp") || !c.Unregister(GLOBAL, cmd) {
+		t.Error("Handlers could not be unregistered.")
+	}
+}
+
+type sequenceHandler struct {
+	order []string
+}
+
+func (s *sequenceHandler) Cmd(_ string, _ irc.Writer, ev *Event) error {
+	s.order = append(s.order, ev.GetArg("n"))
+	return nil
+}
+
+func TestCmds_DispatchSequential(t *testing.T) {
+	c := NewCmds(prefix, dispatch.NewDispatchCore(nil))
+	if c.IsSequential() {
+		t.Error("Cmds should not be sequential by default.")
+	}
+	c.SetSequential(true)
+	if !c.IsSequential() {
+		t.Error("It should be sequential.")
+	}
+
+	buffer, writer := newWriter()
+	state, _ := setup()
+	locker := badLocker{state, nil}
+
+	handler := &sequenceHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL, "n"))
+	if err != nil {
+		t.Error("Unexpected:", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		err = c.Dispatch(server, "", writer, irc.NewEvent(server, netInfo,
+			irc.PRIVMSG, host, channel, fmt.Sprintf(".%s %d", cmd, i)), locker)
+		if err != nil {
+			t.Error("Unexpected:", err)
+		}
+	}
+	c.WaitForHandlers()
+
+	if len(handler.order) != 20 {
+		t.Fatal("Expected all commands to be handled, got:", len(handler.order))
+	}
+	for i, n := range handler.order {
+		if n != fmt.Sprint(i) {
+			t.Errorf("Expected: %v got: %v", i, n)
+		}
+	}
+
+	err = c.Dispatch(server, "", writer, irc.NewEvent(server, netInfo,
+		irc.PRIVMSG, host, channel, "."+cmd), locker)
+	if err != nil {
+		t.Error("Errors should be reported to the user in sequential mode.")
+	}
+	c.WaitForHandlers()
+	if !strings.HasPrefix(buffer.String(), "NOTICE nick :Error") {
+		t.Error("Expected an error notice, got:", buffer.String())
+	}
+
+	if !c.Unregister(GLOBAL, cmd) {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+}
+
+func TestCmds_EachCmd(t *testing.T) {
+	c := NewCmds(prefix, core)
+	var err error
+
+	handler := &errorHandler{}
+
+	err = c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL))
+	if err != nil {
+		t.Error("Unexpected:", err)
+	}
+	err = c.Register(GLOBAL, MkCmd(ext, dsc, "other", handler, ALL, ALL))
+	if err != nil {
+		t.Error("Unexpected:", err)
+	}
+
+	visited := 0
+	EachCmd(func(command *Cmd) bool {
+		visited++
+		return true
+	})
+
+	if visited != 1 {
+		t.Error("Expected to stop after one iteration.")
+	}
+
+	success := c.Unregister(GLOBAL, cmd)
+	if !success {
+		t.Error(cmd, "handler could not be unregistered.")
+	}
+	success = c.Unregister(GLOBAL, "other")
+	if !success {
+		t.Error("other handler could not be unregistered.")
+	}
+}
+
+func TestCmds_Aliases(t *testing.T) {
+	c := NewCmds(prefix, core)
+	handler := &groupHandler{}
+
+	command := MkCmd(ext, dsc, cmd, handler, ALL, ALL, "[arg]")
+	command.Aliases = []string{"c", "cm"}
+	if err := c.Register(GLOBAL, command); err != nil {
+		t.Fatal("Registration failed:", err)
+	}
+
+	other := MkCmd(ext, dsc, "other", handler, ALL, ALL)
+	other.Aliases = []string{"cm"}
+	err := chkErr(c.Register(GLOBAL, other), errFmtDuplicateCmd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	group := MkGroup(ext, dsc, "grp", ALL, ALL,
+		MkCmd("", dsc, "sub", handler, 0, 0),
+		&Cmd{Cmd: "other", Aliases: []string{"SUB"}, Description: dsc})
+	err = chkErr(c.Register(GLOBAL, group), errFmtDuplicateSubcmd)
+	if err != nil {
+		t.Error(err)
+	}
+
+	visited := 0
+	EachCmd(func(found *Cmd) bool {
+		if found == command {
+			visited++
+		}
+		return false
+	})
+	if visited != 1 {
+		t.Error("Aliases should not be iterated over:", visited)
+	}
+
+	_, writer := newWriter()
+	state, store := setup()
+	locker := badLocker{state, store}
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, "CM hello"},
+	}
+	if err = c.Dispatch(server, "", writer, ev, locker); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	c.WaitForHandlers()
+	if handler.called != "Cmd:"+cmd || handler.ev.GetArg("arg") != "hello" {
+		t.Error("Alias was not dispatched to the command:", handler.called)
+	}
+
+	if !c.Unregister(GLOBAL, "c") {
+		t.Error("Could not unregister by alias.")
+	}
+	for _, name := range []string{cmd, "c", "cm"} {
+		if c.Unregister(GLOBAL, name) {
+			t.Error("All names should have been unregistered:", name)
+		}
+	}
+}
+
+func TestCmds_DispatchAliasMacros(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, _ := setupForAuth()
+	defer store.Close()
+	locker := badLocker{state, store}
+
+	handler := &groupHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler, ALL, ALL,
+		"first", "rest..."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Register(GLOBAL, MkAuthCmd(ext, dsc, "authed", handler, ALL, ALL,
+		100, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(channel, alias, expansion string) {
+		err := store.SaveAlias(server, channel,
+			data.NewStoredAlias(alias, expansion, "user"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("", "net", "cmd network")
+	save("", "both", "cmd network")
+	save(channel, "both", "cmd channel $chan $nick")
+	save(channel, "args", "cmd $2 $1 $3 $$1 $nickname $*")
+	save(channel, "loop", "args")
+	save(channel, "auth", "authed")
+
+	var table = []struct {
+		Target string
+		Msg    string
+		Called bool
+		Args   string
+		ErrMsg string
+	}{
+		{nick, "net a b", true, "network a b", ""},
+		{channel, ".net a b", true, "network a b", ""},
+		{nick, "both", true, "network", ""},
+		{channel, ".both", true, "channel " + channel + " nick", ""},
+		{channel, ".args a b", true, "b a $1 $nickname a b", ""},
+		{channel, ".loop", false, "", ""},
+		{channel, ".nope", false, "", ""},
+		{channel, ".auth", false, "", "Access Denied: (100) level required."},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		handler.called, handler.ev = "", nil
+		ev := &irc.Event{
+			Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		err = c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if called := handler.called != ""; called != test.Called {
+			t.Errorf("Expected called to be %v (%v)", test.Called, test.Msg)
+		}
+		if handler.ev != nil {
+			args := handler.ev.GetArg("first") + " " + handler.ev.GetArg("rest")
+			if strings.TrimSpace(args) != test.Args {
+				t.Errorf("Expected args: %q got: %q (%v)", test.Args, args,
+					test.Msg)
+			}
+		}
+		if test.ErrMsg != "" {
+			if e := chkErr(err, test.ErrMsg); e != nil {
+				t.Error(test.Msg, e)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error: %v (%v)", err, test.Msg)
+		}
+	}
+
+	if !c.Unregister(GLOBAL, cmd) || !c.Unregister(GLOBAL, "authed") {
+		t.Error("Handlers could not be unregistered.")
+	}
+}
+
+func TestCmds_ExpandAlias(t *testing.T) {
+	var table = []struct {
+		Expansion string
+		Args      string
+		Expanded  string
+	}{
+		{"cmd", "", "cmd"},
+		{"cmd", "a b", "cmd a b"},
+		{"cmd $1", "a b", "cmd a"},
+		{"cmd $9", "a b", "cmd "},
+		{"cmd $*", "a  b", "cmd a b"},
+		{"cmd $nick $chan", "a", "cmd nick #chan a"},
+		{"cmd $nicks $channel", "", "cmd $nicks $channel"},
+		{"cmd $nick's", "", "cmd nick's"},
+		{"cmd $$ $$1 $", "", "cmd $ $1 $"},
+		{"cmd $x", "a", "cmd $x a"},
+	}
+
+	for _, test := range table {
+		got := expandAlias(test.Expansion, test.Args, "nick", "#chan")
+		if got != test.Expanded {
+			t.Errorf("Expected: %q got: %q (%v)", test.Expanded, got,
+				test.Expansion)
+		}
+	}
+}
+
+func TestCmds_RegisterRateLimits(t *testing.T) {
+	c := NewCmds(prefix, core)
+	handler := &commandHandler{}
+
+	var table = []struct {
+		Limit RateLimit
+		Error bool
+	}{
+		{RateLimit{LIMITUSER, 1, time.Second}, false},
+		{RateLimit{LIMITGLOBAL, 5, time.Hour}, false},
+		{RateLimit{LIMITUSER, 0, time.Second}, true},
+		{RateLimit{LIMITCHANNEL, 1, 0}, true},
+		{RateLimit{LIMITGLOBAL + 1, 1, time.Second}, true},
+	}
+
+	for _, test := range table {
+		command := MkCmd(ext, dsc, cmd, handler, ALL, ALL)
+		command.Limits = []RateLimit{test.Limit}
+		err := c.Register(GLOBAL, command)
+		if test.Error {
+			if e := chkErr(err, errFmtRateLimit); e != nil {
+				t.Error(e)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		c.Unregister(GLOBAL, cmd)
+	}
+}
+
+func TestCmds_DispatchRateLimits(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, user := setupForAuth()
+	defer store.Close()
+	locker := badLocker{state, store}
+
+	user.GrantGlobalFlags("x")
+	if err := store.SaveUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c.limiter.now = func() time.Time { return now }
+
+	handler := &commandHandler{}
+	limited := MkCmd(ext, dsc, cmd, handler, ALL, ALL)
+	limited.Limits = []RateLimit{
+		{LIMITUSER, 1, time.Minute},
+		{LIMITCHANNEL, 2, time.Minute},
+	}
+	silent := MkCmd(ext, dsc, "silent", handler, ALL, ALL)
+	silent.Limits = []RateLimit{{LIMITNETWORK, 1, time.Minute}}
+	silent.LimitSilent = true
+	exempt := MkCmd(ext, dsc, "exempt", handler, ALL, ALL)
+	exempt.Limits = []RateLimit{{LIMITGLOBAL, 1, time.Minute}}
+	exempt.LimitExempt = "x"
+
+	for _, command := range []*Cmd{limited, silent, exempt} {
+		if err := c.Register(GLOBAL, command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limitedMsg := fmt.Sprintf(errFmtRateLimited, cmd, "%v")
+	var table = []struct {
+		Elapsed time.Duration
+		Sender  string
+		Target  string
+		Msg     string
+		Called  bool
+		ErrMsg  string
+	}{
+		{0, host, channel, ".cmd", true, ""},
+		{time.Second, host, channel, ".cmd", false,
+			fmt.Sprintf(errFmtRateLimited, cmd, "59s")},
+		{0, "other!other@other", nick, "cmd", true, ""},
+		{0, "other!other@other", channel, ".cmd", false, limitedMsg},
+		{0, "third!third@third", channel, ".cmd", true, ""},
+		{0, "fourth!fourth@fourth", channel, ".cmd", false, limitedMsg},
+		{time.Minute, host, channel, ".cmd", true, ""},
+
+		{0, host, nick, "silent", true, ""},
+		{0, "other!other@other", nick, "silent", false, ""},
+
+		{0, host, nick, "exempt", true, ""},
+		{0, host, nick, "exempt", true, ""},
+		{0, "other!other@other", nick, "exempt", true, ""},
+		{0, "other!other@other", nick, "exempt", false,
+			fmt.Sprintf(errFmtRateLimited, "exempt", "1m0s")},
+	}
+
+	for i, test := range table {
+		buffer.Reset()
+		handler.called = false
+		now = now.Add(test.Elapsed)
+
+		ev := &irc.Event{
+			Sender: test.Sender, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		err := c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if handler.called != test.Called {
+			t.Errorf("%d) Expected called to be %v (%v)", i, test.Called,
+				test.Msg)
+		}
+		if test.Called {
+			if err != nil {
+				t.Errorf("%d) Unexpected error: %v", i, err)
+			}
+			continue
+		}
+
+		if test.ErrMsg == "" {
+			if err == nil {
+				t.Errorf("%d) Expected an error.", i)
+			}
+			if buffer.Len() != 0 {
+				t.Errorf("%d) Expected no notice, got: %s", i, buffer.String())
+			}
+			continue
+		}
+		if e := chkErr(err, test.ErrMsg); e != nil {
+			t.Errorf("%d) %v", i, e)
+		}
+		if buffer.Len() == 0 {
+			t.Errorf("%d) Expected a notice.", i)
+		}
+	}
+
+	for _, name := range []string{cmd, "silent", "exempt"} {
+		if !c.Unregister(GLOBAL, name) {
+			t.Error("Could not unregister:", name)
+		}
+	}
+}
+
+func TestRateLimiter_SameScope(t *testing.T) {
+	t.Parallel()
+
+	limiter := newRateLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	key := makeLimitKey(LIMITUSER, cmd, server, "", nick)
+	keys := []string{key, key}
+	limits := []RateLimit{
+		{LIMITUSER, 3, time.Minute},
+		{LIMITUSER, 5, time.Hour},
+	}
+
+	for i := 0; i < 3; i++ {
+		if wait := limiter.take(keys, limits); wait != 0 {
+			t.Errorf("Use %d should be allowed, wait: %v", i+1, wait)
+		}
+	}
+	if wait := limiter.take(keys, limits); wait != time.Minute {
+		t.Error("Expected a minute's wait for the 4th use, got:", wait)
+	}
+
+	now = now.Add(time.Minute)
+	for i := 3; i < 5; i++ {
+		if wait := limiter.take(keys, limits); wait != 0 {
+			t.Errorf("Use %d should be allowed, wait: %v", i+1, wait)
+		}
+	}
+	if wait := limiter.take(keys, limits); wait != 59*time.Minute {
+		t.Error("Expected the hourly limit to be exhausted, got:", wait)
+	}
+}
+
+func TestCmds_DispatchConfirm(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, _ := setupForAuth()
+	defer store.Close()
+	locker := badLocker{state, store}
+
+	now := time.Now()
+	c.confirms.now = func() time.Time { return now }
+
+	handler := &commandHandler{}
+	confirmed := MkCmd(ext, dsc, cmd, handler, ALL, ALL)
+	confirmed.Confirm = true
+	confirmed.Limits = []RateLimit{{LIMITUSER, 1, time.Minute}}
+	authed := MkCmd(ext, dsc, "authed", handler, ALL, ALL)
+	authed.Confirm = true
+	authed.RequireAuth = true
+
+	for _, command := range []*Cmd{confirmed, authed} {
+		if err := c.Register(GLOBAL, command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rgxToken := regexp.MustCompile(`confirm ([0-9a-f]+) `)
+	dispatch := func(sender, target, msg string) (string, bool) {
+		buffer.Reset()
+		handler.called = false
+		c.Dispatch(server, "", writer, &irc.Event{
+			Name: irc.PRIVMSG, Sender: sender, NetworkInfo: netInfo,
+			Args: []string{target, msg},
+		}, locker)
+		c.WaitForHandlers()
+		return buffer.String(), handler.called
+	}
+
+	out, called := dispatch(host, nick, cmd)
+	match := rgxToken.FindStringSubmatch(out)
+	if called || match == nil {
+		t.Fatalf("Expected to be asked to confirm, got: %q", out)
+	}
+	token := match[1]
+
+	var table = []struct {
+		Sender string
+		Target string
+		Msg    string
+		Called bool
+		Out    string
+	}{
+		{"other!other@other", nick, "confirm " + token, false, ""},
+		{host, channel, prefix + "confirm " + token, false, ""},
+		{host, nick, "confirm bad", false, errMsgConfirmNotFound},
+		{host, nick, "CONFIRM " + strings.ToUpper(token), true, ""},
+		{host, nick, "confirm " + token, false, ""},
+		{"other!other@other", nick, "authed", false, errMsgNotAuthed},
+	}
+
+	for i, test := range table {
+		out, called := dispatch(test.Sender, test.Target, test.Msg)
+		if called != test.Called {
+			t.Errorf("%v) Expected called to be %v", i, test.Called)
+		}
+		if len(test.Out) == 0 && len(out) != 0 {
+			t.Errorf("%v) Expected no message, got: %q", i, out)
+		} else if !strings.Contains(out, test.Out) {
+			t.Errorf("%v) Expected: %q got: %q", i, test.Out, out)
+		}
+	}
+
+	out, _ = dispatch(host, channel, prefix+"authed")
+	if match = rgxToken.FindStringSubmatch(out); match == nil {
+		t.Fatalf("Expected to be asked to confirm, got: %q", out)
+	}
+	now = now.Add(confirmTimeout)
+	out, called = dispatch(host, channel, prefix+"confirm "+match[1])
+	if called {
+		t.Error("Expected the confirmation to have expired.")
+	} else if len(out) != 0 {
+		t.Error("Expected no message, got:", out)
+	}
+
+	c.Unregister(GLOBAL, cmd)
+	c.Unregister(GLOBAL, "authed")
+}
+
+func TestCmds_DispatchAudit(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, _ := setupForAuth()
+	defer store.Close()
+	locker := badLocker{state, store}
+
+	var entries []*data.AuditEntry
+	c.SetAudit(func(command *Cmd, entry *data.AuditEntry) {
+		entries = append(entries, entry)
+	})
+
+	failing := MkCmd(ext, dsc, cmd, &errorHandler{errors.New("failed")},
+		ALL, ALL, "args...")
+	authed := MkCmd(ext, dsc, "authed", &commandHandler{}, ALL, ALL)
+	authed.RequireAuth = true
+	authed.ReqLevel = 100
+	for _, command := range []*Cmd{failing, authed} {
+		if err := c.Register(GLOBAL, command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var table = []struct {
+		Sender  string
+		Target  string
+		Msg     string
+		Entry   data.AuditEntry
+		Audited bool
+	}{
+		{host, channel, prefix + "cmd  some thing", data.AuditEntry{
+			Target: channel, Account: "user", Command: cmd,
+			Arguments: "  some thing", Result: "failed"}, true},
+		{"other!other@other", nick, "authed", data.AuditEntry{
+			Command: "authed", Result: errMsgNotAuthed}, true},
+		{host, nick, "authed", data.AuditEntry{
+			Account: "user", Command: "authed",
+			Result: MakeLevelError(100).Error()}, true},
+		{host, nick, "unknown", data.AuditEntry{}, false},
+	}
+
+	for i, test := range table {
+		entries = nil
+		c.Dispatch(server, "", writer, &irc.Event{
+			Name: irc.PRIVMSG, Sender: test.Sender, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}, locker)
+		c.WaitForHandlers()
+
+		if !test.Audited {
+			if len(entries) != 0 {
+				t.Errorf("%v) Expected no entries, got: %v", i, entries)
+			}
+			continue
+		}
+		if len(entries) != 1 {
+			t.Errorf("%v) Expected one entry, got: %v", i, len(entries))
+			continue
+		}
+
+		entry := entries[0]
+		if entry.Time.IsZero() || entry.NetworkID != server ||
+			entry.Sender != test.Sender {
+			t.Errorf("%v) Entry was not filled in: %v", i, entry)
+		}
+		test.Entry.Time = entry.Time
+		test.Entry.NetworkID = server
+		test.Entry.Sender = test.Sender
+		if *entry != test.Entry {
+			t.Errorf("%v) Expected: %v\ngot: %v", i, test.Entry, *entry)
+		}
+	}
+
+	c.SetAudit(nil)
+	entries = nil
+	buffer.Reset()
+	c.Dispatch(server, "", writer, &irc.Event{
+		Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+		Args: []string{nick, cmd},
+	}, locker)
+	c.WaitForHandlers()
+	if len(entries) != 0 {
+		t.Error("Expected no entries once auditing is off.")
+	}
+
+	c.Unregister(GLOBAL, cmd)
+	c.Unregister(GLOBAL, "authed")
+}
+
+func TestCmds_DispatchUnknown(t *testing.T) {
+	c := NewCmds(prefix, core)
+	other := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	locker := badLocker{}
+
+	c.SetUnknownCmds(func(networkID, ch string) int {
+		switch {
+		case networkID != server:
+			return 0
+		case ch == "":
+			return PRIVATE
+		case ch == channel:
+			return PUBLIC
+		}
+		return 0
+	})
+
+	handler := &commandHandler{}
+	search := MkCmd(ext, dsc, "search", handler, ALL, ALL)
+	search.Aliases = []string{"find"}
+	registrations := []struct {
+		Cmds    *Cmds
+		Server  string
+		Command *Cmd
+	}{
+		{c, GLOBAL, search},
+		{c, GLOBAL, MkCmd(ext, dsc, "seen", handler, ALL, ALL)},
+		{c, GLOBAL, MkCmd(ext, dsc, "seed", handler, ALL, ALL)},
+		{c, GLOBAL, MkCmd(ext, dsc, "secret", handler, ALL, PRIVATE)},
+		{c, GLOBAL, MkAuthCmd(ext, dsc, "shutdown", handler, ALL, ALL,
+			100, "a")},
+		{other, server, MkCmd(ext, dsc, "weather", handler, ALL, ALL)},
+	}
+	for _, r := range registrations {
+		if err := r.Cmds.Register(r.Server, r.Command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var table = []struct {
+		Name   string
+		Target string
+		Msg    string
+		Expect string
+	}{
+		{irc.PRIVMSG, nick, "serch", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdSuggest, "serch", "search")},
+		{irc.PRIVMSG, nick, "fnd", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdSuggest, "fnd", "find")},
+		{irc.PRIVMSG, nick, "seet", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdSuggest, "seet", "seed, seen")},
+		{irc.PRIVMSG, nick, "secrt", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdSuggest, "secrt", "secret")},
+		{irc.PRIVMSG, channel, ".secrt", "PRIVMSG #chan :nick: " +
+			fmt.Sprintf(errFmtCmdNotFound, "secrt")},
+		{irc.PRIVMSG, channel, ".seen2", "PRIVMSG #chan :nick: " +
+			fmt.Sprintf(errFmtCmdSuggest, "seen2", "seen")},
+		{irc.PRIVMSG, nick, "xyzzy", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdNotFound, "xyzzy")},
+		{irc.PRIVMSG, nick, "shutdwn", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdNotFound, "shutdwn")},
+		{irc.PRIVMSG, nick, "weather", ""},
+		{irc.PRIVMSG, "#other", ".serch", ""},
+		{irc.PRIVMSG, channel, "serch", ""},
+		{irc.NOTICE, nick, "serch", ""},
+		{irc.PRIVMSG, nick, "\x01VERSION\x01", ""},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		ev := &irc.Event{
+			Sender: host, Name: test.Name, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		if err := c.Dispatch(server, "", writer, ev, locker); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		c.WaitForHandlers()
+
+		got := strings.TrimSpace(buffer.String())
+		if got != test.Expect {
+			t.Errorf("Expected: %q got: %q (%v)", test.Expect, got, test.Msg)
+		}
+	}
+
+	state, store, user := setupForAuth()
+	user.GrantGlobal(100, "a")
+	buffer.Reset()
+	ev := &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, "shutdwn"},
+	}
+	c.Dispatch(server, "", writer, ev, badLocker{state, store})
+	expect := "NOTICE nick :" +
+		fmt.Sprintf(errFmtCmdSuggest, "shutdwn", "shutdown")
+	if got := strings.TrimSpace(buffer.String()); got != expect {
+		t.Errorf("Expected: %q got: %q", expect, got)
+	}
+
+	c.SetUnknownCmds(nil)
+	buffer.Reset()
+	ev = &irc.Event{
+		Sender: host, Name: irc.PRIVMSG, NetworkInfo: netInfo,
+		Args: []string{nick, "serch"},
+	}
+	if c.Dispatch(server, "", writer, ev, locker); buffer.Len() != 0 {
+		t.Error("Expected unknown commands to be ignored, got:", buffer)
+	}
+
+	for _, r := range registrations {
+		if !r.Cmds.Unregister(r.Server, r.Command.Cmd) {
+			t.Error("Could not unregister:", r.Command.Cmd)
+		}
+	}
+}
+
+func TestCmds_EditDistance(t *testing.T) {
+	t.Parallel()
+
+	var table = []struct {
+		A, B     string
+		Distance int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"seen", "seen", 0},
+		{"seen", "sen", 1},
+		{"kitten", "sitting", 3},
+		{"search", "serch", 1},
+	}
+
+	for _, test := range table {
+		if d := editDistance(test.A, test.B); d != test.Distance {
+			t.Errorf("Expected distance between %q and %q to be %d, got: %d",
+				test.A, test.B, test.Distance, d)
+		}
+	}
+}
+
+func TestCmds_Usage(t *testing.T) {
+	c := NewCmds(prefix, core)
+	handler := &commandHandler{}
+
+	unregistered := MkCmd(ext, dsc, cmd, handler, ALL, ALL, "a", "[b]")
+	if exp, got := "cmd a [b]", unregistered.Usage(); exp != got {
+		t.Errorf("Expected: %q got: %q", exp, got)
+	}
+
+	var table = []struct {
+		Args  []string
+		Usage string
+	}{
+		{nil, "cmd"},
+		{[]string{"#chan", "~nick", "[*user]"}, "cmd [#chan] <nick> [user]"},
+		{[]string{"n:int(1..5)", "[d:duration]", "rest..."},
+			"cmd <n:int(1..5)> [d:duration] [rest...]"},
+		{[]string{"-v", "-c|--count=int", "--name=", "arg"},
+			"cmd <arg> [-v] [-c|--count=<int>] [--name=<value>]"},
+	}
+
+	for _, test := range table {
+		command := MkCmd(ext, dsc, cmd, handler, ALL, ALL, test.Args...)
+		if err := c.Register(GLOBAL, command); err != nil {
+			t.Fatal(err)
+		}
+		if got := command.Usage(); got != test.Usage {
+			t.Errorf("Expected: %q got: %q", test.Usage, got)
+		}
+		c.Unregister(GLOBAL, cmd)
+	}
+
+	group := MkGroup(ext, dsc, "grp", ALL, ALL,
+		MkCmd(ext, dsc, "add", handler, 0, 0, "text..."),
+		MkCmd(ext, dsc, "del", handler, 0, 0, "id:int"),
+	)
+	if err := c.Register(GLOBAL, group); err != nil {
+		t.Fatal(err)
+	}
+	if exp, got := "grp <add|del>", group.Usage(); exp != got {
+		t.Errorf("Expected: %q got: %q", exp, got)
+	}
+	if exp, got := "grp del <id:int>", group.Subcommand("del").Usage(); exp != got {
+		t.Errorf("Expected: %q got: %q", exp, got)
+	}
+	c.Unregister(GLOBAL, "grp")
+}
+
+func TestCmds_HasAccess(t *testing.T) {
+	t.Parallel()
+
+	handler := &commandHandler{}
+	user, err := data.NewStoredUser("user", "pass", "*!*@host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.GrantChannel(server, channel, 50, "ab")
+
+	var table = []struct {
+		Command *Cmd
+		User    *data.StoredUser
+		Channel string
+		Access  bool
+	}{
+		{MkCmd(ext, dsc, cmd, handler, ALL, ALL), nil, "", true},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 0, ""), nil, "", false},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 0, ""), user, "", true},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 50, "a"), user, channel,
+			true},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 50, "a"), user, "", false},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 51, ""), user, channel,
+			false},
+		{MkAuthCmd(ext, dsc, cmd, handler, ALL, ALL, 0, "c"), user, channel,
+			false},
+	}
+
+	for i, test := range table {
+		access := test.Command.HasAccess(test.User, server, test.Channel)
+		if access != test.Access {
+			t.Errorf("%d) Expected access to be %v", i, test.Access)
+		}
+	}
+}
+
+type lockWriter struct {
+	*bytes.Buffer
+	write chan struct{}
+}
+
+func (l *lockWriter) Write(b []byte) (int, error) {
+	n, err := l.Buffer.Write(b)
+	l.write <- struct{}{}
+	return n, err
+}
+
+type pipeHandler struct {
+	calls []string
+}
+
+func (h *pipeHandler) Cmd(cmd string, w irc.Writer, ev *Event) error {
+	text := ev.GetArg("text")
+	h.calls = append(h.calls, cmd+":"+text)
+	switch cmd {
+	case "echo":
+		return w.Notify(ev.Event, ev.Nick(), text)
+	case "upper", "shout":
+		return w.Notify(ev.Event, ev.Nick(), strings.ToUpper(text))
+	case "fail":
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func TestCmds_SplitPipeline(t *testing.T) {
+	t.Parallel()
+
+	var table = []struct {
+		Msg    string
+		Stages []string
+	}{
+		{"echo a", []string{"echo a"}},
+		{"echo a | upper", []string{"echo a ", "upper"}},
+		{"echo a | .upper b", []string{"echo a ", "upper b"}},
+		{"echo a |", []string{"echo a ", ""}},
+		{"echo a|b", []string{"echo a|b"}},
+		{"echo a \\| upper", []string{"echo a \\| upper"}},
+		{"echo 'a | b' | upper", []string{"echo 'a | b' ", "upper"}},
+		{`echo "a | b" | upper`, []string{`echo "a | b" `, "upper"}},
+		{"echo don't | upper", []string{"echo don't ", "upper"}},
+		{"a | b | c", []string{"a ", "b ", "c"}},
+	}
+
+	for _, test := range table {
+		stages := splitPipeline(test.Msg, prefix)
+		if !reflect.DeepEqual(stages, test.Stages) {
+			t.Errorf("%q: Expected: %q got: %q", test.Msg, test.Stages, stages)
+		}
+	}
+}
+
+func TestCmds_DispatchPipeline(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, _ := setupForAuth()
+	locker := badLocker{state, store}
+
+	handler := &pipeHandler{}
+	shout := MkCmd(ext, dsc, "shout", handler, ALL, ALL, "text...")
+	shout.QuotedArgs = true
+	commands := []*Cmd{
+		MkCmd(ext, dsc, "echo", handler, ALL, ALL, "text..."),
+		MkCmd(ext, dsc, "upper", handler, ALL, ALL, "text..."),
+		MkCmd(ext, dsc, "fail", handler, ALL, ALL, "text..."),
+		MkCmd(ext, dsc, "whisper", handler, ALL, PRIVATE, "text..."),
+		MkAuthCmd(ext, dsc, "secret", handler, ALL, ALL, 100, "",
+			"text..."),
+		shout,
+	}
+	for _, command := range commands {
+		if err := c.Register(GLOBAL, command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var table = []struct {
+		Target string
+		Msg    string
+		Expect string
+		Calls  []string
+	}{
+		{nick, "echo hi | upper", "NOTICE nick :HI",
+			[]string{"echo:hi", "upper:hi"}},
+		{channel, ".echo hi | .upper", "PRIVMSG #chan :HI",
+			[]string{"echo:hi", "upper:hi"}},
+		{channel, ".echo hi | upper", "PRIVMSG #chan :HI",
+			[]string{"echo:hi", "upper:hi"}},
+		{nick, "echo a | upper b", "NOTICE nick :B A",
+			[]string{"echo:a", "upper:b a"}},
+		{nick, "echo a | echo b | upper", "NOTICE nick :B A",
+			[]string{"echo:a", "echo:b a", "upper:b a"}},
+		{nick, "echo a|b", "NOTICE nick :a|b", []string{"echo:a|b"}},
+		{nick, "echo don't | shout 'it'", "NOTICE nick :IT DON'T",
+			[]string{"echo:don't", "shout:it don't"}},
+		{nick, "echo a | fail | upper", "NOTICE nick :failed",
+			[]string{"echo:a", "fail:a"}},
+		{nick, "echo a | nothere", "NOTICE nick :a | nothere",
+			[]string{"echo:a | nothere"}},
+		{channel, ".echo a | whisper", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdNotFound, "whisper"), nil},
+		{nick, "echo a | secret", "NOTICE nick :" +
+			fmt.Sprintf(errFmtInsuffLevel, 100), nil},
+		{nick, "echo a |", "NOTICE nick :a |", []string{"echo:a |"}},
+		{nick, "echo a | echo b | echo c | echo d | upper", "NOTICE nick :" +
+			fmt.Sprintf(errFmtPipeTooLong, maxPipeline), nil},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		handler.calls = nil
+		ev := &irc.Event{
+			Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if got := strings.TrimSpace(buffer.String()); got != test.Expect {
+			t.Errorf("%q: Expected: %q got: %q", test.Msg, test.Expect, got)
+		}
+		if !reflect.DeepEqual(handler.calls, test.Calls) {
+			t.Errorf("%q: Expected calls: %q got: %q",
+				test.Msg, test.Calls, handler.calls)
+		}
+	}
+
+	for _, command := range commands {
+		if !c.Unregister(GLOBAL, command.Cmd) {
+			t.Error("Could not unregister:", command.Cmd)
+		}
+	}
+}
+
+type localeHandler struct {
+	locale string
+}
+
+func (h *localeHandler) Cmd(_ string, w irc.Writer, ev *Event) error {
+	h.locale = ev.Locale
+	return w.Notice(ev.Nick(), "Hello.")
+}
+
+func TestCmds_DispatchLocale(t *testing.T) {
+	c := NewCmds(prefix, core)
+	buffer, writer := newWriter()
+	state, store, user := setupForAuth()
+	locker := badLocker{state, store}
+
+	channelCatalog := locale.Catalog{
+		"Hello.":          {"Hallo."},
+		errFmtCmdNotFound: {"Fehler: (%v)"},
+		errFmtArgAtLeast:  {"Mindestens %v (%v)"},
+	}
+	userCatalog := locale.Catalog{"Hello.": {"Hola."}}
+	locale.Add("x-chan", channelCatalog)
+	locale.Add("x-user", userCatalog)
+	defer locale.Remove("x-chan", channelCatalog)
+	defer locale.Remove("x-user", userCatalog)
+
+	c.SetUnknownCmds(func(string, string) int { return PRIVATE })
+	c.SetLocale(func(networkID, ch string) string {
+		if networkID == server && ch == channel {
+			return "x-chan"
+		}
+		return ""
+	})
+
+	handler := &localeHandler{}
+	err := c.Register(GLOBAL, MkCmd(ext, dsc, "greet", handler, ALL, ALL,
+		"name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var table = []struct {
+		UserLocale string
+		Target     string
+		Msg        string
+		Expect     string
+	}{
+		{"", channel, ".greet bob", "NOTICE nick :Hallo."},
+		{"", nick, "greet bob", "NOTICE nick :Hello."},
+		{"", channel, ".greet", "NOTICE nick :Mindestens 1 (name)"},
+		{"", channel, ".xyzzy", "NOTICE nick :Fehler: (xyzzy)"},
+		{"", nick, "xyzzy", "NOTICE nick :" +
+			fmt.Sprintf(errFmtCmdNotFound, "xyzzy")},
+		{"x-user", nick, "greet bob", "NOTICE nick :Hola."},
+		{"x-user", channel, ".greet bob", "NOTICE nick :Hola."},
+		{"x-user", channel, ".greet", "NOTICE nick :" +
+			fmt.Sprintf(errFmtArgAtLeast, 1, "name")},
+	}
+
+	for _, test := range table {
+		buffer.Reset()
+		user.SetLocale(test.UserLocale)
+		ev := &irc.Event{
+			Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+			Args: []string{test.Target, test.Msg},
+		}
+		c.Dispatch(server, "", writer, ev, locker)
+		c.WaitForHandlers()
+
+		if got := strings.TrimSpace(buffer.String()); got != test.Expect {
+			t.Errorf("%q (%v): Expected: %q got: %q",
+				test.Msg, test.UserLocale, test.Expect, got)
+		}
+	}
+
+	if handler.locale != "x-user" {
+		t.Error("Expected the event to have the user's locale, got:",
+			handler.locale)
+	}
+
+	if !c.Unregister(GLOBAL, "greet") {
+		t.Error("Could not unregister greet.")
+	}
+}
+
+func TestCmds_Panic(t *testing.T) {
+	ch := make(chan struct{}, 1)
+	lk := &lockWriter{&bytes.Buffer{}, ch}
+	logger := log15.New()
+	logger.SetHandler(log15.StreamHandler(lk, log15.LogfmtFormat()))
+	logCore := dispatch.NewDispatchCore(logger)
+
+	c := NewCmds(prefix, logCore)
+	panicMsg := "dispatch panic"
+
+	state, store := setup()
+	locker := badLocker{state, store}
+
+	handler := panicHandler{
+		panicMsg,
+	}
+
+	tmpCmd := MkCmd("panic", "panic desc", "panic", handler, ALL, ALL)
+	c.Register(GLOBAL, tmpCmd)
+
+	ev := irc.NewEvent("", netInfo, irc.PRIVMSG, host, self, "panic")
+	err := c.Dispatch(server, "", nil, ev, locker)
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.WaitForHandlers()
+	<-ch
+	logStr := lk.String()
+
+	if logStr == "" {
+		t.Error("Expected not empty log.")
+	}
+
+	logBytes := lk.Bytes()
+	if !bytes.Contains(logBytes, []byte(panicMsg)) {
+		t.Errorf("Log does not contain: %s\n%s", panicMsg, logBytes)
+	}
+
+	if !bytes.Contains(logBytes, []byte("cmds_test.go")) {
+		t.Error("Does not contain a reference to file that panic'd")
+	}
+}
+
+type identityHandler struct {
+	identity *data.Identity
+	state    *data.State
+}
+
+func (h *identityHandler) Cmd(_ string, _ irc.Writer, ev *Event) error {
+	h.identity = ev.Identity(ev.Nick())
+	h.state = ev.State
+	return nil
+}
+
+func TestCmds_DispatchIdentity(t *testing.T) {
+	c := NewCmds(prefix, core)
+	_, writer := newWriter()
+	state, store := setup()
+	locker := badLocker{state, store}
+
+	handler := &identityHandler{}
+	if err := c.Register(GLOBAL, MkCmd(ext, dsc, cmd, handler,
+		ALL, ALL)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	dispatch := func() {
+		c.Dispatch(server, "", writer, &irc.Event{
+			Name: irc.PRIVMSG, Sender: host, NetworkInfo: netInfo,
+			NetworkID: server, Args: []string{channel, prefix + cmd},
+		}, locker)
+		c.WaitForHandlers()
+	}
+
+	dispatch()
+	if handler.identity != nil {
+		t.Error("Expected no identity without a way to correlate users.")
+	}
+
+	var networkID, lookedUp string
+	identity := &data.Identity{Account: "account"}
+	c.SetIdentity(func(netID, nickorhost string) *data.Identity {
+		networkID, lookedUp = netID, nickorhost
+		return identity
+	})
+
+	dispatch()
+	if handler.identity != identity {
+		t.Error("Expected the identity to be returned, got:", handler.identity)
+	}
+	if networkID != server || lookedUp != "nick" {
+		t.Error("Expected the user to be looked up, got:", networkID, lookedUp)
+	}
+	if handler.state != nil {
+		t.Error("Expected the event to be closed.")
+	}
+
+	c.Unregister(GLOBAL, cmd)
+}
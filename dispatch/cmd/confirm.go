@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+const (
+	// confirmCmd is what a user replies with to confirm a command, followed
+	// by the token they were given.
+	confirmCmd = "confirm"
+	// confirmTimeout is how long a user has to confirm a command.
+	confirmTimeout = 30 * time.Second
+	// confirmTokenSize is the number of random bytes in a token.
+	confirmTokenSize = 4
+)
+
+// confirmation is a command waiting to be confirmed by the user who invoked
+// it.
+type confirmation struct {
+	networkID string
+	channel   string
+	isChan    bool
+	pipeline  []pipeStage
+	ev        *irc.Event
+	expires   time.Time
+}
+
+// confirmer remembers the commands that are waiting to be confirmed.
+type confirmer struct {
+	now     func() time.Time
+	pending map[string]*confirmation
+	protect sync.Mutex
+}
+
+// newConfirmer initializes a confirmer.
+func newConfirmer() *confirmer {
+	return &confirmer{
+		now:     time.Now,
+		pending: make(map[string]*confirmation),
+	}
+}
+
+// add remembers a command until it's confirmed or expires and returns the
+// token that confirms it.
+func (c *confirmer) add(conf *confirmation) (string, error) {
+	buf := make([]byte, confirmTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	c.protect.Lock()
+	defer c.protect.Unlock()
+
+	now := c.now()
+	for t, pending := range c.pending {
+		if !pending.expires.After(now) {
+			delete(c.pending, t)
+		}
+	}
+
+	conf.expires = now.Add(confirmTimeout)
+	c.pending[token] = conf
+	return token, nil
+}
+
+// take removes the command waiting on a token if it was invoked by the user
+// in the channel and has not expired. waiting is true if the user has any
+// commands waiting to be confirmed in the channel.
+func (c *confirmer) take(token, networkID, channel, host string) (
+	conf *confirmation, waiting bool) {
+
+	c.protect.Lock()
+	defer c.protect.Unlock()
+
+	now := c.now()
+	belongs := func(pending *confirmation) bool {
+		return pending.networkID == networkID &&
+			strings.EqualFold(pending.channel, channel) &&
+			strings.EqualFold(pending.ev.Sender, host) &&
+			pending.expires.After(now)
+	}
+
+	for _, pending := range c.pending {
+		if waiting = belongs(pending); waiting {
+			break
+		}
+	}
+
+	if pending, ok := c.pending[token]; ok && belongs(pending) {
+		delete(c.pending, token)
+		return pending, true
+	}
+	return nil, waiting
+}
+
+// mustConfirm checks if any of the commands in a pipeline must be confirmed.
+func mustConfirm(pipeline []pipeStage) bool {
+	for _, stage := range pipeline {
+		if stage.command.Confirm {
+			return true
+		}
+	}
+	return false
+}
+
+// askConfirm remembers a pipeline and asks the user to confirm it.
+func (c *Cmds) askConfirm(networkID, ch string, isChan bool,
+	pipeline []pipeStage, writer irc.Writer, ev *irc.Event,
+	lang string) error {
+
+	token, err := c.confirms.add(&confirmation{
+		networkID: networkID,
+		channel:   ch,
+		isChan:    isChan,
+		pipeline:  pipeline,
+		ev:        ev,
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(pipeline))
+	for i, stage := range pipeline {
+		names[i] = stage.cmd
+	}
+
+	writer.Notice(irc.Nick(ev.Sender), locale.Sprintf(lang,
+		errFmtConfirmRequired, strings.Join(names, " | "), token,
+		confirmTimeout))
+	return nil
+}
+
+// confirm starts the commands waiting on the token given in a message of the
+// form: confirm <token>. The message is only handled if the user has commands
+// waiting to be confirmed in the channel, otherwise it's dispatched as usual.
+func (c *Cmds) confirm(networkID, ch, msg string, writer irc.Writer,
+	ev *irc.Event, locker data.Locker) (handled bool, err error) {
+
+	name, rest := splitFirstField(msg)
+	if !strings.EqualFold(name, confirmCmd) {
+		return false, nil
+	}
+	token, _ := splitFirstField(rest)
+
+	conf, waiting := c.confirms.take(strings.ToLower(token), networkID, ch,
+		ev.Sender)
+	if !waiting {
+		return false, nil
+	}
+	if conf == nil {
+		lang := c.lookupLocale(networkID, ch, ev, locker)
+		writer.Notice(irc.Nick(ev.Sender),
+			locale.Translate(lang, errMsgConfirmNotFound))
+		return true, nil
+	}
+
+	return true, c.start(conf.networkID, conf.channel, conf.isChan,
+		conf.pipeline, false, writer, conf.ev, locker)
+}
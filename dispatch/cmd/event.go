@@ -3,11 +3,16 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
 )
 
 // Event represents the data about the event that occurred. The commander
@@ -60,9 +65,17 @@ type Event struct {
 	// TargetVarUsers is populated when the arguments contain a *user...
 	// argument.
 	TargetVarStoredUser []*data.StoredUser
+	// Locale is the language messages should be sent to the user in, the
+	// writer given to the handler translates into it. See the locale package.
+	Locale string
 
-	args map[string]string
-	once sync.Once
+	args     map[string]string
+	split    map[string][]string
+	typed    map[string]interface{}
+	flags    map[string]string
+	audit    *data.AuditEntry
+	identity IdentityFunc
+	once     sync.Once
 }
 
 // GetArg gets an argument that was passed in to the command by the user. The
@@ -72,14 +85,193 @@ func (ev *Event) GetArg(arg string) string {
 }
 
 // SplitArg behaves exactly like GetArg but calls strings.Fields on the
-// argument. Useful for varargs...
+// argument. Useful for varargs... When the command uses quoted arguments the
+// varargs are returned as they were tokenized instead.
 func (ev *Event) SplitArg(arg string) (args []string) {
+	if split, ok := ev.split[arg]; ok {
+		return split
+	}
 	if str, ok := ev.args[arg]; ok && len(str) > 0 {
 		args = strings.Fields(str)
 	}
 	return
 }
 
+// GetFlag gets the value of a --flag= that was passed in to the command by the
+// user. The long name of the flag without dashes is required to get the value,
+// or the short name if the flag has no long name. If the flag was not given an
+// empty string is returned. Typed flags can also be retrieved with the typed
+// getters, for example GetInt.
+func (ev *Event) GetFlag(flag string) string {
+	return ev.flags[flag]
+}
+
+// HasFlag checks if a flag was passed in to the command by the user. This is
+// how switches that take no value should be checked.
+func (ev *Event) HasFlag(flag string) bool {
+	_, ok := ev.flags[flag]
+	return ok
+}
+
+// GetInt gets an int:arg that was passed in to the command by the user. If the
+// argument was not given 0 is returned.
+func (ev *Event) GetInt(arg string) int {
+	n, _ := ev.typed[arg].(int)
+	return n
+}
+
+// GetFloat gets a float:arg that was passed in to the command by the user. If
+// the argument was not given 0 is returned.
+func (ev *Event) GetFloat(arg string) float64 {
+	n, _ := ev.typed[arg].(float64)
+	return n
+}
+
+// GetDuration gets a duration:arg that was passed in to the command by the
+// user. If the argument was not given 0 is returned.
+func (ev *Event) GetDuration(arg string) time.Duration {
+	d, _ := ev.typed[arg].(time.Duration)
+	return d
+}
+
+// GetBool gets a bool:arg that was passed in to the command by the user. If
+// the argument was not given false is returned.
+func (ev *Event) GetBool(arg string) bool {
+	b, _ := ev.typed[arg].(bool)
+	return b
+}
+
+// GetRegexp gets a regex:arg that was passed in to the command by the user.
+// If the argument was not given nil is returned.
+func (ev *Event) GetRegexp(arg string) *regexp.Regexp {
+	rgx, _ := ev.typed[arg].(*regexp.Regexp)
+	return rgx
+}
+
+// GetURL gets a url:arg that was passed in to the command by the user. If the
+// argument was not given nil is returned.
+func (ev *Event) GetURL(arg string) *url.URL {
+	u, _ := ev.typed[arg].(*url.URL)
+	return u
+}
+
+// GetMask gets a mask:arg that was passed in to the command by the user. If
+// the argument was not given an empty mask is returned.
+func (ev *Event) GetMask(arg string) irc.Mask {
+	mask, _ := ev.typed[arg].(irc.Mask)
+	return mask
+}
+
+// setArg sets the value of an argument, validating and converting it first if
+// the argument has a type.
+func (ev *Event) setArg(arg *argument, value string) (err error) {
+	if arg.Conv != nil {
+		if value, err = ev.convert(arg.Name, value, arg.Conv); err != nil {
+			return err
+		}
+	}
+	ev.args[arg.Name] = value
+	return nil
+}
+
+// setSplitArg sets the tokens that make up a varargs... argument.
+func (ev *Event) setSplitArg(name string, tokens []string) {
+	if ev.split == nil {
+		ev.split = make(map[string][]string)
+	}
+	ev.split[name] = tokens
+}
+
+// convert validates and converts a value, storing the converted value for the
+// typed getters. The value is returned as it should be seen by GetArg.
+func (ev *Event) convert(name, value string, conv argConverter) (
+	string, error) {
+
+	converted, err := conv.convert(name, value)
+	if err != nil {
+		return "", err
+	}
+	if choice, ok := converted.(string); ok {
+		value = choice
+	}
+
+	if ev.typed == nil {
+		ev.typed = make(map[string]interface{})
+	}
+	ev.typed[name] = converted
+	return value, nil
+}
+
+// parseFlags removes the flags declared by the command from the arguments
+// given by the user and stores them. The remaining arguments are returned.
+func (ev *Event) parseFlags(command *Cmd, msgArgs []string) (
+	[]string, error) {
+
+	ev.flags = make(map[string]string)
+	remaining := make([]string, 0, len(msgArgs))
+
+	for i := 0; i < len(msgArgs); i++ {
+		given := msgArgs[i]
+		if given == "--" {
+			remaining = append(remaining, msgArgs[i+1:]...)
+			break
+		}
+		if !isFlag(given) {
+			remaining = append(remaining, given)
+			continue
+		}
+
+		var value string
+		var hasValue bool
+		if index := strings.IndexByte(given, '='); index >= 0 {
+			given, value, hasValue = given[:index], given[index+1:], true
+		}
+
+		f := command.lookupFlag(given)
+		if f == nil {
+			return nil, locale.Errorf(errFmtFlagUnknown, given)
+		}
+
+		if !f.Value {
+			if hasValue {
+				return nil, locale.Errorf(errFmtFlagHasValue, given)
+			}
+			ev.flags[f.Name] = ""
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(msgArgs) {
+				return nil, locale.Errorf(errFmtFlagNeedsValue, given)
+			}
+			i++
+			value = msgArgs[i]
+		}
+
+		if f.Conv != nil {
+			var err error
+			if value, err = ev.convert(f.Name, value, f.Conv); err != nil {
+				return nil, err
+			}
+		}
+		ev.flags[f.Name] = value
+	}
+
+	return remaining, nil
+}
+
+// isFlag checks if an argument given by a user looks like a flag. Negative
+// numbers and a lone dash are not flags.
+func isFlag(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	if arg[1] == '-' {
+		return len(arg) > 2
+	}
+	return unicode.IsLetter(rune(arg[1]))
+}
+
 // FindUserByNick finds a user by their nickname. An error is returned if
 // they were not found.
 func (ev *Event) FindUserByNick(nick string) (*data.User, error) {
@@ -89,7 +281,7 @@ func (ev *Event) FindUserByNick(nick string) (*data.User, error) {
 
 	user := ev.State.GetUser(nick)
 	if user == nil {
-		return nil, fmt.Errorf(errFmtUserNotFound, nick)
+		return nil, locale.Errorf(errFmtUserNotFound, nick)
 	}
 
 	return user, nil
@@ -106,6 +298,10 @@ func (ev *Event) FindAccessByUser(server, nickOrUser string) (
 		err = errors.New(errMsgStoreDisabled)
 		return
 	}
+	if len(nickOrUser) == 0 {
+		err = locale.Errorf(errFmtUserNotFound, nickOrUser)
+		return
+	}
 
 	switch nickOrUser[0] {
 	case '*':
@@ -116,7 +312,7 @@ func (ev *Event) FindAccessByUser(server, nickOrUser string) (
 		uname := nickOrUser[1:]
 		access, err = ev.Store.FindUser(uname)
 		if access == nil {
-			err = fmt.Errorf(errFmtUserNotRegistered, uname)
+			err = locale.Errorf(errFmtUserNotRegistered, uname)
 			return
 		}
 	default:
@@ -127,12 +323,12 @@ func (ev *Event) FindAccessByUser(server, nickOrUser string) (
 
 		user = ev.State.GetUser(nickOrUser)
 		if user == nil {
-			err = fmt.Errorf(errFmtUserNotFound, nickOrUser)
+			err = locale.Errorf(errFmtUserNotFound, nickOrUser)
 			return
 		}
 		access = ev.Store.GetAuthedUser(server, user.Host())
 		if access == nil {
-			err = fmt.Errorf(errFmtUserNotAuthed, nickOrUser)
+			err = locale.Errorf(errFmtUserNotAuthed, nickOrUser)
 			return
 		}
 	}
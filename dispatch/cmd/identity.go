@@ -0,0 +1,30 @@
+package cmd
+
+import "github.com/aarondl/ultimateq/data"
+
+// IdentityFunc finds the users on all networks that are the same person as a
+// user on one of them, nil if the user is not known. It's called after the
+// event's State and Store have been closed.
+type IdentityFunc func(networkID, nickorhost string) *data.Identity
+
+// SetIdentity sets the function that correlates users across networks for
+// Event.Identity, nil turns it off.
+func (c *Cmds) SetIdentity(fn IdentityFunc) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	c.identity = fn
+}
+
+// Identity finds the users on all networks that are the same person as a
+// user on the event's network, for example to see where else a user is
+// online. It's nil if the user is not known or there's no way to correlate
+// users. Correlating users locks the State of every network so the event is
+// closed first, and its State and Store may not be used afterwards.
+func (ev *Event) Identity(nickorhost string) *data.Identity {
+	ev.Close()
+	if ev.identity == nil {
+		return nil
+	}
+	return ev.identity(ev.NetworkID, nickorhost)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// LocaleFunc decides the language messages are sent to users in for a
+// network and channel, the channel is empty for private messages.
+type LocaleFunc func(networkID, channel string) string
+
+// SetLocale sets the function that decides the language messages are sent
+// in. A user that's authenticated and has chosen a language (see
+// data.StoredUser.Locale) is always sent messages in their own language.
+func (c *Cmds) SetLocale(fn LocaleFunc) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	c.locales = fn
+}
+
+// userLocale finds the language to send messages to the user who sent an
+// event in. The store may be nil.
+func (c *Cmds) userLocale(networkID, channel string, ev *irc.Event,
+	store *data.Store) string {
+
+	if store != nil {
+		if access := store.GetAuthedUser(networkID, ev.Sender); access != nil {
+			if lang := access.Locale(); len(lang) != 0 {
+				return lang
+			}
+		}
+	}
+
+	c.protectCmds.RLock()
+	locales := c.locales
+	c.protectCmds.RUnlock()
+
+	if locales == nil {
+		return ""
+	}
+	return locales(networkID, channel)
+}
+
+// lookupLocale finds the language to send messages to the user who sent an
+// event in when the store is not already open.
+func (c *Cmds) lookupLocale(networkID, channel string, ev *irc.Event,
+	locker data.Locker) (lang string) {
+
+	found := locker.ReadStore(func(store *data.Store) {
+		lang = c.userLocale(networkID, channel, ev, store)
+	})
+	if !found {
+		lang = c.userLocale(networkID, channel, ev, nil)
+	}
+	return lang
+}
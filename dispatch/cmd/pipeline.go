@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+// maxPipeline is the most commands that can be chained together in a single
+// pipeline.
+const maxPipeline = 4
+
+// pipeStage is a single command in a pipeline.
+type pipeStage struct {
+	command *Cmd
+	cmd     string
+	args    string
+}
+
+// pipeOutput captures the messages sent by a command in a pipeline so they
+// can be given to the next command. Anything that's not a PRIVMSG or NOTICE,
+// along with CTCPs, is sent on to the network.
+type pipeOutput struct {
+	writer irc.Writer
+	lines  []string
+}
+
+// Write captures the text of a PRIVMSG or NOTICE, and passes anything else
+// on to the real writer.
+func (p *pipeOutput) Write(b []byte) (int, error) {
+	name, rest := splitFirstField(string(b))
+	if name == irc.PRIVMSG || name == irc.NOTICE {
+		index := strings.Index(rest, " :")
+		if index >= 0 && !irc.IsCTCPString(rest[index+2:]) {
+			p.lines = append(p.lines, rest[index+2:])
+			return len(b), nil
+		}
+	}
+	return p.writer.Write(b)
+}
+
+// splitPipeline splits a message into the commands of a pipeline. Commands
+// are separated by a | standing on its own between whitespace, one that's
+// quoted or escaped with a backslash is left alone. The commands after the
+// first may begin with the prefix. The message is only a pipeline if each of
+// the commands after the first is known, see isPipeline.
+func splitPipeline(msg, prefix string) []string {
+	var stages []string
+	var quote byte
+	start := 0
+
+	for i := 0; i < len(msg); i++ {
+		b := msg[i]
+		atField := i == 0 || unicode.IsSpace(rune(msg[i-1]))
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '\\':
+			i++
+		case (b == '"' || b == '\'') && atField:
+			quote = b
+		case b == '|' && atField &&
+			(i+1 == len(msg) || unicode.IsSpace(rune(msg[i+1]))):
+			stages = append(stages, msg[start:i])
+			start = i + 1
+		}
+	}
+	stages = append(stages, msg[start:])
+
+	for i := 1; i < len(stages); i++ {
+		stage := strings.TrimLeftFunc(stages[i], unicode.IsSpace)
+		if len(prefix) != 0 {
+			stage = strings.TrimPrefix(stage, prefix)
+		}
+		stages[i] = stage
+	}
+
+	return stages
+}
+
+// isPipeline checks that each of the commands after the first in a split
+// message names a command. If one doesn't the message is not a pipeline and
+// the | are left to be arguments of the first command.
+func (c *Cmds) isPipeline(networkID, ch, nick string, stages []string,
+	locker data.Locker) bool {
+
+	for _, stage := range stages[1:] {
+		if command, _, _, _ := c.findCmd(networkID, ch, nick, stage,
+			locker); command == nil {
+
+			return false
+		}
+	}
+	return true
+}
+
+// pipeline looks up the commands that follow the first in a pipeline and
+// checks the user has access to all of them, so that nothing is run unless
+// every command in the pipeline can be.
+func (c *Cmds) pipeline(networkID, ch string, msgtype, msgscope int,
+	first pipeStage, stages []string, ev *irc.Event,
+	locker data.Locker) ([]pipeStage, error) {
+
+	if len(stages) > maxPipeline {
+		return nil, locale.Errorf(errFmtPipeTooLong, maxPipeline)
+	}
+
+	nick := irc.Nick(ev.Sender)
+	pipeline := []pipeStage{first}
+	for _, stage := range stages[1:] {
+		command, cmd, args, _ := c.findCmd(networkID, ch, nick, stage, locker)
+		if command == nil || 0 == (msgtype&command.Msgtype) ||
+			0 == (msgscope&command.Msgscope) {
+			return nil, locale.Errorf(errFmtCmdNotFound, cmd)
+		}
+
+		if command.RequireAuth {
+			err := errors.New(errMsgStoreDisabled)
+			locker.ReadStore(func(store *data.Store) {
+				_, err = filterAccess(store, command, networkID, ch, ev)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pipeline = append(pipeline, pipeStage{command, cmd, args})
+	}
+
+	return pipeline, nil
+}
+
+// runPipeline calls each command in a pipeline in turn, the messages sent by
+// a command are captured and their words added to the end of the arguments of
+// the next. The captured words are not tokenized, so quotes in them are kept
+// as they are.
+// The event for the first command must already be created, and HandlerStarted
+// must be called before runPipeline.
+func (c *Cmds) runPipeline(networkID, ch string, isChan bool,
+	pipeline []pipeStage, cmdEv *Event, writer irc.Writer, ev *irc.Event,
+	locker data.Locker) {
+
+	defer c.PanicHandler()
+	defer c.HandlerFinished()
+
+	var input []string
+	for i, stage := range pipeline {
+		if i > 0 {
+			var err error
+			cmdEv, err = c.newEvent(networkID, stage.command, ch, isChan,
+				stage.args, input, nil, writer, ev, locker)
+			if err != nil {
+				return
+			}
+		}
+
+		out := writer
+		var output *pipeOutput
+		if i+1 < len(pipeline) {
+			output = &pipeOutput{writer: writer}
+			out = irc.Helper{Writer: output}
+		}
+
+		if err := c.call(stage.command, stage.cmd, out, cmdEv); err != nil {
+			writer.Notice(cmdEv.Nick(), locale.ErrorString(cmdEv.Locale, err))
+			return
+		}
+
+		if output != nil {
+			input = nil
+			for _, line := range output.lines {
+				input = append(input, strings.Fields(line)...)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants used for defining the scope of a rate limit.
+const (
+	// LIMITUSER limits each user separately. Users are told apart by their
+	// username if they are authenticated and their hostname otherwise.
+	LIMITUSER = iota
+	// LIMITCHANNEL limits each channel separately. In private messages
+	// the limit is applied to each user instead.
+	LIMITCHANNEL
+	// LIMITNETWORK limits each network separately.
+	LIMITNETWORK
+	// LIMITGLOBAL limits all uses of the command across every network.
+	LIMITGLOBAL
+)
+
+// limitSweepInterval is how often the rate limiter throws away the history
+// for keys that are no longer limited.
+const limitSweepInterval = 10 * time.Minute
+
+// RateLimit allows a command to be used a number of times within a duration.
+type RateLimit struct {
+	// Scope is what is being limited, may be any of the constants:
+	// LIMITUSER, LIMITCHANNEL, LIMITNETWORK or LIMITGLOBAL.
+	Scope int
+	// Uses is the number of times the command may be used.
+	Uses int
+	// Per is the duration in which the uses are counted, ie. 3 uses per
+	// minute. A cooldown is a single use per duration.
+	Per time.Duration
+}
+
+// limitHistory is the recent uses of a command under a single key.
+type limitHistory struct {
+	per  time.Duration
+	uses []time.Time
+}
+
+// rateLimiter remembers when commands were used to enforce rate limits.
+type rateLimiter struct {
+	now     func() time.Time
+	swept   time.Time
+	history map[string]*limitHistory
+	protect sync.Mutex
+}
+
+// newRateLimiter initializes a rate limiter.
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:     time.Now,
+		history: make(map[string]*limitHistory),
+	}
+}
+
+// take records a use of a command for each of the limits if none of them are
+// exhausted. keys holds the key that each limit is counted by. If a limit is
+// exhausted nothing is recorded and the time until the command may be used
+// again is returned.
+func (r *rateLimiter) take(keys []string, limits []RateLimit) time.Duration {
+	r.protect.Lock()
+	defer r.protect.Unlock()
+
+	now := r.now()
+	if now.Sub(r.swept) > limitSweepInterval {
+		r.sweep(now)
+	}
+
+	var wait time.Duration
+	for i, limit := range limits {
+		history, ok := r.history[keys[i]]
+		if !ok {
+			continue
+		}
+		history.prune(now)
+		if len(history.uses) < limit.Uses {
+			continue
+		}
+		oldest := history.uses[len(history.uses)-limit.Uses]
+		if w := oldest.Add(limit.Per).Sub(now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		return wait
+	}
+
+	// Limits of the same scope share a key, each use is recorded only once.
+	recorded := make(map[string]bool, len(keys))
+	for i, limit := range limits {
+		history, ok := r.history[keys[i]]
+		if !ok {
+			history = &limitHistory{}
+			r.history[keys[i]] = history
+		}
+		if limit.Per > history.per {
+			history.per = limit.Per
+		}
+		if !recorded[keys[i]] {
+			recorded[keys[i]] = true
+			history.uses = append(history.uses, now)
+		}
+	}
+
+	return 0
+}
+
+// sweep removes the history of keys that have no recent uses.
+func (r *rateLimiter) sweep(now time.Time) {
+	for key, history := range r.history {
+		history.prune(now)
+		if len(history.uses) == 0 {
+			delete(r.history, key)
+		}
+	}
+	r.swept = now
+}
+
+// prune removes the uses that are too old to count against any limit.
+func (l *limitHistory) prune(now time.Time) {
+	i := 0
+	for i < len(l.uses) && !l.uses[i].Add(l.per).After(now) {
+		i++
+	}
+	l.uses = l.uses[i:]
+}
+
+// makeLimitKey creates the key that a use of a command is counted by for the
+// given scope.
+func makeLimitKey(scope int, command, networkID, channel, user string) string {
+	switch scope {
+	case LIMITGLOBAL:
+		return strings.Join([]string{command, "global"}, ":")
+	case LIMITNETWORK:
+		return strings.Join([]string{command, "network", networkID}, ":")
+	case LIMITCHANNEL:
+		if len(channel) == 0 {
+			channel = user
+		}
+		return strings.Join([]string{
+			command, "channel", networkID, strings.ToLower(channel),
+		}, ":")
+	}
+	return strings.Join([]string{
+		command, "user", networkID, strings.ToLower(user),
+	}, ":")
+}
+
+// roundWait rounds the time left on a rate limit up to the nearest second so
+// it can be shown to a user.
+func roundWait(wait time.Duration) time.Duration {
+	return (wait + time.Second - 1) / time.Second * time.Second
+}
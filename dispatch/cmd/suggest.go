@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/ultimateq/locale"
+)
+
+const (
+	// maxSuggestions is the most commands that will be suggested for a
+	// command that was not found.
+	maxSuggestions = 3
+	// maxSuggestDistance is the largest edit distance a command can be from
+	// the name given and still be suggested.
+	maxSuggestDistance = 3
+)
+
+// UnknownCmdsFunc decides how to answer a command that's not found on a
+// network and channel, the channel is empty for private messages. It returns
+// 0 to ignore the command, PRIVATE to notice the user or PUBLIC to answer in
+// the channel the command was given in.
+type UnknownCmdsFunc func(networkID, channel string) int
+
+// SetUnknownCmds sets the function that decides how commands that are not
+// found are answered, by default they're ignored. Only a PRIVMSG is answered,
+// never a NOTICE or CTCP. Commands registered to the network by another cmds
+// are not answered either, so only one cmds per network should have this set.
+func (c *Cmds) SetUnknownCmds(fn UnknownCmdsFunc) {
+	c.protectCmds.Lock()
+	defer c.protectCmds.Unlock()
+
+	c.unknownCmds = fn
+}
+
+// unknownCmd answers a command that was not found with the commands that
+// are most similar to it, if the network and channel are configured to.
+func (c *Cmds) unknownCmd(networkID, cmd, channel string, msgscope int,
+	writer irc.Writer, ev *irc.Event, locker data.Locker) {
+
+	c.protectCmds.RLock()
+	unknownCmds := c.unknownCmds
+	c.protectCmds.RUnlock()
+
+	if unknownCmds == nil || len(cmd) == 0 {
+		return
+	}
+
+	mode := unknownCmds(networkID, channel)
+	if mode != PRIVATE && mode != PUBLIC {
+		return
+	}
+
+	var suggestions []string
+	var registered bool
+	suggest := func(store *data.Store) {
+		var user *data.StoredUser
+		if store != nil {
+			user = store.GetAuthedUser(networkID, ev.Sender)
+		}
+		suggestions, registered = suggestCmds(networkID, channel, cmd,
+			msgscope, user)
+	}
+	if !locker.ReadStore(suggest) {
+		suggest(nil)
+	}
+	if registered {
+		return
+	}
+
+	lang := c.lookupLocale(networkID, channel, ev, locker)
+	msg := locale.Sprintf(lang, errFmtCmdNotFound, cmd)
+	if len(suggestions) != 0 {
+		msg = locale.Sprintf(lang, errFmtCmdSuggest, cmd,
+			strings.Join(suggestions, ", "))
+	}
+
+	nick := irc.Nick(ev.Sender)
+	if mode == PUBLIC && len(channel) != 0 {
+		writer.Privmsgf(channel, "%v: %v", nick, msg)
+	} else {
+		writer.Notice(nick, msg)
+	}
+}
+
+// suggestCmds finds the names of the commands available on a network that
+// are closest to the name given, nearest first. Commands the user doesn't
+// have access to on the channel are never suggested, the user is nil if
+// they're not authenticated. If the name is registered to the network
+// registered is true and there are no suggestions.
+func suggestCmds(networkID, channel, name string, msgscope int,
+	user *data.StoredUser) (suggestions []string, registered bool) {
+
+	protectGlobalReg.RLock()
+	defer protectGlobalReg.RUnlock()
+
+	name = strings.ToLower(name)
+	limit := len(name) / 3
+	if limit < 1 {
+		limit = 1
+	} else if limit > maxSuggestDistance {
+		limit = maxSuggestDistance
+	}
+
+	distances := make(map[string]int)
+	for key, cmd := range globalCmdRegistry {
+		var candidate string
+		switch {
+		case strings.HasPrefix(key, GLOBAL+":"):
+			candidate = key[len(GLOBAL)+1:]
+		case strings.HasPrefix(key, networkID+":"):
+			candidate = key[len(networkID)+1:]
+		default:
+			continue
+		}
+
+		candidate = strings.ToLower(candidate)
+		if candidate == name {
+			return nil, true
+		}
+		if 0 == msgscope&cmd.Msgscope ||
+			!cmd.HasAccess(user, networkID, channel) {
+
+			continue
+		}
+		if distance := editDistance(name, candidate); distance <= limit {
+			distances[candidate] = distance
+		}
+	}
+
+	for candidate := range distances {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if distances[a] != distances[b] {
+			return distances[a] < distances[b]
+		}
+		return a < b
+	})
+
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions, false
+}
+
+// editDistance calculates the number of single character insertions,
+// deletions and substitutions it takes to turn a into b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// min3 returns the smallest of three integers.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"unicode"
+)
+
+// tokenize splits a string into arguments the way a shell would. Whitespace
+// separates arguments unless it's inside single or double quotes, and a
+// backslash escapes the character following it except inside single quotes.
+func tokenize(str string) ([]string, error) {
+	var tokens []string
+	var token bytes.Buffer
+	var quote rune
+	var inToken, escaped bool
+
+	for _, r := range str {
+		switch {
+		case escaped:
+			token.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				token.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New(errMsgUnterminatedQuote)
+	}
+	if escaped {
+		token.WriteRune('\\')
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+
+	return tokens, nil
+}
@@ -2,6 +2,7 @@ package dispatch
 
 import (
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,12 +22,48 @@ type (
 	eventTable map[int]interface{}
 	// eventTableState is the map used to hold the event handlers for an event
 	eventTableState map[string]eventTable
+	// priorityTable is the storage used to keep priority handlers for an
+	// event, it's kept sorted in the order the handlers are to be run.
+	priorityTable []priorityHandler
+	// priorityTableState is the map used to hold the priority handlers for an
+	// event.
+	priorityTableState map[string]priorityTable
 )
 
+// priorityHandler is a handler registered with RegisterPriority.
+type priorityHandler struct {
+	id       int
+	priority int
+	handler  interface{}
+}
+
+// Len implements sort.Interface
+func (p priorityTable) Len() int { return len(p) }
+
+// Less implements sort.Interface, higher priorities are sorted first.
+func (p priorityTable) Less(i, j int) bool {
+	return p[i].priority > p[j].priority
+}
+
+// Swap implements sort.Interface
+func (p priorityTable) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
 // Dispatcher is made for handling dispatching of raw-ish irc events.
+//
+// There are two kinds of handlers a Dispatcher can run. Handlers added with
+// Register are run concurrently each in their own goroutine, in no particular
+// order. Handlers added with RegisterPriority are run synchronously in order
+// of their priority before any of the concurrent handlers are started, and may
+// consume the event (see PriorityHandler) to stop it from being dispatched to
+// any handlers that would run after them.
+//
+// In sequential mode (see SetSequential) the concurrent handlers are instead
+// run in the order the events arrived for each channel, see SequenceKey.
 type Dispatcher struct {
 	*DispatchCore
 	events        eventTableState
+	priorities    priorityTableState
+	sequencer     *Sequencer
 	protectEvents sync.RWMutex
 }
 
@@ -35,33 +72,106 @@ func NewDispatcher(core *DispatchCore) *Dispatcher {
 	return &Dispatcher{
 		DispatchCore: core,
 		events:       make(eventTableState),
+		priorities:   make(priorityTableState),
 	}
 }
 
+// SetSequential turns sequential mode on or off. While on, the handlers for an
+// event are not started until all the handlers for the previous events
+// with the same SequenceKey have finished. Events for different channels
+// are still handled in parallel.
+func (d *Dispatcher) SetSequential(sequential bool) {
+	d.protectEvents.Lock()
+	defer d.protectEvents.Unlock()
+
+	if !sequential {
+		d.sequencer = nil
+	} else if d.sequencer == nil {
+		d.sequencer = NewSequencer()
+	}
+}
+
+// IsSequential checks if the dispatcher is in sequential mode.
+func (d *Dispatcher) IsSequential() bool {
+	d.protectEvents.RLock()
+	defer d.protectEvents.RUnlock()
+
+	return d.sequencer != nil
+}
+
 // Register registers an event handler to a particular event. In return a
 // unique identifer is given to later pass into Unregister in case of a need
 // to unregister the event handler.
 func (d *Dispatcher) Register(event string, handler interface{}) int {
 	event = strings.ToUpper(event)
-	id := rand.Int()
 
 	d.protectEvents.Lock()
 	defer d.protectEvents.Unlock()
 
-	if ev, ok := d.events[event]; !ok {
+	id := d.newID(event)
+	if _, ok := d.events[event]; !ok {
 		d.events[event] = make(eventTable)
-	} else {
-		for _, has := ev[id]; has; id = rand.Int() {
-		}
 	}
 
 	d.events[event][id] = handler
 	return id
 }
 
-// Unregister uses the event name, and the identifier returned by Register to
-// unregister a callback from the Dispatcher. If the callback was removed it
-// returns true, false if it could not be found.
+// RegisterPriority registers a synchronous event handler to a particular
+// event. Priority handlers for an event (and those registered for irc.RAW)
+// are run one after another, highest priority first, before any handlers
+// registered with Register. Handlers sharing a priority are run in the
+// order they were registered, those registered to the event itself before
+// those registered to irc.RAW. The returned identifier can be passed to
+// Unregister.
+//
+// Since priority handlers block the dispatching of all events that come
+// after it, they should do very little work and return quickly. The handler
+// may be any of the types a normal handler can be, but only handlers
+// implementing PriorityHandler are able to consume events.
+func (d *Dispatcher) RegisterPriority(event string, priority int,
+	handler interface{}) int {
+
+	event = strings.ToUpper(event)
+
+	d.protectEvents.Lock()
+	defer d.protectEvents.Unlock()
+
+	id := d.newID(event)
+	table := append(d.priorities[event], priorityHandler{id, priority, handler})
+	sort.Stable(table)
+	d.priorities[event] = table
+	return id
+}
+
+// newID creates an identifier that's unique for the event. Not thread safe.
+func (d *Dispatcher) newID(event string) int {
+	for {
+		id := rand.Int()
+		if _, has := d.events[event][id]; has {
+			continue
+		}
+		if d.priorities[event].indexOf(id) >= 0 {
+			continue
+		}
+		return id
+	}
+}
+
+// indexOf finds the index of a handler in the table by it's id, -1 if it
+// could not be found.
+func (p priorityTable) indexOf(id int) int {
+	for i := range p {
+		if p[i].id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Unregister uses the event name, and the identifier returned by Register or
+// RegisterPriority to unregister a callback from the Dispatcher. If the
+// callback was removed it returns true, false if it could not be found.
 func (d *Dispatcher) Unregister(event string, id int) bool {
 	event = strings.ToUpper(event)
 
@@ -74,13 +184,58 @@ func (d *Dispatcher) Unregister(event string, id int) bool {
 			return true
 		}
 	}
+	if table, ok := d.priorities[event]; ok {
+		if i := table.indexOf(id); i >= 0 {
+			newTable := make(priorityTable, 0, len(table)-1)
+			newTable = append(newTable, table[:i]...)
+			d.priorities[event] = append(newTable, table[i+1:]...)
+			return true
+		}
+	}
 	return false
 }
 
 // Dispatch an IrcMessage to event handlers handling event also ensures all raw
-// handlers receive all messages. Returns false if no eventtable was found for
-// the primary sent event.
+// handlers receive all messages. The priority handlers are run first, and if
+// none of them consume the event it's dispatched to the concurrent handlers.
+// Returns false if no eventtable was found for the primary sent event, or the
+// event was consumed.
 func (d *Dispatcher) Dispatch(w irc.Writer, ev *irc.Event) bool {
+	if d.DispatchPriority(w, ev) {
+		return false
+	}
+	return d.DispatchConcurrent(w, ev)
+}
+
+// DispatchPriority runs only the priority handlers for the event, including
+// those registered for irc.RAW, in order. Returns true if one of the handlers
+// consumed the event, in which case no handler after it has been run.
+func (d *Dispatcher) DispatchPriority(w irc.Writer, ev *irc.Event) bool {
+	event := strings.ToUpper(ev.Name)
+
+	d.protectEvents.RLock()
+	table := make(priorityTable, 0,
+		len(d.priorities[event])+len(d.priorities[irc.RAW]))
+	table = append(table, d.priorities[event]...)
+	if event != irc.RAW {
+		table = append(table, d.priorities[irc.RAW]...)
+	}
+	d.protectEvents.RUnlock()
+
+	sort.Stable(table)
+	for _, p := range table {
+		if d.resolvePriorityHandler(p.handler, w, ev) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DispatchConcurrent dispatches the event to only the concurrent handlers,
+// ignoring the priority handlers. Returns false if no eventtable was found
+// for the primary sent event.
+func (d *Dispatcher) DispatchConcurrent(w irc.Writer, ev *irc.Event) bool {
 	event := strings.ToUpper(ev.Name)
 
 	d.protectEvents.RLock()
@@ -98,9 +253,21 @@ func (d *Dispatcher) dispatchHelper(event string,
 	w irc.Writer, ev *irc.Event) bool {
 
 	if evtable, ok := d.events[event]; ok {
+		var key string
+		if d.sequencer != nil {
+			key = SequenceKey(ev)
+		}
 		for _, handler := range evtable {
 			d.HandlerStarted()
-			go d.resolveHandler(handler, event, w, ev)
+			if d.sequencer == nil {
+				go d.resolveHandler(handler, event, w, ev)
+				continue
+			}
+
+			handler := handler
+			d.sequencer.Run(key, func() {
+				d.resolveHandler(handler, event, w, ev)
+			})
 		}
 		return true
 	}
@@ -116,6 +283,29 @@ func (d *Dispatcher) resolveHandler(
 	defer d.PanicHandler()
 	defer d.HandlerFinished()
 
+	d.callHandler(handler, w, ev)
+}
+
+// resolvePriorityHandler runs a handler registered by RegisterPriority
+// returning true if the handler consumed the event.
+func (d *Dispatcher) resolvePriorityHandler(
+	handler interface{}, w irc.Writer, ev *irc.Event) (consumed bool) {
+
+	defer d.PanicHandler()
+
+	if priorityHandler, ok := handler.(PriorityHandler); ok {
+		return priorityHandler.HandlePriority(w, ev)
+	}
+
+	d.callHandler(handler, w, ev)
+	return false
+}
+
+// callHandler coerces the IrcMessage for the handler's type and calls it's
+// primary dispatch method.
+func (d *Dispatcher) callHandler(
+	handler interface{}, w irc.Writer, ev *irc.Event) {
+
 	var handled bool
 	switch ev.Name {
 	case irc.PRIVMSG, irc.NOTICE:
@@ -2,6 +2,8 @@ package dispatch
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aarondl/ultimateq/irc"
@@ -144,6 +146,191 @@ func TestDispatcher_RawDispatch(t *testing.T) {
 	}
 }
 
+type testPriorityHandler struct {
+	callback func(w irc.Writer, ev *irc.Event) bool
+}
+
+func (handler testPriorityHandler) HandlePriority(
+	w irc.Writer, ev *irc.Event) bool {
+
+	return handler.callback(w, ev)
+}
+
+func TestDispatcher_PriorityRegistration(t *testing.T) {
+	t.Parallel()
+	d := NewDispatcher(core)
+	handler := testHandler{}
+
+	id := d.RegisterPriority(irc.PRIVMSG, 5, handler)
+	if id == 0 {
+		t.Error("It should have given back an id.")
+	}
+	id2 := d.Register(irc.PRIVMSG, handler)
+	if id == id2 {
+		t.Error("It should not produce duplicate ids.")
+	}
+	if !d.Unregister("privmsg", id) {
+		t.Error("It should unregister priority handlers via it's id.")
+	}
+	if d.Unregister("privmsg", id) {
+		t.Error("It should not unregister the same event multiple times.")
+	}
+	if len(d.priorities[irc.PRIVMSG]) != 0 {
+		t.Error("The handler should have been removed.")
+	}
+}
+
+func TestDispatcher_PriorityOrdering(t *testing.T) {
+	t.Parallel()
+	var order []string
+	var async []string
+	var protect = make(chan int, 1)
+	protect <- 0
+
+	mkHandler := func(name string) testHandler {
+		return testHandler{func(w irc.Writer, ev *irc.Event) {
+			order = append(order, name)
+		}}
+	}
+
+	d := NewDispatcher(core)
+	send := testPoint{irc.Helper{}}
+
+	d.Register(irc.PRIVMSG, testHandler{func(w irc.Writer, ev *irc.Event) {
+		<-protect
+		async = append(async, strings.Join(order, " "))
+		protect <- 0
+	}})
+	d.RegisterPriority(irc.PRIVMSG, 0, mkHandler("low"))
+	d.RegisterPriority(irc.PRIVMSG, 10, mkHandler("high"))
+	d.RegisterPriority(irc.RAW, 5, mkHandler("raw"))
+	d.RegisterPriority(irc.PRIVMSG, 5, mkHandler("mid"))
+	d.RegisterPriority(irc.QUIT, 20, mkHandler("quit"))
+
+	privmsg := &irc.Event{Name: irc.PRIVMSG}
+	d.Dispatch(send, privmsg)
+	d.WaitForHandlers()
+
+	if got := strings.Join(order, " "); got != "high mid raw low" {
+		t.Error("Priority handlers ran in the wrong order:", got)
+	}
+	if len(async) != 1 || async[0] != "high mid raw low" {
+		t.Error("Concurrent handlers should run after priority ones:", async)
+	}
+}
+
+func TestDispatcher_PriorityConsume(t *testing.T) {
+	t.Parallel()
+	var first, second, concurrent, raw bool
+
+	d := NewDispatcher(core)
+	send := testPoint{irc.Helper{}}
+
+	d.RegisterPriority(irc.PRIVMSG, 10, testPriorityHandler{
+		func(w irc.Writer, ev *irc.Event) bool {
+			first = true
+			return ev.Sender == "ignored"
+		},
+	})
+	d.RegisterPriority(irc.PRIVMSG, 0, testHandler{
+		func(w irc.Writer, ev *irc.Event) {
+			second = true
+		},
+	})
+	d.Register(irc.PRIVMSG, testHandler{func(w irc.Writer, ev *irc.Event) {
+		concurrent = true
+	}})
+	d.Register(irc.RAW, testHandler{func(w irc.Writer, ev *irc.Event) {
+		raw = true
+	}})
+
+	if d.Dispatch(send, &irc.Event{Name: irc.PRIVMSG, Sender: "ignored"}) {
+		t.Error("A consumed event should not be reported as handled.")
+	}
+	d.WaitForHandlers()
+	if !first {
+		t.Error("The consuming handler should have been called.")
+	}
+	if second || concurrent || raw {
+		t.Error("No handlers should be called after consumption.")
+	}
+
+	first = false
+	if !d.Dispatch(send, &irc.Event{Name: irc.PRIVMSG, Sender: "other"}) {
+		t.Error("The event should have been handled.")
+	}
+	d.WaitForHandlers()
+	if !first || !second || !concurrent || !raw {
+		t.Error("All handlers should be called when not consumed.")
+	}
+}
+
+func TestDispatcher_PriorityPanic(t *testing.T) {
+	t.Parallel()
+	var called bool
+
+	logCore := NewDispatchCore(log15.New())
+	logCore.log.SetHandler(log15.DiscardHandler())
+	d := NewDispatcher(logCore)
+	send := testPoint{irc.Helper{}}
+
+	d.RegisterPriority(irc.PRIVMSG, 10, testHandler{
+		func(w irc.Writer, ev *irc.Event) {
+			panic("failure")
+		},
+	})
+	d.RegisterPriority(irc.PRIVMSG, 0, testHandler{
+		func(w irc.Writer, ev *irc.Event) {
+			called = true
+		},
+	})
+
+	if d.DispatchPriority(send, &irc.Event{Name: irc.PRIVMSG}) {
+		t.Error("A panicking handler should not consume the event.")
+	}
+	if !called {
+		t.Error("Handlers after a panicking handler should still run.")
+	}
+}
+
+func TestDispatcher_Sequential(t *testing.T) {
+	t.Parallel()
+	d := NewDispatcher(core)
+	if d.IsSequential() {
+		t.Error("Dispatchers should not be sequential by default.")
+	}
+	d.SetSequential(true)
+	if !d.IsSequential() {
+		t.Error("It should be sequential.")
+	}
+
+	var order []string
+	d.Register(irc.PRIVMSG, testHandler{func(w irc.Writer, ev *irc.Event) {
+		order = append(order, ev.Message())
+	}})
+
+	send := testPoint{irc.Helper{}}
+	for i := 0; i < 20; i++ {
+		d.Dispatch(send, irc.NewEvent("net", netInfo, irc.PRIVMSG,
+			"n!u@h", "#chan", fmt.Sprint(i)))
+	}
+	d.WaitForHandlers()
+
+	if len(order) != 20 {
+		t.Fatal("Expected all events to be handled, got:", len(order))
+	}
+	for i, msg := range order {
+		if msg != fmt.Sprint(i) {
+			t.Errorf("Expected: %v got: %v", i, msg)
+		}
+	}
+
+	d.SetSequential(false)
+	if d.IsSequential() {
+		t.Error("It should not be sequential.")
+	}
+}
+
 // ================================
 // Testing types
 // ================================
@@ -2,6 +2,13 @@ package dispatch
 
 import "github.com/aarondl/ultimateq/irc"
 
+// PriorityHandler is for handlers registered with a priority that would like
+// to stop an event from reaching the handlers that would run after it.
+// Returning true consumes the event.
+type PriorityHandler interface {
+	HandlePriority(irc.Writer, *irc.Event) bool
+}
+
 // PrivmsgHandler is for handling privmsgs going to channel or user targets.
 type PrivmsgHandler interface {
 	Privmsg(irc.Writer, *irc.Event)
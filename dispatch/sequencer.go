@@ -0,0 +1,78 @@
+package dispatch
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// Sequencer runs functions in the order they were given to it for each key,
+// while functions for different keys are run concurrently. It's used by the
+// dispatchers when they are in sequential mode to ensure events from a
+// channel are processed in the order they arrived.
+type Sequencer struct {
+	queues  map[string][]func()
+	protect sync.Mutex
+}
+
+// NewSequencer initializes a sequencer.
+func NewSequencer() *Sequencer {
+	return &Sequencer{
+		queues: make(map[string][]func()),
+	}
+}
+
+// Run queues fn to be run after all the functions previously queued for key
+// have returned. It never blocks.
+func (s *Sequencer) Run(key string, fn func()) {
+	s.protect.Lock()
+	queue, running := s.queues[key]
+	s.queues[key] = append(queue, fn)
+	s.protect.Unlock()
+
+	if !running {
+		go s.work(key)
+	}
+}
+
+// work runs the queue for a key until it's empty, at which point the key is
+// removed so the next call to Run will start a new worker.
+func (s *Sequencer) work(key string) {
+	for {
+		s.protect.Lock()
+		queue := s.queues[key]
+		if len(queue) == 0 {
+			delete(s.queues, key)
+			s.protect.Unlock()
+			return
+		}
+		fn := queue[0]
+		queue[0] = nil
+		s.queues[key] = queue[1:]
+		s.protect.Unlock()
+
+		fn()
+	}
+}
+
+// SequenceKey creates the key an event is sequenced by. Events targeting a
+// channel are keyed by network and channel, other PRIVMSG and NOTICE events
+// are keyed by network and the nick of the sender, and anything else is keyed
+// by only the network.
+func SequenceKey(ev *irc.Event) string {
+	if ev.NetworkInfo != nil && len(ev.Args) > 0 && ev.IsTargetChan() {
+		return MakeSequenceKey(ev.NetworkID, ev.Target())
+	}
+
+	switch ev.Name {
+	case irc.PRIVMSG, irc.NOTICE:
+		return MakeSequenceKey(ev.NetworkID, ev.Nick())
+	}
+	return MakeSequenceKey(ev.NetworkID, "")
+}
+
+// MakeSequenceKey creates a key for a network and a channel or nick.
+func MakeSequenceKey(networkID, target string) string {
+	return networkID + ":" + strings.ToLower(target)
+}
@@ -0,0 +1,70 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestSequencer_Order(t *testing.T) {
+	t.Parallel()
+	s := NewSequencer()
+
+	results := make(chan int, 50)
+	for i := 0; i < 50; i++ {
+		i := i
+		s.Run("key", func() {
+			if i%10 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			results <- i
+		})
+	}
+
+	for i := 0; i < 50; i++ {
+		if got := <-results; got != i {
+			t.Fatalf("Expected: %v got: %v", i, got)
+		}
+	}
+}
+
+func TestSequencer_Parallel(t *testing.T) {
+	t.Parallel()
+	s := NewSequencer()
+
+	block, done := make(chan int), make(chan int)
+	s.Run("a", func() { <-block })
+	s.Run("b", func() { done <- 0 })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("A blocked key should not stop other keys from running.")
+	}
+	close(block)
+}
+
+func TestSequenceKey(t *testing.T) {
+	t.Parallel()
+	ni := irc.NewNetworkInfo()
+
+	var tests = []struct {
+		Event *irc.Event
+		Key   string
+	}{
+		{irc.NewEvent("net", ni, irc.PRIVMSG, "n!u@h", "#Chan", "hi"),
+			"net:#chan"},
+		{irc.NewEvent("net", ni, irc.JOIN, "n!u@h", "#chan"), "net:#chan"},
+		{irc.NewEvent("net", ni, irc.PRIVMSG, "N!u@h", "bot", "hi"), "net:n"},
+		{irc.NewEvent("net", ni, irc.RPL_WELCOME, "srv", "bot", "hi"),
+			"net:"},
+		{&irc.Event{Name: irc.PRIVMSG, NetworkID: "net"}, "net:"},
+	}
+
+	for _, test := range tests {
+		if got := SequenceKey(test.Event); got != test.Key {
+			t.Errorf("Expected: %v got: %v", test.Key, got)
+		}
+	}
+}
@@ -11,12 +11,12 @@ const (
 
 // IsCTCP checks if the current byte string is a CTCP message.
 func IsCTCP(msg []byte) bool {
-	return ctcpDelim == msg[0] && ctcpDelim == msg[len(msg)-1]
+	return len(msg) >= 2 && ctcpDelim == msg[0] && ctcpDelim == msg[len(msg)-1]
 }
 
 // IsCTCPString checks if the current string is a CTCP message.
 func IsCTCPString(msg string) bool {
-	return ctcpDelim == msg[0] && ctcpDelim == msg[len(msg)-1]
+	return len(msg) >= 2 && ctcpDelim == msg[0] && ctcpDelim == msg[len(msg)-1]
 }
 
 // CTCPunpack unpacks a CTCP message.
@@ -48,6 +48,11 @@ func TestIsCTCP(t *testing.T) {
 	if IsCTCP(no) {
 		t.Errorf("Expected (% X) to NOT be a CTCP.", no)
 	}
+	for _, short := range [][]byte{nil, []byte("\x01")} {
+		if IsCTCP(short) {
+			t.Errorf("Expected (% X) to NOT be a CTCP.", short)
+		}
+	}
 }
 
 func TestIsCTCPString(t *testing.T) {
@@ -58,6 +63,11 @@ func TestIsCTCPString(t *testing.T) {
 	if IsCTCPString(no) {
 		t.Errorf("Expected (%s) to NOT be a CTCP.", no)
 	}
+	for _, short := range []string{"", "\x01"} {
+		if IsCTCPString(short) {
+			t.Errorf("Expected (%q) to NOT be a CTCP.", short)
+		}
+	}
 }
 
 func TestCTCPUnpack(t *testing.T) {
@@ -345,6 +345,39 @@ func (p *NetworkInfo) IsChannel(target string) (isChan bool) {
 	return
 }
 
+// ToLower lowercases a nick or channel name using the network's casemapping.
+// In rfc1459 casemapping []\~ are the uppercase versions of {}|^ and in
+// strict-rfc1459 casemapping ~ and ^ are not considered.
+func (p *NetworkInfo) ToLower(name string) string {
+	p.protect.RLock()
+	casemapping := p.casemapping
+	p.protect.RUnlock()
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case casemapping == "ascii":
+			return r
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '~' && casemapping == "rfc1459":
+			return '^'
+		}
+		return r
+	}, name)
+}
+
+// EqualFold checks if two nicks or channel names are equal under the
+// network's casemapping.
+func (p *NetworkInfo) EqualFold(a, b string) bool {
+	return p.ToLower(a) == p.ToLower(b)
+}
+
 // ParseMyInfo adds all values in a 005 to the current networkinfo object.
 func (p *NetworkInfo) ParseMyInfo(e *Event) {
 	p.protect.Lock()
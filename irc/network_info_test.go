@@ -142,3 +142,35 @@ func TestNetworkInfo_IsChannel(t *testing.T) {
 		t.Error("It should return false when empty.")
 	}
 }
+
+func TestNetworkInfo_ToLower(t *testing.T) {
+	t.Parallel()
+
+	var table = []struct {
+		Casemapping string
+		Name        string
+		Lower       string
+	}{
+		{"ascii", `Nick[]\~`, `nick[]\~`},
+		{"rfc1459", `Nick[]\~`, `nick{}|^`},
+		{"strict-rfc1459", `Nick[]\~`, `nick{}|~`},
+	}
+
+	for _, test := range table {
+		p := NewNetworkInfo()
+		p.casemapping = test.Casemapping
+		if got := p.ToLower(test.Name); got != test.Lower {
+			t.Errorf("Expected %v to be %v in %v, got: %v", test.Name,
+				test.Lower, test.Casemapping, got)
+		}
+	}
+
+	p := NewNetworkInfo()
+	p.casemapping = "rfc1459"
+	if !p.EqualFold("Nick[a]", "nick{A}") {
+		t.Error("Expected the nicks to be equal.")
+	}
+	if p.EqualFold("nick", "nick2") {
+		t.Error("Expected the nicks not to be equal.")
+	}
+}
@@ -15,6 +15,13 @@ const (
 	QUIT    = "QUIT"
 	TOPIC   = "TOPIC"
 
+	// Sent by servers supporting the IRCv3 away-notify, account-notify,
+	// chghost and setname extensions.
+	AWAY    = "AWAY"
+	ACCOUNT = "ACCOUNT"
+	CHGHOST = "CHGHOST"
+	SETNAME = "SETNAME"
+
 	CTCP      = PRIVMSG
 	CTCPReply = NOTICE
 )
@@ -107,6 +114,27 @@ const (
 	RPL_ADMINEMAIL      = "259"
 	RPL_TRYAGAIN        = "263"
 
+	// Common extensions to the replies.
+	RPL_WHOISACCOUNT   = "330"
+	RPL_TOPICWHOTIME   = "333"
+	RPL_WHOSPCRPL      = "354"
+	RPL_WHOISSECURE    = "671"
+	RPL_QUIETLIST      = "728"
+	RPL_ENDOFQUIETLIST = "729"
+
+	// Replies to MONITOR and WATCH, used to learn when users come online.
+	RPL_MONONLINE    = "730"
+	RPL_MONOFFLINE   = "731"
+	RPL_MONLIST      = "732"
+	RPL_ENDOFMONLIST = "733"
+	ERR_MONLISTFULL  = "734"
+	RPL_LOGON        = "600"
+	RPL_LOGOFF       = "601"
+	RPL_WATCHOFF     = "602"
+	RPL_NOWON        = "604"
+	RPL_NOWOFF       = "605"
+	ERR_TOOMANYWATCH = "512"
+
 	ERR_NOSUCHNICK        = "401"
 	ERR_NOSUCHSERVER      = "402"
 	ERR_NOSUCHCHANNEL     = "403"
@@ -170,4 +198,45 @@ const (
 	RAW        = "RAW"
 	CONNECT    = "CONNECT"
 	DISCONNECT = "DISCONNECT"
+	// DCCCHAT is a line of text received in a DCC CHAT session, it's
+	// shaped like a PRIVMSG sent directly to the bot.
+	DCCCHAT = "DCCCHAT"
+)
+
+// State change events, these are pseudo events dispatched after the state
+// has been updated by an irc event. The sender is the user that caused the
+// change and the arguments are as described.
+const (
+	// USERJOINED args: channel
+	USERJOINED = "USERJOINED"
+	// USERPARTED args: channel, reason
+	USERPARTED = "USERPARTED"
+	// USERKICKED args: channel, nick, reason
+	USERKICKED = "USERKICKED"
+	// USERQUIT args: reason
+	USERQUIT = "USERQUIT"
+	// NICKCHANGED args: old nick, new nick
+	NICKCHANGED = "NICKCHANGED"
+	// MODECHANGED args: channel, the channel modes that changed
+	MODECHANGED = "MODECHANGED"
+	// USERMODECHANGED args: channel, nick, the mode given or taken like +o
+	USERMODECHANGED = "USERMODECHANGED"
+	// TOPICCHANGED args: channel, old topic, new topic
+	TOPICCHANGED = "TOPICCHANGED"
+	// SELFJOINED args: channel
+	SELFJOINED = "SELFJOINED"
+	// SELFPARTED args: channel, reason
+	SELFPARTED = "SELFPARTED"
+	// SELFKICKED args: channel, nick, reason
+	SELFKICKED = "SELFKICKED"
+)
+
+// Presence events, these are pseudo events dispatched when a user the bot is
+// keeping track of comes online or goes offline. The sender is the user's
+// fullhost when it's known, their nick otherwise.
+const (
+	// USERONLINE args: nick
+	USERONLINE = "USERONLINE"
+	// USEROFFLINE args: nick
+	USEROFFLINE = "USEROFFLINE"
 )
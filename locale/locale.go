@@ -0,0 +1,243 @@
+/*
+Package locale translates the messages the bot sends to users.
+
+Messages are written in English and used as the keys into a catalog for each
+language. The bot and its extensions add catalogs for the languages they
+support, messages that are missing from a catalog are sent untranslated.
+
+	locale.Add("de", locale.Catalog{
+		"Error: Command not found (%v), try \"help\".": {
+			"Fehler: Befehl nicht gefunden (%v), versuche \"help\".",
+		},
+		"Found %v user.": {"%v Benutzer gefunden.", "%v Benutzer gefunden."},
+	})
+
+	locale.Sprintf("de", "Error: Command not found (%v), try \"help\".", cmd)
+	locale.Pluralf("de", "Found %v user.", "Found %v users.", n, n)
+*/
+package locale
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Default is the language messages are written in, messages are never
+// translated into it.
+const Default = "en"
+
+// Catalog maps messages to their translations in a single language. A
+// translation has a form for each plural category of the language, messages
+// that are not pluralized need only the one.
+type Catalog map[string][]string
+
+// PluralRule chooses the plural form to use for a number, it returns the
+// index of the form in a translation.
+type PluralRule func(n int) int
+
+var (
+	// catalogs holds the catalog for each language.
+	catalogs = make(map[string]Catalog)
+	// pluralRules holds the languages whose plural forms are not chosen by
+	// defaultPluralRule.
+	pluralRules = map[string]PluralRule{
+		"fr": func(n int) int {
+			if n > 1 {
+				return 1
+			}
+			return 0
+		},
+	}
+	// protect protects the catalogs and plural rules.
+	protect sync.RWMutex
+)
+
+// defaultPluralRule chooses between the singular and plural form of most
+// languages, including English, German and Spanish.
+func defaultPluralRule(n int) int {
+	if n == 1 {
+		return 0
+	}
+	return 1
+}
+
+// Normalize turns a language into the form it's stored in, ie. de_AT becomes
+// de-at.
+func Normalize(lang string) string {
+	lang = strings.Replace(strings.TrimSpace(lang), "_", "-", -1)
+	return strings.ToLower(lang)
+}
+
+// Add adds the messages in a catalog to the language, messages already
+// translated are replaced.
+func Add(lang string, catalog Catalog) {
+	protect.Lock()
+	defer protect.Unlock()
+
+	lang = Normalize(lang)
+	existing, ok := catalogs[lang]
+	if !ok {
+		existing = make(Catalog)
+		catalogs[lang] = existing
+	}
+	for message, translation := range catalog {
+		existing[message] = translation
+	}
+}
+
+// Remove removes the messages in a catalog from the language.
+func Remove(lang string, catalog Catalog) {
+	protect.Lock()
+	defer protect.Unlock()
+
+	lang = Normalize(lang)
+	existing, ok := catalogs[lang]
+	if !ok {
+		return
+	}
+	for message := range catalog {
+		delete(existing, message)
+	}
+	if len(existing) == 0 {
+		delete(catalogs, lang)
+	}
+}
+
+// Has checks if there is a catalog for the language.
+func Has(lang string) bool {
+	protect.RLock()
+	defer protect.RUnlock()
+
+	for _, l := range candidates(Normalize(lang)) {
+		if _, ok := catalogs[l]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPluralRule sets the rule that chooses the plural form for a language.
+func SetPluralRule(lang string, rule PluralRule) {
+	protect.Lock()
+	defer protect.Unlock()
+
+	pluralRules[Normalize(lang)] = rule
+}
+
+// Translate translates a message into the language, if there is no
+// translation the message is returned.
+func Translate(lang, message string) string {
+	return Plural(lang, message, message, 1)
+}
+
+// Plural translates the form of a message that should be used for the
+// number n. The singular form is the key into the catalog.
+func Plural(lang, one, other string, n int) string {
+	translation, rule := lookup(lang, one)
+	if translation == nil {
+		if n == 1 {
+			return one
+		}
+		return other
+	}
+
+	form := rule(n)
+	if form < 0 {
+		form = 0
+	} else if form >= len(translation) {
+		form = len(translation) - 1
+	}
+	return translation[form]
+}
+
+// Sprintf translates a format string into the language and formats it.
+func Sprintf(lang, format string, args ...interface{}) string {
+	return fmt.Sprintf(Translate(lang, format), args...)
+}
+
+// Pluralf translates the form of a format string that should be used for
+// the number n and formats it.
+func Pluralf(lang, one, other string, n int, args ...interface{}) string {
+	return fmt.Sprintf(Plural(lang, one, other, n), args...)
+}
+
+// lookup finds the translation of a message and the plural rule for the
+// language. A regional language falls back to its base, ie. de-at to de.
+func lookup(lang, message string) ([]string, PluralRule) {
+	lang = Normalize(lang)
+	if len(lang) == 0 || lang == Default {
+		return nil, nil
+	}
+
+	protect.RLock()
+	defer protect.RUnlock()
+
+	for _, l := range candidates(lang) {
+		translation, ok := catalogs[l][message]
+		if !ok || len(translation) == 0 {
+			continue
+		}
+
+		rule, ok := pluralRules[l]
+		if !ok {
+			if rule, ok = pluralRules[lang]; !ok {
+				rule = defaultPluralRule
+			}
+		}
+		return translation, rule
+	}
+
+	return nil, nil
+}
+
+// candidates returns the languages to look for a translation in, the
+// language followed by each of the languages it's based on.
+func candidates(lang string) []string {
+	langs := []string{lang}
+	for index := strings.LastIndexByte(lang, '-'); index > 0; {
+		lang = lang[:index]
+		langs = append(langs, lang)
+		index = strings.LastIndexByte(lang, '-')
+	}
+	return langs
+}
+
+// Error is an error whose message is translated when it's shown to a user.
+type Error struct {
+	one   string
+	other string
+	n     int
+	args  []interface{}
+}
+
+// Errorf creates an error from a format string that can be translated.
+func Errorf(format string, args ...interface{}) error {
+	return &Error{one: format, other: format, n: 1, args: args}
+}
+
+// PluralErrorf creates an error from the form of a format string that should
+// be used for the number n.
+func PluralErrorf(one, other string, n int, args ...interface{}) error {
+	return &Error{one: one, other: other, n: n, args: args}
+}
+
+// Error returns the error message in English.
+func (e *Error) Error() string {
+	return e.Translate(Default)
+}
+
+// Translate returns the error message in a language.
+func (e *Error) Translate(lang string) string {
+	return Pluralf(lang, e.one, e.other, e.n, e.args...)
+}
+
+// ErrorString returns the message of an error in a language. Errors that
+// were not created by this package are translated only if their message is
+// found in the catalog as is.
+func ErrorString(lang string, err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Translate(lang)
+	}
+	return Translate(lang, err.Error())
+}
@@ -0,0 +1,159 @@
+package locale
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	fmtFound    = "Found %v user."
+	fmtFoundAll = "Found %v users."
+	msgHello    = "Hello."
+)
+
+var testCatalog = Catalog{
+	msgHello: {"Hallo."},
+	fmtFound: {"%v Benutzer gefunden.", "%v Benutzer insgesamt gefunden."},
+}
+
+func TestLocale_Normalize(t *testing.T) {
+	t.Parallel()
+
+	var table = []struct {
+		Lang   string
+		Expect string
+	}{
+		{"de", "de"},
+		{"DE", "de"},
+		{"de_AT", "de-at"},
+		{" es-MX ", "es-mx"},
+	}
+
+	for _, test := range table {
+		if got := Normalize(test.Lang); got != test.Expect {
+			t.Errorf("%q: Expected: %q got: %q", test.Lang, test.Expect, got)
+		}
+	}
+}
+
+func TestLocale_Translate(t *testing.T) {
+	Add("x-tr", testCatalog)
+	defer Remove("x-tr", testCatalog)
+
+	var table = []struct {
+		Lang   string
+		Msg    string
+		Expect string
+	}{
+		{"x-tr", msgHello, "Hallo."},
+		{"X_TR", msgHello, "Hallo."},
+		{"x-tr-region", msgHello, "Hallo."},
+		{"x-tr", "Not translated.", "Not translated."},
+		{"x-none", msgHello, msgHello},
+		{Default, msgHello, msgHello},
+		{"", msgHello, msgHello},
+	}
+
+	for _, test := range table {
+		if got := Translate(test.Lang, test.Msg); got != test.Expect {
+			t.Errorf("%q (%v): Expected: %q got: %q",
+				test.Msg, test.Lang, test.Expect, got)
+		}
+	}
+
+	if !Has("x-tr") || !Has("x-tr-region") || Has("x-none") {
+		t.Error("Expected only x-tr to have a catalog.")
+	}
+
+	if got := Sprintf("x-tr", fmtFound, 5); got != "5 Benutzer gefunden." {
+		t.Error("Expected the format to be translated, got:", got)
+	}
+}
+
+func TestLocale_Plural(t *testing.T) {
+	Add("x-pl", testCatalog)
+	Add("x-one", testCatalog)
+	SetPluralRule("x-one", func(n int) int {
+		if n > 1 {
+			return 1
+		}
+		return 0
+	})
+	defer Remove("x-pl", testCatalog)
+	defer Remove("x-one", testCatalog)
+
+	var table = []struct {
+		Lang   string
+		N      int
+		Expect string
+	}{
+		{Default, 1, "Found 1 user."},
+		{Default, 0, "Found 0 users."},
+		{Default, 2, "Found 2 users."},
+		{"x-pl", 1, "1 Benutzer gefunden."},
+		{"x-pl", 0, "0 Benutzer insgesamt gefunden."},
+		{"x-pl", 2, "2 Benutzer insgesamt gefunden."},
+		{"x-one", 0, "0 Benutzer gefunden."},
+		{"x-one", 2, "2 Benutzer insgesamt gefunden."},
+	}
+
+	for _, test := range table {
+		got := Pluralf(test.Lang, fmtFound, fmtFoundAll, test.N, test.N)
+		if got != test.Expect {
+			t.Errorf("%v (%v): Expected: %q got: %q",
+				test.N, test.Lang, test.Expect, got)
+		}
+	}
+
+	if got := Plural("x-pl", msgHello, "Hellos.", 5); got != "Hallo." {
+		t.Error("Expected the only form to be used, got:", got)
+	}
+}
+
+func TestLocale_Remove(t *testing.T) {
+	Add("x-rm", testCatalog)
+	Add("x-rm", Catalog{"Bye.": {"Tschüss."}})
+
+	Remove("x-rm", testCatalog)
+	if got := Translate("x-rm", msgHello); got != msgHello {
+		t.Error("Expected the message to be removed, got:", got)
+	}
+	if got := Translate("x-rm", "Bye."); got != "Tschüss." {
+		t.Error("Expected the other message to remain, got:", got)
+	}
+
+	Remove("x-rm", Catalog{"Bye.": nil})
+	if Has("x-rm") {
+		t.Error("Expected the empty catalog to be removed.")
+	}
+}
+
+func TestLocale_Error(t *testing.T) {
+	Add("x-err", testCatalog)
+	defer Remove("x-err", testCatalog)
+
+	err := Errorf(fmtFound, 1)
+	if got := err.Error(); got != "Found 1 user." {
+		t.Error("Expected the error in English, got:", got)
+	}
+	if got := ErrorString("x-err", err); got != "1 Benutzer gefunden." {
+		t.Error("Expected the error to be translated, got:", got)
+	}
+
+	err = PluralErrorf(fmtFound, fmtFoundAll, 3, 3)
+	if got := err.Error(); got != "Found 3 users." {
+		t.Error("Expected the plural error in English, got:", got)
+	}
+	if got := ErrorString("x-err", err); got != "3 Benutzer insgesamt gefunden." {
+		t.Error("Expected the plural error to be translated, got:", got)
+	}
+
+	err = errors.New(msgHello)
+	if got := ErrorString("x-err", err); got != "Hallo." {
+		t.Error("Expected the plain error to be translated, got:", got)
+	}
+	err = errors.New("Unknown.")
+	if got := ErrorString("x-err", err); got != "Unknown." {
+		t.Error("Expected the plain error as is, got:", got)
+	}
+}
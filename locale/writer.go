@@ -0,0 +1,88 @@
+package locale
+
+import "github.com/aarondl/ultimateq/irc"
+
+// Writer translates the messages written to it into a language before
+// writing them to the underlying writer. The format strings of formatted
+// messages are translated, as are the string arguments of other messages that
+// are found in the language's catalog.
+type Writer struct {
+	irc.Writer
+	Lang string
+}
+
+// NewWriter creates a writer that translates messages into the language. If
+// the language is the default the writer itself is returned.
+func NewWriter(writer irc.Writer, lang string) irc.Writer {
+	lang = Normalize(lang)
+	if len(lang) == 0 || lang == Default {
+		return writer
+	}
+	if w, ok := writer.(Writer); ok {
+		writer = w.Writer
+	}
+	return Writer{Writer: writer, Lang: lang}
+}
+
+// Privmsg sends a translated privmsg with spaces between non-strings.
+func (w Writer) Privmsg(target string, args ...interface{}) error {
+	return w.Writer.Privmsg(target, w.translate(args)...)
+}
+
+// Privmsgln sends a translated privmsg with spaces between everything.
+func (w Writer) Privmsgln(target string, args ...interface{}) error {
+	return w.Writer.Privmsgln(target, w.translate(args)...)
+}
+
+// Privmsgf sends a translated formatted privmsg.
+func (w Writer) Privmsgf(target, format string, args ...interface{}) error {
+	return w.Writer.Privmsgf(target, Translate(w.Lang, format), args...)
+}
+
+// Notice sends a translated notice with spaces between non-strings.
+func (w Writer) Notice(target string, args ...interface{}) error {
+	return w.Writer.Notice(target, w.translate(args)...)
+}
+
+// Noticeln sends a translated notice with spaces between everything.
+func (w Writer) Noticeln(target string, args ...interface{}) error {
+	return w.Writer.Noticeln(target, w.translate(args)...)
+}
+
+// Noticef sends a translated formatted notice.
+func (w Writer) Noticef(target, format string, args ...interface{}) error {
+	return w.Writer.Noticef(target, Translate(w.Lang, format), args...)
+}
+
+// Notify sends a translated notification with spaces between non-strings.
+func (w Writer) Notify(ev *irc.Event, target string,
+	args ...interface{}) error {
+
+	return w.Writer.Notify(ev, target, w.translate(args)...)
+}
+
+// Notifyln sends a translated notification with spaces between everything.
+func (w Writer) Notifyln(ev *irc.Event, target string,
+	args ...interface{}) error {
+
+	return w.Writer.Notifyln(ev, target, w.translate(args)...)
+}
+
+// Notifyf sends a translated formatted notification.
+func (w Writer) Notifyf(ev *irc.Event, target, format string,
+	args ...interface{}) error {
+
+	return w.Writer.Notifyf(ev, target, Translate(w.Lang, format), args...)
+}
+
+// translate translates each of the string arguments of a message.
+func (w Writer) translate(args []interface{}) []interface{} {
+	translated := make([]interface{}, len(args))
+	for i, arg := range args {
+		if str, ok := arg.(string); ok {
+			arg = Translate(w.Lang, str)
+		}
+		translated[i] = arg
+	}
+	return translated
+}
@@ -0,0 +1,75 @@
+package locale
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestWriter(t *testing.T) {
+	Add("x-wr", testCatalog)
+	defer Remove("x-wr", testCatalog)
+
+	buffer := &bytes.Buffer{}
+	helper := irc.Helper{Writer: buffer}
+
+	if _, ok := NewWriter(helper, Default).(Writer); ok {
+		t.Error("Expected no translation for the default language.")
+	}
+	if _, ok := NewWriter(helper, "").(Writer); ok {
+		t.Error("Expected no translation without a language.")
+	}
+
+	w := NewWriter(helper, "x-wr")
+	if nested, ok := NewWriter(w, "x-wr").(Writer); !ok {
+		t.Error("Expected a translating writer.")
+	} else if _, ok := nested.Writer.(Writer); ok {
+		t.Error("Expected translating writers not to be nested.")
+	}
+
+	ev := &irc.Event{
+		Name: irc.PRIVMSG, Sender: "nick!user@host",
+		Args:        []string{"#chan", "hi"},
+		NetworkInfo: irc.NewNetworkInfo(),
+	}
+
+	var table = []struct {
+		Send   func() error
+		Expect string
+	}{
+		{func() error { return w.Notice("nick", msgHello) },
+			"NOTICE nick :Hallo."},
+		{func() error { return w.Noticeln("nick", msgHello, "Bye.") },
+			"NOTICE nick :Hallo. Bye."},
+		{func() error { return w.Noticef("nick", fmtFound, 2) },
+			"NOTICE nick :2 Benutzer gefunden."},
+		{func() error { return w.Privmsg("#chan", msgHello) },
+			"PRIVMSG #chan :Hallo."},
+		{func() error { return w.Privmsgln("#chan", msgHello, 5) },
+			"PRIVMSG #chan :Hallo. 5"},
+		{func() error { return w.Privmsgf("#chan", fmtFound, 1) },
+			"PRIVMSG #chan :1 Benutzer gefunden."},
+		{func() error { return w.Notify(ev, "nick", msgHello) },
+			"PRIVMSG #chan :Hallo."},
+		{func() error { return w.Notifyln(ev, "nick", msgHello) },
+			"PRIVMSG #chan :Hallo."},
+		{func() error { return w.Notifyf(ev, "nick", fmtFound, 3) },
+			"PRIVMSG #chan :3 Benutzer gefunden."},
+		{func() error { return w.Notice("nick", "Hello. again") },
+			"NOTICE nick :Hello. again"},
+		{func() error { return w.Join("#chan") },
+			"JOIN :#chan"},
+	}
+
+	for i, test := range table {
+		buffer.Reset()
+		if err := test.Send(); err != nil {
+			t.Errorf("%v: Unexpected error: %v", i, err)
+		}
+		if got := strings.TrimSpace(buffer.String()); got != test.Expect {
+			t.Errorf("%v: Expected: %q got: %q", i, test.Expect, got)
+		}
+	}
+}